@@ -0,0 +1,153 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// AgentUserID is the well-known nonroot user that Porter uses for the invocation image and the agent.
+	AgentUserID int64 = 65532
+
+	// AgentGroupID is the group that the Porter Agent runs as. Porter builds the bundles with the root group
+	// having the same permissions as the owner, so the agent runs as the root group.
+	AgentGroupID int64 = 0
+)
+
+// DefaultAgentPodSecurityContext returns the security context of the Porter Agent pod
+// that is used when the AgentConfig does not override it.
+// It is compliant with the restricted Pod Security Standard.
+func DefaultAgentPodSecurityContext() *v1.PodSecurityContext {
+	return &v1.PodSecurityContext{
+		RunAsNonRoot: ptr.To(true),
+		RunAsUser:    ptr.To(AgentUserID),
+		RunAsGroup:   ptr.To(AgentGroupID),
+		FSGroup:      ptr.To(AgentGroupID),
+		SeccompProfile: &v1.SeccompProfile{
+			Type: v1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
+
+// DefaultAgentContainerSecurityContext returns the security context of the Porter Agent container
+// that is used when the AgentConfig does not override it.
+// It is compliant with the restricted Pod Security Standard. The root filesystem is writable
+// because the agent copies its configuration into the Porter home directory.
+func DefaultAgentContainerSecurityContext() *v1.SecurityContext {
+	return &v1.SecurityContext{
+		AllowPrivilegeEscalation: ptr.To(false),
+		Capabilities: &v1.Capabilities{
+			Drop: []v1.Capability{"ALL"},
+		},
+	}
+}
+
+// overlaySecurityContext sets the fields that are defined on the override onto the target.
+// Nested fields, such as capabilities or the seccomp profile, are replaced as a whole.
+func overlaySecurityContext(target interface{}, override interface{}) error {
+	var targetRaw, overrideRaw map[string]interface{}
+	if err := roundTripJSON(target, &targetRaw); err != nil {
+		return err
+	}
+	if err := roundTripJSON(override, &overrideRaw); err != nil {
+		return err
+	}
+	for k, v := range overrideRaw {
+		targetRaw[k] = v
+	}
+
+	// Reset the target so that the nested fields are not merged into the existing values
+	reset := reflect.ValueOf(target).Elem()
+	reset.Set(reflect.Zero(reset.Type()))
+	return roundTripJSON(targetRaw, target)
+}
+
+func roundTripJSON(in interface{}, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+// validateAgentSecurityContext returns an error describing the settings that
+// prevent the Porter Agent pod from being created or from starting.
+func validateAgentSecurityContext(podCtx *v1.PodSecurityContext, containerCtx *v1.SecurityContext) error {
+	var problems []string
+
+	// The container settings take precedence over the pod settings
+	runAsUser := podCtx.RunAsUser
+	if containerCtx.RunAsUser != nil {
+		runAsUser = containerCtx.RunAsUser
+	}
+	runAsNonRoot := podCtx.RunAsNonRoot
+	if containerCtx.RunAsNonRoot != nil {
+		runAsNonRoot = containerCtx.RunAsNonRoot
+	}
+	if ptr.Deref(runAsNonRoot, false) && runAsUser != nil && *runAsUser == 0 {
+		problems = append(problems, "runAsNonRoot is true but runAsUser is 0 (root)")
+	}
+
+	ids := []struct {
+		field string
+		value *int64
+	}{
+		{"securityContext.runAsUser", podCtx.RunAsUser},
+		{"securityContext.runAsGroup", podCtx.RunAsGroup},
+		{"securityContext.fsGroup", podCtx.FSGroup},
+		{"containerSecurityContext.runAsUser", containerCtx.RunAsUser},
+		{"containerSecurityContext.runAsGroup", containerCtx.RunAsGroup},
+	}
+	for _, id := range ids {
+		if id.value != nil && *id.value < 0 {
+			problems = append(problems, fmt.Sprintf("%s must not be negative", id.field))
+		}
+	}
+
+	if containerCtx.AllowPrivilegeEscalation != nil && !*containerCtx.AllowPrivilegeEscalation {
+		if ptr.Deref(containerCtx.Privileged, false) {
+			problems = append(problems, "allowPrivilegeEscalation cannot be false when privileged is true")
+		}
+		if containerCtx.Capabilities != nil {
+			for _, c := range containerCtx.Capabilities.Add {
+				if c == "SYS_ADMIN" || c == "CAP_SYS_ADMIN" {
+					problems = append(problems, "allowPrivilegeEscalation cannot be false when the SYS_ADMIN capability is added")
+				}
+			}
+		}
+	}
+
+	problems = append(problems, validateSeccompProfile("securityContext.seccompProfile", podCtx.SeccompProfile)...)
+	problems = append(problems, validateSeccompProfile("containerSecurityContext.seccompProfile", containerCtx.SeccompProfile)...)
+
+	if len(problems) > 0 {
+		return errors.Errorf("invalid security context for the porter agent: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validateSeccompProfile(field string, profile *v1.SeccompProfile) []string {
+	if profile == nil {
+		return nil
+	}
+
+	switch profile.Type {
+	case v1.SeccompProfileTypeLocalhost:
+		if ptr.Deref(profile.LocalhostProfile, "") == "" {
+			return []string{fmt.Sprintf("%s.localhostProfile must be set when the type is Localhost", field)}
+		}
+	case v1.SeccompProfileTypeRuntimeDefault, v1.SeccompProfileTypeUnconfined:
+		if profile.LocalhostProfile != nil {
+			return []string{fmt.Sprintf("%s.localhostProfile can only be set when the type is Localhost", field)}
+		}
+	default:
+		return []string{fmt.Sprintf("%s.type %q is not supported", field, profile.Type)}
+	}
+	return nil
+}
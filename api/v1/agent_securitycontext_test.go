@@ -0,0 +1,130 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestAgentConfigSpecAdapter_GetPodSecurityContext(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		c := NewAgentConfigSpecAdapter(AgentConfigSpec{})
+		podCtx, err := c.GetPodSecurityContext()
+		require.NoError(t, err)
+		assert.Equal(t, DefaultAgentPodSecurityContext(), podCtx)
+		assert.Equal(t, ptr.To(true), podCtx.RunAsNonRoot)
+		assert.Equal(t, v1.SeccompProfileTypeRuntimeDefault, podCtx.SeccompProfile.Type)
+	})
+
+	t.Run("override", func(t *testing.T) {
+		c := NewAgentConfigSpecAdapter(AgentConfigSpec{PodTemplate: &AgentPodTemplate{
+			SecurityContext: &v1.PodSecurityContext{
+				RunAsUser:          ptr.To(int64(1000)),
+				SupplementalGroups: []int64{2000},
+			},
+		}})
+		podCtx, err := c.GetPodSecurityContext()
+		require.NoError(t, err)
+		assert.Equal(t, ptr.To(int64(1000)), podCtx.RunAsUser, "the custom user should be used")
+		assert.Equal(t, []int64{2000}, podCtx.SupplementalGroups, "the custom groups should be used")
+		assert.Equal(t, ptr.To(true), podCtx.RunAsNonRoot, "fields that are not set should use the default")
+		assert.Equal(t, ptr.To(AgentGroupID), podCtx.FSGroup, "fields that are not set should use the default")
+	})
+}
+
+func TestAgentConfigSpecAdapter_GetContainerSecurityContext(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		c := NewAgentConfigSpecAdapter(AgentConfigSpec{})
+		containerCtx, err := c.GetContainerSecurityContext()
+		require.NoError(t, err)
+		assert.Equal(t, ptr.To(false), containerCtx.AllowPrivilegeEscalation)
+		assert.Equal(t, []v1.Capability{"ALL"}, containerCtx.Capabilities.Drop)
+		assert.Nil(t, containerCtx.ReadOnlyRootFilesystem)
+	})
+
+	t.Run("override", func(t *testing.T) {
+		c := NewAgentConfigSpecAdapter(AgentConfigSpec{PodTemplate: &AgentPodTemplate{
+			ContainerSecurityContext: &v1.SecurityContext{
+				ReadOnlyRootFilesystem: ptr.To(true),
+				Capabilities:           &v1.Capabilities{Add: []v1.Capability{"NET_BIND_SERVICE"}},
+			},
+		}})
+		containerCtx, err := c.GetContainerSecurityContext()
+		require.NoError(t, err)
+		assert.Equal(t, ptr.To(true), containerCtx.ReadOnlyRootFilesystem)
+		assert.Equal(t, &v1.Capabilities{Add: []v1.Capability{"NET_BIND_SERVICE"}}, containerCtx.Capabilities, "capabilities should be replaced as a whole")
+		assert.Equal(t, ptr.To(false), containerCtx.AllowPrivilegeEscalation, "fields that are not set should use the default")
+	})
+}
+
+func TestAgentConfigSpecAdapter_ValidateSecurityContext(t *testing.T) {
+	testcases := []struct {
+		name      string
+		template  AgentPodTemplate
+		wantError string
+	}{
+		{name: "default"},
+		{
+			name:      "root user with runAsNonRoot",
+			template:  AgentPodTemplate{ContainerSecurityContext: &v1.SecurityContext{RunAsUser: ptr.To(int64(0))}},
+			wantError: "runAsNonRoot is true but runAsUser is 0 (root)",
+		},
+		{
+			name: "root user allowed",
+			template: AgentPodTemplate{SecurityContext: &v1.PodSecurityContext{
+				RunAsUser:    ptr.To(int64(0)),
+				RunAsNonRoot: ptr.To(false),
+			}},
+		},
+		{
+			name:      "negative group",
+			template:  AgentPodTemplate{SecurityContext: &v1.PodSecurityContext{FSGroup: ptr.To(int64(-1))}},
+			wantError: "securityContext.fsGroup must not be negative",
+		},
+		{
+			name:      "privileged",
+			template:  AgentPodTemplate{ContainerSecurityContext: &v1.SecurityContext{Privileged: ptr.To(true)}},
+			wantError: "allowPrivilegeEscalation cannot be false when privileged is true",
+		},
+		{
+			name: "privileged with escalation",
+			template: AgentPodTemplate{ContainerSecurityContext: &v1.SecurityContext{
+				Privileged:               ptr.To(true),
+				AllowPrivilegeEscalation: ptr.To(true),
+			}},
+		},
+		{
+			name:      "sys admin",
+			template:  AgentPodTemplate{ContainerSecurityContext: &v1.SecurityContext{Capabilities: &v1.Capabilities{Add: []v1.Capability{"SYS_ADMIN"}}}},
+			wantError: "allowPrivilegeEscalation cannot be false when the SYS_ADMIN capability is added",
+		},
+		{
+			name:      "localhost seccomp profile without a path",
+			template:  AgentPodTemplate{SecurityContext: &v1.PodSecurityContext{SeccompProfile: &v1.SeccompProfile{Type: v1.SeccompProfileTypeLocalhost}}},
+			wantError: "securityContext.seccompProfile.localhostProfile must be set when the type is Localhost",
+		},
+		{
+			name: "localhost seccomp profile",
+			template: AgentPodTemplate{ContainerSecurityContext: &v1.SecurityContext{SeccompProfile: &v1.SeccompProfile{
+				Type:             v1.SeccompProfileTypeLocalhost,
+				LocalhostProfile: ptr.To("profiles/porter.json"),
+			}}},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewAgentConfigSpecAdapter(AgentConfigSpec{PodTemplate: &tc.template})
+			err := c.ValidateSecurityContext()
+			if tc.wantError == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantError)
+			}
+		})
+	}
+}
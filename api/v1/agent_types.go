@@ -37,4 +37,16 @@ const (
 
 	// ConditionFailed means the Porter agent failed.
 	ConditionFailed AgentConditionType = "Failed"
+
+	// ConditionWaitingForAgentConfig means the Porter agent is waiting for the AgentConfig or PorterConfig
+	// that it uses to be ready before it can be scheduled.
+	ConditionWaitingForAgentConfig AgentConditionType = "WaitingForAgentConfig"
+
+	// ConditionPluginUpdateFailed means the plugins of an AgentConfig could not be updated,
+	// and the Porter agent keeps using the plugins that were previously installed.
+	ConditionPluginUpdateFailed AgentConditionType = "PluginUpdateFailed"
+
+	// ConditionSourcesResolved means the sources of a credential or parameter set that are resolved by the operator,
+	// such as the keys of a Kubernetes Secret, exist. It is false while a source is missing, and the agent is not run.
+	ConditionSourcesResolved AgentConditionType = "SourcesResolved"
 )
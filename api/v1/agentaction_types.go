@@ -5,12 +5,19 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// KindAgentAction represents AgentAction kind value.
+const KindAgentAction = "AgentAction"
+
 // AgentActionSpec defines the desired state of AgentAction
 type AgentActionSpec struct {
 	// AgentConfig is the name of an AgentConfig to use instead of the AgentConfig defined at the namespace or system level.
 	// +optional
 	AgentConfig *corev1.LocalObjectReference `json:"agentConfig,omitempty"`
 
+	// PorterConfig is the name of a PorterConfig to apply on top of the PorterConfig defined at the namespace or system level.
+	// +optional
+	PorterConfig *corev1.LocalObjectReference `json:"porterConfig,omitempty"`
+
 	// Command to run inside the Porter Agent job. Defaults to running the agent.
 	Command []string `json:"command,omitempty"`
 
@@ -50,6 +57,26 @@ type AgentActionStatus struct {
 	// Each condition refers to the status of the Job
 	// Possible conditions are: Scheduled, Started, Completed, and Failed
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// AgentConfigSources records the configuration layer that supplied each field of the resolved agent configuration,
+	// keyed by the path to the field. For example, podTemplate.labels.team: namespace.
+	// The layers are ClusterAgentConfig/NAME, system, namespace and instance.
+	// +optional
+	AgentConfigSources ConfigSources `json:"agentConfigSources,omitempty"`
+
+	// PorterConfigSources records the configuration layer that supplied each field of the resolved porter configuration,
+	// keyed by the path to the field. For example, storage[in-cluster-mongodb].config.url: default.
+	// +optional
+	PorterConfigSources ConfigSources `json:"porterConfigSources,omitempty"`
+
+	// EffectiveAgentConfig is the resolved agent configuration that was used to run the action.
+	// +optional
+	EffectiveAgentConfig *AgentConfigSpec `json:"effectiveAgentConfig,omitempty"`
+
+	// EffectivePorterConfig is the resolved porter configuration that was used to run the action,
+	// with sensitive values redacted.
+	// +optional
+	EffectivePorterConfig *PorterConfigSpec `json:"effectivePorterConfig,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -5,12 +5,14 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net/url"
+	"path"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
-	"github.com/mitchellh/mapstructure"
 	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -21,8 +23,23 @@ const (
 	// AnnotationAgentCfgPluginHash is the label used to store plugin hashes from a AgentConfig definition.
 	AnnotationAgentCfgPluginsHash = "agent-config-plugins-hash"
 
+	// AnnotationPluginsUnusedSince is the annotation used to record when a plugin volume was
+	// first found to be unused by any AgentConfig, so that it is removed after a grace period.
+	AnnotationPluginsUnusedSince = Prefix + "plugins-unused-since"
+
+	// AnnotationPluginCacheRefs is the annotation used to record the AgentConfigs, as a comma separated
+	// list of namespace/name, that use a shared plugin cache, so that it is removed once it is no longer used.
+	AnnotationPluginCacheRefs = Prefix + "plugin-cache-refs"
+
+	// AnnotationPluginCacheUnsupported is the annotation used to record why the volume of a shared plugin cache
+	// cannot be bound to other namespaces, so that the AgentConfigs that use it install their plugins in their own namespace.
+	AnnotationPluginCacheUnsupported = Prefix + "plugin-cache-unsupported"
+
 	// KindAgentConfig represents AgentConfig kind value.
 	KindAgentConfig = "AgentConfig"
+
+	// DefaultKeepOnFailure is how long the volume and secrets of a failed run of the Porter Agent are kept by default.
+	DefaultKeepOnFailure = 24 * time.Hour
 )
 
 // DefaultPlugins is the set of default plugins that will be used by the operator.
@@ -34,27 +51,30 @@ var DefaultPlugins = map[string]Plugin{
 //
 // SERIALIZATION NOTE:
 //
-//		The json serialization is for persisting this to Kubernetes.
-//	 The mapstructure tags is used internally for AgentConfigSpec.MergeConfig.
+//	The json serialization is for persisting this to Kubernetes, and is used by MergeAgentConfigLayers.
 type AgentConfigSpec struct {
 	// PorterRepository is the repository for the Porter Agent image.
 	// Defaults to ghcr.io/getporter/porter-agent
 	// +optional
+	// +nullable
 	PorterRepository string `json:"porterRepository,omitempty" mapstructure:"porterRepository,omitempty"`
 
 	// PorterVersion is the tag for the Porter Agent image.
 	// Defaults to a well-known version of the agent that has been tested with the operator.
 	// Users SHOULD override this to use more recent versions.
 	// +optional
+	// +nullable
 	PorterVersion string `json:"porterVersion,omitempty" mapstructure:"porterVersion,omitempty"`
 
 	// ServiceAccount is the service account to run the Porter Agent under.
 	// +optional
+	// +nullable
 	ServiceAccount string `json:"serviceAccount,omitempty" mapstructure:"serviceAccount,omitempty"`
 
 	// StorageClassName is the name of the storage class that Porter will request
 	// when running the Porter Agent. It is used to determine what the storage class
 	// will be for the volume requested
+	// +nullable
 	StorageClassName string `json:"storageClassName,omitempty" mapstructure:"storageClassName,omitempty"`
 
 	// VolumeSize is the size of the persistent volume that Porter will
@@ -63,58 +83,277 @@ type AgentConfigSpec struct {
 	// be large enough to store any files used by the bundle including credentials,
 	// parameters and outputs.
 	// +optional
+	// +nullable
 	VolumeSize string `json:"volumeSize,omitempty" mapstructure:"volumeSize,omitempty"`
 
 	// TTLSecondsAfterFinished set the time limit of the lifetime of a Job
 	// that has finished execution.
 	// +kubebuilder:default:=600
+	// +nullable
 	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty" mapstructure:"ttlSecondsAftterFinished,omitempty"`
 
 	// PullPolicy specifies when to pull the Porter Agent image. The default
 	// is to use PullAlways when the tag is canary or latest, and PullIfNotPresent
 	// otherwise.
 	// +optional
+	// +nullable
 	PullPolicy v1.PullPolicy `json:"pullPolicy,omitempty" mapstructure:"pullPolicy,omitempty"`
 
 	// InstallationServiceAccount specifies a service account to run the Kubernetes pod/job for the installation image.
 	// The default is to run without a service account.
 	// This can be useful for a bundle which is targeting the kubernetes cluster that the operator is installed in.
 	// +optional
+	// +nullable
 	InstallationServiceAccount string `json:"installationServiceAccount,omitempty" mapstructure:"installationServiceAccount,omitempty"`
 
 	// RetryLimit specifies the maximum number of retries that a failed agent job will run before being marked as failure.
 	// The default is set to 6 the same as the `BackoffLimit` on a kubernetes job.
+	// +nullable
 	RetryLimit *int32 `json:"retryLimit,omitempty" mapstructure:"retryLimit,omitempty"`
 
 	// PluginConfigFile specifies plugins required to run Porter bundles.
 	// In order to utilize mapstructure omitempty tag with an embedded struct, this field needs to be a pointer
 	// +optional
+	// +nullable
 	PluginConfigFile *PluginFileSpec `json:"pluginConfigFile,omitempty" mapstructure:"pluginConfigFile,omitempty"`
+
+	// ImagePullSecrets are the names of secrets in the same namespace, of type kubernetes.io/dockerconfigjson or kubernetes.io/dockercfg,
+	// that are used to pull the Porter Agent image and the bundles.
+	// They are combined with the image pull secrets of the installation service account.
+	// +optional
+	// +nullable
+	ImagePullSecrets []v1.LocalObjectReference `json:"imagePullSecrets,omitempty" mapstructure:"imagePullSecrets,omitempty"`
+
+	// PodTemplate customizes the scheduling, resources and metadata of the pod that runs the Porter Agent.
+	// +optional
+	// +nullable
+	PodTemplate *AgentPodTemplate `json:"podTemplate,omitempty" mapstructure:"podTemplate,omitempty"`
+
+	// InstallerPodLabels are added to the pods that run the bundle's invocation image, which are created by the
+	// Kubernetes driver of the Porter Agent. Labels used by the operator to track the pod cannot be overridden.
+	// The driver does not support customizing the resources, tolerations, node selector or annotations of the pods.
+	// +optional
+	// +nullable
+	InstallerPodLabels map[string]string `json:"installerPodLabels,omitempty" mapstructure:"installerPodLabels,omitempty"`
+
+	// CleanupPolicy determines when the volume and secrets created for each run of the Porter Agent are removed.
+	// By default, they are removed when the agent succeeds, and kept for 24 hours when it fails so that they can be inspected.
+	// +optional
+	// +nullable
+	CleanupPolicy *AgentCleanupPolicy `json:"cleanupPolicy,omitempty" mapstructure:"cleanupPolicy,omitempty"`
+
+	// PluginDelivery determines how the plugins are made available to the Porter Agent.
+	// By default, they are installed once on a ReadOnlyMany volume that is mounted by each run of the agent.
+	// +optional
+	// +nullable
+	PluginDelivery *PluginDelivery `json:"pluginDelivery,omitempty" mapstructure:"pluginDelivery,omitempty"`
 }
 
-// MergeConfig from another AgentConfigSpec. The values from the override are applied
-// only when they are not empty.
-func (c AgentConfigSpec) MergeConfig(overrides ...AgentConfigSpec) (AgentConfigSpec, error) {
-	final := c
-	var targetRaw map[string]interface{}
-	if err := mapstructure.Decode(c, &targetRaw); err != nil {
-		return AgentConfigSpec{}, err
-	}
+// PluginDeliveryMode is how the plugins are made available to the Porter Agent.
+type PluginDeliveryMode string
 
-	for _, override := range overrides {
-		var overrideRaw map[string]interface{}
-		if err := mapstructure.Decode(override, &overrideRaw); err != nil {
-			return AgentConfigSpec{}, err
+const (
+	// PluginDeliveryVolume installs the plugins once on a ReadOnlyMany persistent volume, named after a hash of the plugins,
+	// which is mounted by each run of the Porter Agent.
+	PluginDeliveryVolume PluginDeliveryMode = "Volume"
+
+	// PluginDeliveryImage installs the plugins once and publishes them to an OCI image, tagged with a hash of the plugins,
+	// which is copied into an emptyDir volume with an init container in each agent pod.
+	PluginDeliveryImage PluginDeliveryMode = "Image"
+
+	// PluginDeliverySharedVolume installs the plugins once per set of plugins on a ReadOnlyMany persistent volume
+	// in the operator namespace, which is shared by the namespaces that use the same plugins.
+	PluginDeliverySharedVolume PluginDeliveryMode = "SharedVolume"
+
+	// DefaultPluginPublisherImage is the image used to publish the plugin image, it must contain crane and a shell.
+	DefaultPluginPublisherImage = "gcr.io/go-containerregistry/crane:debug"
+
+	// DefaultPluginBaseImage is the base image of the plugin image, it must contain a cp command.
+	DefaultPluginBaseImage = "busybox:1.36"
+
+	// PluginImagePath is the directory in a plugin image that contains the plugins.
+	PluginImagePath = "/plugins"
+)
+
+// PluginDelivery determines how the plugins are made available to the Porter Agent,
+// for clusters where the storage does not support ReadOnlyMany volumes.
+type PluginDelivery struct {
+	// Mode is how the plugins are delivered: Volume, SharedVolume or Image. Defaults to Volume.
+	// +kubebuilder:validation:Enum=Volume;SharedVolume;Image
+	// +optional
+	Mode PluginDeliveryMode `json:"mode,omitempty" mapstructure:"mode,omitempty"`
+
+	// Repository is the OCI repository where the plugin images are published, for example example.com/porter-plugins.
+	// Each set of plugins is published once, tagged with the hash of the plugins. Required when the mode is Image.
+	// The image pull secrets of the AgentConfig must allow pushing to the repository.
+	// +optional
+	Repository string `json:"repository,omitempty" mapstructure:"repository,omitempty"`
+
+	// PublisherImage is the image that publishes the plugin image, it must contain crane and a shell.
+	// Defaults to gcr.io/go-containerregistry/crane:debug.
+	// +optional
+	PublisherImage string `json:"publisherImage,omitempty" mapstructure:"publisherImage,omitempty"`
+
+	// BaseImage is the base image of the plugin image, it must contain a cp command. Defaults to busybox.
+	// +optional
+	BaseImage string `json:"baseImage,omitempty" mapstructure:"baseImage,omitempty"`
+}
+
+// UsesVolume returns whether the plugins are installed on a persistent volume.
+func (d PluginDelivery) UsesVolume() bool {
+	return d.Mode == PluginDeliveryVolume || d.Mode == PluginDeliverySharedVolume
+}
+
+// IsShared returns whether the plugins are installed on a volume that is shared across namespaces.
+func (d PluginDelivery) IsShared() bool {
+	return d.Mode == PluginDeliverySharedVolume
+}
+
+// GetImage returns the reference of the plugin image that contains the plugins with the specified hash.
+func (d PluginDelivery) GetImage(pluginsHash string) string {
+	return d.Repository + ":" + pluginsHash
+}
+
+// Validate checks that the plugin delivery has the settings required by its mode.
+func (d PluginDelivery) Validate() error {
+	switch d.Mode {
+	case PluginDeliveryVolume, PluginDeliverySharedVolume:
+		return nil
+	case PluginDeliveryImage:
+		if d.Repository == "" {
+			return errors.New("pluginDelivery.repository is required when the plugin delivery mode is Image")
 		}
+		// The tag is the hash of the plugins
+		if name := d.Repository[strings.LastIndex(d.Repository, "/")+1:]; strings.ContainsAny(name, ":@") {
+			return errors.Errorf("pluginDelivery.repository %q should not include a tag or digest", d.Repository)
+		}
+		return nil
+	default:
+		return errors.Errorf("invalid plugin delivery mode %q", d.Mode)
+	}
+}
+
+// AgentCleanupPolicy determines when the volume and secrets created for a run of the Porter Agent are removed.
+// They are always removed when the AgentAction is deleted.
+type AgentCleanupPolicy struct {
+	// DeleteOnSuccess removes the resources as soon as the Porter Agent succeeds. Defaults to true.
+	// +optional
+	// +nullable
+	DeleteOnSuccess *bool `json:"deleteOnSuccess,omitempty"`
 
-		targetRaw = MergeMap(targetRaw, overrideRaw)
+	// KeepOnFailure is how long the resources are kept after the Porter Agent fails, for example 12h. Defaults to 24h.
+	// Set to 0s to remove them as soon as the agent fails.
+	// +optional
+	// +nullable
+	KeepOnFailure *metav1.Duration `json:"keepOnFailure,omitempty"`
+}
+
+// GetDeleteOnSuccess returns whether the resources are removed when the Porter Agent succeeds.
+func (p *AgentCleanupPolicy) GetDeleteOnSuccess() bool {
+	if p == nil || p.DeleteOnSuccess == nil {
+		return true
+	}
+	return *p.DeleteOnSuccess
+}
+
+// GetKeepOnFailure returns how long the resources are kept after the Porter Agent fails.
+func (p *AgentCleanupPolicy) GetKeepOnFailure() time.Duration {
+	if p == nil || p.KeepOnFailure == nil {
+		return DefaultKeepOnFailure
 	}
+	return p.KeepOnFailure.Duration
+}
+
+// AgentPodTemplate defines customizations for the pod that runs the Porter Agent.
+type AgentPodTemplate struct {
+	// Labels to add to the Porter Agent pod. Labels used by the operator to track the job cannot be overridden.
+	// +optional
+	// +nullable
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations to add to the Porter Agent pod.
+	// +optional
+	// +nullable
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Resources are the compute resources required by the Porter Agent container.
+	// +optional
+	// +nullable
+	Resources *v1.ResourceRequirements `json:"resources,omitempty"`
+
+	// NodeSelector must match a node's labels for the Porter Agent pod to be scheduled on that node.
+	// +optional
+	// +nullable
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations allow the Porter Agent pod to be scheduled on nodes with matching taints.
+	// +optional
+	// +nullable
+	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity defines the scheduling constraints of the Porter Agent pod.
+	// +optional
+	// +nullable
+	Affinity *v1.Affinity `json:"affinity,omitempty"`
+
+	// PriorityClassName is the priority class of the Porter Agent pod.
+	// +optional
+	// +nullable
+	PriorityClassName string `json:"priorityClassName,omitempty"`
 
-	if err := mapstructure.Decode(targetRaw, &final); err != nil {
+	// SecurityContext is the pod level security context of the Porter Agent pod.
+	// The fields that are set override the default security context, which is compliant with the restricted Pod Security Standard.
+	// +optional
+	// +nullable
+	SecurityContext *v1.PodSecurityContext `json:"securityContext,omitempty"`
+
+	// ContainerSecurityContext is the security context of the Porter Agent container.
+	// The fields that are set override the default security context, which is compliant with the restricted Pod Security Standard.
+	// +optional
+	// +nullable
+	ContainerSecurityContext *v1.SecurityContext `json:"containerSecurityContext,omitempty"`
+}
+
+// Merge applies the values from the override to the pod template.
+// Labels, annotations, node selectors and resource quantities are merged by key,
+// the remaining fields are replaced, see MergeAgentConfigLayers.
+func (t AgentPodTemplate) Merge(override AgentPodTemplate) (AgentPodTemplate, error) {
+	var result AgentPodTemplate
+	if err := mergeSpecs(&result, t, override); err != nil {
+		return AgentPodTemplate{}, err
+	}
+	return result, nil
+}
+
+// MergeConfig from other AgentConfigSpec values, from the least to the most specific.
+// The specs are deep merged, see MergeAgentConfigLayers.
+func (c AgentConfigSpec) MergeConfig(overrides ...AgentConfigSpec) (AgentConfigSpec, error) {
+	specs := make([]interface{}, 0, len(overrides)+1)
+	specs = append(specs, c)
+	for _, override := range overrides {
+		specs = append(specs, override)
+	}
+
+	var result AgentConfigSpec
+	if err := mergeSpecs(&result, specs...); err != nil {
 		return AgentConfigSpec{}, err
 	}
+	return result, nil
+}
 
-	return final, nil
+// MergeAgentConfigLayers deep merges the layers of agent configuration, from the least to the most specific,
+// and returns the merged spec along with the layer that supplied each field:
+//   - Maps, such as the plugins or the pod labels, are merged key by key.
+//   - Lists of objects with a name, such as the image pull secrets, are merged by name.
+//   - The other values, including the other lists, are replaced.
+//   - A field explicitly set to null removes the value defined by the less specific layers.
+func MergeAgentConfigLayers(layers ...ConfigLayer) (AgentConfigSpec, ConfigSources, error) {
+	var result AgentConfigSpec
+	sources, err := mergeConfigLayers(&result, layers...)
+	if err != nil {
+		return AgentConfigSpec{}, nil, err
+	}
+	return result, sources, nil
 }
 
 // AgentConfigStatus defines the observed state of AgentConfig
@@ -124,6 +363,87 @@ type AgentConfigStatus struct {
 	// +kubebuilder:default:=false
 	// +kubebuilder:validation:Type=boolean
 	Ready bool `json:"ready"`
+
+	// UnusedPluginVolumes are the plugin volumes previously installed by the AgentConfig
+	// that are no longer used by any AgentConfig in the namespace, and are scheduled for removal.
+	// +optional
+	UnusedPluginVolumes []UnusedPluginVolume `json:"unusedPluginVolumes,omitempty"`
+
+	// InstalledPlugins are the plugins installed on the plugin volume, as reported by porter plugins list
+	// after the plugins are installed.
+	// +optional
+	InstalledPlugins []InstalledPlugin `json:"installedPlugins,omitempty"`
+
+	// InstalledPluginsHash is the hash of the plugins that were installed when InstalledPlugins was reported.
+	// +optional
+	InstalledPluginsHash string `json:"installedPluginsHash,omitempty"`
+
+	// ActivePlugins are the plugins that were last installed successfully on a plugin volume or published to a plugin image.
+	// The Porter agent keeps using them while the plugins are updated, and when the update fails.
+	// +optional
+	ActivePlugins *ActivePlugins `json:"activePlugins,omitempty"`
+}
+
+// ActivePlugins is a set of plugins installed on a plugin volume, or published to a plugin image, that is ready to be used by the Porter agent.
+type ActivePlugins struct {
+	// PluginsHash is the hash of the plugins installed on the volume or image.
+	PluginsHash string `json:"pluginsHash"`
+
+	// PersistentVolumeClaim is the name of the plugin volume. Empty when the plugins are delivered with an image.
+	// +optional
+	PersistentVolumeClaim string `json:"persistentVolumeClaim,omitempty"`
+
+	// Image is the plugin image that contains the plugins, when the plugins are delivered with an image.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Plugins installed on the volume or image.
+	Plugins map[string]Plugin `json:"plugins"`
+}
+
+// GetLocation returns where the plugins are installed, either the name of the plugin volume or the plugin image.
+func (p ActivePlugins) GetLocation() string {
+	if p.Image != "" {
+		return p.Image
+	}
+	return p.PersistentVolumeClaim
+}
+
+// InstalledPlugin is a plugin that is installed on the plugin volume.
+type InstalledPlugin struct {
+	// Name of the plugin.
+	Name string `json:"name"`
+
+	// Version of the plugin that is installed. Empty when the plugin was requested but is not installed.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// RequestedVersion is the version of the plugin defined by the AgentConfig. Empty when the version is not pinned.
+	// +optional
+	RequestedVersion string `json:"requestedVersion,omitempty"`
+
+	// Source is where the plugin was installed from: its url, feed url or mirror, or the default plugin feed.
+	// +optional
+	Source string `json:"source,omitempty"`
+
+	// VersionMismatch is true when the installed version is not the requested version.
+	// +optional
+	VersionMismatch bool `json:"versionMismatch,omitempty"`
+}
+
+// UnusedPluginVolume is a plugin volume (pvc) that is no longer used and will be removed after a grace period.
+type UnusedPluginVolume struct {
+	// Name of the persistent volume claim.
+	Name string `json:"name"`
+
+	// PluginsHash is the hash of the plugins installed on the volume.
+	PluginsHash string `json:"pluginsHash"`
+
+	// UnusedSince is when the operator first found that the volume was unused.
+	UnusedSince metav1.Time `json:"unusedSince"`
+
+	// DeleteAfter is when the volume is removed, unless it is used again by an AgentConfig before then.
+	DeleteAfter metav1.Time `json:"deleteAfter"`
 }
 
 // +kubebuilder:object:root=true
@@ -235,6 +555,99 @@ type Plugin struct {
 	URL     string `json:"url,omitempty" mapstructure:"url,omitempty"`
 	Mirror  string `json:"mirror,omitempty" mapstructure:"mirror,omitempty"`
 	Version string `json:"version,omitempty" mapstructure:"version,omitempty"`
+
+	// Source installs the plugin from an archive stored in the cluster instead of downloading it,
+	// for clusters that cannot reach a plugin feed.
+	// +optional
+	Source *PluginSource `json:"source,omitempty" yaml:"-" mapstructure:"-"`
+}
+
+// PluginSource is a plugin archive stored in the cluster, in the namespace of the AgentConfig.
+// The archive is a gzipped tarball that contains the plugin binary, named after the plugin, at its root.
+// Exactly one of ConfigMap, Secret or PersistentVolumeClaim must be set.
+type PluginSource struct {
+	// ConfigMap that contains the archive.
+	// +optional
+	ConfigMap *PluginArchiveKeyRef `json:"configMap,omitempty"`
+
+	// Secret that contains the archive.
+	// +optional
+	Secret *PluginArchiveKeyRef `json:"secret,omitempty"`
+
+	// PersistentVolumeClaim of an existing volume that contains the archive.
+	// +optional
+	PersistentVolumeClaim *PluginArchiveVolumeRef `json:"persistentVolumeClaim,omitempty"`
+
+	// SHA256 is the hex encoded checksum of the archive, which is verified before the plugin is installed.
+	// +kubebuilder:validation:Pattern=`^[a-fA-F0-9]{64}$`
+	SHA256 string `json:"sha256"`
+}
+
+// PluginArchiveKeyRef selects the key of a ConfigMap or Secret that contains a plugin archive.
+type PluginArchiveKeyRef struct {
+	// Name of the ConfigMap or Secret.
+	Name string `json:"name"`
+
+	// Key that contains the archive.
+	Key string `json:"key"`
+}
+
+// PluginArchiveVolumeRef selects a plugin archive on a persistent volume.
+type PluginArchiveVolumeRef struct {
+	// ClaimName is the name of the persistent volume claim.
+	ClaimName string `json:"claimName"`
+
+	// Path to the archive, relative to the root of the volume.
+	Path string `json:"path"`
+}
+
+var sha256Regex = regexp.MustCompile(`^[a-fA-F0-9]{64}$`)
+
+// Validate checks that the source selects a single archive and has a valid checksum.
+func (s PluginSource) Validate() error {
+	var sources int
+	if s.ConfigMap != nil {
+		sources++
+		if s.ConfigMap.Name == "" || s.ConfigMap.Key == "" {
+			return errors.New("source.configMap requires a name and a key")
+		}
+	}
+	if s.Secret != nil {
+		sources++
+		if s.Secret.Name == "" || s.Secret.Key == "" {
+			return errors.New("source.secret requires a name and a key")
+		}
+	}
+	if s.PersistentVolumeClaim != nil {
+		sources++
+		if s.PersistentVolumeClaim.ClaimName == "" || s.PersistentVolumeClaim.Path == "" {
+			return errors.New("source.persistentVolumeClaim requires a claimName and a path")
+		}
+		if path.IsAbs(s.PersistentVolumeClaim.Path) || strings.HasPrefix(path.Clean(s.PersistentVolumeClaim.Path), "..") {
+			return errors.Errorf("source.persistentVolumeClaim.path %q must be relative to the root of the volume", s.PersistentVolumeClaim.Path)
+		}
+	}
+	if sources != 1 {
+		return errors.New("source requires exactly one of configMap, secret or persistentVolumeClaim")
+	}
+	if !sha256Regex.MatchString(s.SHA256) {
+		return errors.Errorf("source.sha256 %q is not a hex encoded SHA256 checksum", s.SHA256)
+	}
+	return nil
+}
+
+// String describes where the archive is stored.
+func (s PluginSource) String() string {
+	switch {
+	case s.ConfigMap != nil:
+		return fmt.Sprintf("configmap/%s/%s", s.ConfigMap.Name, s.ConfigMap.Key)
+	case s.Secret != nil:
+		return fmt.Sprintf("secret/%s/%s", s.Secret.Name, s.Secret.Key)
+	case s.PersistentVolumeClaim != nil:
+		return fmt.Sprintf("persistentvolumeclaim/%s/%s", s.PersistentVolumeClaim.ClaimName, s.PersistentVolumeClaim.Path)
+	default:
+		return ""
+	}
 }
 
 // AgentConfigSpecAdapter is a wrapper of AgentConfigSpec with a list representation of plugins configuration.
@@ -256,12 +669,47 @@ func NewAgentConfigSpecAdapter(spec AgentConfigSpec) AgentConfigSpecAdapter {
 	}
 }
 
+// GetSpec returns the AgentConfigSpec that the adapter was created from.
+func (c AgentConfigSpecAdapter) GetSpec() AgentConfigSpec {
+	return c.original
+}
+
 // GetPluginsPVCName returns a name used for this agent config plugin persistent volume claim.
 // Returns an empty string when no plugins are specified, in which case the PVC should not be mounted
 func (c AgentConfigSpecAdapter) GetPluginsPVCName(namespace string) string {
 	return c.Plugins.GetPVCName(namespace)
 }
 
+// GetPluginDelivery returns how the plugins are made available to the Porter Agent,
+// defaulting the mode to Volume and the images used to publish the plugin image.
+func (c AgentConfigSpecAdapter) GetPluginDelivery() PluginDelivery {
+	var result PluginDelivery
+	if c.original.PluginDelivery != nil {
+		result = *c.original.PluginDelivery
+	}
+	if result.Mode == "" {
+		result.Mode = PluginDeliveryVolume
+	}
+	if result.PublisherImage == "" {
+		result.PublisherImage = DefaultPluginPublisherImage
+	}
+	if result.BaseImage == "" {
+		result.BaseImage = DefaultPluginBaseImage
+	}
+	return result
+}
+
+// GetPluginImage returns the reference of the plugin image that contains the plugins of the AgentConfig.
+// Returns an empty string when no plugins are specified or the plugins are not delivered with an image.
+func (c AgentConfigSpecAdapter) GetPluginImage() string {
+	delivery := c.GetPluginDelivery()
+	hash, ok := c.Plugins.GetLabels()[LabelPluginsHash]
+	if !ok || delivery.Mode != PluginDeliveryImage {
+		return ""
+	}
+	return delivery.GetImage(hash)
+}
+
 // GetPorterImage returns the fully qualified image name of the Porter Agent
 // image. Defaults the repository and tag when not set.
 func (c AgentConfigSpecAdapter) GetPorterImage() string {
@@ -342,7 +790,73 @@ func (c *AgentConfigSpecAdapter) GetTTLSecondsAfterFinished() *int32 {
 	return c.original.TTLSecondsAfterFinished
 }
 
+// GetImagePullSecrets returns the config value of image pull secrets.
+func (c AgentConfigSpecAdapter) GetImagePullSecrets() []v1.LocalObjectReference {
+	return c.original.ImagePullSecrets
+}
+
+// GetPodSecurityContext returns the security context of the Porter Agent pod,
+// applying the fields set on the pod template over DefaultAgentPodSecurityContext.
+func (c AgentConfigSpecAdapter) GetPodSecurityContext() (*v1.PodSecurityContext, error) {
+	result := DefaultAgentPodSecurityContext()
+	if c.original.PodTemplate != nil && c.original.PodTemplate.SecurityContext != nil {
+		if err := overlaySecurityContext(result, c.original.PodTemplate.SecurityContext); err != nil {
+			return nil, errors.Wrap(err, "invalid pod security context")
+		}
+	}
+	return result, nil
+}
+
+// GetContainerSecurityContext returns the security context of the Porter Agent container,
+// applying the fields set on the pod template over DefaultAgentContainerSecurityContext.
+func (c AgentConfigSpecAdapter) GetContainerSecurityContext() (*v1.SecurityContext, error) {
+	result := DefaultAgentContainerSecurityContext()
+	if c.original.PodTemplate != nil && c.original.PodTemplate.ContainerSecurityContext != nil {
+		if err := overlaySecurityContext(result, c.original.PodTemplate.ContainerSecurityContext); err != nil {
+			return nil, errors.Wrap(err, "invalid container security context")
+		}
+	}
+	return result, nil
+}
+
+// ValidateSecurityContext checks that the resolved pod and container security contexts
+// can be used together, so that an invalid combination is reported before the agent job is created.
+func (c AgentConfigSpecAdapter) ValidateSecurityContext() error {
+	podCtx, err := c.GetPodSecurityContext()
+	if err != nil {
+		return err
+	}
+	containerCtx, err := c.GetContainerSecurityContext()
+	if err != nil {
+		return err
+	}
+	return validateAgentSecurityContext(podCtx, containerCtx)
+}
+
+// GetInstallerPodLabels returns the labels to add to the pods that run the bundle.
+func (c AgentConfigSpecAdapter) GetInstallerPodLabels() map[string]string {
+	return c.original.InstallerPodLabels
+}
+
+// GetPodTemplate returns the customizations for the Porter Agent pod.
+// Returns an empty template when none is defined.
+func (c AgentConfigSpecAdapter) GetPodTemplate() AgentPodTemplate {
+	if c.original.PodTemplate == nil {
+		return AgentPodTemplate{}
+	}
+	return *c.original.PodTemplate
+}
+
+// ToPorterDocument returns the plugins file that porter uses to install the plugins.
+// Plugins with a source are installed from their archive by the operator, so they are not included.
 func (c AgentConfigSpecAdapter) ToPorterDocument() ([]byte, error) {
+	plugins := make(map[string]Plugin, len(c.Plugins.data))
+	for name, p := range c.Plugins.data {
+		if p.Source == nil {
+			plugins[name] = p
+		}
+	}
+
 	raw := struct {
 		SchemaType    string            `yaml:"schemaType"`
 		SchemaVersion string            `yaml:"schemaVersion"`
@@ -350,7 +864,7 @@ func (c AgentConfigSpecAdapter) ToPorterDocument() ([]byte, error) {
 	}{
 		SchemaType:    "Plugins",
 		SchemaVersion: c.original.PluginConfigFile.SchemaVersion,
-		Plugins:       c.Plugins.data,
+		Plugins:       plugins,
 	}
 
 	return yaml.Marshal(raw)
@@ -399,6 +913,17 @@ func (op *PluginsConfigList) Add(name string, p Plugin) {
 	})
 }
 
+// GetNamesWithSource returns the names of the plugins that are installed from an archive stored in the cluster, sorted alphabetically.
+func (op PluginsConfigList) GetNamesWithSource() []string {
+	var names []string
+	for _, name := range op.keys {
+		if op.data[name].Source != nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 // GetNames returns an array of plugin names in the list sorted alphabetically.
 func (op PluginsConfigList) GetNames() []string {
 	return op.keys
@@ -465,6 +990,9 @@ func (op PluginsConfigList) label() string {
 		if p.Version != "" {
 			plugins = append(plugins, fmt.Sprintf("_%s", p.Version))
 		}
+		if p.Source != nil {
+			plugins = append(plugins, fmt.Sprintf("_%s", strings.ToLower(p.Source.SHA256)))
+		}
 		i++
 	}
 
@@ -2,6 +2,7 @@ package v1
 
 import (
 	"testing"
+	"time"
 
 	"get.porter.sh/porter/pkg/plugins"
 	portertest "get.porter.sh/porter/pkg/test"
@@ -10,6 +11,7 @@ import (
 	"github.com/stretchr/testify/require"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestAgentConfigSpecAdapter_GetPorterImage(t *testing.T) {
@@ -232,10 +234,91 @@ func TestAgentConfigSpec_MergeConfig(t *testing.T) {
 		assert.Equal(t, "2Mi", config.VolumeSize)
 		assert.Equal(t, v1.PullAlways, config.PullPolicy)
 		assert.Equal(t, "override", config.InstallationServiceAccount)
-		assert.Equal(t, &PluginFileSpec{Plugins: map[string]Plugin{"azure": {FeedURL: "localhost:6000"}}}, config.PluginConfigFile)
+		wantPlugins := map[string]Plugin{"test-plugin": {FeedURL: "localhost:5000"}, "kubernetes": {}, "azure": {FeedURL: "localhost:6000"}}
+		assert.Equal(t, &PluginFileSpec{Plugins: wantPlugins}, config.PluginConfigFile, "the plugins should be merged by name")
 	})
 }
 
+func TestAgentConfigSpec_MergeConfig_PodTemplate(t *testing.T) {
+	systemConfig := AgentConfigSpec{
+		PodTemplate: &AgentPodTemplate{
+			Labels:       map[string]string{"team": "platform", "tier": "tools"},
+			NodeSelector: map[string]string{"pool": "tooling"},
+			Resources: &v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m"), v1.ResourceMemory: resource.MustParse("128Mi")},
+			},
+			Tolerations:       []v1.Toleration{{Key: "tooling", Operator: v1.TolerationOpExists}},
+			PriorityClassName: "low",
+		},
+	}
+	nsConfig := AgentConfigSpec{
+		ServiceAccount: "porter-agent",
+	}
+	instConfig := AgentConfigSpec{
+		PodTemplate: &AgentPodTemplate{
+			Labels:      map[string]string{"tier": "bundles"},
+			Annotations: map[string]string{"example.com/owner": "me"},
+			Resources: &v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("256Mi")},
+				Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse("512Mi")},
+			},
+			PriorityClassName: "high",
+		},
+	}
+
+	config, err := systemConfig.MergeConfig(nsConfig, instConfig)
+	require.NoError(t, err)
+	assert.Equal(t, "porter-agent", config.ServiceAccount)
+	require.NotNil(t, config.PodTemplate)
+	assert.Equal(t, map[string]string{"team": "platform", "tier": "bundles"}, config.PodTemplate.Labels)
+	assert.Equal(t, map[string]string{"example.com/owner": "me"}, config.PodTemplate.Annotations)
+	assert.Equal(t, map[string]string{"pool": "tooling"}, config.PodTemplate.NodeSelector)
+	assert.Equal(t, systemConfig.PodTemplate.Tolerations, config.PodTemplate.Tolerations)
+	assert.Equal(t, "high", config.PodTemplate.PriorityClassName)
+	wantResources := &v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m"), v1.ResourceMemory: resource.MustParse("256Mi")},
+		Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse("512Mi")},
+	}
+	assert.Equal(t, wantResources, config.PodTemplate.Resources)
+
+	// The pod templates that were merged should not be modified
+	assert.Equal(t, map[string]string{"team": "platform", "tier": "tools"}, systemConfig.PodTemplate.Labels)
+	assert.Equal(t, "100m", systemConfig.PodTemplate.Resources.Requests.Cpu().String())
+	assert.Equal(t, "128Mi", systemConfig.PodTemplate.Resources.Requests.Memory().String())
+}
+
+func TestAgentConfigSpec_MergeConfig_InstallerPodLabels(t *testing.T) {
+	nsConfig := AgentConfigSpec{
+		InstallerPodLabels: map[string]string{"team": "platform", "tier": "bundles"},
+	}
+	instConfig := AgentConfigSpec{
+		InstallerPodLabels: map[string]string{"tier": "apps"},
+	}
+
+	config, err := AgentConfigSpec{}.MergeConfig(nsConfig, instConfig)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "platform", "tier": "apps"}, config.InstallerPodLabels)
+	assert.Nil(t, config.PodTemplate, "the agent pod template should not be set")
+}
+
+func TestAgentPodTemplate_Merge(t *testing.T) {
+	template := AgentPodTemplate{
+		Labels:      map[string]string{"team": "platform"},
+		Tolerations: []v1.Toleration{{Key: "tooling", Operator: v1.TolerationOpExists}},
+	}
+	override := AgentPodTemplate{
+		Labels:            map[string]string{"tier": "bundles"},
+		PriorityClassName: "high",
+	}
+
+	result, err := template.Merge(override)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "platform", "tier": "bundles"}, result.Labels)
+	assert.Equal(t, template.Tolerations, result.Tolerations)
+	assert.Equal(t, "high", result.PriorityClassName)
+	assert.Equal(t, map[string]string{"team": "platform"}, template.Labels, "the template should not be modified")
+}
+
 func TestAgentConfig_MergeConfigs(t *testing.T) {
 	t.Run("empty is ignored", func(t *testing.T) {
 		nsSpec := AgentConfigSpec{
@@ -288,7 +371,8 @@ func TestAgentConfig_MergeConfigs(t *testing.T) {
 		assert.Equal(t, "2Mi", config.Spec.VolumeSize)
 		assert.Equal(t, v1.PullAlways, config.Spec.PullPolicy)
 		assert.Equal(t, "override", config.Spec.InstallationServiceAccount)
-		assert.Equal(t, &PluginFileSpec{Plugins: map[string]Plugin{"azure": {FeedURL: "localhost:6000"}}}, config.Spec.PluginConfigFile)
+		wantPlugins := map[string]Plugin{"test-plugin": {FeedURL: "localhost:5000"}, "kubernetes": {}, "azure": {FeedURL: "localhost:6000"}}
+		assert.Equal(t, &PluginFileSpec{Plugins: wantPlugins}, config.Spec.PluginConfigFile, "the plugins should be merged by name")
 	})
 }
 
@@ -321,6 +405,13 @@ func TestAgentConfigSpecAdapter_ToPorterDocument(t *testing.T) {
 						Mirror:  "http://example.com",
 						URL:     "test",
 					},
+					// Plugins from a source in the cluster are installed by the operator
+					"plugin3": {
+						Source: &PluginSource{
+							ConfigMap: &PluginArchiveKeyRef{Name: "plugins", Key: "plugin3.tgz"},
+							SHA256:    "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+						},
+					},
 				},
 			},
 			wantFile:   wantGoldenFile,
@@ -398,3 +489,115 @@ func TestHashString(t *testing.T) {
 	str := hashString("fake-string")
 	assert.Equal(t, "ab19e45285992b247dd281213f803479", str)
 }
+
+func TestAgentCleanupPolicy(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		var policy *AgentCleanupPolicy
+		assert.True(t, policy.GetDeleteOnSuccess())
+		assert.Equal(t, DefaultKeepOnFailure, policy.GetKeepOnFailure())
+	})
+
+	t.Run("set", func(t *testing.T) {
+		keep := false
+		policy := &AgentCleanupPolicy{
+			DeleteOnSuccess: &keep,
+			KeepOnFailure:   &metav1.Duration{Duration: time.Hour},
+		}
+		assert.False(t, policy.GetDeleteOnSuccess())
+		assert.Equal(t, time.Hour, policy.GetKeepOnFailure())
+	})
+}
+
+func TestAgentConfigSpecAdapter_GetPluginDelivery(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		delivery := NewAgentConfigSpecAdapter(AgentConfigSpec{}).GetPluginDelivery()
+		assert.Equal(t, PluginDeliveryVolume, delivery.Mode)
+		assert.Equal(t, DefaultPluginPublisherImage, delivery.PublisherImage)
+		assert.Equal(t, DefaultPluginBaseImage, delivery.BaseImage)
+		assert.True(t, delivery.UsesVolume())
+		assert.False(t, delivery.IsShared())
+		assert.NoError(t, delivery.Validate())
+	})
+
+	t.Run("shared volume", func(t *testing.T) {
+		spec := AgentConfigSpec{PluginDelivery: &PluginDelivery{Mode: PluginDeliverySharedVolume}}
+		delivery := NewAgentConfigSpecAdapter(spec).GetPluginDelivery()
+		assert.True(t, delivery.UsesVolume())
+		assert.True(t, delivery.IsShared())
+		assert.NoError(t, delivery.Validate())
+	})
+
+	t.Run("image", func(t *testing.T) {
+		spec := AgentConfigSpec{PluginDelivery: &PluginDelivery{Mode: PluginDeliveryImage, BaseImage: "example.com/base:v1"}}
+		delivery := NewAgentConfigSpecAdapter(spec).GetPluginDelivery()
+		assert.False(t, delivery.UsesVolume())
+		assert.Equal(t, "example.com/base:v1", delivery.BaseImage)
+		assert.EqualError(t, delivery.Validate(), "pluginDelivery.repository is required when the plugin delivery mode is Image")
+
+		delivery.Repository = "example.com/porter-plugins:v1.0.0"
+		assert.EqualError(t, delivery.Validate(), `pluginDelivery.repository "example.com/porter-plugins:v1.0.0" should not include a tag or digest`)
+
+		delivery.Repository = "localhost:5000/porter-plugins"
+		assert.NoError(t, delivery.Validate())
+		assert.Equal(t, "localhost:5000/porter-plugins:abc123", delivery.GetImage("abc123"))
+	})
+}
+
+func TestAgentConfigSpecAdapter_GetPluginImage(t *testing.T) {
+	plugins := &PluginFileSpec{Plugins: map[string]Plugin{"kubernetes": {Version: "v1.0.0"}}}
+	spec := AgentConfigSpec{
+		PluginConfigFile: plugins,
+		PluginDelivery:   &PluginDelivery{Mode: PluginDeliveryImage, Repository: "example.com/porter-plugins"},
+	}
+	adapter := NewAgentConfigSpecAdapter(spec)
+	hash := adapter.Plugins.GetLabels()[LabelPluginsHash]
+	assert.Equal(t, "example.com/porter-plugins:"+hash, adapter.GetPluginImage(), "the plugin image should be tagged with the hash of the plugins")
+
+	spec.PluginDelivery = nil
+	assert.Empty(t, NewAgentConfigSpecAdapter(spec).GetPluginImage(), "the plugins are not delivered with an image")
+
+	spec.PluginDelivery = &PluginDelivery{Mode: PluginDeliveryImage, Repository: "example.com/porter-plugins"}
+	spec.PluginConfigFile = nil
+	assert.Empty(t, NewAgentConfigSpecAdapter(spec).GetPluginImage(), "there are no plugins to deliver")
+}
+
+func TestPluginSource_Validate(t *testing.T) {
+	const checksum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	configMap := &PluginArchiveKeyRef{Name: "plugins", Key: "kubernetes.tgz"}
+	testcases := []struct {
+		name    string
+		source  PluginSource
+		wantErr string
+	}{
+		{name: "configmap", source: PluginSource{ConfigMap: configMap, SHA256: checksum}},
+		{name: "secret", source: PluginSource{Secret: &PluginArchiveKeyRef{Name: "plugins", Key: "kubernetes.tgz"}, SHA256: checksum}},
+		{name: "volume", source: PluginSource{PersistentVolumeClaim: &PluginArchiveVolumeRef{ClaimName: "plugins", Path: "kubernetes/v1.0.0.tgz"}, SHA256: checksum}},
+		{name: "no source", source: PluginSource{SHA256: checksum}, wantErr: "exactly one of"},
+		{name: "multiple sources", source: PluginSource{ConfigMap: configMap, Secret: configMap, SHA256: checksum}, wantErr: "exactly one of"},
+		{name: "missing key", source: PluginSource{ConfigMap: &PluginArchiveKeyRef{Name: "plugins"}, SHA256: checksum}, wantErr: "requires a name and a key"},
+		{name: "path outside the volume", source: PluginSource{PersistentVolumeClaim: &PluginArchiveVolumeRef{ClaimName: "plugins", Path: "../kubernetes.tgz"}, SHA256: checksum}, wantErr: "must be relative"},
+		{name: "missing checksum", source: PluginSource{ConfigMap: configMap}, wantErr: "is not a hex encoded SHA256 checksum"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.source.Validate()
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestPluginsConfigList_GetLabels_Source(t *testing.T) {
+	newPlugins := func(checksum string) PluginsConfigList {
+		return NewPluginsList(map[string]Plugin{
+			"kubernetes": {Source: &PluginSource{ConfigMap: &PluginArchiveKeyRef{Name: "plugins", Key: "kubernetes.tgz"}, SHA256: checksum}},
+		})
+	}
+	first := newPlugins("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+	second := newPlugins("a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447")
+	assert.NotEqual(t, first.GetLabels()[LabelPluginsHash], second.GetLabels()[LabelPluginsHash], "a new archive should be installed on a new volume")
+	assert.Equal(t, []string{"kubernetes"}, first.GetNamesWithSource())
+}
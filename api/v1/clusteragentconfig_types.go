@@ -0,0 +1,65 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KindClusterAgentConfig represents ClusterAgentConfig kind value.
+const KindClusterAgentConfig = "ClusterAgentConfig"
+
+// ClusterAgentConfigSpec defines the configuration for the Porter agent
+// that is applied to the namespaces selected by the configuration.
+// Plugins are installed by the AgentConfig controller, which does not reconcile cluster configuration,
+// so the plugins must be defined by an AgentConfig.
+// +kubebuilder:validation:XValidation:rule="!has(self.pluginConfigFile)",message="pluginConfigFile is not supported by ClusterAgentConfig, define the plugins in an AgentConfig"
+type ClusterAgentConfigSpec struct {
+	// NamespaceSelector selects the namespaces that use this configuration.
+	// All namespaces are selected when it is not set.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// Priority determines the order in which the configurations that select the same namespace are applied.
+	// A configuration with a higher priority overrides the values from a configuration with a lower priority.
+	// Configurations with the same priority are applied in alphabetical order of their name.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	AgentConfigSpec `json:",inline"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Priority",type="integer",JSONPath=".spec.priority"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ClusterAgentConfig is the Schema for the clusteragentconfigs API.
+// It defines default AgentConfig values for the namespaces that it selects.
+type ClusterAgentConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ClusterAgentConfigSpec `json:"spec,omitempty"`
+}
+
+// SelectsNamespace returns whether the configuration applies to a namespace with the specified labels.
+func (c *ClusterAgentConfig) SelectsNamespace(namespaceLabels map[string]string) (bool, error) {
+	return selectsNamespace(c.Spec.NamespaceSelector, namespaceLabels)
+}
+
+// GetPriority returns the priority of the configuration.
+func (c *ClusterAgentConfig) GetPriority() int32 {
+	return c.Spec.Priority
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterAgentConfigList contains a list of ClusterAgentConfig values.
+type ClusterAgentConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterAgentConfig `json:"items"`
+}
+
+func init() {
+	objectTypes = append(objectTypes, &ClusterAgentConfig{}, &ClusterAgentConfigList{})
+}
@@ -0,0 +1,62 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KindClusterPorterConfig represents ClusterPorterConfig kind value.
+const KindClusterPorterConfig = "ClusterPorterConfig"
+
+// ClusterPorterConfigSpec defines the Porter configuration
+// that is applied to the namespaces selected by the configuration.
+type ClusterPorterConfigSpec struct {
+	// NamespaceSelector selects the namespaces that use this configuration.
+	// All namespaces are selected when it is not set.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// Priority determines the order in which the configurations that select the same namespace are applied.
+	// A configuration with a higher priority overrides the values from a configuration with a lower priority.
+	// Configurations with the same priority are applied in alphabetical order of their name.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	PorterConfigSpec `json:",inline"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Priority",type="integer",JSONPath=".spec.priority"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ClusterPorterConfig is the Schema for the clusterporterconfigs API.
+// It defines default PorterConfig values for the namespaces that it selects.
+type ClusterPorterConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ClusterPorterConfigSpec `json:"spec,omitempty"`
+}
+
+// SelectsNamespace returns whether the configuration applies to a namespace with the specified labels.
+func (c *ClusterPorterConfig) SelectsNamespace(namespaceLabels map[string]string) (bool, error) {
+	return selectsNamespace(c.Spec.NamespaceSelector, namespaceLabels)
+}
+
+// GetPriority returns the priority of the configuration.
+func (c *ClusterPorterConfig) GetPriority() int32 {
+	return c.Spec.Priority
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterPorterConfigList contains a list of ClusterPorterConfig values.
+type ClusterPorterConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterPorterConfig `json:"items"`
+}
+
+func init() {
+	objectTypes = append(objectTypes, &ClusterPorterConfig{}, &ClusterPorterConfigList{})
+}
@@ -0,0 +1,189 @@
+package v1
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ConfigLayer is the spec of a configuration resource at one level of the configuration hierarchy,
+// for example the AgentConfig defined at the system or namespace level.
+// +kubebuilder:object:generate=false
+type ConfigLayer struct {
+	// Source identifies the level that supplied the configuration, and is recorded
+	// for each field of the merged configuration that it supplies.
+	Source string
+
+	// Spec is the json representation of the resource spec.
+	// A field that is explicitly set to null removes the value defined by a less specific layer.
+	Spec map[string]interface{}
+}
+
+// NewConfigLayer creates a ConfigLayer from a typed spec.
+func NewConfigLayer(source string, spec interface{}) (ConfigLayer, error) {
+	layer := ConfigLayer{Source: source}
+	if err := roundTripJSON(spec, &layer.Spec); err != nil {
+		return ConfigLayer{}, errors.Wrapf(err, "error converting the %s configuration", source)
+	}
+	return layer, nil
+}
+
+// mergeSpecs deep merges typed specs, from the least to the most specific, into out. See mergeConfigLayers.
+func mergeSpecs(out interface{}, specs ...interface{}) error {
+	layers := make([]ConfigLayer, 0, len(specs))
+	for i, spec := range specs {
+		layer, err := NewConfigLayer(fmt.Sprintf("override %d", i), spec)
+		if err != nil {
+			return err
+		}
+		layers = append(layers, layer)
+	}
+
+	_, err := mergeConfigLayers(out, layers...)
+	return err
+}
+
+// ConfigSources records the layer that supplied each field of a merged configuration,
+// keyed by the path to the field. Items in a list that is merged by name are identified by
+// their name in the path, for example storage[mongodb].config.url.
+type ConfigSources map[string]string
+
+// mergeConfigLayers deep merges the layers, from the least to the most specific, into out:
+//   - Maps are merged key by key.
+//   - Lists of objects that all have a name are merged by name.
+//   - Other values, including the other lists, are replaced.
+//   - A null value removes the value from the less specific layers.
+func mergeConfigLayers(out interface{}, layers ...ConfigLayer) (ConfigSources, error) {
+	merged := map[string]interface{}{}
+	sources := ConfigSources{}
+	for _, layer := range layers {
+		mergeConfigMap(merged, layer.Spec, "", layer.Source, sources)
+	}
+
+	if err := roundTripJSON(merged, out); err != nil {
+		return nil, errors.Wrap(err, "error converting the merged configuration")
+	}
+	return sources, nil
+}
+
+func mergeConfigMap(target map[string]interface{}, override map[string]interface{}, path string, source string, sources ConfigSources) {
+	for key, value := range override {
+		fieldPath := key
+		if path != "" {
+			fieldPath = path + "." + key
+		}
+		mergeConfigValue(target, key, value, fieldPath, source, sources)
+	}
+}
+
+func mergeConfigValue(target map[string]interface{}, key string, value interface{}, path string, source string, sources ConfigSources) {
+	if value == nil {
+		delete(target, key)
+		sources.clear(path)
+		return
+	}
+
+	switch override := value.(type) {
+	case map[string]interface{}:
+		existing, ok := target[key].(map[string]interface{})
+		if !ok {
+			sources.clear(path)
+			existing = make(map[string]interface{}, len(override))
+			if len(override) == 0 {
+				// An empty object is meaningful, for example a plugin that uses the default settings
+				sources[path] = source
+			}
+		}
+		mergeConfigMap(existing, override, path, source, sources)
+		target[key] = existing
+	case []interface{}:
+		existing, ok := target[key].([]interface{})
+		if ok && isNamedList(existing) && isNamedList(override) {
+			target[key] = mergeNamedList(existing, override, path, source, sources)
+			return
+		}
+		if !ok && isNamedList(override) && len(override) > 0 {
+			sources.clear(path)
+			target[key] = mergeNamedList(nil, override, path, source, sources)
+			return
+		}
+		sources.clear(path)
+		target[key] = override
+		sources[path] = source
+	default:
+		sources.clear(path)
+		target[key] = override
+		sources[path] = source
+	}
+}
+
+// mergeNamedList merges the items of two lists by name. The items that are only in
+// the target keep their order, and the new items are appended in the order of the override.
+func mergeNamedList(target []interface{}, override []interface{}, path string, source string, sources ConfigSources) []interface{} {
+	result := make([]interface{}, 0, len(target)+len(override))
+	index := make(map[string]int, len(target))
+	for _, item := range target {
+		index[item.(map[string]interface{})["name"].(string)] = len(result)
+		result = append(result, item)
+	}
+
+	for _, item := range override {
+		overrideItem := item.(map[string]interface{})
+		name := overrideItem["name"].(string)
+		itemPath := fmt.Sprintf("%s[%s]", path, name)
+		if i, ok := index[name]; ok {
+			existing := result[i].(map[string]interface{})
+			mergeConfigMap(existing, overrideItem, itemPath, source, sources)
+			continue
+		}
+
+		newItem := make(map[string]interface{}, len(overrideItem))
+		mergeConfigMap(newItem, overrideItem, itemPath, source, sources)
+		index[name] = len(result)
+		result = append(result, newItem)
+	}
+	return result
+}
+
+// isNamedList determines if every item in a list is an object with a name.
+func isNamedList(items []interface{}) bool {
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := obj["name"].(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// clear removes the source of a field and of all of its nested fields.
+func (s ConfigSources) clear(path string) {
+	for key := range s {
+		if key == path || strings.HasPrefix(key, path+".") || strings.HasPrefix(key, path+"[") {
+			delete(s, key)
+		}
+	}
+}
+
+// String lists the sources sorted by path.
+func (s ConfigSources) String() string {
+	paths := make([]string, 0, len(s))
+	for path := range s {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	for i, path := range paths {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s=%s", path, s[path])
+	}
+	return b.String()
+}
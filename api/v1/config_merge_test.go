@@ -0,0 +1,125 @@
+package v1
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func parseConfigLayer(t *testing.T, source string, spec string) ConfigLayer {
+	layer := ConfigLayer{Source: source}
+	require.NoError(t, json.Unmarshal([]byte(spec), &layer.Spec))
+	return layer
+}
+
+func TestMergePorterConfigLayers(t *testing.T) {
+	system := parseConfigLayer(t, "system", `{
+		"verbosity": "info",
+		"default-secrets": "vault",
+		"secrets": [
+			{"name": "vault", "plugin": "hashicorp.vault", "config": {"vault_addr": "https://vault", "path_prefix": "porter"}},
+			{"name": "keyvault", "plugin": "azure.keyvault", "config": {"vault": "mykeyvault"}}
+		],
+		"experimental": ["build-drivers", "structured-logs"]
+	}`)
+	namespace := parseConfigLayer(t, "namespace", `{
+		"secrets": [
+			{"name": "vault", "config": {"path_prefix": "team-blue"}},
+			{"name": "k8s", "plugin": "kubernetes.secrets"}
+		],
+		"experimental": ["dependencies-v2"]
+	}`)
+	instance := parseConfigLayer(t, "instance", `{
+		"verbosity": "debug",
+		"default-secrets": null
+	}`)
+
+	cfg, sources, err := MergePorterConfigLayers(system, namespace, instance)
+	require.NoError(t, err)
+
+	assert.Equal(t, ptr.To("debug"), cfg.Verbosity)
+	assert.Nil(t, cfg.DefaultSecrets, "a null value should remove the value from a less specific layer")
+	assert.Equal(t, []string{"dependencies-v2"}, cfg.Experimental, "lists without names should be replaced")
+
+	require.Len(t, cfg.Secrets, 3, "the secrets should be merged by name")
+	assert.Equal(t, "vault", cfg.Secrets[0].Name)
+	assert.Equal(t, "hashicorp.vault", cfg.Secrets[0].PluginSubKey)
+	assert.JSONEq(t, `{"vault_addr": "https://vault", "path_prefix": "team-blue"}`, string(cfg.Secrets[0].Config.Raw),
+		"the plugin config should be merged key by key")
+	assert.Equal(t, "keyvault", cfg.Secrets[1].Name)
+	assert.Equal(t, "k8s", cfg.Secrets[2].Name)
+
+	wantSources := ConfigSources{
+		"verbosity":                         "instance",
+		"secrets[vault].name":               "namespace",
+		"secrets[vault].plugin":             "system",
+		"secrets[vault].config.vault_addr":  "system",
+		"secrets[vault].config.path_prefix": "namespace",
+		"secrets[keyvault].name":            "system",
+		"secrets[keyvault].plugin":          "system",
+		"secrets[keyvault].config.vault":    "system",
+		"secrets[k8s].name":                 "namespace",
+		"secrets[k8s].plugin":               "namespace",
+		"experimental":                      "namespace",
+	}
+	assert.Equal(t, wantSources, sources)
+}
+
+func TestMergeAgentConfigLayers(t *testing.T) {
+	system := parseConfigLayer(t, "system", `{
+		"porterVersion": "v1.0.0",
+		"imagePullSecrets": [{"name": "registry-a"}],
+		"pluginConfigFile": {"schemaVersion": "1.0.0", "plugins": {"kubernetes": {"version": "v1.0.0"}}},
+		"podTemplate": {"labels": {"team": "platform", "tier": "tools"}, "tolerations": [{"key": "tooling", "operator": "Exists"}]}
+	}`)
+	namespace := parseConfigLayer(t, "namespace", `{
+		"imagePullSecrets": [{"name": "registry-b"}],
+		"pluginConfigFile": {"plugins": {"azure": {}}},
+		"podTemplate": {"labels": {"tier": null}}
+	}`)
+	instance := parseConfigLayer(t, "instance", `{
+		"porterVersion": "v1.1.0",
+		"podTemplate": {"tolerations": null}
+	}`)
+
+	cfg, sources, err := MergeAgentConfigLayers(system, namespace, instance)
+	require.NoError(t, err)
+
+	assert.Equal(t, "v1.1.0", cfg.PorterVersion)
+	require.Len(t, cfg.ImagePullSecrets, 2, "the image pull secrets should be merged by name")
+	assert.Equal(t, "registry-a", cfg.ImagePullSecrets[0].Name)
+	assert.Equal(t, "registry-b", cfg.ImagePullSecrets[1].Name)
+	require.NotNil(t, cfg.PluginConfigFile)
+	assert.Equal(t, "1.0.0", cfg.PluginConfigFile.SchemaVersion)
+	assert.Equal(t, map[string]Plugin{"kubernetes": {Version: "v1.0.0"}, "azure": {}}, cfg.PluginConfigFile.Plugins,
+		"the plugins should be merged key by key")
+	require.NotNil(t, cfg.PodTemplate)
+	assert.Equal(t, map[string]string{"team": "platform"}, cfg.PodTemplate.Labels, "a null label should remove the label")
+	assert.Empty(t, cfg.PodTemplate.Tolerations, "null tolerations should remove the tolerations")
+
+	assert.Equal(t, "instance", sources["porterVersion"])
+	assert.Equal(t, "system", sources["pluginConfigFile.plugins.kubernetes.version"])
+	assert.Equal(t, "namespace", sources["pluginConfigFile.plugins.azure"])
+	assert.Equal(t, "system", sources["podTemplate.labels.team"])
+	assert.NotContains(t, sources, "podTemplate.labels.tier")
+	assert.NotContains(t, sources, "podTemplate.tolerations")
+}
+
+func TestMergeConfigLayers_DoesNotModifyLayers(t *testing.T) {
+	system := parseConfigLayer(t, "system", `{"podTemplate": {"labels": {"team": "platform"}}}`)
+	namespace := parseConfigLayer(t, "namespace", `{"podTemplate": {"labels": {"team": "blue"}}}`)
+
+	_, _, err := MergeAgentConfigLayers(system, namespace)
+	require.NoError(t, err)
+
+	labels := system.Spec["podTemplate"].(map[string]interface{})["labels"].(map[string]interface{})
+	assert.Equal(t, "platform", labels["team"])
+}
+
+func TestConfigSources_String(t *testing.T) {
+	sources := ConfigSources{"verbosity": "instance", "default-storage": "system"}
+	assert.Equal(t, "default-storage=system, verbosity=instance", sources.String())
+}
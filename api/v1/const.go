@@ -36,12 +36,20 @@ const (
 	// Porter Agent.
 	SecretTypeWorkdir = "workdir"
 
+	// SecretTypeImagePullSecret is the value of the secret type label applied to the
+	// secret that contains the merged docker config used to pull images for the Porter Agent and bundles.
+	SecretTypeImagePullSecret = "image-pull-secret"
+
 	// LabelManaged is a label applied to resources created by the Porter
 	// Operator.
 	LabelManaged = Prefix + "managed"
 
 	LabelPluginsHash = Prefix + "plugins-hash"
 
+	// LabelPluginCache is a label applied to the AgentConfig that installs a shared plugin cache in the operator
+	// namespace, and to the volumes that make the cache available in other namespaces.
+	LabelPluginCache = Prefix + "plugin-cache"
+
 	// LabelResourceKind is a label applied to resources created by the Porter
 	// Operator, representing the kind of owning resource. It is used to help the
 	// operator determine if a resource has already been created.
@@ -63,6 +71,11 @@ const (
 	// Porter Operator, representing the retry attempt identifier.
 	LabelRetry = Prefix + "retry"
 
+	// LabelReapply is a label applied to the agent actions of an Installation,
+	// counting the times that the generation of the installation was applied
+	// again because a credential or parameter set that it uses was updated.
+	LabelReapply = Prefix + "reapply"
+
 	// FinalizerName is the name of the finalizer applied to Porter Operator
 	// resources that should be reconciled by the operator before allowing it to
 	// be deleted.
@@ -107,4 +120,8 @@ const (
 	// VolumePorterPluginsPath is the mount path of the volume containing Porter's
 	// config file.
 	VolumePorterPluginsPath = "/app/.porter/plugins"
+
+	// VolumePorterSourcesPath is the mount path of the volumes containing the
+	// files of credential and parameter sources resolved by the operator.
+	VolumePorterSourcesPath = "/porter-sources"
 )
@@ -17,7 +17,7 @@ type Credential struct {
 	Name string `json:"name" yaml:"name"`
 
 	//Source is the bundle credential source
-	//supported: secret
+	//supported: secret, secretKeyRef
 	//unsupported: file path(via configMap), specific value, env var, shell cmd
 	Source CredentialSource `json:"source" yaml:"source"`
 }
@@ -26,6 +26,33 @@ type Credential struct {
 type CredentialSource struct {
 	//Secret is a credential source using a secret plugin
 	Secret string `json:"secret,omitempty" yaml:"secret,omitempty"`
+
+	// SecretKeyRef is a credential source using a key of a Kubernetes Secret in the namespace of the CredentialSet.
+	// It is resolved by the operator instead of a secret plugin, and passed to the Porter Agent of the installations
+	// that use the credential set as an environment variable.
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty" yaml:"-"`
+}
+
+// Validate checks that the credential source has exactly one source.
+func (s CredentialSource) Validate() error {
+	if (s.Secret == "") == (s.SecretKeyRef == nil) {
+		return errors.New("exactly one of secret or secretKeyRef must be set")
+	}
+	if s.SecretKeyRef != nil && (s.SecretKeyRef.Name == "" || s.SecretKeyRef.Key == "") {
+		return errors.New("secretKeyRef requires a name and a key")
+	}
+	return nil
+}
+
+// MarshalYAML converts a credential source resolved by the operator into the environment variable source that Porter reads it from.
+func (s CredentialSource) MarshalYAML() (interface{}, error) {
+	if s.SecretKeyRef != nil {
+		return map[string]string{"env": GetSecretKeyRefEnvName(*s.SecretKeyRef)}, nil
+	}
+
+	type Alias CredentialSource
+	return Alias(s), nil
 }
 
 // CredentialSetSpec defines the desired state of CredentialSet
@@ -34,6 +61,10 @@ type CredentialSetSpec struct {
 	// +optional
 	AgentConfig *corev1.LocalObjectReference `json:"agentConfig,omitempty" yaml:"-"`
 
+	// PorterConfig is the name of a PorterConfig to apply on top of the PorterConfig defined at the namespace or system level.
+	// +optional
+	PorterConfig *corev1.LocalObjectReference `json:"porterConfig,omitempty" yaml:"-"`
+
 	//
 	// These are fields from the Porter credential set resource.
 	// Your goal is that someone can copy/paste a resource from Porter into the
@@ -53,6 +84,17 @@ type CredentialSetSpec struct {
 	Credentials []Credential `json:"credentials" yaml:"credentials"`
 }
 
+// GetSecretKeyRefs returns the Kubernetes Secret keys that the credentials are resolved from by the operator.
+func (cs CredentialSetSpec) GetSecretKeyRefs() []corev1.SecretKeySelector {
+	var refs []corev1.SecretKeySelector
+	for _, cred := range cs.Credentials {
+		if cred.Source.SecretKeyRef != nil {
+			refs = append(refs, *cred.Source.SecretKeyRef)
+		}
+	}
+	return refs
+}
+
 func (cs CredentialSetSpec) ToPorterDocument() ([]byte, error) {
 	b, err := yaml.Marshal(cs)
 	return b, errors.Wrap(err, "error converting the CredentialSet spec into its Porter resource representation")
@@ -103,3 +103,48 @@ func TestCredentialSet_SetRetryAnnotation(t *testing.T) {
 		})
 	}
 }
+
+func TestCredentialSource_Validate(t *testing.T) {
+	ref := &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "db"}, Key: "password"}
+	testcases := []struct {
+		name    string
+		source  CredentialSource
+		wantErr string
+	}{
+		{name: "secret", source: CredentialSource{Secret: "password"}},
+		{name: "secretKeyRef", source: CredentialSource{SecretKeyRef: ref}},
+		{name: "no source", source: CredentialSource{}, wantErr: "exactly one of secret or secretKeyRef must be set"},
+		{name: "both sources", source: CredentialSource{Secret: "password", SecretKeyRef: ref}, wantErr: "exactly one of secret or secretKeyRef must be set"},
+		{name: "missing key", source: CredentialSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "db"}}}, wantErr: "secretKeyRef requires a name and a key"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.source.Validate()
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCredentialSetSpec_ToPorterDocument_SecretKeyRef(t *testing.T) {
+	ref := corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "db"}, Key: "password"}
+	cs := CredentialSetSpec{
+		SchemaVersion: string(storage.DefaultCredentialSetSchemaVersion),
+		Name:          "porter-test-me",
+		Namespace:     "dev",
+		Credentials: []Credential{
+			{Name: "password", Source: CredentialSource{SecretKeyRef: &ref}},
+			{Name: "token", Source: CredentialSource{Secret: "token"}},
+		},
+	}
+
+	got, err := cs.ToPorterDocument()
+	require.NoError(t, err)
+	assert.Contains(t, string(got), "env: "+GetSecretKeyRefEnvName(ref), "the operator should pass the key of the secret to porter in an environment variable")
+	assert.Contains(t, string(got), "secret: token")
+	assert.NotContains(t, string(got), "secretKeyRef")
+	assert.Equal(t, []corev1.SecretKeySelector{ref}, cs.GetSecretKeyRefs())
+}
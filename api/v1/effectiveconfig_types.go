@@ -0,0 +1,72 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// KindEffectiveConfig represents EffectiveConfig kind value.
+	KindEffectiveConfig = "EffectiveConfig"
+
+	// EffectiveConfigName is the name of the EffectiveConfig that the operator maintains in each namespace.
+	EffectiveConfigName = "default"
+)
+
+// EffectiveConfigStatus is the configuration that is used by default for the resources in a namespace,
+// resolved from the cluster, system and namespace level configuration.
+type EffectiveConfigStatus struct {
+	// AgentConfig is the resolved agent configuration.
+	// +optional
+	AgentConfig *AgentConfigSpec `json:"agentConfig,omitempty"`
+
+	// AgentConfigSources records the configuration layer that supplied each field of the resolved agent configuration,
+	// keyed by the path to the field.
+	// +optional
+	AgentConfigSources ConfigSources `json:"agentConfigSources,omitempty"`
+
+	// ActivePlugins are the plugins that the Porter Agent uses instead of the plugins of the resolved agent configuration,
+	// which are not installed yet, or failed to install. It is only set while the Porter Agent uses them.
+	// +optional
+	ActivePlugins *ActivePlugins `json:"activePlugins,omitempty"`
+
+	// PorterConfig is the resolved porter configuration, with sensitive values redacted.
+	// +optional
+	PorterConfig *PorterConfigSpec `json:"porterConfig,omitempty"`
+
+	// PorterConfigSources records the configuration layer that supplied each field of the resolved porter configuration,
+	// keyed by the path to the field.
+	// +optional
+	PorterConfigSources ConfigSources `json:"porterConfigSources,omitempty"`
+
+	// LastUpdated is when the configuration was last resolved.
+	// +optional
+	LastUpdated *metav1.Time `json:"lastUpdated,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Last Updated",type="date",JSONPath=".status.lastUpdated"
+
+// EffectiveConfig is the Schema for the effectiveconfigs API.
+// It is a read-only view of the configuration that is used by default in a namespace, which
+// is maintained by the operator and updated when any layer of configuration changes.
+// Resources that reference an AgentConfig or PorterConfig merge it on top of this configuration.
+type EffectiveConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status EffectiveConfigStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EffectiveConfigList contains a list of EffectiveConfig values.
+type EffectiveConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EffectiveConfig `json:"items"`
+}
+
+func init() {
+	objectTypes = append(objectTypes, &EffectiveConfig{}, &EffectiveConfigList{})
+}
@@ -13,6 +13,26 @@ import (
 const (
 	Prefix          = "getporter.org/"
 	AnnotationRetry = Prefix + "retry"
+
+	// AnnotationSetGenerations is an annotation on the agent action of an Installation that records
+	// the generation of each credential and parameter set that was used, as a comma separated list of KIND/NAME=GENERATION.
+	AnnotationSetGenerations = Prefix + "set-generations"
+
+	// AnnotationReapplyCause is an annotation on the agent action of an Installation that records
+	// why the installation was applied again without a change to its spec.
+	AnnotationReapplyCause = Prefix + "reapply-cause"
+)
+
+// SetChangePolicy determines what happens to an Installation when a credential or parameter set that it uses is updated.
+// +kubebuilder:validation:Enum=Reapply;Ignore
+type SetChangePolicy string
+
+const (
+	// SetChangePolicyReapply applies the installation again once the updated set is applied to Porter.
+	SetChangePolicyReapply SetChangePolicy = "Reapply"
+
+	// SetChangePolicyIgnore keeps the installation as is, the change is used by the next run of the installation.
+	SetChangePolicyIgnore SetChangePolicy = "Ignore"
 )
 
 // We marshal installation spec to yaml when converting to a porter object
@@ -28,6 +48,10 @@ type InstallationSpec struct {
 	// +optional
 	AgentConfig *corev1.LocalObjectReference `json:"agentConfig,omitempty" yaml:"-"`
 
+	// PorterConfig is the name of a PorterConfig to apply on top of the PorterConfig defined at the namespace or system level.
+	// +optional
+	PorterConfig *corev1.LocalObjectReference `json:"porterConfig,omitempty" yaml:"-"`
+
 	//
 	// These are fields from the Porter installation resource.
 	// Your goal is that someone can copy/paste a resource from Porter into the
@@ -62,6 +86,20 @@ type InstallationSpec struct {
 
 	// ParameterSets that should be included when the bundle is reconciled.
 	ParameterSets []string `json:"parameterSets,omitempty" yaml:"parameterSets,omitempty"`
+
+	// SetChangePolicy determines if the installation is applied again when one of its CredentialSets or ParameterSets is updated.
+	// Defaults to Reapply.
+	// +optional
+	SetChangePolicy SetChangePolicy `json:"setChangePolicy,omitempty" yaml:"-"`
+}
+
+// GetSetChangePolicy returns the policy for changes to the credential and parameter sets of the installation,
+// defaulting to Reapply.
+func (in InstallationSpec) GetSetChangePolicy() SetChangePolicy {
+	if in.SetChangePolicy == "" {
+		return SetChangePolicyReapply
+	}
+	return in.SetChangePolicy
 }
 
 type OCIReferenceParts struct {
@@ -107,6 +145,49 @@ func (in InstallationSpec) MarshalYAML() (interface{}, error) {
 // InstallationStatus defines the observed state of Installation
 type InstallationStatus struct {
 	PorterResourceStatus `json:",inline"`
+
+	// Porter is the status of the installation as recorded by Porter after the most recent run.
+	// +optional
+	Porter *PorterInstallationStatus `json:"porter,omitempty"`
+}
+
+// PorterInstallationStatus is the status of an installation as recorded by Porter.
+type PorterInstallationStatus struct {
+	// InstallationID is the identifier Porter assigned to the installation.
+	InstallationID string `json:"installationID,omitempty"`
+
+	// RunID is the identifier of the most recent run of the installation.
+	RunID string `json:"runID,omitempty"`
+
+	// Action is the name of the bundle action executed by the most recent run, for example install or upgrade.
+	Action string `json:"action,omitempty"`
+
+	// ResultID is the identifier of the result of the most recent run.
+	ResultID string `json:"resultID,omitempty"`
+
+	// ResultStatus is the status of the most recent run, for example succeeded or failed.
+	ResultStatus string `json:"resultStatus,omitempty"`
+
+	// BundleReference is the OCI reference of the installed bundle.
+	BundleReference string `json:"bundleReference,omitempty"`
+
+	// BundleVersion is the version of the installed bundle.
+	BundleVersion string `json:"bundleVersion,omitempty"`
+
+	// BundleDigest is the digest of the installed bundle.
+	BundleDigest string `json:"bundleDigest,omitempty"`
+
+	// Created is when Porter created the installation.
+	Created *metav1.Time `json:"created,omitempty"`
+
+	// Modified is when Porter last modified the installation.
+	Modified *metav1.Time `json:"modified,omitempty"`
+
+	// Installed is when the bundle was installed.
+	Installed *metav1.Time `json:"installed,omitempty"`
+
+	// Uninstalled is when the bundle was uninstalled.
+	Uninstalled *metav1.Time `json:"uninstalled,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -117,6 +198,9 @@ type InstallationStatus struct {
 // +kubebuilder:printcolumn:name="Porter Namespace",type="string",JSONPath=".spec.namespace"
 // +kubebuilder:printcolumn:name="Last Action",type="string",JSONPath=".status.action.name"
 // +kubebuilder:printcolumn:name="Last Status",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Porter Action",type="string",JSONPath=".status.porter.action"
+// +kubebuilder:printcolumn:name="Porter Status",type="string",JSONPath=".status.porter.resultStatus"
+// +kubebuilder:printcolumn:name="Bundle",type="string",JSONPath=".status.porter.bundleReference",priority=1
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 type Installation struct {
 	metav1.TypeMeta   `json:",inline"`
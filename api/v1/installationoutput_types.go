@@ -2,18 +2,52 @@ package v1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 const (
 	InstallationOutputSucceeded  = "InstallationOutputSucceeded"
 	AnnotationInstallationOutput = Prefix + "installationoutput"
+
+	// InstallationOutputPorterConnected is a condition indicating whether the
+	// operator can reach the Porter gRPC server to sync outputs.
+	InstallationOutputPorterConnected = "PorterConnected"
 )
 
+const (
+	// OutputEncodingBase64 is the encoding of a file output value that is not
+	// valid UTF-8 text.
+	OutputEncodingBase64 = "base64"
+)
+
+// Output is a single output value of an installation, as reported by Porter.
 type Output struct {
-	Name      string `json:"name"`
-	Type      string `json:"type"`
-	Sensitive bool   `json:"sensitive"`
-	Value     string `json:"value"`
+	// Name of the output.
+	Name string `json:"name"`
+
+	// Type is the type of the output declared by the bundle, for example
+	// string, number, integer, boolean, object, array or file.
+	Type string `json:"type"`
+
+	// Sensitive indicates if the output value is sensitive.
+	Sensitive bool `json:"sensitive"`
+
+	// Value is the text representation of the output.
+	// Numbers and booleans are formatted as text, objects and arrays as compact json,
+	// and file outputs contain the file contents.
+	Value string `json:"value"`
+
+	// JSONValue is the output value as json, with the type returned by Porter preserved.
+	// It is only set for outputs that are not strings, such as numbers, booleans, objects and arrays.
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	JSONValue *runtime.RawExtension `json:"jsonValue,omitempty"`
+
+	// Encoding of Value when it is not plain text. A file output that is not valid UTF-8
+	// is base64 encoded.
+	// +optional
+	Encoding string `json:"encoding,omitempty"`
 }
 
 // InstallationOutputSpec defines the desired state of InstallationOutput
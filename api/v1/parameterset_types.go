@@ -17,8 +17,8 @@ type Parameter struct {
 	Name string `json:"name" yaml:"name"`
 
 	//Source is the bundle parameter source
-	//supported: secret, value
-	//unsupported: file path(via configMap), env var, shell cmd
+	//supported: secret, value, env, configMapKeyRef, fileFromConfigMap
+	//unsupported: shell cmd
 	Source ParameterSource `json:"source" yaml:"source"`
 }
 
@@ -27,6 +27,55 @@ type ParameterSource struct {
 	Secret string `json:"secret,omitempty" yaml:"secret,omitempty"`
 	// Value is a paremeter source using plaintext value
 	Value string `json:"value,omitempty" yaml:"value,omitempty"`
+	// Env is a parameter source using an environment variable of the Porter Agent.
+	// +optional
+	Env string `json:"env,omitempty" yaml:"env,omitempty"`
+
+	// ConfigMapKeyRef is a parameter source using a key of a ConfigMap in the namespace of the ParameterSet.
+	// It is resolved by the operator, and passed to the Porter Agent of the installations
+	// that use the parameter set as an environment variable.
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty" yaml:"-"`
+
+	// FileFromConfigMap is a source for a file parameter using a key of a ConfigMap in the namespace of the ParameterSet.
+	// It is resolved by the operator, and mounted as a file in the Porter Agent of the installations
+	// that use the parameter set.
+	// +optional
+	FileFromConfigMap *corev1.ConfigMapKeySelector `json:"fileFromConfigMap,omitempty" yaml:"-"`
+}
+
+// Validate checks that the parameter source has at most one source.
+func (s ParameterSource) Validate() error {
+	count := 0
+	for _, set := range []bool{s.Secret != "", s.Value != "", s.Env != "", s.ConfigMapKeyRef != nil, s.FileFromConfigMap != nil} {
+		if set {
+			count++
+		}
+	}
+	if count > 1 {
+		return errors.New("only one of secret, value, env, configMapKeyRef or fileFromConfigMap may be set")
+	}
+	if s.ConfigMapKeyRef != nil && (s.ConfigMapKeyRef.Name == "" || s.ConfigMapKeyRef.Key == "") {
+		return errors.New("configMapKeyRef requires a name and a key")
+	}
+	if s.FileFromConfigMap != nil && (s.FileFromConfigMap.Name == "" || s.FileFromConfigMap.Key == "") {
+		return errors.New("fileFromConfigMap requires a name and a key")
+	}
+	return nil
+}
+
+// MarshalYAML converts a parameter source resolved by the operator into the environment variable or file source
+// that Porter reads it from.
+func (s ParameterSource) MarshalYAML() (interface{}, error) {
+	if s.ConfigMapKeyRef != nil {
+		return map[string]string{"env": GetConfigMapKeyRefEnvName(*s.ConfigMapKeyRef)}, nil
+	}
+	if s.FileFromConfigMap != nil {
+		return map[string]string{"path": GetFileFromConfigMapPath(*s.FileFromConfigMap)}, nil
+	}
+
+	type Alias ParameterSource
+	return Alias(s), nil
 }
 
 // ParameterSetSpec defines the desired state of ParameterSet
@@ -35,6 +84,10 @@ type ParameterSetSpec struct {
 	// +optional
 	AgentConfig *corev1.LocalObjectReference `json:"agentConfig,omitempty" yaml:"-"`
 
+	// PorterConfig is the name of a PorterConfig to apply on top of the PorterConfig defined at the namespace or system level.
+	// +optional
+	PorterConfig *corev1.LocalObjectReference `json:"porterConfig,omitempty" yaml:"-"`
+
 	//
 	// These are fields from the Porter parameter set resource.
 	// Your goal is that someone can copy/paste a resource from Porter into the
@@ -53,6 +106,21 @@ type ParameterSetSpec struct {
 	Parameters []Parameter `json:"parameters" yaml:"parameters"`
 }
 
+// GetConfigMapKeyRefs returns the ConfigMap keys that the parameters are resolved from by the operator,
+// either as an environment variable or as a file.
+func (ps ParameterSetSpec) GetConfigMapKeyRefs() []corev1.ConfigMapKeySelector {
+	var refs []corev1.ConfigMapKeySelector
+	for _, param := range ps.Parameters {
+		if param.Source.ConfigMapKeyRef != nil {
+			refs = append(refs, *param.Source.ConfigMapKeyRef)
+		}
+		if param.Source.FileFromConfigMap != nil {
+			refs = append(refs, *param.Source.FileFromConfigMap)
+		}
+	}
+	return refs
+}
+
 func (ps ParameterSetSpec) ToPorterDocument() ([]byte, error) {
 	b, err := yaml.Marshal(ps)
 	return b, errors.Wrap(err, "error converting the ParameterSet spec into its Porter resource representation")
@@ -108,3 +108,53 @@ func TestParameterSet_SetRetryAnnotation(t *testing.T) {
 		})
 	}
 }
+
+func TestParameterSource_Validate(t *testing.T) {
+	ref := &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}, Key: "region"}
+	testcases := []struct {
+		name    string
+		source  ParameterSource
+		wantErr string
+	}{
+		{name: "value", source: ParameterSource{Value: "eastus"}},
+		{name: "env", source: ParameterSource{Env: "REGION"}},
+		{name: "configMapKeyRef", source: ParameterSource{ConfigMapKeyRef: ref}},
+		{name: "fileFromConfigMap", source: ParameterSource{FileFromConfigMap: ref}},
+		{name: "multiple sources", source: ParameterSource{Value: "eastus", ConfigMapKeyRef: ref}, wantErr: "only one of secret, value, env, configMapKeyRef or fileFromConfigMap may be set"},
+		{name: "missing key", source: ParameterSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}}}, wantErr: "configMapKeyRef requires a name and a key"},
+		{name: "missing file name", source: ParameterSource{FileFromConfigMap: &corev1.ConfigMapKeySelector{Key: "region"}}, wantErr: "fileFromConfigMap requires a name and a key"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.source.Validate()
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestParameterSetSpec_ToPorterDocument_ConfigMapSources(t *testing.T) {
+	valueRef := corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}, Key: "region"}
+	fileRef := corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}, Key: "kubeconfig"}
+	ps := ParameterSetSpec{
+		SchemaVersion: string(storage.DefaultParameterSetSchemaVersion),
+		Name:          "porter-test-me",
+		Namespace:     "dev",
+		Parameters: []Parameter{
+			{Name: "region", Source: ParameterSource{ConfigMapKeyRef: &valueRef}},
+			{Name: "kubeconfig", Source: ParameterSource{FileFromConfigMap: &fileRef}},
+			{Name: "token", Source: ParameterSource{Env: "TOKEN"}},
+		},
+	}
+
+	got, err := ps.ToPorterDocument()
+	require.NoError(t, err)
+	assert.Contains(t, string(got), "env: "+GetConfigMapKeyRefEnvName(valueRef))
+	assert.Contains(t, string(got), "path: /porter-sources/configmaps/settings/kubeconfig")
+	assert.Contains(t, string(got), "env: TOKEN")
+	assert.NotContains(t, string(got), "configMapKeyRef")
+	assert.Equal(t, []corev1.ConfigMapKeySelector{valueRef, fileRef}, ps.GetConfigMapKeyRefs())
+}
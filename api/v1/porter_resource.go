@@ -3,9 +3,14 @@ package v1
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
 
+	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 type PorterResourceStatus struct {
@@ -48,3 +53,55 @@ func getRetryLabelValue(annotations map[string]string) string {
 	sum := md5.Sum([]byte(retry))
 	return hex.EncodeToString(sum[:])
 }
+
+// selectsNamespace returns whether the label selector of a cluster scoped configuration
+// matches a namespace with the specified labels. A nil selector matches all namespaces.
+func selectsNamespace(selector *metav1.LabelSelector, namespaceLabels map[string]string) (bool, error) {
+	if selector == nil {
+		return true, nil
+	}
+
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, errors.Wrap(err, "invalid namespace selector")
+	}
+	return s.Matches(labels.Set(namespaceLabels)), nil
+}
+
+// GetSecretKeyRefEnvName returns the name of the environment variable that the operator sets on the Porter Agent
+// with the value of a key of a Kubernetes Secret, so that Porter can read it with an env source.
+func GetSecretKeyRefEnvName(ref corev1.SecretKeySelector) string {
+	return getSourceEnvName("PORTER_SECRET", ref.Name, ref.Key)
+}
+
+// GetConfigMapKeyRefEnvName returns the name of the environment variable that the operator sets on the Porter Agent
+// with the value of a key of a ConfigMap, so that Porter can read it with an env source.
+func GetConfigMapKeyRefEnvName(ref corev1.ConfigMapKeySelector) string {
+	return getSourceEnvName("PORTER_CONFIGMAP", ref.Name, ref.Key)
+}
+
+// GetFileFromConfigMapPath returns the path of the file where the operator mounts a key of a ConfigMap
+// in the Porter Agent, so that Porter can read it with a path source.
+func GetFileFromConfigMapPath(ref corev1.ConfigMapKeySelector) string {
+	return path.Join(GetConfigMapSourcePath(ref.Name), ref.Key)
+}
+
+// GetConfigMapSourcePath returns the directory where the operator mounts the keys of a ConfigMap in the Porter Agent.
+func GetConfigMapSourcePath(name string) string {
+	return path.Join(VolumePorterSourcesPath, "configmaps", name)
+}
+
+// getSourceEnvName returns a valid environment variable name for a key of a Kubernetes resource.
+// The readable part of the name may collide once sanitized, so it ends with a hash of the resource and key.
+func getSourceEnvName(prefix string, name string, key string) string {
+	sanitize := func(value string) string {
+		return strings.Map(func(r rune) rune {
+			if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				return r
+			}
+			return '_'
+		}, strings.ToUpper(value))
+	}
+	sum := md5.Sum([]byte(name + "/" + key))
+	return fmt.Sprintf("%s_%s_%s_%s", prefix, sanitize(name), sanitize(key), strings.ToUpper(hex.EncodeToString(sum[:4])))
+}
@@ -4,6 +4,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestGetRetryLabelValue(t *testing.T) {
@@ -17,3 +20,35 @@ func TestGetRetryLabelValue(t *testing.T) {
 
 	assert.Empty(t, getRetryLabelValue(annotations), "retry label value should be empty when no annotation is set")
 }
+
+func TestGetSecretKeyRefEnvName(t *testing.T) {
+	newRef := func(name string, key string) corev1.SecretKeySelector {
+		return corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+	}
+
+	name := GetSecretKeyRefEnvName(newRef("my-db", "admin.password"))
+	assert.Regexp(t, `^PORTER_SECRET_MY_DB_ADMIN_PASSWORD_[0-9A-F]{8}$`, name, "the name should be a valid environment variable")
+	assert.Equal(t, name, GetSecretKeyRefEnvName(newRef("my-db", "admin.password")), "the name should be stable")
+	assert.NotEqual(t, name, GetSecretKeyRefEnvName(newRef("my.db", "admin-password")), "keys that sanitize to the same name should not collide")
+}
+
+func TestSelectsNamespace(t *testing.T) {
+	nsLabels := map[string]string{"team": "blue"}
+
+	ok, err := selectsNamespace(nil, nsLabels)
+	require.NoError(t, err)
+	assert.True(t, ok, "a nil selector should select all namespaces")
+
+	ok, err = selectsNamespace(&metav1.LabelSelector{MatchLabels: map[string]string{"team": "blue"}}, nsLabels)
+	require.NoError(t, err)
+	assert.True(t, ok, "a matching selector should select the namespace")
+
+	ok, err = selectsNamespace(&metav1.LabelSelector{MatchLabels: map[string]string{"team": "red"}}, nsLabels)
+	require.NoError(t, err)
+	assert.False(t, ok, "a selector that does not match should not select the namespace")
+
+	_, err = selectsNamespace(&metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+		{Key: "team", Operator: "Bogus"},
+	}}, nsLabels)
+	require.Error(t, err, "an invalid selector should return an error")
+}
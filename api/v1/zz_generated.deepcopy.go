@@ -10,6 +10,28 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ActivePlugins) DeepCopyInto(out *ActivePlugins) {
+	*out = *in
+	if in.Plugins != nil {
+		in, out := &in.Plugins, &out.Plugins
+		*out = make(map[string]Plugin, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ActivePlugins.
+func (in *ActivePlugins) DeepCopy() *ActivePlugins {
+	if in == nil {
+		return nil
+	}
+	out := new(ActivePlugins)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AgentAction) DeepCopyInto(out *AgentAction) {
 	*out = *in
@@ -77,6 +99,11 @@ func (in *AgentActionSpec) DeepCopyInto(out *AgentActionSpec) {
 		*out = new(corev1.LocalObjectReference)
 		**out = **in
 	}
+	if in.PorterConfig != nil {
+		in, out := &in.PorterConfig, &out.PorterConfig
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
 	if in.Command != nil {
 		in, out := &in.Command, &out.Command
 		*out = make([]string, len(*in))
@@ -158,6 +185,30 @@ func (in *AgentActionStatus) DeepCopyInto(out *AgentActionStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.AgentConfigSources != nil {
+		in, out := &in.AgentConfigSources, &out.AgentConfigSources
+		*out = make(ConfigSources, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.PorterConfigSources != nil {
+		in, out := &in.PorterConfigSources, &out.PorterConfigSources
+		*out = make(ConfigSources, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.EffectiveAgentConfig != nil {
+		in, out := &in.EffectiveAgentConfig, &out.EffectiveAgentConfig
+		*out = new(AgentConfigSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.EffectivePorterConfig != nil {
+		in, out := &in.EffectivePorterConfig, &out.EffectivePorterConfig
+		*out = new(PorterConfigSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentActionStatus.
@@ -170,6 +221,31 @@ func (in *AgentActionStatus) DeepCopy() *AgentActionStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AgentCleanupPolicy) DeepCopyInto(out *AgentCleanupPolicy) {
+	*out = *in
+	if in.DeleteOnSuccess != nil {
+		in, out := &in.DeleteOnSuccess, &out.DeleteOnSuccess
+		*out = new(bool)
+		**out = **in
+	}
+	if in.KeepOnFailure != nil {
+		in, out := &in.KeepOnFailure, &out.KeepOnFailure
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentCleanupPolicy.
+func (in *AgentCleanupPolicy) DeepCopy() *AgentCleanupPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(AgentCleanupPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AgentConfig) DeepCopyInto(out *AgentConfig) {
 	*out = *in
@@ -264,6 +340,33 @@ func (in *AgentConfigSpec) DeepCopyInto(out *AgentConfigSpec) {
 		*out = new(PluginFileSpec)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.PodTemplate != nil {
+		in, out := &in.PodTemplate, &out.PodTemplate
+		*out = new(AgentPodTemplate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.InstallerPodLabels != nil {
+		in, out := &in.InstallerPodLabels, &out.InstallerPodLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.CleanupPolicy != nil {
+		in, out := &in.CleanupPolicy, &out.CleanupPolicy
+		*out = new(AgentCleanupPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PluginDelivery != nil {
+		in, out := &in.PluginDelivery, &out.PluginDelivery
+		*out = new(PluginDelivery)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentConfigSpec.
@@ -297,6 +400,23 @@ func (in *AgentConfigSpecAdapter) DeepCopy() *AgentConfigSpecAdapter {
 func (in *AgentConfigStatus) DeepCopyInto(out *AgentConfigStatus) {
 	*out = *in
 	in.PorterResourceStatus.DeepCopyInto(&out.PorterResourceStatus)
+	if in.UnusedPluginVolumes != nil {
+		in, out := &in.UnusedPluginVolumes, &out.UnusedPluginVolumes
+		*out = make([]UnusedPluginVolume, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.InstalledPlugins != nil {
+		in, out := &in.InstalledPlugins, &out.InstalledPlugins
+		*out = make([]InstalledPlugin, len(*in))
+		copy(*out, *in)
+	}
+	if in.ActivePlugins != nil {
+		in, out := &in.ActivePlugins, &out.ActivePlugins
+		*out = new(ActivePlugins)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentConfigStatus.
@@ -309,10 +429,252 @@ func (in *AgentConfigStatus) DeepCopy() *AgentConfigStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AgentPodTemplate) DeepCopyInto(out *AgentPodTemplate) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(corev1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(corev1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecurityContext != nil {
+		in, out := &in.SecurityContext, &out.SecurityContext
+		*out = new(corev1.PodSecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ContainerSecurityContext != nil {
+		in, out := &in.ContainerSecurityContext, &out.ContainerSecurityContext
+		*out = new(corev1.SecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentPodTemplate.
+func (in *AgentPodTemplate) DeepCopy() *AgentPodTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(AgentPodTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterAgentConfig) DeepCopyInto(out *ClusterAgentConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAgentConfig.
+func (in *ClusterAgentConfig) DeepCopy() *ClusterAgentConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterAgentConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterAgentConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterAgentConfigList) DeepCopyInto(out *ClusterAgentConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterAgentConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAgentConfigList.
+func (in *ClusterAgentConfigList) DeepCopy() *ClusterAgentConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterAgentConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterAgentConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterAgentConfigSpec) DeepCopyInto(out *ClusterAgentConfigSpec) {
+	*out = *in
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	in.AgentConfigSpec.DeepCopyInto(&out.AgentConfigSpec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAgentConfigSpec.
+func (in *ClusterAgentConfigSpec) DeepCopy() *ClusterAgentConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterAgentConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPorterConfig) DeepCopyInto(out *ClusterPorterConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPorterConfig.
+func (in *ClusterPorterConfig) DeepCopy() *ClusterPorterConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPorterConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterPorterConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPorterConfigList) DeepCopyInto(out *ClusterPorterConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterPorterConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPorterConfigList.
+func (in *ClusterPorterConfigList) DeepCopy() *ClusterPorterConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPorterConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterPorterConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPorterConfigSpec) DeepCopyInto(out *ClusterPorterConfigSpec) {
+	*out = *in
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	in.PorterConfigSpec.DeepCopyInto(&out.PorterConfigSpec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPorterConfigSpec.
+func (in *ClusterPorterConfigSpec) DeepCopy() *ClusterPorterConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPorterConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in ConfigSources) DeepCopyInto(out *ConfigSources) {
+	{
+		in := &in
+		*out = make(ConfigSources, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigSources.
+func (in ConfigSources) DeepCopy() ConfigSources {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigSources)
+	in.DeepCopyInto(out)
+	return *out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Credential) DeepCopyInto(out *Credential) {
 	*out = *in
-	out.Source = in.Source
+	in.Source.DeepCopyInto(&out.Source)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Credential.
@@ -392,10 +754,17 @@ func (in *CredentialSetSpec) DeepCopyInto(out *CredentialSetSpec) {
 		*out = new(corev1.LocalObjectReference)
 		**out = **in
 	}
+	if in.PorterConfig != nil {
+		in, out := &in.PorterConfig, &out.PorterConfig
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
 	if in.Credentials != nil {
 		in, out := &in.Credentials, &out.Credentials
 		*out = make([]Credential, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 }
 
@@ -428,6 +797,11 @@ func (in *CredentialSetStatus) DeepCopy() *CredentialSetStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CredentialSource) DeepCopyInto(out *CredentialSource) {
 	*out = *in
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialSource.
@@ -440,6 +814,112 @@ func (in *CredentialSource) DeepCopy() *CredentialSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EffectiveConfig) DeepCopyInto(out *EffectiveConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EffectiveConfig.
+func (in *EffectiveConfig) DeepCopy() *EffectiveConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(EffectiveConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EffectiveConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EffectiveConfigList) DeepCopyInto(out *EffectiveConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]EffectiveConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EffectiveConfigList.
+func (in *EffectiveConfigList) DeepCopy() *EffectiveConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(EffectiveConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EffectiveConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EffectiveConfigStatus) DeepCopyInto(out *EffectiveConfigStatus) {
+	*out = *in
+	if in.AgentConfig != nil {
+		in, out := &in.AgentConfig, &out.AgentConfig
+		*out = new(AgentConfigSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AgentConfigSources != nil {
+		in, out := &in.AgentConfigSources, &out.AgentConfigSources
+		*out = make(ConfigSources, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ActivePlugins != nil {
+		in, out := &in.ActivePlugins, &out.ActivePlugins
+		*out = new(ActivePlugins)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PorterConfig != nil {
+		in, out := &in.PorterConfig, &out.PorterConfig
+		*out = new(PorterConfigSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PorterConfigSources != nil {
+		in, out := &in.PorterConfigSources, &out.PorterConfigSources
+		*out = make(ConfigSources, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.LastUpdated != nil {
+		in, out := &in.LastUpdated, &out.LastUpdated
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EffectiveConfigStatus.
+func (in *EffectiveConfigStatus) DeepCopy() *EffectiveConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(EffectiveConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Installation) DeepCopyInto(out *Installation) {
 	*out = *in
@@ -586,7 +1066,9 @@ func (in *InstallationOutputStatus) DeepCopyInto(out *InstallationOutputStatus)
 	if in.Outputs != nil {
 		in, out := &in.Outputs, &out.Outputs
 		*out = make([]Output, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 }
 
@@ -608,6 +1090,11 @@ func (in *InstallationSpec) DeepCopyInto(out *InstallationSpec) {
 		*out = new(corev1.LocalObjectReference)
 		**out = **in
 	}
+	if in.PorterConfig != nil {
+		in, out := &in.PorterConfig, &out.PorterConfig
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
 	out.Bundle = in.Bundle
 	if in.Labels != nil {
 		in, out := &in.Labels, &out.Labels
@@ -643,6 +1130,11 @@ func (in *InstallationSpec) DeepCopy() *InstallationSpec {
 func (in *InstallationStatus) DeepCopyInto(out *InstallationStatus) {
 	*out = *in
 	in.PorterResourceStatus.DeepCopyInto(&out.PorterResourceStatus)
+	if in.Porter != nil {
+		in, out := &in.Porter, &out.Porter
+		*out = new(PorterInstallationStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstallationStatus.
@@ -655,6 +1147,21 @@ func (in *InstallationStatus) DeepCopy() *InstallationStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InstalledPlugin) DeepCopyInto(out *InstalledPlugin) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstalledPlugin.
+func (in *InstalledPlugin) DeepCopy() *InstalledPlugin {
+	if in == nil {
+		return nil
+	}
+	out := new(InstalledPlugin)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OCIReferenceParts) DeepCopyInto(out *OCIReferenceParts) {
 	*out = *in
@@ -673,6 +1180,11 @@ func (in *OCIReferenceParts) DeepCopy() *OCIReferenceParts {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Output) DeepCopyInto(out *Output) {
 	*out = *in
+	if in.JSONValue != nil {
+		in, out := &in.JSONValue, &out.JSONValue
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Output.
@@ -688,7 +1200,7 @@ func (in *Output) DeepCopy() *Output {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Parameter) DeepCopyInto(out *Parameter) {
 	*out = *in
-	out.Source = in.Source
+	in.Source.DeepCopyInto(&out.Source)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Parameter.
@@ -768,10 +1280,17 @@ func (in *ParameterSetSpec) DeepCopyInto(out *ParameterSetSpec) {
 		*out = new(corev1.LocalObjectReference)
 		**out = **in
 	}
+	if in.PorterConfig != nil {
+		in, out := &in.PorterConfig, &out.PorterConfig
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
 	if in.Parameters != nil {
 		in, out := &in.Parameters, &out.Parameters
 		*out = make([]Parameter, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 }
 
@@ -804,6 +1323,16 @@ func (in *ParameterSetStatus) DeepCopy() *ParameterSetStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ParameterSource) DeepCopyInto(out *ParameterSource) {
 	*out = *in
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(corev1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FileFromConfigMap != nil {
+		in, out := &in.FileFromConfigMap, &out.FileFromConfigMap
+		*out = new(corev1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ParameterSource.
@@ -819,6 +1348,11 @@ func (in *ParameterSource) DeepCopy() *ParameterSource {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Plugin) DeepCopyInto(out *Plugin) {
 	*out = *in
+	if in.Source != nil {
+		in, out := &in.Source, &out.Source
+		*out = new(PluginSource)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Plugin.
@@ -831,6 +1365,36 @@ func (in *Plugin) DeepCopy() *Plugin {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PluginArchiveKeyRef) DeepCopyInto(out *PluginArchiveKeyRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PluginArchiveKeyRef.
+func (in *PluginArchiveKeyRef) DeepCopy() *PluginArchiveKeyRef {
+	if in == nil {
+		return nil
+	}
+	out := new(PluginArchiveKeyRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PluginArchiveVolumeRef) DeepCopyInto(out *PluginArchiveVolumeRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PluginArchiveVolumeRef.
+func (in *PluginArchiveVolumeRef) DeepCopy() *PluginArchiveVolumeRef {
+	if in == nil {
+		return nil
+	}
+	out := new(PluginArchiveVolumeRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PluginConfig) DeepCopyInto(out *PluginConfig) {
 	*out = *in
@@ -847,6 +1411,21 @@ func (in *PluginConfig) DeepCopy() *PluginConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PluginDelivery) DeepCopyInto(out *PluginDelivery) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PluginDelivery.
+func (in *PluginDelivery) DeepCopy() *PluginDelivery {
+	if in == nil {
+		return nil
+	}
+	out := new(PluginDelivery)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PluginFileSpec) DeepCopyInto(out *PluginFileSpec) {
 	*out = *in
@@ -854,7 +1433,7 @@ func (in *PluginFileSpec) DeepCopyInto(out *PluginFileSpec) {
 		in, out := &in.Plugins, &out.Plugins
 		*out = make(map[string]Plugin, len(*in))
 		for key, val := range *in {
-			(*out)[key] = val
+			(*out)[key] = *val.DeepCopy()
 		}
 	}
 }
@@ -869,6 +1448,36 @@ func (in *PluginFileSpec) DeepCopy() *PluginFileSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PluginSource) DeepCopyInto(out *PluginSource) {
+	*out = *in
+	if in.ConfigMap != nil {
+		in, out := &in.ConfigMap, &out.ConfigMap
+		*out = new(PluginArchiveKeyRef)
+		**out = **in
+	}
+	if in.Secret != nil {
+		in, out := &in.Secret, &out.Secret
+		*out = new(PluginArchiveKeyRef)
+		**out = **in
+	}
+	if in.PersistentVolumeClaim != nil {
+		in, out := &in.PersistentVolumeClaim, &out.PersistentVolumeClaim
+		*out = new(PluginArchiveVolumeRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PluginSource.
+func (in *PluginSource) DeepCopy() *PluginSource {
+	if in == nil {
+		return nil
+	}
+	out := new(PluginSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PluginsConfigList) DeepCopyInto(out *PluginsConfigList) {
 	*out = *in
@@ -876,7 +1485,7 @@ func (in *PluginsConfigList) DeepCopyInto(out *PluginsConfigList) {
 		in, out := &in.data, &out.data
 		*out = make(map[string]Plugin, len(*in))
 		for key, val := range *in {
-			(*out)[key] = val
+			(*out)[key] = *val.DeepCopy()
 		}
 	}
 	if in.keys != nil {
@@ -1024,6 +1633,37 @@ func (in *PorterConfigSpec) DeepCopy() *PorterConfigSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PorterInstallationStatus) DeepCopyInto(out *PorterInstallationStatus) {
+	*out = *in
+	if in.Created != nil {
+		in, out := &in.Created, &out.Created
+		*out = (*in).DeepCopy()
+	}
+	if in.Modified != nil {
+		in, out := &in.Modified, &out.Modified
+		*out = (*in).DeepCopy()
+	}
+	if in.Installed != nil {
+		in, out := &in.Installed, &out.Installed
+		*out = (*in).DeepCopy()
+	}
+	if in.Uninstalled != nil {
+		in, out := &in.Uninstalled, &out.Uninstalled
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PorterInstallationStatus.
+func (in *PorterInstallationStatus) DeepCopy() *PorterInstallationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PorterInstallationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PorterResourceStatus) DeepCopyInto(out *PorterResourceStatus) {
 	*out = *in
@@ -1153,3 +1793,20 @@ func (in *TelemetryConfig) DeepCopy() *TelemetryConfig {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UnusedPluginVolume) DeepCopyInto(out *UnusedPluginVolume) {
+	*out = *in
+	in.UnusedSince.DeepCopyInto(&out.UnusedSince)
+	in.DeleteAfter.DeepCopyInto(&out.DeleteAfter)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UnusedPluginVolume.
+func (in *UnusedPluginVolume) DeepCopy() *UnusedPluginVolume {
+	if in == nil {
+		return nil
+	}
+	out := new(UnusedPluginVolume)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AgentResourceSweeperOptions configures how often the operator looks for agent resources to remove.
+type AgentResourceSweeperOptions struct {
+	// Interval between sweeps. The sweeper is disabled when it is zero.
+	Interval time.Duration
+}
+
+// BindFlags registers flags for the sweeper options.
+func (o *AgentResourceSweeperOptions) BindFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&o.Interval, "agent-resource-sweep-interval", time.Hour, "How often to remove the volumes and secrets left behind by the Porter Agent. Set to 0 to disable the sweeper.")
+}
+
+// AgentResourceSweeper periodically removes the volumes and secrets created for a run of the Porter Agent
+// that are no longer needed:
+//   - The resources of an AgentAction that no longer exists, for example resources created before they were owned by the AgentAction.
+//   - The resources of a failed run once the KeepOnFailure period of the cleanup policy has passed.
+//
+// It implements manager.Runnable.
+type AgentResourceSweeper struct {
+	client.Client
+	Log  logr.Logger
+	Opts AgentResourceSweeperOptions
+}
+
+// Start sweeps the agent resources on an interval until the context is cancelled.
+func (s *AgentResourceSweeper) Start(ctx context.Context) error {
+	if s.Opts.Interval <= 0 {
+		s.Log.V(Log2ApplicationState).Info("The agent resource sweeper is disabled")
+		return nil
+	}
+
+	ticker := time.NewTicker(s.Opts.Interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Sweep(ctx); err != nil {
+			s.Log.V(Log0Error).Error(err, "Could not sweep the agent resources")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable so that only the leader removes resources.
+func (s *AgentResourceSweeper) NeedLeaderElection() bool {
+	return true
+}
+
+// Sweep removes the agent resources that are no longer needed.
+func (s *AgentResourceSweeper) Sweep(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "AgentResourceSweeper.Sweep")
+	defer span.End()
+
+	log := s.Log
+	log.V(Log5Trace).Info("Sweeping agent resources")
+
+	selector := client.MatchingLabels{
+		porterv1.LabelManaged:      "true",
+		porterv1.LabelResourceKind: porterv1.KindAgentAction,
+	}
+	var pvcs corev1.PersistentVolumeClaimList
+	if err := s.List(ctx, &pvcs, selector); err != nil {
+		return errors.Wrap(err, "error listing the agent volumes (pvc)")
+	}
+	var secrets corev1.SecretList
+	if err := s.List(ctx, &secrets, selector); err != nil {
+		return errors.Wrap(err, "error listing the agent secrets")
+	}
+
+	objs := make([]client.Object, 0, len(pvcs.Items)+len(secrets.Items))
+	for i := range pvcs.Items {
+		objs = append(objs, &pvcs.Items[i])
+	}
+	for i := range secrets.Items {
+		objs = append(objs, &secrets.Items[i])
+	}
+
+	// Cache the action of each resource, most actions have several resources
+	actions := map[types.NamespacedName]*porterv1.AgentAction{}
+	now := time.Now()
+	var removed int
+	for _, obj := range objs {
+		key := types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetLabels()[porterv1.LabelResourceName]}
+		if key.Name == "" {
+			continue
+		}
+		action, ok := actions[key]
+		if !ok {
+			action = &porterv1.AgentAction{}
+			if err := s.Get(ctx, key, action); err != nil {
+				if !apierrors.IsNotFound(err) {
+					return errors.Wrapf(err, "error retrieving agent action %s", key)
+				}
+				action = nil
+			}
+			actions[key] = action
+		}
+
+		if !isSweepable(action, obj, now) {
+			continue
+		}
+
+		log.V(Log4Debug).Info("Removing agent resource", "type", fmt.Sprintf("%T", obj), "namespace", obj.GetNamespace(), "name", obj.GetName(), "agentaction", key.Name)
+		if err := s.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, "error removing agent resource %s/%s", obj.GetNamespace(), obj.GetName())
+		}
+		removed++
+	}
+
+	log.V(Log4Debug).Info("Swept agent resources", "removed", removed)
+	return nil
+}
+
+// isSweepable determines if a resource created for a run of the agent can be removed.
+// The resources of an action that does not exist are always removed. Otherwise, only the
+// resources of the current run are removed, once they expire according to the cleanup policy.
+func isSweepable(action *porterv1.AgentAction, obj client.Object, now time.Time) bool {
+	if action == nil {
+		return true
+	}
+
+	labels := obj.GetLabels()
+	if labels[porterv1.LabelResourceGeneration] != fmt.Sprintf("%d", action.Generation) || labels[porterv1.LabelRetry] != action.GetRetryLabelValue() {
+		return false
+	}
+	return agentResourcesExpired(action, now)
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAgentResourceSweeper_Sweep(t *testing.T) {
+	ctx := context.Background()
+
+	agentLabels := func(action string, generation string) map[string]string {
+		return map[string]string{
+			porterv1.LabelManaged:            "true",
+			porterv1.LabelResourceKind:       porterv1.KindAgentAction,
+			porterv1.LabelResourceName:       action,
+			porterv1.LabelResourceGeneration: generation,
+			porterv1.LabelRetry:              "",
+		}
+	}
+	failedAction := func(name string, failedAt time.Time) *porterv1.AgentAction {
+		return &porterv1.AgentAction{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: name, Generation: 1},
+			Status: porterv1.AgentActionStatus{
+				Phase: porterv1.PhaseFailed,
+				Conditions: []metav1.Condition{{
+					Type:               string(porterv1.ConditionFailed),
+					Status:             metav1.ConditionTrue,
+					Reason:             "JobFailed",
+					LastTransitionTime: metav1.NewTime(failedAt),
+				}},
+			},
+		}
+	}
+
+	expired := failedAction("expired", time.Now().Add(-25*time.Hour))
+	recent := failedAction("recent", time.Now().Add(-time.Hour))
+	retried := failedAction("retried", time.Now().Add(-25*time.Hour))
+	retried.Generation = 2
+
+	newPVC := func(name string, labels map[string]string) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: name, Labels: labels}}
+	}
+	newSecret := func(name string, labels map[string]string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: name, Labels: labels}}
+	}
+	orphanedPVC := newPVC("orphaned", agentLabels("deleted", "1"))
+	orphanedSecret := newSecret("orphaned", agentLabels("deleted", "1"))
+	expiredSecret := newSecret("expired", agentLabels("expired", "1"))
+	recentSecret := newSecret("recent", agentLabels("recent", "1"))
+	previousRunSecret := newSecret("retried", agentLabels("retried", "1"))
+	unmanagedSecret := newSecret("unmanaged", map[string]string{porterv1.LabelResourceName: "deleted"})
+
+	objs := []client.Object{expired, recent, retried, orphanedPVC, orphanedSecret, expiredSecret, recentSecret, previousRunSecret, unmanagedSecret}
+	sweeper := setupAgentResourceSweeper(objs...)
+	require.NoError(t, sweeper.Sweep(ctx))
+
+	assertRemoved := func(obj client.Object, msg string) {
+		err := sweeper.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+		assert.True(t, apierrors.IsNotFound(err), msg)
+	}
+	assertKept := func(obj client.Object, msg string) {
+		assert.NoError(t, sweeper.Get(ctx, client.ObjectKeyFromObject(obj), obj), msg)
+	}
+	assertRemoved(orphanedPVC, "the volume of an action that does not exist should be removed")
+	assertRemoved(orphanedSecret, "the secret of an action that does not exist should be removed")
+	assertRemoved(expiredSecret, "the secret of a failed run should be removed once the keep period has passed")
+	assertKept(recentSecret, "the secret of a failed run should be kept during the keep period")
+	assertKept(previousRunSecret, "only the resources of the current run are removed by the cleanup policy")
+	assertKept(unmanagedSecret, "resources that are not managed by the operator should be kept")
+}
+
+func TestAgentResourceSweeper_Start_Disabled(t *testing.T) {
+	sweeper := setupAgentResourceSweeper()
+	sweeper.Opts.Interval = 0
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, sweeper.Start(ctx), "a disabled sweeper should return immediately")
+	assert.NoError(t, ctx.Err(), "a disabled sweeper should not wait for the context to be cancelled")
+}
+
+func setupAgentResourceSweeper(objs ...client.Object) *AgentResourceSweeper {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(porterv1.AddToScheme(scheme))
+
+	fakeBuilder := fake.NewClientBuilder()
+	fakeBuilder.WithScheme(scheme)
+	fakeBuilder.WithObjects(objs...).WithStatusSubresource(objs...)
+	fakeClient := fakeBuilder.Build()
+
+	return &AgentResourceSweeper{
+		Client: fakeClient,
+		Log:    logr.Discard(),
+		Opts:   AgentResourceSweeperOptions{Interval: time.Hour},
+	}
+}
@@ -2,14 +2,19 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"sort"
 	"strings"
+	"time"
 
 	porterv1 "get.porter.sh/operator/api/v1"
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/yaml.v3"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -19,15 +24,21 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 // +kubebuilder:rbac:groups=getporter.org,resources=agentconfigs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=getporter.org,resources=porterconfigs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=getporter.org,resources=clusteragentconfigs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=getporter.org,resources=clusterporterconfigs,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 // +kubebuilder:rbac:groups=getporter.org,resources=agentactions,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=getporter.org,resources=agentactions/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=getporter.org,resources=agentactions/finalizers,verbs=update
@@ -35,25 +46,115 @@ import (
 // +kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 type AgentActionReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Scheme   *runtime.Scheme
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *AgentActionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Index the actions that are waiting for their configuration, so that they are requeued when it is ready
+	ctx := context.Background()
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &porterv1.AgentAction{}, agentConfigIndexKey, indexWaitingActionByAgentConfig); err != nil {
+		return errors.Wrap(err, "error indexing the agent actions by agent config")
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &porterv1.AgentAction{}, porterConfigIndexKey, indexWaitingActionByPorterConfig); err != nil {
+		return errors.Wrap(err, "error indexing the agent actions by porter config")
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&porterv1.AgentAction{}, builder.WithPredicates(resourceChanged{})).
 		Owns(&batchv1.Job{}).
+		Watches(&porterv1.AgentConfig{}, handler.EnqueueRequestsFromMapFunc(r.mapAgentConfigToWaitingActions)).
+		Watches(&porterv1.PorterConfig{}, handler.EnqueueRequestsFromMapFunc(r.mapPorterConfigToWaitingActions)).
 		Complete(r)
 }
 
+const (
+	// agentConfigIndexKey indexes the actions that are waiting for their configuration
+	// by the namespace/name of each AgentConfig that may determine whether it is ready.
+	agentConfigIndexKey = "agentConfig"
+
+	// porterConfigIndexKey indexes the actions that are waiting for their configuration
+	// by the namespace/name of the PorterConfig that they reference.
+	porterConfigIndexKey = "porterConfig"
+)
+
+// isWaitingForConfig determines if an action is parked until its AgentConfig or PorterConfig is ready.
+func isWaitingForConfig(action *porterv1.AgentAction) bool {
+	return apimeta.IsStatusConditionTrue(action.Status.Conditions, string(porterv1.ConditionWaitingForAgentConfig))
+}
+
+func indexWaitingActionByAgentConfig(obj client.Object) []string {
+	action := obj.(*porterv1.AgentAction)
+	if !isWaitingForConfig(action) {
+		return nil
+	}
+
+	keys := []string{
+		operatorNamespace + "/default",
+		action.Namespace + "/default",
+	}
+	if action.Spec.AgentConfig != nil {
+		keys = append(keys, action.Namespace+"/"+action.Spec.AgentConfig.Name)
+	}
+	return keys
+}
+
+func indexWaitingActionByPorterConfig(obj client.Object) []string {
+	action := obj.(*porterv1.AgentAction)
+	if !isWaitingForConfig(action) || action.Spec.PorterConfig == nil {
+		return nil
+	}
+	return []string{action.Namespace + "/" + action.Spec.PorterConfig.Name}
+}
+
+// mapAgentConfigToWaitingActions requests the actions that are waiting for an AgentConfig,
+// once it is ready or has plugins installed that the actions can use.
+func (r *AgentActionReconciler) mapAgentConfigToWaitingActions(ctx context.Context, obj client.Object) []reconcile.Request {
+	agentCfg := obj.(*porterv1.AgentConfig)
+	if !agentCfg.Status.Ready && agentCfg.Status.ActivePlugins == nil {
+		return nil
+	}
+	return r.listWaitingActions(ctx, agentConfigIndexKey, agentCfg)
+}
+
+// mapPorterConfigToWaitingActions requests the actions that are waiting for a PorterConfig that they reference.
+func (r *AgentActionReconciler) mapPorterConfigToWaitingActions(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.listWaitingActions(ctx, porterConfigIndexKey, obj)
+}
+
+func (r *AgentActionReconciler) listWaitingActions(ctx context.Context, indexKey string, cfg client.Object) []reconcile.Request {
+	actions := &porterv1.AgentActionList{}
+	key := cfg.GetNamespace() + "/" + cfg.GetName()
+	if err := r.List(ctx, actions, client.MatchingFields{indexKey: key}); err != nil {
+		r.Log.V(Log0Error).Error(err, "Could not list the agent actions waiting for their configuration", indexKey, key)
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(actions.Items))
+	for _, action := range actions.Items {
+		r.Log.V(Log4Debug).Info("Requeuing agent action because its configuration is ready", "namespace", action.Namespace, "agentaction", action.Name, indexKey, key)
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: action.Namespace, Name: action.Name}})
+	}
+	return requests
+}
+
 // Reconcile is called when the spec of an AgentAction is changed
 // or a job associated with an agent is updated.
 // Either schedule a job to handle a spec change, or update the AgentAction status in response to the job's state.
 func (r *AgentActionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := startReconcileSpan(ctx, "AgentAction", req)
+	result, err := r.reconcile(ctx, req)
+	endSpan(span, err)
+	return result, err
+}
+
+func (r *AgentActionReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("agentaction", req.Name, "namespace", req.Namespace)
 
 	// Retrieve the action
@@ -61,10 +162,13 @@ func (r *AgentActionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	err := r.Get(ctx, req.NamespacedName, action)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
+			recordAgentActionQueued(req.NamespacedName, nil)
 			return ctrl.Result{}, nil
 		}
 		return ctrl.Result{Requeue: false}, err
 	}
+	// Count the action in the queue depth with the status that it has once it is reconciled
+	defer recordAgentActionQueued(req.NamespacedName, action)
 
 	if action.DeletionTimestamp != nil {
 		if controllerutil.ContainsFinalizer(action, porterv1.FinalizerName) {
@@ -72,6 +176,7 @@ func (r *AgentActionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			if err := r.Update(ctx, action); err != nil {
 				return ctrl.Result{}, err
 			}
+			r.Recorder.Event(action, "Normal", "RemoveFinalizer", fmt.Sprintf("removed finalizer from agent action %s", action.Name))
 		}
 	}
 
@@ -96,7 +201,10 @@ func (r *AgentActionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	// Check if we have already handled any spec changes
 	if handled {
-		// Nothing for us to do at this point
+		// Remove the resources used by the agent once it has finished, according to the cleanup policy
+		if err = r.cleanupAgentResources(ctx, log, action); err != nil {
+			return ctrl.Result{}, err
+		}
 		log.V(Log4Debug).Info("Reconciliation complete: A porter agent has already been dispatched.")
 		return ctrl.Result{}, nil
 	}
@@ -104,6 +212,10 @@ func (r *AgentActionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	// Run a porter agent
 	err = r.runPorter(ctx, log, action)
 	if err != nil {
+		if errors.Is(err, errAgentConfigNotReady) || errors.Is(err, errPorterConfigNotFound) {
+			// Park the action until its configuration is ready, the AgentConfig and PorterConfig watches requeue it
+			return ctrl.Result{}, r.waitForConfig(ctx, log, action, err)
+		}
 		return ctrl.Result{}, err
 	}
 
@@ -135,17 +247,40 @@ func (r *AgentActionReconciler) isHandled(ctx context.Context, log logr.Logger,
 
 // Check the status of the porter-agent job and use that to update the AgentAction status
 func (r *AgentActionReconciler) syncStatus(ctx context.Context, log logr.Logger, action *porterv1.AgentAction, job *batchv1.Job) error {
+	_, span := startSpan(ctx, "AgentAction.syncStatus")
+	defer span.End()
+
 	origStatus := action.Status
 
 	r.applyJobToStatus(log, action, job)
 
 	if !reflect.DeepEqual(origStatus, action.Status) {
-		return r.saveStatus(ctx, log, action)
+		if err := r.saveStatus(ctx, log, action); err != nil {
+			return err
+		}
+		recordAgentActionPhaseChange(action, origStatus.Phase, job)
+		r.recordJobEvent(action, origStatus.Phase, job)
 	}
 
 	return nil
 }
 
+// Emit an event on the agent action when the phase of its job changes
+func (r *AgentActionReconciler) recordJobEvent(action *porterv1.AgentAction, origPhase porterv1.AgentPhase, job *batchv1.Job) {
+	if job == nil || action.Status.Phase == origPhase {
+		return
+	}
+
+	switch action.Status.Phase {
+	case porterv1.PhaseRunning:
+		r.Recorder.Event(action, "Normal", "JobStarted", fmt.Sprintf("porter agent job %s started", job.Name))
+	case porterv1.PhaseSucceeded:
+		r.Recorder.Event(action, "Normal", "JobCompleted", fmt.Sprintf("porter agent job %s completed", job.Name))
+	case porterv1.PhaseFailed:
+		r.Recorder.Event(action, "Warning", "JobFailed", fmt.Sprintf("porter agent job %s failed, see the job logs for details", job.Name))
+	}
+}
+
 // Only update the status with a PATCH, don't clobber the entire resource
 func (r *AgentActionReconciler) saveStatus(ctx context.Context, log logr.Logger, action *porterv1.AgentAction) error {
 	log.V(Log5Trace).Info("Patching agent action status")
@@ -163,7 +298,12 @@ func (r *AgentActionReconciler) applyJobToStatus(log logr.Logger, action *porter
 
 	if job == nil {
 		action.Status.Job = nil
+		// Keep whether the action is waiting for its configuration, which is managed when the job is created
+		waiting := apimeta.FindStatusCondition(action.Status.Conditions, string(porterv1.ConditionWaitingForAgentConfig))
 		action.Status.Conditions = nil
+		if waiting != nil {
+			action.Status.Conditions = []metav1.Condition{*waiting}
+		}
 		log.V(Log5Trace).Info("Cleared status because there is no current job")
 		return
 	}
@@ -192,16 +332,48 @@ func (r *AgentActionReconciler) applyJobToStatus(log logr.Logger, action *porter
 func (r *AgentActionReconciler) runPorter(ctx context.Context, log logr.Logger, action *porterv1.AgentAction) error {
 	log.V(Log5Trace).Info("Porter agent requested", "namespace", action.Namespace, "action", action.Name)
 
-	agentCfg, err := r.resolveAgentConfig(ctx, log, action)
+	agentCfg, agentCfgSources, err := r.resolveAgentConfig(ctx, log, action)
 	if err != nil {
 		return err
 	}
 
-	porterCfg, err := r.resolvePorterConfig(ctx, log, action)
+	// Report a security context that cannot be used before creating any resources for the agent
+	if err = agentCfg.ValidateSecurityContext(); err != nil {
+		r.Recorder.Event(action, "Warning", "InvalidSecurityContext", err.Error())
+		return err
+	}
+
+	porterCfg, porterCfgSources, err := r.resolvePorterConfig(ctx, log, action)
 	if err != nil {
 		return err
 	}
 
+	if apimeta.IsStatusConditionTrue(action.Status.Conditions, string(porterv1.ConditionWaitingForAgentConfig)) {
+		log.V(Log4Debug).Info("The configuration used by the agent is ready")
+		apimeta.SetStatusCondition(&action.Status.Conditions, metav1.Condition{
+			Type:               string(porterv1.ConditionWaitingForAgentConfig),
+			Reason:             "ConfigReady",
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: action.Generation,
+		})
+	}
+
+	// Record which layer of configuration supplied each setting used by the agent
+	action.Status.AgentConfigSources = agentCfgSources
+	action.Status.PorterConfigSources = porterCfgSources
+
+	// Record the configuration that was used, so that it can be reviewed when the agent misbehaves
+	effectiveAgentCfg := agentCfg.GetSpec()
+	action.Status.EffectiveAgentConfig = &effectiveAgentCfg
+	effectivePorterCfg, err := porterCfg.Redact()
+	if err != nil {
+		return err
+	}
+	action.Status.EffectivePorterConfig = &effectivePorterCfg
+	if err = r.saveStatus(ctx, log, action); err != nil {
+		return err
+	}
+
 	pvc, err := r.createAgentVolume(ctx, log, action, agentCfg)
 	if err != nil {
 		return err
@@ -212,11 +384,11 @@ func (r *AgentActionReconciler) runPorter(ctx context.Context, log logr.Logger,
 		return err
 	}
 
-	workdirSecret, err := r.createWorkdirSecret(ctx, log, action)
+	workdirSecret, err := r.createWorkdirSecret(ctx, log, action, agentCfg)
 	if err != nil {
 		return err
 	}
-	imgPullSecret, err := r.getImagePullSecret(ctx, log, action, agentCfg)
+	imgPullSecret, err := r.createImagePullSecret(ctx, log, action, agentCfg)
 	if err != nil {
 		return err
 	}
@@ -229,6 +401,87 @@ func (r *AgentActionReconciler) runPorter(ctx context.Context, log logr.Logger,
 	return nil
 }
 
+// waitForConfig records that the action is waiting for its AgentConfig or PorterConfig to be ready.
+func (r *AgentActionReconciler) waitForConfig(ctx context.Context, log logr.Logger, action *porterv1.AgentAction, reason error) error {
+	log.V(Log4Debug).Info("Waiting for the agent configuration to be ready", "reason", reason.Error())
+
+	condReason := "AgentConfigNotReady"
+	if errors.Is(reason, errPorterConfigNotFound) {
+		condReason = "PorterConfigNotFound"
+	}
+	if !apimeta.IsStatusConditionTrue(action.Status.Conditions, string(porterv1.ConditionWaitingForAgentConfig)) {
+		r.Recorder.Event(action, "Normal", string(porterv1.ConditionWaitingForAgentConfig), reason.Error())
+	}
+	apimeta.SetStatusCondition(&action.Status.Conditions, metav1.Condition{
+		Type:               string(porterv1.ConditionWaitingForAgentConfig),
+		Reason:             condReason,
+		Message:            reason.Error(),
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: action.Generation,
+	})
+	return r.saveStatus(ctx, log, action)
+}
+
+// cleanupAgentResources removes the volume and secrets created for the current run of the agent,
+// when they have expired according to the cleanup policy.
+// Failed runs that are kept for a while are removed later by the AgentResourceSweeper.
+func (r *AgentActionReconciler) cleanupAgentResources(ctx context.Context, log logr.Logger, action *porterv1.AgentAction) error {
+	if !agentResourcesExpired(action, time.Now()) {
+		return nil
+	}
+	return deleteAgentResources(ctx, log, r.Client, action.Namespace, r.getSharedAgentLabels(action))
+}
+
+// agentResourcesExpired determines if the volume and secrets of the current run of the agent should be removed,
+// according to the cleanup policy of the agent configuration that was used to run it.
+func agentResourcesExpired(action *porterv1.AgentAction, now time.Time) bool {
+	var policy *porterv1.AgentCleanupPolicy
+	if action.Status.EffectiveAgentConfig != nil {
+		policy = action.Status.EffectiveAgentConfig.CleanupPolicy
+	}
+
+	switch action.Status.Phase {
+	case porterv1.PhaseSucceeded:
+		return policy.GetDeleteOnSuccess()
+	case porterv1.PhaseFailed:
+		failed := apimeta.FindStatusCondition(action.Status.Conditions, string(porterv1.ConditionFailed))
+		if failed == nil {
+			return false
+		}
+		return !now.Before(failed.LastTransitionTime.Add(policy.GetKeepOnFailure()))
+	default:
+		return false
+	}
+}
+
+// deleteAgentResources removes the volume and secrets created for a run of the agent, selected by their labels.
+func deleteAgentResources(ctx context.Context, log logr.Logger, c client.Client, namespace string, labels map[string]string) error {
+	var pvcs corev1.PersistentVolumeClaimList
+	if err := c.List(ctx, &pvcs, client.InNamespace(namespace), client.MatchingLabels(labels)); err != nil {
+		return errors.Wrap(err, "error listing the agent volumes (pvc) to remove")
+	}
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+		log.V(Log4Debug).Info("Removing agent volume (pvc)", "namespace", pvc.Namespace, "name", pvc.Name)
+		if err := c.Delete(ctx, pvc); client.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, "error removing agent volume (pvc) %s", pvc.Name)
+		}
+	}
+
+	var secrets corev1.SecretList
+	if err := c.List(ctx, &secrets, client.InNamespace(namespace), client.MatchingLabels(labels)); err != nil {
+		return errors.Wrap(err, "error listing the agent secrets to remove")
+	}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		log.V(Log4Debug).Info("Removing agent secret", "namespace", secret.Namespace, "name", secret.Name)
+		if err := c.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, "error removing agent secret %s", secret.Name)
+		}
+	}
+	return nil
+}
+
 // get the labels that are used to match agent resources, merging custom labels defined on the action.
 func (r *AgentActionReconciler) getSharedAgentLabels(action *porterv1.AgentAction) map[string]string {
 	labels := map[string]string{
@@ -278,6 +531,9 @@ func (r *AgentActionReconciler) createAgentVolume(ctx context.Context, log logr.
 		pvc.Spec.StorageClassName = &storageClassName
 	}
 
+	if err := controllerutil.SetControllerReference(action, pvc, r.Scheme); err != nil {
+		return nil, errors.Wrap(err, "error setting the owner of the agent volume (pvc)")
+	}
 	if err := r.Create(ctx, pvc); err != nil {
 		return nil, errors.Wrap(err, "error creating the agent volume (pvc)")
 	}
@@ -320,6 +576,9 @@ func (r *AgentActionReconciler) createConfigSecret(ctx context.Context, log logr
 		},
 	}
 
+	if err = controllerutil.SetControllerReference(action, secret, r.Scheme); err != nil {
+		return nil, errors.Wrap(err, "error setting the owner of the porter config secret")
+	}
 	if err = r.Create(ctx, secret); err != nil {
 		return nil, errors.Wrap(err, "error creating the porter config secret")
 	}
@@ -329,7 +588,7 @@ func (r *AgentActionReconciler) createConfigSecret(ctx context.Context, log logr
 }
 
 // creates a secret for the porter configuration directory
-func (r *AgentActionReconciler) createWorkdirSecret(ctx context.Context, log logr.Logger, action *porterv1.AgentAction) (*corev1.Secret, error) {
+func (r *AgentActionReconciler) createWorkdirSecret(ctx context.Context, log logr.Logger, action *porterv1.AgentAction, agentCfg porterv1.AgentConfigSpecAdapter) (*corev1.Secret, error) {
 	labels := r.getSharedAgentLabels(action)
 	labels[porterv1.LabelSecretType] = porterv1.SecretTypeWorkdir
 
@@ -343,6 +602,10 @@ func (r *AgentActionReconciler) createWorkdirSecret(ctx context.Context, log log
 	}
 
 	// Create a secret with all the files that should be copied into the agent's working directory
+	files := make(map[string][]byte, len(action.Spec.Files)+1)
+	for k, v := range action.Spec.Files {
+		files[k] = v
+	}
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: action.Name + "-",
@@ -351,9 +614,12 @@ func (r *AgentActionReconciler) createWorkdirSecret(ctx context.Context, log log
 		},
 		Type:      corev1.SecretTypeOpaque,
 		Immutable: ptr.To(true),
-		Data:      action.Spec.Files,
+		Data:      files,
 	}
 
+	if err := controllerutil.SetControllerReference(action, secret, r.Scheme); err != nil {
+		return nil, errors.Wrap(err, "error setting the owner of the porter workdir secret")
+	}
 	if err := r.Create(ctx, secret); err != nil {
 		return nil, errors.Wrap(err, "error creating the porter workdir secret")
 	}
@@ -362,8 +628,21 @@ func (r *AgentActionReconciler) createWorkdirSecret(ctx context.Context, log log
 	return secret, nil
 }
 
-// creates a secret for the porter configuration directory
-func (r *AgentActionReconciler) getImagePullSecret(ctx context.Context, log logr.Logger, action *porterv1.AgentAction, agentCfg porterv1.AgentConfigSpecAdapter) (*corev1.Secret, error) {
+// creates a secret with the docker config used to pull images for the agent and the bundle,
+// merging the image pull secrets of the installation service account and the agent configuration.
+// Returns nil when there are no image pull secrets.
+func (r *AgentActionReconciler) createImagePullSecret(ctx context.Context, log logr.Logger, action *porterv1.AgentAction, agentCfg porterv1.AgentConfigSpecAdapter) (*corev1.Secret, error) {
+	labels := r.getSharedAgentLabels(action)
+	labels[porterv1.LabelSecretType] = porterv1.SecretTypeImagePullSecret
+
+	var results corev1.SecretList
+	if err := r.List(ctx, &results, client.InNamespace(action.Namespace), client.MatchingLabels(labels)); err != nil {
+		return nil, errors.Wrap(err, "error checking for an existing image pull secret")
+	}
+
+	if len(results.Items) > 0 {
+		return &results.Items[0], nil
+	}
 
 	installationSvcAccountName := "default"
 	if agentCfg.GetInstallationServiceAccount() != "" {
@@ -377,24 +656,96 @@ func (r *AgentActionReconciler) getImagePullSecret(ctx context.Context, log logr
 		return nil, errors.Wrap(err, "error checking for a service account")
 	}
 	log.V(Log4Debug).Info("found service account for image pull secrets", "name", instSvcAccount.Name, "number_image_pull_secrets", len(instSvcAccount.ImagePullSecrets))
-	var err error
-	var imgPullSec corev1.Secret
-	for _, secObjRef := range instSvcAccount.ImagePullSecrets {
-		log.V(Log4Debug).Info("looking for service account image pull secrets", "sa_namespace", instSvcAccount.Namespace, "sa_name", instSvcAccount.Name, "secret_name", secObjRef.Name)
-		if err := r.Get(ctx, types.NamespacedName{Namespace: action.Namespace, Name: secObjRef.Name}, &imgPullSec); err != nil {
-			log.V(Log4Debug).Info("no image pull secret found for service account", "sa_namespace", instSvcAccount.Namespace, "sa_name", imgPullSec.Name, "secret_name", imgPullSec.Name)
-		}
-		log.V(Log4Debug).Info("found image pull secret found for service account", "sa_namespace", instSvcAccount.Namespace, "sa_name", imgPullSec.Name, "secret_name", imgPullSec.Name)
-		//TODO:(bdegeeter) grab the first dockerconfig json for now. Need to address multiple image pull secrets in a single service account
-		if imgPullSec.Type == "kubernetes.io/dockerconfigjson" {
-			if len(instSvcAccount.ImagePullSecrets) > 1 {
-				log.V(Log4Debug).Info("more that one image pull secret found using first secret", "sa_name", instSvcAccount.Name, "secret_namespace", imgPullSec.Namespace, "secret_name", imgPullSec.Name)
+
+	// Merge the registry credentials from each secret, the secrets listed in the agent configuration take precedence
+	auths := map[string]json.RawMessage{}
+	addSecret := func(name string, required bool) error {
+		var imgPullSecret corev1.Secret
+		if err := r.Get(ctx, types.NamespacedName{Namespace: action.Namespace, Name: name}, &imgPullSecret); err != nil {
+			if apierrors.IsNotFound(err) && !required {
+				log.V(Log4Debug).Info("image pull secret referenced by the service account was not found", "sa_name", instSvcAccount.Name, "secret_name", name)
+				return nil
 			}
-			return &imgPullSec, nil
+			return errors.Wrapf(err, "error retrieving image pull secret %s", name)
 		}
+
+		secretAuths, err := getDockerConfigAuths(imgPullSecret)
+		if err != nil {
+			return err
+		}
+		log.V(Log4Debug).Info("found image pull secret", "secret_name", name, "registries", len(secretAuths))
+		for registry, auth := range secretAuths {
+			auths[registry] = auth
+		}
+		return nil
+	}
+	for _, ref := range instSvcAccount.ImagePullSecrets {
+		if err := addSecret(ref.Name, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, ref := range agentCfg.GetImagePullSecrets() {
+		if err := addSecret(ref.Name, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(auths) == 0 {
+		log.V(Log4Debug).Info("no image pull secret for service account", "sa_name", instSvcAccount.Name, "sa_namespace", instSvcAccount.Namespace)
+		return nil, nil
+	}
+
+	dockerCfg, err := json.Marshal(map[string]interface{}{"auths": auths})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling the docker config for the image pull secret")
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: action.Name + "-",
+			Namespace:    action.Namespace,
+			Labels:       labels,
+		},
+		Type:      corev1.SecretTypeDockerConfigJson,
+		Immutable: ptr.To(true),
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: dockerCfg,
+		},
+	}
+
+	if err = controllerutil.SetControllerReference(action, secret, r.Scheme); err != nil {
+		return nil, errors.Wrap(err, "error setting the owner of the image pull secret")
+	}
+	if err = r.Create(ctx, secret); err != nil {
+		return nil, errors.Wrap(err, "error creating the image pull secret")
+	}
+
+	log.V(Log4Debug).Info("Created secret for the image pull secrets", "name", secret.Name, "registries", len(auths))
+	return secret, nil
+}
+
+// getDockerConfigAuths returns the registry credentials defined in a kubernetes.io/dockerconfigjson
+// or kubernetes.io/dockercfg secret, by registry. Other types of secrets do not have any credentials.
+func getDockerConfigAuths(secret corev1.Secret) (map[string]json.RawMessage, error) {
+	switch secret.Type {
+	case corev1.SecretTypeDockerConfigJson:
+		var cfg struct {
+			Auths map[string]json.RawMessage `json:"auths"`
+		}
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &cfg); err != nil {
+			return nil, errors.Wrapf(err, "error parsing the docker config in image pull secret %s", secret.Name)
+		}
+		return cfg.Auths, nil
+	case corev1.SecretTypeDockercfg:
+		// The legacy format is the contents of the auths section
+		var auths map[string]json.RawMessage
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigKey], &auths); err != nil {
+			return nil, errors.Wrapf(err, "error parsing the docker config in image pull secret %s", secret.Name)
+		}
+		return auths, nil
+	default:
+		return nil, nil
 	}
-	log.V(Log4Debug).Info("no image pull secret for service account", "sa_name", instSvcAccount.Name, "sa_namespace", instSvcAccount.Namespace, "img_pull_secret_name", imgPullSec.Name, "img_pull_secret_namespace", imgPullSec.Namespace)
-	return nil, errors.Wrap(err, "could not get image pull secret")
 }
 
 func (r *AgentActionReconciler) getAgentJobLabels(action *porterv1.AgentAction) map[string]string {
@@ -407,12 +758,44 @@ func (r *AgentActionReconciler) createAgentJob(ctx context.Context, log logr.Log
 	action *porterv1.AgentAction, agentCfg porterv1.AgentConfigSpecAdapter,
 	pvc *corev1.PersistentVolumeClaim, configSecret *corev1.Secret, workdirSecret *corev1.Secret, imgPullSecret *corev1.Secret) (batchv1.Job, error) {
 
+	// Continue the trace of the change that triggered the action, so that the agent run is part of the same trace
+	ctx, span := startSpan(extractTraceAnnotations(ctx, action.Annotations), "AgentAction.createAgentJob",
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+		trace.WithAttributes(attribute.String("k8s.resource.name", action.Name), semconv.K8SNamespaceName(action.Namespace)))
+	defer span.End()
+
 	// not checking for an existing job because that happens earlier during reconcile
 
 	labels := r.getAgentJobLabels(action)
-	env, envFrom := r.getAgentEnv(action, agentCfg, pvc)
+	env, envFrom := r.getAgentEnv(ctx, action, agentCfg, pvc)
 	volumes, volumeMounts := r.getAgentVolumes(ctx, log, action, agentCfg, pvc, configSecret, workdirSecret, imgPullSecret)
 
+	podTemplate := agentCfg.GetPodTemplate()
+	// The labels used by the operator to find the pod take precedence over the custom labels
+	podLabels := make(map[string]string, len(podTemplate.Labels)+len(labels))
+	for k, v := range podTemplate.Labels {
+		podLabels[k] = v
+	}
+	for k, v := range labels {
+		podLabels[k] = v
+	}
+	var resources corev1.ResourceRequirements
+	if podTemplate.Resources != nil {
+		resources = *podTemplate.Resources.DeepCopy()
+	}
+	var imagePullSecrets []corev1.LocalObjectReference
+	if imgPullSecret != nil {
+		imagePullSecrets = []corev1.LocalObjectReference{{Name: imgPullSecret.Name}}
+	}
+	podSecurityContext, err := agentCfg.GetPodSecurityContext()
+	if err != nil {
+		return batchv1.Job{}, err
+	}
+	containerSecurityContext, err := agentCfg.GetContainerSecurityContext()
+	if err != nil {
+		return batchv1.Job{}, err
+	}
+
 	porterJob := batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: action.Name + "-",
@@ -427,9 +810,11 @@ func (r *AgentActionReconciler) createAgentJob(ctx context.Context, log logr.Log
 				ObjectMeta: metav1.ObjectMeta{
 					GenerateName: action.Name + "-",
 					Namespace:    action.Namespace,
-					Labels:       labels,
+					Labels:       podLabels,
+					Annotations:  podTemplate.Annotations,
 				},
 				Spec: corev1.PodSpec{
+					InitContainers: getPluginInitContainers(action, agentCfg, env, envFrom, volumeMounts, resources, containerSecurityContext),
 					Containers: []corev1.Container{
 						{
 							Name:            "porter-agent",
@@ -441,23 +826,22 @@ func (r *AgentActionReconciler) createAgentJob(ctx context.Context, log logr.Log
 							EnvFrom:         envFrom,
 							VolumeMounts:    volumeMounts,
 							WorkingDir:      porterv1.VolumePorterWorkDirPath,
+							Resources:       resources,
+							SecurityContext: containerSecurityContext,
 						},
 					},
-					Volumes: volumes,
+					Volumes:           volumes,
+					NodeSelector:      podTemplate.NodeSelector,
+					Tolerations:       podTemplate.Tolerations,
+					Affinity:          podTemplate.Affinity,
+					PriorityClassName: podTemplate.PriorityClassName,
 					// If a Job is marked as failure, the pod has to be deleted when RestartPolicy is set to OnFailure to prevent the pod keeps restarting.
 					// To preserve the failed pods, the RestartPolicy needs to be set as Never. The AgentAction job will create a  new pod on retry and leave the failed ones alone.
 					// For more details, see the github issue: https://github.com/kubernetes/kubernetes/issues/74848#issuecomment-971487582
 					RestartPolicy:      "Never",
 					ServiceAccountName: agentCfg.GetServiceAccount(),
-					ImagePullSecrets:   nil, // TODO: Make pulling from a private registry possible
-					SecurityContext: &corev1.PodSecurityContext{
-						// Run as the well-known nonroot user that Porter uses for the invocation image and the agent
-						RunAsUser: ptr.To(int64(65532)),
-						// Porter builds the bundles with the root group having the same permissions as the owner
-						// So make sure that we are running as the root group
-						RunAsGroup: ptr.To(int64(0)),
-						FSGroup:    ptr.To(int64(0)),
-					},
+					ImagePullSecrets:   imagePullSecrets,
+					SecurityContext:    podSecurityContext,
 				},
 			},
 		},
@@ -477,68 +861,63 @@ func (r *AgentActionReconciler) createAgentJob(ctx context.Context, log logr.Log
 			log.V(Log0Error).Error(err, "error creating Porter agent job", "base64EncodedJob", badJobYaml)
 		}
 
-		return batchv1.Job{}, errors.Wrap(err, "error creating Porter agent job")
+		err = errors.Wrap(err, "error creating Porter agent job")
+		span.RecordError(err)
+		return batchv1.Job{}, err
 	}
 
+	span.SetAttributes(attribute.String("k8s.job.name", porterJob.Name))
 	log.V(Log4Debug).Info("Created Job for the Porter agent", "name", porterJob.Name)
+	r.Recorder.Event(action, "Normal", "CreateJob", fmt.Sprintf("created porter agent job %s", porterJob.Name))
 	return porterJob, nil
 }
 
-func (r *AgentActionReconciler) resolveAgentConfig(ctx context.Context, log logr.Logger, action *porterv1.AgentAction) (porterv1.AgentConfigSpecAdapter, error) {
+// resolveAgentConfig merges the agent configuration that applies to the action, see resolveAgentConfigLayers,
+// and returns the layer that supplied each field of the merged configuration.
+func (r *AgentActionReconciler) resolveAgentConfig(ctx context.Context, log logr.Logger, action *porterv1.AgentAction) (porterv1.AgentConfigSpecAdapter, porterv1.ConfigSources, error) {
 	log.V(Log5Trace).Info("Resolving porter agent configuration")
 
-	logConfig := func(level string, config *porterv1.AgentConfig) {
-		if config == nil || config.Name == "" {
-			return
-		}
-
-		log.V(Log4Debug).Info("Found porter agent configuration",
-			"level", level,
-			"namespace", config.Namespace,
-			"name", config.Name,
-			"plugin", config.Spec.PluginConfigFile)
+	var instance string
+	if action.Spec.AgentConfig != nil {
+		instance = action.Spec.AgentConfig.Name
 	}
-
-	// Read agent configuration defined at the system level
-	systemCfg := &porterv1.AgentConfig{}
-	err := r.Get(ctx, types.NamespacedName{Name: "default", Namespace: operatorNamespace}, systemCfg)
-	if err != nil && !apierrors.IsNotFound(err) {
-		return porterv1.AgentConfigSpecAdapter{}, errors.Wrap(err, "cannot retrieve system level porter agent configuration")
+	layers, mostSpecific, err := resolveAgentConfigLayers(ctx, log, r.Client, action.Namespace, instance)
+	if err != nil {
+		return porterv1.AgentConfigSpecAdapter{}, nil, err
 	}
-	logConfig("system", systemCfg)
 
-	// Read agent configuration defined at the namespace level
-	nsCfg := &porterv1.AgentConfig{}
-	err = r.Get(ctx, types.NamespacedName{Name: "default", Namespace: action.Namespace}, nsCfg)
-	if err != nil && !apierrors.IsNotFound(err) {
-		return porterv1.AgentConfigSpecAdapter{}, errors.Wrap(err, "cannot retrieve system level porter agent configuration")
+	// Apply overrides, each layer is deep merged into the previous layers.
+	// For example, if the namespace plugins are {"azure": {}, "hashicorp": {}} and the installation plugins are {"kubernetes": {}}
+	// the result of the merge is {"azure": {}, "hashicorp": {}, "kubernetes": {}}
+	spec, sources, err := porterv1.MergeAgentConfigLayers(layers...)
+	if err != nil {
+		return porterv1.AgentConfigSpecAdapter{}, nil, err
 	}
-	logConfig("namespace", nsCfg)
-
-	// Read agent configuration override
-	instCfg := &porterv1.AgentConfig{}
-	if action.Spec.AgentConfig != nil {
-		err = r.Get(ctx, types.NamespacedName{Name: action.Spec.AgentConfig.Name, Namespace: action.Namespace}, instCfg)
-		if err != nil && !apierrors.IsNotFound(err) {
-			return porterv1.AgentConfigSpecAdapter{}, errors.Wrap(err, "cannot retrieve system level porter agent configuration")
-		}
-		logConfig("instance", instCfg)
+	cfgList := porterv1.NewAgentConfigSpecAdapter(spec)
+
+	// The readiness is determined by the most specific AgentConfig, because it installs the plugins.
+	// When the configuration only comes from cluster configurations, there is nothing to install
+	// unless plugins are required, which must be installed by an AgentConfig in the namespace.
+	var ready bool
+	if mostSpecific != nil {
+		ready = hasInstalledPlugins(mostSpecific, cfgList)
+	} else if len(layers) > 0 {
+		ready = cfgList.Plugins.IsZero()
 	}
-
-	// Apply overrides
-	// the merging logic here is each subsequent config will override the previous config.
-	// for example, if namespace Spec.Plugins is {"azure": {}, "hashicorp": {}} and installation Spec.Plugins is {"kubernetes": {}}
-	// the result of the merge will be {"kubernetes": {}}
-	base := systemCfg
-	cfg, err := base.MergeConfigs(*nsCfg, *instCfg)
-	if err != nil {
-		return porterv1.AgentConfigSpecAdapter{}, err
+	// Keep using the plugins that were previously installed while the plugins are updated, or when the update failed,
+	// instead of blocking every action in the namespace until the AgentConfig is ready again.
+	if !ready && !action.CreatedByAgentConfig() && canUseActivePlugins(mostSpecific, cfgList) {
+		log.V(Log4Debug).Info("Using the previously installed plugins because the AgentConfig is not ready",
+			"agentconfig", mostSpecific.Name, "plugins", mostSpecific.Status.ActivePlugins.GetLocation())
+		cfgList.Plugins = porterv1.NewPluginsList(mostSpecific.Status.ActivePlugins.Plugins)
+		ready = true
 	}
-
-	if !cfg.Status.Ready && !action.CreatedByAgentConfig() {
-		return porterv1.AgentConfigSpecAdapter{}, errors.New("resolved agent configuration is not ready to be used. Waiting for the next retry")
+	if !ready && !action.CreatedByAgentConfig() {
+		if mostSpecific != nil {
+			return porterv1.AgentConfigSpecAdapter{}, nil, errors.Wrapf(errAgentConfigNotReady, "AgentConfig %s/%s", mostSpecific.Namespace, mostSpecific.Name)
+		}
+		return porterv1.AgentConfigSpecAdapter{}, nil, errors.Wrapf(errAgentConfigNotReady, "no AgentConfig in namespace %s installs the required plugins", action.Namespace)
 	}
-	cfgList := porterv1.NewAgentConfigSpecAdapter(cfg.Spec)
 
 	log.V(Log4Debug).Info("resolved porter agent configuration",
 		"porterImage", cfgList.GetPorterImage(),
@@ -548,64 +927,71 @@ func (r *AgentActionReconciler) resolveAgentConfig(ctx context.Context, log logr
 		"installationServiceAccount", cfgList.GetInstallationServiceAccount(),
 		"plugin", cfgList.Plugins.GetNames(),
 	)
-	return cfgList, nil
+	log.V(Log5Trace).Info("resolved porter agent configuration sources", "sources", sources.String())
+	return cfgList, sources, nil
 }
 
-func (r *AgentActionReconciler) resolvePorterConfig(ctx context.Context, log logr.Logger, action *porterv1.AgentAction) (porterv1.PorterConfigSpec, error) {
-	log.V(Log5Trace).Info("Resolving porter configuration file")
-
-	logConfig := func(level string, config *porterv1.PorterConfig) {
-		if config == nil || config.Name == "" {
-			return
-		}
-		log.V(Log4Debug).Info("Found porter config",
-			"level", level,
-			"namespace", config.Namespace,
-			"name", config.Name)
-	}
-
-	// Provide a safe default config in case nothing is defined anywhere
-	defaultCfg := porterv1.PorterConfigSpec{
-		DefaultStorage:       ptr.To("in-cluster-mongodb"),
-		DefaultSecretsPlugin: ptr.To("kubernetes.secrets"),
-		Storage: []porterv1.StorageConfig{
-			{PluginConfig: porterv1.PluginConfig{
-				Name:         "in-cluster-mongodb",
-				PluginSubKey: "mongodb",
-				Config:       runtime.RawExtension{Raw: []byte(`{"url":"mongodb://mongodb.porter-operator-system.svc.cluster.local"}`)},
-			}},
-		},
+// hasInstalledPlugins determines if an AgentConfig is ready and installed the resolved plugins.
+// The AgentConfig is only reconciled again after a less specific layer changes its plugins,
+// so until then it may still be ready with the previous plugins, and the plugin volume of the resolved plugins does not exist yet.
+func hasInstalledPlugins(agentCfg *porterv1.AgentConfig, spec porterv1.AgentConfigSpecAdapter) bool {
+	if !agentCfg.Status.Ready {
+		return false
 	}
+	if spec.Plugins.IsZero() {
+		return true
+	}
+	active := agentCfg.Status.ActivePlugins
+	return active != nil && active.PluginsHash == spec.Plugins.GetLabels()[porterv1.LabelPluginsHash]
+}
 
-	// Read agent configuration defined at the system level
-	systemCfg := &porterv1.PorterConfig{}
-	err := r.Get(ctx, types.NamespacedName{Name: "default", Namespace: operatorNamespace}, systemCfg)
-	if err != nil && !apierrors.IsNotFound(err) {
-		return porterv1.PorterConfigSpec{}, errors.Wrap(err, "cannot retrieve system level porter agent configuration")
+// canUseActivePlugins determines if an action can run with the plugins that were last installed
+// by an AgentConfig that is not ready, because its plugins are being updated or the update failed.
+// The plugins must have been delivered the same way, for example to an image in the same repository.
+func canUseActivePlugins(agentCfg *porterv1.AgentConfig, spec porterv1.AgentConfigSpecAdapter) bool {
+	if agentCfg == nil || agentCfg.Status.ActivePlugins == nil || isDeleted(agentCfg) {
+		return false
 	}
-	logConfig("system", systemCfg)
+	active := agentCfg.Status.ActivePlugins
+	if delivery := spec.GetPluginDelivery(); delivery.Mode == porterv1.PluginDeliveryImage {
+		return active.Image == delivery.GetImage(active.PluginsHash)
+	}
+	return active.Image == ""
+}
 
-	// Read agent configuration defined at the namespace level
-	nsCfg := &porterv1.PorterConfig{}
-	err = r.Get(ctx, types.NamespacedName{Name: "default", Namespace: action.Namespace}, nsCfg)
-	if err != nil && !apierrors.IsNotFound(err) {
-		return porterv1.PorterConfigSpec{}, errors.Wrap(err, "cannot retrieve namespace level porter agent configuration")
+// resolvePorterConfig merges the porter configuration that applies to the action, see resolvePorterConfigLayers,
+// and returns the layer that supplied each field of the merged configuration.
+func (r *AgentActionReconciler) resolvePorterConfig(ctx context.Context, log logr.Logger, action *porterv1.AgentAction) (porterv1.PorterConfigSpec, porterv1.ConfigSources, error) {
+	log.V(Log5Trace).Info("Resolving porter configuration file")
+
+	var instance string
+	if action.Spec.PorterConfig != nil {
+		instance = action.Spec.PorterConfig.Name
+	}
+	layers, err := resolvePorterConfigLayers(ctx, log, r.Client, action.Namespace, instance)
+	if err != nil {
+		return porterv1.PorterConfigSpec{}, nil, err
 	}
-	logConfig("namespace", nsCfg)
 
 	// Resolve final configuration
 	// We don't log the final config because we haven't yet added the feature to enable not having sensitive data in porter's config files
-	base := &defaultCfg
-	cfg, err := base.MergeConfig(systemCfg.Spec, nsCfg.Spec)
+	cfg, sources, err := porterv1.MergePorterConfigLayers(layers...)
 	if err != nil {
-		return porterv1.PorterConfigSpec{}, err
+		return porterv1.PorterConfigSpec{}, nil, err
 	}
 
-	return cfg, nil
+	return cfg, sources, nil
 }
 
-func (r *AgentActionReconciler) getAgentEnv(action *porterv1.AgentAction, agentCfg porterv1.AgentConfigSpecAdapter, pvc *corev1.PersistentVolumeClaim) ([]corev1.EnvVar, []corev1.EnvFromSource) {
-	sharedLabels := r.getSharedAgentLabels(action)
+func (r *AgentActionReconciler) getAgentEnv(ctx context.Context, action *porterv1.AgentAction, agentCfg porterv1.AgentConfigSpecAdapter, pvc *corev1.PersistentVolumeClaim) ([]corev1.EnvVar, []corev1.EnvFromSource) {
+	// The labels used by the operator to find the installer take precedence over the custom labels
+	installerLabels := make(map[string]string, len(agentCfg.GetInstallerPodLabels()))
+	for k, v := range agentCfg.GetInstallerPodLabels() {
+		installerLabels[k] = v
+	}
+	for k, v := range r.getSharedAgentLabels(action) {
+		installerLabels[k] = v
+	}
 
 	env := []corev1.EnvVar{
 		{
@@ -623,7 +1009,7 @@ func (r *AgentActionReconciler) getAgentEnv(action *porterv1.AgentAction, agentC
 		},
 		{
 			Name:  "LABELS",
-			Value: r.getFormattedInstallerLabels(sharedLabels),
+			Value: r.getFormattedInstallerLabels(installerLabels),
 		},
 		{
 			Name:  "JOB_VOLUME_NAME",
@@ -647,6 +1033,9 @@ func (r *AgentActionReconciler) getAgentEnv(action *porterv1.AgentAction, agentC
 		},
 	}
 
+	// Pass the trace context to porter so that its spans are part of the same trace
+	env = append(env, getTraceEnv(ctx)...)
+
 	env = append(env, action.Spec.Env...)
 
 	envFrom := []corev1.EnvFromSource{
@@ -715,7 +1104,7 @@ func (r *AgentActionReconciler) getAgentVolumes(ctx context.Context, log logr.Lo
 			Name: porterv1.VolumeImgPullSecretName,
 			VolumeSource: corev1.VolumeSource{
 				Secret: &corev1.SecretVolumeSource{
-					Items:      []corev1.KeyToPath{{Key: ".dockerconfigjson", Path: ".docker/config.json"}},
+					Items:      []corev1.KeyToPath{{Key: corev1.DockerConfigJsonKey, Path: ".docker/config.json"}},
 					SecretName: imgPullSecret.Name,
 					Optional:   ptr.To(false),
 				},
@@ -733,7 +1122,20 @@ func (r *AgentActionReconciler) getAgentVolumes(ctx context.Context, log logr.Lo
 		pluginsPVCName := agentCfg.GetPluginsPVCName(action.Namespace)
 
 		// Check if we should mount a PVC for plugins, it will be an empty string if no plugins are used
-		if pluginsPVCName != "" {
+		if pluginsPVCName != "" && !agentCfg.GetPluginDelivery().UsesVolume() {
+			// The plugins are copied into an empty volume by an init container, see getPluginInitContainers
+			log.V(Log4Debug).Info("mounting empty porter plugin volume", "mode", agentCfg.GetPluginDelivery().Mode)
+			volumes = append(volumes, corev1.Volume{
+				Name: porterv1.VolumePorterPluginsName,
+				VolumeSource: corev1.VolumeSource{
+					EmptyDir: &corev1.EmptyDirVolumeSource{},
+				},
+			})
+			volumeMounts = append(volumeMounts, corev1.VolumeMount{
+				Name:      porterv1.VolumePorterPluginsName,
+				MountPath: porterv1.VolumePorterPluginsPath,
+			})
+		} else if pluginsPVCName != "" {
 			log.V(Log4Debug).Info("mounting porter plugin volume", "claim name", pluginsPVCName)
 			volumes = append(volumes, corev1.Volume{
 				Name: porterv1.VolumePorterPluginsName,
@@ -751,6 +1153,10 @@ func (r *AgentActionReconciler) getAgentVolumes(ctx context.Context, log logr.Lo
 		}
 	}
 
+	if usesLocalPluginsContainer(action, agentCfg) {
+		volumes = append(volumes, getPluginSourceVolumes(agentCfg)...)
+	}
+
 	volumes = append(volumes, action.Spec.Volumes...)
 
 	volumeMounts = append(volumeMounts, action.Spec.VolumeMounts...)
@@ -758,6 +1164,31 @@ func (r *AgentActionReconciler) getAgentVolumes(ctx context.Context, log logr.Lo
 	return volumes, volumeMounts
 }
 
+// getPluginInitContainers returns the init containers that install the plugins from a source in the cluster,
+// and when the plugins are delivered with an image, that publish the plugin image or copy the plugins from it
+// into the empty plugin volume of the agent pod.
+func getPluginInitContainers(action *porterv1.AgentAction, agentCfg porterv1.AgentConfigSpecAdapter, env []corev1.EnvVar, envFrom []corev1.EnvFromSource,
+	volumeMounts []corev1.VolumeMount, resources corev1.ResourceRequirements, securityContext *corev1.SecurityContext) []corev1.Container {
+	var containers []corev1.Container
+	publish := isPluginImageAction(action, agentCfg)
+	if publish {
+		containers = append(containers, getInstallPluginsInitContainer(agentCfg, env, envFrom, volumeMounts, resources, securityContext))
+	} else if !action.CreatedByAgentConfig() && agentCfg.GetPluginImage() != "" {
+		containers = append(containers, getCopyPluginsInitContainer(agentCfg, resources, securityContext))
+	}
+
+	// The plugins from a source in the cluster are installed after the plugins from a feed
+	if usesLocalPluginsContainer(action, agentCfg) {
+		containers = append(containers, getLocalPluginsInitContainer(agentCfg, volumeMounts, resources, securityContext))
+	}
+
+	// The plugins are published once they are all installed
+	if publish {
+		containers = append(containers, getPublishPluginsInitContainer(agentCfg, volumeMounts, resources, securityContext))
+	}
+	return containers
+}
+
 func (r *AgentActionReconciler) getFormattedInstallerLabels(labels map[string]string) string {
 	// represent the shared labels that we are applying to all the things in a way that porter can accept on the command line
 	// These labels are added to the invocation image and should be sorted consistently
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	v1 "get.porter.sh/operator/api/v1"
 	"github.com/go-logr/logr"
@@ -16,10 +17,12 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 func TestPorterResourceStatus_ApplyAgentAction(t *testing.T) {
@@ -205,6 +208,16 @@ func TestAgentActionReconciler_Reconcile(t *testing.T) {
 		}
 	}
 
+	// Returns the events emitted since the last call
+	recorder := controller.Recorder.(*record.FakeRecorder)
+	drainEvents := func() []string {
+		var events []string
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
+		}
+		return events
+	}
+
 	triggerReconcile()
 
 	// Verify the action was picked up and the status initialized
@@ -222,6 +235,25 @@ func TestAgentActionReconciler_Reconcile(t *testing.T) {
 	assert.Equal(t, job.Name, action.Status.Job.Name, "expected ActiveJob to contain the job name")
 	assert.Equal(t, v1.PhasePending, action.Status.Phase, "incorrect Phase")
 	assert.True(t, apimeta.IsStatusConditionTrue(action.Status.Conditions, string(v1.ConditionScheduled)))
+	assert.Contains(t, drainEvents(), "Normal CreateJob created porter agent job "+job.Name)
+	assert.Equal(t, "namespace", action.Status.AgentConfigSources["retryLimit"], "expected the source of the agent configuration to be recorded")
+	assert.Equal(t, "default", action.Status.PorterConfigSources["default-storage"], "expected the source of the porter configuration to be recorded")
+	require.NotNil(t, action.Status.EffectiveAgentConfig, "expected the resolved agent configuration to be recorded")
+	assert.Equal(t, ptr.To(retryLimit), action.Status.EffectiveAgentConfig.RetryLimit)
+	require.NotNil(t, action.Status.EffectivePorterConfig, "expected the resolved porter configuration to be recorded")
+	assert.Equal(t, ptr.To("in-cluster-mongodb"), action.Status.EffectivePorterConfig.DefaultStorage)
+
+	// Verify the resources created for the agent are owned by the action
+	var pvcs corev1.PersistentVolumeClaimList
+	require.NoError(t, controller.List(ctx, &pvcs, client.InNamespace(namespace)))
+	require.Len(t, pvcs.Items, 1)
+	assert.True(t, metav1.IsControlledBy(&pvcs.Items[0], &action), "expected the agent volume to be owned by the action")
+	var secrets corev1.SecretList
+	require.NoError(t, controller.List(ctx, &secrets, client.InNamespace(namespace)))
+	require.NotEmpty(t, secrets.Items)
+	for _, secret := range secrets.Items {
+		assert.True(t, metav1.IsControlledBy(&secret, &action), "expected secret %s to be owned by the action", secret.Name)
+	}
 
 	// Start the job
 	job.Status.Active = 1
@@ -234,6 +266,7 @@ func TestAgentActionReconciler_Reconcile(t *testing.T) {
 	assert.Equal(t, job.Name, action.Status.Job.Name, "expected Job to contain the job name")
 	assert.Equal(t, v1.PhaseRunning, action.Status.Phase, "incorrect Phase")
 	assert.True(t, apimeta.IsStatusConditionTrue(action.Status.Conditions, string(v1.ConditionStarted)))
+	assert.Equal(t, []string{"Normal JobStarted porter agent job " + job.Name + " started"}, drainEvents())
 
 	// Complete the job
 	job.Status.Active = 0
@@ -247,6 +280,13 @@ func TestAgentActionReconciler_Reconcile(t *testing.T) {
 	require.NotNil(t, action.Status.Job, "expected Job to still be set")
 	assert.Equal(t, v1.PhaseSucceeded, action.Status.Phase, "incorrect Phase")
 	assert.True(t, apimeta.IsStatusConditionTrue(action.Status.Conditions, string(v1.ConditionComplete)))
+	assert.Equal(t, []string{"Normal JobCompleted porter agent job " + job.Name + " completed"}, drainEvents())
+
+	// Verify that the resources created for the agent were removed when it succeeded
+	require.NoError(t, controller.List(ctx, &pvcs, client.InNamespace(namespace)))
+	assert.Empty(t, pvcs.Items, "expected the agent volume to be removed")
+	require.NoError(t, controller.List(ctx, &secrets, client.InNamespace(namespace)))
+	assert.Empty(t, secrets.Items, "expected the agent secrets to be removed")
 
 	// Fail the pod once
 	job.Status.Active = 0
@@ -273,6 +313,7 @@ func TestAgentActionReconciler_Reconcile(t *testing.T) {
 	require.NotNil(t, action.Status.Job, "expected Job to still be set")
 	assert.Equal(t, v1.PhaseFailed, action.Status.Phase, "incorrect Phase")
 	assert.True(t, apimeta.IsStatusConditionTrue(action.Status.Conditions, string(v1.ConditionFailed)))
+	assert.Contains(t, drainEvents(), "Warning JobFailed porter agent job "+job.Name+" failed, see the job logs for details")
 
 	// Edit the action spec
 	action.Generation = 2
@@ -658,7 +699,7 @@ func TestAgentActionReconciler_createWorkdirSecret(t *testing.T) {
 				err := controller.Client.Create(context.Background(), secret)
 				require.NoError(t, err)
 			}
-			secret, err := controller.createWorkdirSecret(context.Background(), logr.Discard(), action)
+			secret, err := controller.createWorkdirSecret(context.Background(), logr.Discard(), action, v1.AgentConfigSpecAdapter{})
 			require.NoError(t, err)
 
 			// Verify the secret properties
@@ -681,6 +722,75 @@ func TestAgentActionReconciler_createWorkdirSecret(t *testing.T) {
 	}
 }
 
+func TestAgentActionReconciler_createImagePullSecret(t *testing.T) {
+	namespace := "test"
+	newSecret := func(name string, secretType corev1.SecretType, key string, data string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Type:       secretType,
+			Data:       map[string][]byte{key: []byte(data)},
+		}
+	}
+	testSA := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "installeraccount"},
+		ImagePullSecrets: []corev1.LocalObjectReference{
+			{Name: "dockerhub"},
+			{Name: "missing"},
+			{Name: "legacy"},
+			{Name: "not-a-docker-config"},
+		},
+	}
+
+	t.Run("merge secrets", func(t *testing.T) {
+		controller := setupAgentActionController(testSA,
+			newSecret("dockerhub", corev1.SecretTypeDockerConfigJson, corev1.DockerConfigJsonKey, `{"auths":{"docker.io":{"auth":"c2E="}}}`),
+			newSecret("legacy", corev1.SecretTypeDockercfg, corev1.DockerConfigKey, `{"quay.io":{"auth":"bGVnYWN5"},"ghcr.io":{"auth":"b2xk"}}`),
+			newSecret("not-a-docker-config", corev1.SecretTypeOpaque, "password", "secret"),
+			newSecret("agent-registry", corev1.SecretTypeDockerConfigJson, corev1.DockerConfigJsonKey, `{"auths":{"ghcr.io":{"auth":"bmV3"}}}`),
+		)
+		action := testAgentAction()
+		agentCfg := v1.NewAgentConfigSpecAdapter(v1.AgentConfigSpec{
+			InstallationServiceAccount: "installeraccount",
+			ImagePullSecrets:           []corev1.LocalObjectReference{{Name: "agent-registry"}},
+		})
+
+		secret, err := controller.createImagePullSecret(context.Background(), logr.Discard(), action, agentCfg)
+		require.NoError(t, err)
+		require.NotNil(t, secret)
+		assert.Equal(t, corev1.SecretTypeDockerConfigJson, secret.Type, "incorrect secret type")
+		assertSharedAgentLabels(t, secret.Labels)
+		assertContains(t, secret.Labels, v1.LabelSecretType, v1.SecretTypeImagePullSecret, "incorrect label")
+		wantCfg := `{"auths":{"docker.io":{"auth":"c2E="},"ghcr.io":{"auth":"bmV3"},"quay.io":{"auth":"bGVnYWN5"}}}`
+		assert.JSONEq(t, wantCfg, string(secret.Data[corev1.DockerConfigJsonKey]), "the secrets from the agent config should take precedence")
+
+		// The secret should be reused when the action is reconciled again
+		existing, err := controller.createImagePullSecret(context.Background(), logr.Discard(), action, agentCfg)
+		require.NoError(t, err)
+		assert.Equal(t, secret.Name, existing.Name, "expected the existing image pull secret to be reused")
+	})
+
+	t.Run("missing agent config secret", func(t *testing.T) {
+		controller := setupAgentActionController(testSA)
+		agentCfg := v1.NewAgentConfigSpecAdapter(v1.AgentConfigSpec{
+			InstallationServiceAccount: "installeraccount",
+			ImagePullSecrets:           []corev1.LocalObjectReference{{Name: "agent-registry"}},
+		})
+
+		_, err := controller.createImagePullSecret(context.Background(), logr.Discard(), testAgentAction(), agentCfg)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "error retrieving image pull secret agent-registry")
+	})
+
+	t.Run("no image pull secrets", func(t *testing.T) {
+		controller := setupAgentActionController(testSA)
+		agentCfg := v1.NewAgentConfigSpecAdapter(v1.AgentConfigSpec{InstallationServiceAccount: "installeraccount"})
+
+		secret, err := controller.createImagePullSecret(context.Background(), logr.Discard(), testAgentAction(), agentCfg)
+		require.NoError(t, err)
+		assert.Nil(t, secret)
+	})
+}
+
 func TestAgentActionReconciler_createAgentJob(t *testing.T) {
 	controller := setupAgentActionController()
 
@@ -727,6 +837,8 @@ func TestAgentActionReconciler_createAgentJob(t *testing.T) {
 	assert.Equal(t, ptr.To(int64(65532)), podTemplate.Spec.SecurityContext.RunAsUser, "incorrect RunAsUser")
 	assert.Equal(t, ptr.To(int64(0)), podTemplate.Spec.SecurityContext.RunAsGroup, "incorrect RunAsGroup")
 	assert.Equal(t, ptr.To(int64(0)), podTemplate.Spec.SecurityContext.FSGroup, "incorrect FSGroup")
+	assert.Equal(t, ptr.To(true), podTemplate.Spec.SecurityContext.RunAsNonRoot, "incorrect RunAsNonRoot")
+	assert.Equal(t, &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}, podTemplate.Spec.SecurityContext.SeccompProfile, "incorrect SeccompProfile")
 
 	// Verify the agent container
 	agentContainer := podTemplate.Spec.Containers[0]
@@ -734,6 +846,7 @@ func TestAgentActionReconciler_createAgentJob(t *testing.T) {
 	assert.Equal(t, "getporter/custom-agent:v1.0.0", agentContainer.Image, "incorrect agent image")
 	assert.Equal(t, corev1.PullPolicy("Always"), agentContainer.ImagePullPolicy, "incorrect agent pull policy")
 	assert.Equal(t, []string{"installation", "apply", "installation.yaml"}, agentContainer.Args, "incorrect agent command arguments")
+	assert.Equal(t, v1.DefaultAgentContainerSecurityContext(), agentContainer.SecurityContext, "incorrect agent container security context")
 	assertEnvVar(t, agentContainer.Env, "PORTER_RUNTIME_DRIVER", "kubernetes")
 	assertEnvVar(t, agentContainer.Env, "KUBE_NAMESPACE", "test")
 	assertEnvVar(t, agentContainer.Env, "IN_CLUSTER", "true")
@@ -830,6 +943,7 @@ func TestAgentActionReconciler_createAgentJob_withImagePullSecrets(t *testing.T)
 	assert.Equal(t, v1.VolumePorterWorkDirName, podTemplate.Spec.Volumes[2].Name, "expected the porter-workdir volume")
 	assert.Equal(t, v1.VolumeImgPullSecretName, podTemplate.Spec.Volumes[3].Name, "expected the img-pull-secret volume")
 	assert.Equal(t, testSA.ImagePullSecrets[0].Name, podTemplate.Spec.Volumes[3].Secret.SecretName, "expected the service account image pull secret name")
+	assert.Equal(t, []corev1.LocalObjectReference{{Name: imgPullSecret.Name}}, podTemplate.Spec.ImagePullSecrets, "expected the image pull secret to be used to pull the agent image")
 	assert.Equal(t, v1.VolumePorterPluginsName, podTemplate.Spec.Volumes[4].Name, "expected the porter-workdir volume")
 	assert.Equal(t, "porteraccount", podTemplate.Spec.ServiceAccountName, "incorrect service account for the pod")
 	assert.Equal(t, ptr.To(int64(65532)), podTemplate.Spec.SecurityContext.RunAsUser, "incorrect RunAsUser")
@@ -861,6 +975,66 @@ func TestAgentActionReconciler_createAgentJob_withImagePullSecrets(t *testing.T)
 
 }
 
+func TestAgentActionReconciler_createAgentJob_withPodTemplate(t *testing.T) {
+	controller := setupAgentActionController()
+
+	action := testAgentAction()
+	tolerations := []corev1.Toleration{{Key: "tooling", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}}
+	affinity := &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+			MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "kubernetes.io/arch", Operator: corev1.NodeSelectorOpIn, Values: []string{"amd64"}}},
+		}}},
+	}}
+	resources := &corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+		Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+	}
+	agentCfg := v1.NewAgentConfigSpecAdapter(v1.AgentConfigSpec{
+		PorterRepository: "getporter/custom-agent",
+		PorterVersion:    "v1.0.0",
+		ServiceAccount:   "porteraccount",
+		PodTemplate: &v1.AgentPodTemplate{
+			Labels:            map[string]string{"team": "platform", v1.LabelManaged: "false"},
+			Annotations:       map[string]string{"example.com/owner": "platform"},
+			Resources:         resources,
+			NodeSelector:      map[string]string{"pool": "tooling"},
+			Tolerations:       tolerations,
+			Affinity:          affinity,
+			PriorityClassName: "porter-agent",
+		},
+	})
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "mypvc"}}
+	configSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "mysecret"}}
+	workDirSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "mysecret"}}
+	job, err := controller.createAgentJob(context.Background(), logr.Discard(), action, agentCfg, pvc, configSecret, workDirSecret, nil)
+	require.NoError(t, err)
+
+	podTemplate := job.Spec.Template
+	assertSharedAgentLabels(t, podTemplate.Labels)
+	assertContains(t, podTemplate.Labels, "team", "platform", "expected the custom label on the pod")
+	assert.NotContains(t, job.Labels, "team", "the custom labels should only be applied to the pod")
+	assert.Equal(t, map[string]string{"example.com/owner": "platform"}, podTemplate.Annotations, "incorrect pod annotations")
+	assert.Equal(t, map[string]string{"pool": "tooling"}, podTemplate.Spec.NodeSelector, "incorrect node selector")
+	assert.Equal(t, tolerations, podTemplate.Spec.Tolerations, "incorrect tolerations")
+	assert.Equal(t, affinity, podTemplate.Spec.Affinity, "incorrect affinity")
+	assert.Equal(t, "porter-agent", podTemplate.Spec.PriorityClassName, "incorrect priority class")
+	assert.Equal(t, *resources, podTemplate.Spec.Containers[0].Resources, "incorrect agent container resources")
+}
+
+func TestAgentActionReconciler_getAgentEnv_withInstallerPodLabels(t *testing.T) {
+	controller := setupAgentActionController()
+
+	action := testAgentAction()
+	agentCfg := v1.NewAgentConfigSpecAdapter(v1.AgentConfigSpec{
+		InstallationServiceAccount: "installeraccount",
+		InstallerPodLabels:         map[string]string{"team": "platform", v1.LabelJobType: "custom"},
+	})
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "mypvc"}}
+
+	env, _ := controller.getAgentEnv(context.Background(), action, agentCfg, pvc)
+	assertEnvVar(t, env, "LABELS", "getporter.org/jobType=bundle-installer getporter.org/managed=true getporter.org/resourceGeneration=1 getporter.org/resourceKind=AgentAction getporter.org/resourceName=porter-hello getporter.org/retry= team=platform testLabel=abc123")
+}
+
 func TestAgentActionReconciler_getAgentVolumes_agentconfigaction(t *testing.T) {
 	controller := setupAgentActionController()
 	action := testAgentAction()
@@ -899,6 +1073,157 @@ func TestAgentActionReconciler_getAgentVolumes_agentconfigaction(t *testing.T) {
 	assertVolumeMount(t, volumeMountsForAgentCfg, v1.VolumePorterWorkDirName, v1.VolumePorterWorkDirPath)
 }
 
+func TestAgentActionReconciler_createAgentJob_withPluginDelivery(t *testing.T) {
+	newAgentCfg := func(delivery v1.PluginDelivery) v1.AgentConfigSpecAdapter {
+		return v1.NewAgentConfigSpecAdapter(v1.AgentConfigSpec{
+			ServiceAccount: "porteraccount",
+			PluginConfigFile: &v1.PluginFileSpec{
+				SchemaVersion: "1.0.0",
+				Plugins:       map[string]v1.Plugin{"kubernetes": {Version: "v1.0.0"}},
+			},
+			PluginDelivery: &delivery,
+		})
+	}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "mypvc"}}
+	configSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "mysecret"}}
+	workDirSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "mysecret"}}
+
+	assertEmptyPluginVolume := func(t *testing.T, podSpec corev1.PodSpec) {
+		var found bool
+		for _, volume := range podSpec.Volumes {
+			if volume.Name == v1.VolumePorterPluginsName {
+				found = true
+				assert.NotNil(t, volume.EmptyDir, "expected the plugin volume to be an emptyDir")
+				assert.Nil(t, volume.PersistentVolumeClaim, "the plugin volume should not use a pvc")
+			}
+		}
+		assert.True(t, found, "expected the plugin volume")
+		assertVolumeMount(t, podSpec.Containers[0].VolumeMounts, v1.VolumePorterPluginsName, v1.VolumePorterPluginsPath)
+	}
+
+	t.Run("image", func(t *testing.T) {
+		controller := setupAgentActionController()
+		agentCfg := newAgentCfg(v1.PluginDelivery{Mode: v1.PluginDeliveryImage, Repository: "example.com/porter-plugins"})
+		job, err := controller.createAgentJob(context.Background(), logr.Discard(), testAgentAction(), agentCfg, pvc, configSecret, workDirSecret, nil)
+		require.NoError(t, err)
+
+		podSpec := job.Spec.Template.Spec
+		assertEmptyPluginVolume(t, podSpec)
+		require.Len(t, podSpec.InitContainers, 1)
+		initContainer := podSpec.InitContainers[0]
+		hash := agentCfg.Plugins.GetLabels()[v1.LabelPluginsHash]
+		assert.Equal(t, "example.com/porter-plugins:"+hash, initContainer.Image, "the plugins should be copied from the image published for the plugins")
+		assert.Equal(t, []string{"cp", "-R", "/plugins/.", v1.VolumePorterPluginsPath}, initContainer.Command)
+		assertVolumeMount(t, initContainer.VolumeMounts, v1.VolumePorterPluginsName, v1.VolumePorterPluginsPath)
+	})
+
+	t.Run("publish image", func(t *testing.T) {
+		controller := setupAgentActionController()
+		agentCfg := newAgentCfg(v1.PluginDelivery{Mode: v1.PluginDeliveryImage, Repository: "example.com/porter-plugins"})
+		// The action created by the AgentConfig to publish the plugins
+		action := testAgentAction()
+		action.SetOwnerReferences([]metav1.OwnerReference{{Kind: v1.KindAgentConfig}})
+		action.Spec.Args = []string{"plugins", "list", "-o", "json"}
+		action.Spec.Volumes = []corev1.Volume{{Name: v1.VolumePorterPluginsName, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}
+		action.Spec.VolumeMounts = []corev1.VolumeMount{{Name: v1.VolumePorterPluginsName, MountPath: v1.VolumePorterPluginsPath}}
+		job, err := controller.createAgentJob(context.Background(), logr.Discard(), action, agentCfg, pvc, configSecret, workDirSecret, nil)
+		require.NoError(t, err)
+
+		podSpec := job.Spec.Template.Spec
+		assertEmptyPluginVolume(t, podSpec)
+		require.Len(t, podSpec.InitContainers, 2)
+		installContainer := podSpec.InitContainers[0]
+		assert.Equal(t, "install-plugins", installContainer.Name)
+		assert.Equal(t, agentCfg.GetPorterImage(), installContainer.Image)
+		assert.Equal(t, []string{"plugins", "install", "-f", "plugins.yaml"}, installContainer.Args)
+		assertVolumeMount(t, installContainer.VolumeMounts, v1.VolumePorterWorkDirName, v1.VolumePorterWorkDirPath)
+		assertVolumeMount(t, installContainer.VolumeMounts, v1.VolumePorterPluginsName, v1.VolumePorterPluginsPath)
+
+		publishContainer := podSpec.InitContainers[1]
+		assert.Equal(t, "publish-plugins", publishContainer.Name)
+		assert.Equal(t, v1.DefaultPluginPublisherImage, publishContainer.Image)
+		require.Len(t, publishContainer.Command, 3)
+		hash := agentCfg.Plugins.GetLabels()[v1.LabelPluginsHash]
+		assert.Contains(t, publishContainer.Command[2], "tar -cf '/porter-shared/plugins.tar' -C '/app/.porter' 'plugins'")
+		assert.Contains(t, publishContainer.Command[2], "crane append --base 'busybox:1.36' --new_layer '/porter-shared/plugins.tar' --new_tag 'example.com/porter-plugins:"+hash+"'")
+		assert.Contains(t, publishContainer.Env, corev1.EnvVar{Name: "DOCKER_CONFIG", Value: "/home/nonroot/.docker"})
+		assertVolumeMount(t, publishContainer.VolumeMounts, v1.VolumePorterPluginsName, v1.VolumePorterPluginsPath)
+		assertVolumeMount(t, publishContainer.VolumeMounts, v1.VolumePorterSharedName, v1.VolumePorterSharedPath)
+
+		// The agent lists the published plugins
+		assert.Equal(t, []string{"plugins", "list", "-o", "json"}, podSpec.Containers[0].Args)
+	})
+
+	t.Run("volume", func(t *testing.T) {
+		controller := setupAgentActionController()
+		agentCfg := newAgentCfg(v1.PluginDelivery{})
+		job, err := controller.createAgentJob(context.Background(), logr.Discard(), testAgentAction(), agentCfg, pvc, configSecret, workDirSecret, nil)
+		require.NoError(t, err)
+		assert.Empty(t, job.Spec.Template.Spec.InitContainers, "the plugins on a volume should not use an init container")
+	})
+}
+
+func TestAgentActionReconciler_createAgentJob_withPluginSource(t *testing.T) {
+	const checksum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	agentCfg := v1.NewAgentConfigSpecAdapter(v1.AgentConfigSpec{
+		ServiceAccount: "porteraccount",
+		PluginConfigFile: &v1.PluginFileSpec{
+			SchemaVersion: "1.0.0",
+			Plugins: map[string]v1.Plugin{
+				"azure": {Version: "v1.0.0"},
+				"kubernetes": {Source: &v1.PluginSource{
+					PersistentVolumeClaim: &v1.PluginArchiveVolumeRef{ClaimName: "plugin-archives", Path: "kubernetes.tgz"},
+					SHA256:                checksum,
+				}},
+			},
+		},
+	})
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "mypvc"}}
+	configSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "mysecret"}}
+	workDirSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "mysecret"}}
+
+	// The action created by the AgentConfig to install the plugins on its volume
+	action := testAgentAction()
+	action.SetOwnerReferences([]metav1.OwnerReference{{Kind: v1.KindAgentConfig}})
+	action.Spec.Args = []string{"plugins", "install", "-f", "plugins.yaml"}
+	action.Spec.Volumes = []corev1.Volume{{Name: v1.VolumePorterPluginsName, VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "plugins"}}}}
+	action.Spec.VolumeMounts = []corev1.VolumeMount{{Name: v1.VolumePorterPluginsName, MountPath: v1.VolumePorterPluginsPath, SubPath: "plugins"}}
+
+	controller := setupAgentActionController()
+	job, err := controller.createAgentJob(context.Background(), logr.Discard(), action, agentCfg, pvc, configSecret, workDirSecret, nil)
+	require.NoError(t, err)
+
+	podSpec := job.Spec.Template.Spec
+	require.Len(t, podSpec.InitContainers, 1)
+	initContainer := podSpec.InitContainers[0]
+	assert.Equal(t, "install-local-plugins", initContainer.Name)
+	assert.Equal(t, agentCfg.GetPorterImage(), initContainer.Image)
+	require.Len(t, initContainer.Command, 3)
+	assert.Contains(t, initContainer.Command[2], "echo '"+checksum+"  /app/plugin-sources/kubernetes/kubernetes.tgz' | sha256sum -c -", "the archive should be verified before it is installed")
+	assert.Contains(t, initContainer.Command[2], "tar -xzf '/app/plugin-sources/kubernetes/kubernetes.tgz' -C '/app/.porter/plugins/kubernetes'")
+	assert.NotContains(t, initContainer.Command[2], "azure", "plugins from a feed are installed by porter")
+	require.Len(t, initContainer.VolumeMounts, 2)
+	assert.Equal(t, corev1.VolumeMount{Name: v1.VolumePorterPluginsName, MountPath: v1.VolumePorterPluginsPath, SubPath: "plugins"}, initContainer.VolumeMounts[0])
+	assert.Equal(t, corev1.VolumeMount{Name: "plugin-source-kubernetes", MountPath: "/app/plugin-sources/kubernetes", ReadOnly: true}, initContainer.VolumeMounts[1])
+
+	var found bool
+	for _, volume := range podSpec.Volumes {
+		if volume.Name == "plugin-source-kubernetes" {
+			found = true
+			require.NotNil(t, volume.PersistentVolumeClaim)
+			assert.Equal(t, "plugin-archives", volume.PersistentVolumeClaim.ClaimName)
+			assert.True(t, volume.PersistentVolumeClaim.ReadOnly)
+		}
+	}
+	assert.True(t, found, "expected the volume with the plugin archive")
+
+	// The other actions of the AgentConfig use the installed plugins
+	action.Spec.Args = []string{"plugins", "list", "-o", "json"}
+	job, err = controller.createAgentJob(context.Background(), logr.Discard(), action, agentCfg, pvc, configSecret, workDirSecret, nil)
+	require.NoError(t, err)
+	assert.Empty(t, job.Spec.Template.Spec.InitContainers)
+}
+
 // Ensure that we can create a valid AgentAction when no plugins were specified for the AgentConfig
 // In which case we should not mount porter-plugins into the agent
 func TestAgentActionReconciler_NoPluginsSpecified(t *testing.T) {
@@ -965,10 +1290,10 @@ func TestAgentActionReconciler_resolveAgentConfig(t *testing.T) {
 	actionWithNoOverride.Name = "no override"
 	controller := setupAgentActionController(&systemCfg, &overrideCfg, actionWithOverride, actionWithNoOverride)
 
-	_, err := controller.resolveAgentConfig(context.Background(), logr.Discard(), actionWithOverride)
+	_, _, err := controller.resolveAgentConfig(context.Background(), logr.Discard(), actionWithOverride)
 	require.ErrorContains(t, err, "resolved agent configuration is not ready to be used")
 
-	cfg, err := controller.resolveAgentConfig(context.Background(), logr.Discard(), actionWithNoOverride)
+	cfg, _, err := controller.resolveAgentConfig(context.Background(), logr.Discard(), actionWithNoOverride)
 	require.NoError(t, err)
 	require.Equal(t, "v1.0", cfg.GetPorterVersion())
 
@@ -977,11 +1302,248 @@ func TestAgentActionReconciler_resolveAgentConfig(t *testing.T) {
 		{Kind: v1.KindAgentConfig},
 	}
 	actionWithOverride.SetOwnerReferences(agentCfgRef)
-	cfg, err = controller.resolveAgentConfig(context.Background(), logr.Discard(), actionWithOverride)
+	cfg, _, err = controller.resolveAgentConfig(context.Background(), logr.Discard(), actionWithOverride)
 	require.NoError(t, err)
 	require.Equal(t, "v2", cfg.GetPorterVersion())
 }
 
+func TestAgentActionReconciler_resolveAgentConfig_ActivePlugins(t *testing.T) {
+	oldPlugins := map[string]v1.Plugin{"kubernetes": {Version: "v1.0.0"}}
+	agentCfg := v1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test"},
+		Spec: v1.AgentConfigSpec{
+			PluginConfigFile: &v1.PluginFileSpec{Plugins: map[string]v1.Plugin{"kubernetes": {Version: "v1.1.0"}}},
+		},
+		Status: v1.AgentConfigStatus{
+			Ready: false,
+			ActivePlugins: &v1.ActivePlugins{
+				PluginsHash:           v1.NewPluginsList(oldPlugins).GetLabels()[v1.LabelPluginsHash],
+				PersistentVolumeClaim: v1.NewPluginsList(oldPlugins).GetPVCName("test"),
+				Plugins:               oldPlugins,
+			},
+		},
+	}
+	action := testAgentAction()
+	controller := setupAgentActionController(&agentCfg, action)
+
+	cfg, _, err := controller.resolveAgentConfig(context.Background(), logr.Discard(), action)
+	require.NoError(t, err, "the action should not wait while the plugins are updated")
+	assert.Equal(t, agentCfg.Status.ActivePlugins.PersistentVolumeClaim, cfg.GetPluginsPVCName(action.Namespace), "the action should use the previously installed plugins")
+
+	// The action that installs the new plugins uses the plugins from the spec
+	action.SetOwnerReferences([]metav1.OwnerReference{{Kind: v1.KindAgentConfig}})
+	cfg, _, err = controller.resolveAgentConfig(context.Background(), logr.Discard(), action)
+	require.NoError(t, err)
+	plugin, _ := cfg.Plugins.GetByName("kubernetes")
+	assert.Equal(t, "v1.1.0", plugin.Version)
+
+	// The previously installed plugins cannot be used when the plugins are now delivered with an image
+	agentCfg.Spec.PluginDelivery = &v1.PluginDelivery{Mode: v1.PluginDeliveryImage, Repository: "example.com/porter-plugins"}
+	require.NoError(t, controller.Update(context.Background(), &agentCfg))
+	action.SetOwnerReferences(nil)
+	_, _, err = controller.resolveAgentConfig(context.Background(), logr.Discard(), action)
+	require.ErrorContains(t, err, "resolved agent configuration is not ready to be used")
+
+	// The previously published plugin image is used while the plugins are updated
+	oldHash := v1.NewPluginsList(oldPlugins).GetLabels()[v1.LabelPluginsHash]
+	agentCfg.Status.ActivePlugins = &v1.ActivePlugins{PluginsHash: oldHash, Image: "example.com/porter-plugins:" + oldHash, Plugins: oldPlugins}
+	require.NoError(t, controller.Status().Update(context.Background(), &agentCfg))
+	cfg, _, err = controller.resolveAgentConfig(context.Background(), logr.Discard(), action)
+	require.NoError(t, err)
+	assert.Equal(t, agentCfg.Status.ActivePlugins.Image, cfg.GetPluginImage(), "the action should use the previously published plugin image")
+}
+
+func TestAgentActionReconciler_resolveAgentConfig_StalePlugins(t *testing.T) {
+	nsPlugins := map[string]v1.Plugin{"kubernetes": {Version: "v1.0.0"}}
+	systemCfg := v1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: operatorNamespace},
+		Spec: v1.AgentConfigSpec{
+			PluginConfigFile: &v1.PluginFileSpec{Plugins: map[string]v1.Plugin{"azure": {}}},
+		},
+		Status: v1.AgentConfigStatus{Ready: true},
+	}
+	// The namespace AgentConfig is still ready with the plugins that it installed before the system level added a plugin
+	nsCfg := v1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test"},
+		Spec: v1.AgentConfigSpec{
+			PluginConfigFile: &v1.PluginFileSpec{Plugins: nsPlugins},
+		},
+		Status: v1.AgentConfigStatus{
+			Ready: true,
+			ActivePlugins: &v1.ActivePlugins{
+				PluginsHash:           v1.NewPluginsList(nsPlugins).GetLabels()[v1.LabelPluginsHash],
+				PersistentVolumeClaim: v1.NewPluginsList(nsPlugins).GetPVCName("test"),
+				Plugins:               nsPlugins,
+			},
+		},
+	}
+	action := testAgentAction()
+	controller := setupAgentActionController(&systemCfg, &nsCfg, action)
+
+	cfg, _, err := controller.resolveAgentConfig(context.Background(), logr.Discard(), action)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kubernetes"}, cfg.Plugins.GetNames(), "the action should use the installed plugins until the merged plugins are installed")
+	assert.Equal(t, nsCfg.Status.ActivePlugins.PersistentVolumeClaim, cfg.GetPluginsPVCName(action.Namespace))
+
+	// Without installed plugins to fall back to, the action waits for the merged plugins to be installed
+	nsCfg.Status.ActivePlugins = nil
+	require.NoError(t, controller.Status().Update(context.Background(), &nsCfg))
+	_, _, err = controller.resolveAgentConfig(context.Background(), logr.Discard(), action)
+	require.ErrorContains(t, err, "resolved agent configuration is not ready to be used")
+}
+
+func TestAgentActionReconciler_resolveAgentConfig_ClusterConfig(t *testing.T) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"team": "blue"}}}
+	allNamespaces := &v1.ClusterAgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "all"},
+		Spec: v1.ClusterAgentConfigSpec{
+			AgentConfigSpec: v1.AgentConfigSpec{
+				PorterRepository: "example.com/porter-agent",
+				PorterVersion:    "v1.0",
+			},
+		},
+	}
+	blueTeam := &v1.ClusterAgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "blue"},
+		Spec: v1.ClusterAgentConfigSpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "blue"}},
+			Priority:          10,
+			AgentConfigSpec: v1.AgentConfigSpec{
+				PorterVersion: "v1.1",
+			},
+		},
+	}
+	redTeam := &v1.ClusterAgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "red"},
+		Spec: v1.ClusterAgentConfigSpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "red"}},
+			Priority:          20,
+			AgentConfigSpec: v1.AgentConfigSpec{
+				PorterVersion: "v1.2",
+			},
+		},
+	}
+
+	t.Run("cluster configs only", func(t *testing.T) {
+		action := testAgentAction()
+		controller := setupAgentActionController(ns, allNamespaces, blueTeam, redTeam, action)
+
+		cfg, _, err := controller.resolveAgentConfig(context.Background(), logr.Discard(), action)
+		require.NoError(t, err, "a cluster config without plugins should be ready to use")
+		assert.Equal(t, "example.com/porter-agent", cfg.GetPorterRepository())
+		assert.Equal(t, "v1.1", cfg.GetPorterVersion(), "the selected config with the highest priority should win")
+	})
+
+	t.Run("namespace config overrides cluster configs", func(t *testing.T) {
+		action := testAgentAction()
+		nsCfg := &v1.AgentConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: action.Namespace},
+			Spec:       v1.AgentConfigSpec{PorterVersion: "v2.0"},
+			Status:     v1.AgentConfigStatus{Ready: true},
+		}
+		controller := setupAgentActionController(ns, allNamespaces, blueTeam, redTeam, nsCfg, action)
+
+		cfg, sources, err := controller.resolveAgentConfig(context.Background(), logr.Discard(), action)
+		require.NoError(t, err)
+		assert.Equal(t, "example.com/porter-agent", cfg.GetPorterRepository())
+		assert.Equal(t, "v2.0", cfg.GetPorterVersion())
+		assert.Equal(t, "ClusterAgentConfig/all", sources["porterRepository"])
+		assert.Equal(t, "namespace", sources["porterVersion"])
+	})
+
+	t.Run("cluster config with plugins", func(t *testing.T) {
+		action := testAgentAction()
+		withPlugins := allNamespaces.DeepCopy()
+		withPlugins.Spec.PluginConfigFile = &v1.PluginFileSpec{
+			SchemaVersion: "1.0.0",
+			Plugins:       map[string]v1.Plugin{"kubernetes": {Version: "v1.0.0"}},
+		}
+		controller := setupAgentActionController(ns, withPlugins, action)
+
+		_, _, err := controller.resolveAgentConfig(context.Background(), logr.Discard(), action)
+		require.ErrorContains(t, err, "resolved agent configuration is not ready to be used",
+			"plugins must be installed by an AgentConfig in the namespace")
+	})
+}
+
+func TestAgentActionReconciler_resolvePorterConfig_ClusterConfig(t *testing.T) {
+	action := testAgentAction()
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: action.Namespace, Labels: map[string]string{"team": "blue"}}}
+	low := &v1.ClusterPorterConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "b-low"},
+		Spec: v1.ClusterPorterConfigSpec{
+			PorterConfigSpec: v1.PorterConfigSpec{
+				Verbosity:      ptr.To("info"),
+				DefaultStorage: ptr.To("cluster-storage"),
+			},
+		},
+	}
+	high := &v1.ClusterPorterConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "a-high"},
+		Spec: v1.ClusterPorterConfigSpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "blue"}},
+			Priority:          1,
+			PorterConfigSpec: v1.PorterConfigSpec{
+				Verbosity: ptr.To("debug"),
+			},
+		},
+	}
+	unselected := &v1.ClusterPorterConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "unselected"},
+		Spec: v1.ClusterPorterConfigSpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "red"}},
+			Priority:          100,
+			PorterConfigSpec: v1.PorterConfigSpec{
+				Verbosity: ptr.To("error"),
+			},
+		},
+	}
+	nsCfg := &v1.PorterConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: action.Namespace},
+		Spec: v1.PorterConfigSpec{
+			DefaultStorage: ptr.To("namespace-storage"),
+		},
+	}
+	controller := setupAgentActionController(ns, low, high, unselected, nsCfg, action)
+
+	cfg, sources, err := controller.resolvePorterConfig(context.Background(), logr.Discard(), action)
+	require.NoError(t, err)
+	assert.Equal(t, "ClusterPorterConfig/a-high", sources["verbosity"])
+	assert.Equal(t, "namespace", sources["default-storage"])
+	assert.Equal(t, "default", sources["storage[in-cluster-mongodb].config.url"])
+	assert.Equal(t, "debug", *cfg.Verbosity, "the selected config with the highest priority should win")
+	assert.Equal(t, "namespace-storage", *cfg.DefaultStorage, "the namespace config should override the cluster configs")
+	assert.Equal(t, "kubernetes.secrets", *cfg.DefaultSecretsPlugin, "the operator defaults should be kept")
+}
+
+func TestAgentActionReconciler_resolvePorterConfig_Reference(t *testing.T) {
+	action := testAgentAction()
+	nsCfg := &v1.PorterConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: action.Namespace},
+		Spec: v1.PorterConfigSpec{
+			Verbosity:      ptr.To("info"),
+			DefaultStorage: ptr.To("namespace-storage"),
+		},
+	}
+	instCfg := &v1.PorterConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-storage", Namespace: action.Namespace},
+		Spec: v1.PorterConfigSpec{
+			DefaultStorage: ptr.To("team-storage"),
+		},
+	}
+	controller := setupAgentActionController(nsCfg, instCfg, action)
+
+	action.Spec.PorterConfig = &corev1.LocalObjectReference{Name: instCfg.Name}
+	cfg, _, err := controller.resolvePorterConfig(context.Background(), logr.Discard(), action)
+	require.NoError(t, err)
+	assert.Equal(t, "team-storage", *cfg.DefaultStorage, "the referenced config should override the namespace config")
+	assert.Equal(t, "info", *cfg.Verbosity, "the namespace config should be kept when not overridden")
+
+	action.Spec.PorterConfig = &corev1.LocalObjectReference{Name: "missing"}
+	_, _, err = controller.resolvePorterConfig(context.Background(), logr.Discard(), action)
+	require.ErrorContains(t, err, "cannot retrieve the porter configuration missing referenced by the action")
+}
+
 func assertSharedAgentLabels(t *testing.T, labels map[string]string) {
 	assertContains(t, labels, v1.LabelManaged, "true", "incorrect label")
 	assertContains(t, labels, v1.LabelResourceKind, "AgentAction", "incorrect label")
@@ -1037,11 +1599,115 @@ func setupAgentActionController(objs ...client.Object) AgentActionReconciler {
 	fakeBuilder := fake.NewClientBuilder()
 	fakeBuilder.WithScheme(scheme)
 	fakeBuilder.WithObjects(objs...).WithStatusSubresource(objs...)
+	fakeBuilder.WithIndex(&v1.AgentAction{}, agentConfigIndexKey, indexWaitingActionByAgentConfig)
+	fakeBuilder.WithIndex(&v1.AgentAction{}, porterConfigIndexKey, indexWaitingActionByPorterConfig)
 	fakeClient := fakeBuilder.Build()
 
 	return AgentActionReconciler{
-		Log:    logr.Discard(),
-		Client: fakeClient,
-		Scheme: scheme,
+		Log:      logr.Discard(),
+		Client:   fakeClient,
+		Recorder: record.NewFakeRecorder(42),
+		Scheme:   scheme,
+	}
+}
+
+func TestAgentActionReconciler_Reconcile_WaitingForAgentConfig(t *testing.T) {
+	ctx := context.Background()
+
+	action := &v1.AgentAction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns-install", Generation: 1},
+		Spec: v1.AgentActionSpec{
+			AgentConfig:  &corev1.LocalObjectReference{Name: "custom"},
+			PorterConfig: &corev1.LocalObjectReference{Name: "custom"},
+		},
+	}
+	agentCfg := &v1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "custom", Generation: 1},
+		Spec: v1.AgentConfigSpec{
+			PluginConfigFile: &v1.PluginFileSpec{Plugins: map[string]v1.Plugin{"kubernetes": {}}},
+		},
+	}
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "default"}}
+	controller := setupAgentActionController(action, agentCfg, sa)
+	key := client.ObjectKeyFromObject(action)
+
+	reconcileAction := func() {
+		result, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		require.NoError(t, err, "an action waiting for its configuration should not be retried with an error")
+		require.True(t, result.IsZero())
+		require.NoError(t, controller.Get(ctx, key, action))
+	}
+	assertWaiting := func(reason string) {
+		cond := apimeta.FindStatusCondition(action.Status.Conditions, string(v1.ConditionWaitingForAgentConfig))
+		require.NotNil(t, cond, "expected the action to be waiting for its configuration")
+		assert.Equal(t, metav1.ConditionTrue, cond.Status)
+		assert.Equal(t, reason, cond.Reason)
+		var jobs batchv1.JobList
+		require.NoError(t, controller.List(ctx, &jobs))
+		assert.Empty(t, jobs.Items, "expected the agent to not be scheduled")
+	}
+
+	// The AgentConfig is installing its plugins
+	reconcileAction()
+	assertWaiting("AgentConfigNotReady")
+	assert.Empty(t, controller.mapAgentConfigToWaitingActions(ctx, agentCfg), "the action should not be requeued until the AgentConfig is ready")
+
+	// The AgentConfig is ready, but the PorterConfig does not exist yet
+	agentCfg.Status.Ready = true
+	agentCfg.Status.ActivePlugins = newActivePlugins(v1.NewAgentConfigAdapter(*agentCfg), &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "plugins"}})
+	require.NoError(t, controller.Status().Update(ctx, agentCfg))
+	wantRequests := []reconcile.Request{{NamespacedName: key}}
+	assert.Equal(t, wantRequests, controller.mapAgentConfigToWaitingActions(ctx, agentCfg))
+	reconcileAction()
+	assertWaiting("PorterConfigNotFound")
+
+	// Create the PorterConfig
+	porterCfg := &v1.PorterConfig{ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "custom"}}
+	require.NoError(t, controller.Create(ctx, porterCfg))
+	assert.Equal(t, wantRequests, controller.mapPorterConfigToWaitingActions(ctx, porterCfg))
+	reconcileAction()
+
+	assert.True(t, apimeta.IsStatusConditionFalse(action.Status.Conditions, string(v1.ConditionWaitingForAgentConfig)),
+		"expected the action to no longer be waiting")
+	assert.Empty(t, controller.mapAgentConfigToWaitingActions(ctx, agentCfg), "the action should no longer be indexed")
+	var jobs batchv1.JobList
+	require.NoError(t, controller.List(ctx, &jobs))
+	assert.Len(t, jobs.Items, 1, "expected the agent to be scheduled")
+}
+
+func TestAgentResourcesExpired(t *testing.T) {
+	now := time.Now()
+	failedAt := func(ago time.Duration) []metav1.Condition {
+		return []metav1.Condition{{
+			Type:               string(v1.ConditionFailed),
+			Status:             metav1.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(now.Add(-ago)),
+		}}
+	}
+	keepSucceeded := &v1.AgentCleanupPolicy{DeleteOnSuccess: ptr.To(false)}
+	keepFailedForHour := &v1.AgentCleanupPolicy{KeepOnFailure: &metav1.Duration{Duration: time.Hour}}
+
+	testcases := []struct {
+		name       string
+		phase      v1.AgentPhase
+		conditions []metav1.Condition
+		policy     *v1.AgentCleanupPolicy
+		want       bool
+	}{
+		{name: "running", phase: v1.PhaseRunning, want: false},
+		{name: "succeeded", phase: v1.PhaseSucceeded, want: true},
+		{name: "succeeded and kept", phase: v1.PhaseSucceeded, policy: keepSucceeded, want: false},
+		{name: "failed recently", phase: v1.PhaseFailed, conditions: failedAt(time.Hour), want: false},
+		{name: "failed a day ago", phase: v1.PhaseFailed, conditions: failedAt(25 * time.Hour), want: true},
+		{name: "failed before the custom keep period", phase: v1.PhaseFailed, conditions: failedAt(2 * time.Hour), policy: keepFailedForHour, want: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			action := testAgentAction()
+			action.Status.Phase = tc.phase
+			action.Status.Conditions = tc.conditions
+			action.Status.EffectiveAgentConfig = &v1.AgentConfigSpec{CleanupPolicy: tc.policy}
+			assert.Equal(t, tc.want, agentResourcesExpired(action, now))
+		})
 	}
 }
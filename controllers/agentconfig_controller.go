@@ -14,34 +14,76 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+// pluginsFileName is the name of the file in the working directory of the Porter Agent with the plugins to install.
+const pluginsFileName = "plugins.yaml"
+
 // AgentConfigReconciler calls porter to execute changes made to an AgentConfig CRD
 type AgentConfigReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Scheme   *runtime.Scheme
+
+	// PluginVolumeSweeper configures how plugin volumes that are no longer used are removed.
+	PluginVolumeSweeper PluginVolumeSweeperOptions
+
+	// PodLogs reads the output of porter plugins list, to report the installed plugins.
+	// The installed plugins are not reported when it is nil.
+	// +optional
+	PodLogs PodLogReader
 }
 
 //+kubebuilder:rbac:groups=getporter.org,resources=agentconfigs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=getporter.org,resources=agentconfigs/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=getporter.org,resources=agentconfigs/finalizers,verbs=update
 //+kubebuilder:rbac:groups=getporter.org,resources=porterconfigs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=getporter.org,resources=clusteragentconfigs,verbs=get;list;watch
 //+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=persistentvolumes,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=pods/log,verbs=get
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *AgentConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.Add(manager.RunnableFunc(r.StartPluginVolumeSweeper)); err != nil {
+		return err
+	}
+
+	// Index the plugin sources, so that the plugins are verified again when their archive is created or changed
+	ctx := context.Background()
+	for _, obj := range []client.Object{&porterv1.AgentConfig{}, &porterv1.ClusterAgentConfig{}} {
+		if err := mgr.GetFieldIndexer().IndexField(ctx, obj, pluginConfigMapIndexKey, indexAgentConfigByPluginConfigMap); err != nil {
+			return errors.Wrapf(err, "error indexing the %T by plugin configmap", obj)
+		}
+		if err := mgr.GetFieldIndexer().IndexField(ctx, obj, pluginSecretIndexKey, indexAgentConfigByPluginSecret); err != nil {
+			return errors.Wrapf(err, "error indexing the %T by plugin secret", obj)
+		}
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&porterv1.AgentConfig{}, builder.WithPredicates(resourceChanged{})).
 		Owns(&porterv1.AgentAction{}).
 		Owns(&corev1.PersistentVolumeClaim{}).
+		Watches(&porterv1.AgentConfig{}, handler.EnqueueRequestsFromMapFunc(r.mapPluginCacheToAgentConfigs)).
+		Watches(&porterv1.AgentConfig{}, handler.EnqueueRequestsFromMapFunc(r.mapConfigLayerToAgentConfigs), builder.WithPredicates(resourceChanged{})).
+		Watches(&porterv1.ClusterAgentConfig{}, handler.EnqueueRequestsFromMapFunc(r.mapConfigLayerToAgentConfigs), builder.WithPredicates(resourceChanged{})).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.mapPluginSourceToAgentConfigs(pluginConfigMapIndexKey))).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.mapPluginSourceToAgentConfigs(pluginSecretIndexKey))).
 		Complete(r)
 }
 
@@ -49,6 +91,13 @@ func (r *AgentConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 // or a job associated with an agent config is updated.
 // Either schedule a job to handle a spec change, or update the agent config status in response to the job's state.
 func (r *AgentConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := startReconcileSpan(ctx, "AgentConfig", req)
+	result, err := r.reconcile(ctx, req)
+	endSpan(span, err)
+	return result, err
+}
+
+func (r *AgentConfigReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("agent config", req.Name, "namespace", req.Namespace)
 
 	// Retrieve the agent config
@@ -63,6 +112,9 @@ func (r *AgentConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 
 	agentCfg := porterv1.NewAgentConfigAdapter(*agentCfgData)
+	if err = r.resolvePlugins(ctx, log, agentCfg); err != nil {
+		return ctrl.Result{}, err
+	}
 
 	log = log.WithValues("resourceVersion", agentCfg.ResourceVersion, "generation", agentCfg.Generation, "observedGeneration", agentCfg.Status.ObservedGeneration, "status", agentCfg.Status.Ready)
 	log.V(Log5Trace).Info("Reconciling agent config")
@@ -89,11 +141,18 @@ func (r *AgentConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 	if processed {
 		err = removeAgentCfgFinalizer(ctx, log, r.Client, agentCfg)
+		if err == nil {
+			r.Recorder.Event(&agentCfg.AgentConfig, "Normal", "RemoveFinalizer", fmt.Sprintf("removed finalizer from agent config %s", agentCfg.Name))
+		}
 		log.V(Log4Debug).Info("Reconciliation complete: Finalizer has been removed from the AgentConfig.")
 		return ctrl.Result{}, err
 	}
 
-	updatedStatus, err := r.syncPluginInstallStatus(ctx, log, agentCfg)
+	updatedStatus, err := r.syncPluginInstallStatus(ctx, log, agentCfg, action)
+	if errors.Is(err, errInvalidPluginSource) {
+		log.V(Log4Debug).Info("Reconciliation complete: Waiting for the plugin sources to be fixed", "error", err.Error())
+		return ctrl.Result{}, nil
+	}
 	if err != nil {
 		return ctrl.Result{}, err
 	}
@@ -138,6 +197,16 @@ func (r *AgentConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil
 	}
 
+	// Verify the archives of the plugins installed from a source in the cluster before they are installed
+	if err = r.verifyPluginSources(ctx, log, agentCfg); err != nil {
+		if errors.Is(err, errInvalidPluginSource) {
+			r.Recorder.Event(&agentCfg.AgentConfig, "Warning", "InvalidPluginSource", err.Error())
+			log.V(Log4Debug).Info("Reconciliation complete: Waiting for the plugin sources to be fixed", "error", err.Error())
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
 	pvc, created, err := r.createEmptyPluginVolume(ctx, log, agentCfg)
 	if err != nil {
 		return ctrl.Result{}, err
@@ -155,9 +224,78 @@ func (r *AgentConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	return ctrl.Result{}, nil
 }
 
+// resolvePlugins merges the less specific layers of agent configuration into the spec of the AgentConfig,
+// so that it installs the same plugins that are resolved for the actions that use it.
+// For example, the AgentConfig named default in a namespace also installs the plugins defined
+// by the system level AgentConfig.
+// A shared plugin cache is not layered, it installs the plugins that were resolved for the AgentConfigs that use it.
+func (r *AgentConfigReconciler) resolvePlugins(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter) error {
+	if isPluginCache(&agentCfg.AgentConfig) {
+		return nil
+	}
+
+	var instance string
+	if agentCfg.Name != "default" {
+		instance = agentCfg.Name
+	}
+	layers, _, err := resolveAgentConfigLayers(ctx, log, r.Client, agentCfg.Namespace, instance)
+	if err != nil {
+		return err
+	}
+
+	spec, _, err := porterv1.MergeAgentConfigLayers(layers...)
+	if err != nil {
+		return err
+	}
+	agentCfg.Spec = porterv1.NewAgentConfigSpecAdapter(spec)
+	return nil
+}
+
+// mapConfigLayerToAgentConfigs reconciles the AgentConfigs that merge a less specific layer of configuration when it changes,
+// so that they install the merged plugins. The layers are the ClusterAgentConfig resources and the system level AgentConfig,
+// which are merged into every AgentConfig, and the AgentConfig named default in a namespace, which is merged into
+// the other AgentConfigs in the same namespace.
+func (r *AgentConfigReconciler) mapConfigLayerToAgentConfigs(ctx context.Context, obj client.Object) []reconcile.Request {
+	var opts []client.ListOption
+	if agentCfg, ok := obj.(*porterv1.AgentConfig); ok {
+		if agentCfg.Name != "default" {
+			return nil
+		}
+		if agentCfg.Namespace != operatorNamespace {
+			opts = append(opts, client.InNamespace(agentCfg.Namespace))
+		}
+	}
+
+	list := &porterv1.AgentConfigList{}
+	if err := r.List(ctx, list, opts...); err != nil {
+		r.Log.V(Log0Error).Error(err, "Could not list the agent configurations that use a layer of configuration", "kind", obj.GetObjectKind().GroupVersionKind().Kind, "name", obj.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, item := range list.Items {
+		if item.Namespace == obj.GetNamespace() && item.Name == obj.GetName() || isPluginCache(&item) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKey{Namespace: item.Namespace, Name: item.Name}})
+	}
+	return requests
+}
+
+// getPluginInstallActionLabels returns the labels of the agent action that installs the plugins of an AgentConfig.
+// The plugins are merged from the less specific layers of configuration, which can change without changing
+// the generation of the AgentConfig, so the hash of the plugins identifies the action as well.
+func getPluginInstallActionLabels(agentCfg *porterv1.AgentConfigAdapter) map[string]string {
+	labels := getActionLabels(agentCfg)
+	if hash, ok := agentCfg.Spec.Plugins.GetLabels()[porterv1.LabelPluginsHash]; ok {
+		labels[porterv1.LabelPluginsHash] = hash
+	}
+	return labels
+}
+
 // Determines if this AgentConfig has been handled by Porter
 func (r *AgentConfigReconciler) isHandled(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter) (*porterv1.AgentAction, bool, error) {
-	labels := getActionLabels(agentCfg)
+	labels := getPluginInstallActionLabels(agentCfg)
 	results := porterv1.AgentActionList{}
 	err := r.List(ctx, &results, client.InNamespace(agentCfg.Namespace), client.MatchingLabels(labels))
 	if err != nil {
@@ -237,7 +375,7 @@ func (r *AgentConfigReconciler) runPorterPluginInstall(ctx context.Context, log
 		return nil
 	}
 
-	installCmd := []string{"plugins", "install", "-f", "plugins.yaml"}
+	installCmd := []string{"plugins", "install", "-f", pluginsFileName}
 	action, err := r.createAgentAction(ctx, log, pvc, agentCfg, installCmd)
 	if err != nil {
 		return err
@@ -249,8 +387,27 @@ func (r *AgentConfigReconciler) runPorterPluginInstall(ctx context.Context, log
 
 // createAgentAction creates an AgentAction with the temporary volumes that's used for plugin installation.
 func (r *AgentConfigReconciler) createAgentAction(ctx context.Context, log logr.Logger, pvc *corev1.PersistentVolumeClaim, agentCfg *porterv1.AgentConfigAdapter, args []string) (*porterv1.AgentAction, error) {
+	ctx, span := startSpan(ctx, "AgentConfig.createAgentAction")
+	defer span.End()
+
 	log.V(Log5Trace).Info("Creating porter agent action")
-	labels := getActionLabels(agentCfg)
+	action, err := r.newAgentAction(ctx, pvc, agentCfg, getPluginInstallActionLabels(agentCfg), args)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.Create(ctx, action); err != nil {
+		return nil, errors.Wrap(err, "error creating the porter agent action")
+	}
+
+	r.Recorder.Event(&agentCfg.AgentConfig, "Normal", "CreateAgentAction", fmt.Sprintf("created agent config agent action for %s", agentCfg.Name))
+
+	log.V(Log4Debug).Info("Created porter agent action", "name", action.Name)
+	return action, nil
+}
+
+// newAgentAction defines an AgentAction, owned by the AgentConfig, that runs porter with the plugin volume mounted.
+func (r *AgentConfigReconciler) newAgentAction(ctx context.Context, pvc *corev1.PersistentVolumeClaim, agentCfg *porterv1.AgentConfigAdapter, labels map[string]string, args []string) (*porterv1.AgentAction, error) {
 	for k, v := range agentCfg.Labels {
 		labels[k] = v
 	}
@@ -267,7 +424,7 @@ func (r *AgentConfigReconciler) createAgentAction(ctx context.Context, log logr.
 			Namespace:    agentCfg.Namespace,
 			GenerateName: agentCfg.Name + "-",
 			Labels:       labels,
-			Annotations:  agentCfg.Annotations,
+			Annotations:  injectTraceAnnotations(ctx, agentCfg.Annotations),
 			OwnerReferences: []metav1.OwnerReference{
 				{ // I'm not using controllerutil.SetControllerReference because I can't track down why that throws a panic when running our tests
 					APIVersion:         agentCfg.APIVersion,
@@ -285,25 +442,29 @@ func (r *AgentConfigReconciler) createAgentAction(ctx context.Context, log logr.
 			Volumes:      []corev1.Volume{volumn},
 			VolumeMounts: []corev1.VolumeMount{volumnMount},
 			Files: map[string][]byte{
-				"plugins.yaml": pluginsCfg,
+				pluginsFileName: pluginsCfg,
 			},
 		},
 	}
 
-	if err := r.Create(ctx, action); err != nil {
-		return nil, errors.Wrap(err, "error creating the porter agent action")
-	}
-
-	log.V(Log4Debug).Info("Created porter agent action", "name", action.Name)
 	return action, nil
 }
 
 // Check the status of the porter-agent job and use that to update the AgentAction status
 func (r *AgentConfigReconciler) syncStatus(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter, action *porterv1.AgentAction) error {
+	_, span := startSpan(ctx, "AgentConfig.syncStatus")
+	defer span.End()
+
+	// The status of an AgentConfig that uses a shared plugin cache is synced from the cache instead, see syncSharedPluginCache,
+	// and the status of an AgentConfig whose plugin image was already published is kept, see syncPluginImage
+	if action == nil && (usesSharedPluginCache(agentCfg) || hasPublishedPluginImage(agentCfg)) && !isDeleted(agentCfg) {
+		return nil
+	}
 
 	origStatus := agentCfg.Status
 
 	applyAgentAction(log, agentCfg, action)
+	updateFailed := setPluginUpdateFailedCondition(agentCfg, origStatus)
 
 	// if the spec changed, we need to reset the readiness of the agent config
 	if origStatus.Ready && origStatus.ObservedGeneration != agentCfg.Generation || agentCfg.Status.Phase != porterv1.PhaseSucceeded {
@@ -311,12 +472,63 @@ func (r *AgentConfigReconciler) syncStatus(ctx context.Context, log logr.Logger,
 	}
 
 	if !reflect.DeepEqual(origStatus, agentCfg.Status) {
-		return r.saveStatus(ctx, log, agentCfg)
+		if err := r.saveStatus(ctx, log, agentCfg); err != nil {
+			return err
+		}
+		recordAgentActionEvent(r.Recorder, &agentCfg.AgentConfig, origStatus.Phase, action)
+		if updateFailed {
+			log.V(Log4Debug).Info("Keeping the previously installed plugins because the plugins could not be updated", "plugins", agentCfg.Status.ActivePlugins.GetLocation())
+			r.Recorder.Event(&agentCfg.AgentConfig, "Warning", "PluginUpdateFailed", fmt.Sprintf("could not update the plugins, the agent keeps using the plugins installed on %s", agentCfg.Status.ActivePlugins.GetLocation()))
+		}
 	}
 
 	return nil
 }
 
+// setPluginUpdateFailedCondition flags an AgentConfig whose plugins could not be updated, when plugins were previously
+// installed successfully, and returns true when the update was not already flagged.
+// The conditions are copied from the agent action on each reconcile, so the condition is kept only while the action is failed.
+func setPluginUpdateFailedCondition(agentCfg *porterv1.AgentConfigAdapter, origStatus porterv1.AgentConfigStatus) bool {
+	active := agentCfg.Status.ActivePlugins
+	hash := agentCfg.Spec.Plugins.GetLabels()[porterv1.LabelPluginsHash]
+	if agentCfg.Status.Phase != porterv1.PhaseFailed || active == nil || active.PluginsHash == hash || isDeleted(agentCfg) {
+		return false
+	}
+
+	cond := metav1.Condition{
+		Type:               string(porterv1.ConditionPluginUpdateFailed),
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: agentCfg.Generation,
+		Reason:             "PluginInstallFailed",
+		Message:            fmt.Sprintf("The plugins could not be installed, the plugins installed on %s are used instead", active.GetLocation()),
+	}
+	prev := apimeta.FindStatusCondition(origStatus.Conditions, cond.Type)
+	if prev != nil {
+		cond.LastTransitionTime = prev.LastTransitionTime
+	}
+	apimeta.SetStatusCondition(&agentCfg.Status.Conditions, cond)
+	return prev == nil
+}
+
+// newActivePlugins records the plugins of the AgentConfig as the plugins installed on a plugin volume that is ready to be used,
+// or on the plugin image of the AgentConfig when there is no volume.
+func newActivePlugins(agentCfg *porterv1.AgentConfigAdapter, pvc *corev1.PersistentVolumeClaim) *porterv1.ActivePlugins {
+	plugins := make(map[string]porterv1.Plugin, len(agentCfg.Spec.Plugins.GetNames()))
+	for _, name := range agentCfg.Spec.Plugins.GetNames() {
+		plugins[name], _ = agentCfg.Spec.Plugins.GetByName(name)
+	}
+	active := &porterv1.ActivePlugins{
+		PluginsHash: agentCfg.Spec.Plugins.GetLabels()[porterv1.LabelPluginsHash],
+		Plugins:     plugins,
+	}
+	if pvc != nil {
+		active.PersistentVolumeClaim = pvc.Name
+	} else {
+		active.Image = agentCfg.Spec.GetPluginImage()
+	}
+	return active
+}
+
 // Only update the status with a PATCH, don't clobber the entire agent config
 func (r *AgentConfigReconciler) saveStatus(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter) error {
 	log.V(Log5Trace).Info("Patching agent config status")
@@ -341,12 +553,24 @@ func (r *AgentConfigReconciler) retry(ctx context.Context, log logr.Logger, agen
 	if err := r.Update(ctx, action); err != nil {
 		return errors.Wrap(err, "error updating the associated porter agent action")
 	}
+	recordAgentActionRetry(action)
+	r.Recorder.Event(&agentCfg.AgentConfig, "Normal", "RetryAgentAction", fmt.Sprintf("retried agent config agent action %s", action.Name))
 
 	log.V(Log4Debug).Info("Retried associated porter agent action", "name", "retry", action.Name, retry)
 	return nil
 }
 
+// definePluginVomeAndMount defines the plugin volume of an agent action created by the AgentConfig,
+// which is an emptyDir volume when there is no plugin volume claim because the plugins are published to an image.
 func definePluginVomeAndMount(pvc *corev1.PersistentVolumeClaim) (corev1.Volume, corev1.VolumeMount) {
+	if pvc == nil {
+		volume := corev1.Volume{
+			Name:         porterv1.VolumePorterPluginsName,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		}
+		return volume, corev1.VolumeMount{Name: porterv1.VolumePorterPluginsName, MountPath: porterv1.VolumePorterPluginsPath}
+	}
+
 	volume := corev1.Volume{
 		Name: porterv1.VolumePorterPluginsName,
 		VolumeSource: corev1.VolumeSource{
@@ -416,10 +640,12 @@ func (r *AgentConfigReconciler) createHashPVC(ctx context.Context, log logr.Logg
 }
 
 // removeAgentCfgFinalizer deletes the porter finalizer from the specified resource and saves it.
-func removeAgentCfgFinalizer(ctx context.Context, log logr.Logger, client client.Client, agentCfg *porterv1.AgentConfigAdapter) error {
+func removeAgentCfgFinalizer(ctx context.Context, log logr.Logger, clnt client.Client, agentCfg *porterv1.AgentConfigAdapter) error {
 	log.V(Log5Trace).Info("removing finalizer")
+	// Patch only the finalizers, so that the fields of the spec that are explicitly set to null are kept
+	patch := client.MergeFrom(agentCfg.AgentConfig.DeepCopy())
 	controllerutil.RemoveFinalizer(agentCfg, porterv1.FinalizerName)
-	return client.Update(ctx, &agentCfg.AgentConfig)
+	return clnt.Patch(ctx, &agentCfg.AgentConfig, patch)
 }
 
 func (r *AgentConfigReconciler) shouldDelete(agentCfg *porterv1.AgentConfigAdapter) bool {
@@ -448,7 +674,8 @@ func (r *AgentConfigReconciler) cleanup(ctx context.Context, log logr.Logger, ag
 	}
 
 	pv := &corev1.PersistentVolume{}
-	pvKey := client.ObjectKey{Namespace: pvc.Namespace, Name: pvc.Spec.VolumeName}
+	// Persistent volumes are cluster scoped
+	pvKey := client.ObjectKey{Name: pvc.Spec.VolumeName}
 	err = r.Get(ctx, pvKey, pv)
 	if apierrors.IsNotFound(err) {
 		return nil
@@ -548,17 +775,25 @@ func (r *AgentConfigReconciler) deleteTemporaryPVC(ctx context.Context, log logr
 	if err := r.Delete(ctx, tempPVC); err != nil {
 		return err
 	}
+	r.Recorder.Event(&agentCfg.AgentConfig, "Normal", "DeleteTemporaryPluginVolume", fmt.Sprintf("deleted temporary plugin volume claim %s", tempPVC.Name))
 	log.V(Log4Debug).Info("Deleted temporary persistent volume claim.", "persistentvolumeclaim", tempPVC.Name, "namespace", tempPVC.Namespace)
 	return nil
 }
 
 // isReadyToBeDeleted checks if an AgentConfig is ready to be deleted.
-// It checks if any related persistent volume resources are released.
+// It checks if any related persistent volume resources are released, after releasing the shared plugin caches
+// used by the AgentConfig, which are removed once they are no longer used.
 func (r *AgentConfigReconciler) isReadyToBeDeleted(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter) (bool, error) {
 	if !isDeleted(agentCfg) {
 		return false, nil
 	}
 
+	if agentCfg.Spec.GetPluginDelivery().IsShared() {
+		if err := r.releasePluginCaches(ctx, log, agentCfg, ""); err != nil {
+			return false, err
+		}
+	}
+
 	pvc, exists, err := r.getPersistentVolumeClaim(ctx, agentCfg.Namespace, agentCfg.GetPluginsPVCName())
 	if err != nil {
 		return false, err
@@ -638,6 +873,12 @@ func (r *AgentConfigReconciler) updateOwnerReference(ctx context.Context, log lo
 		agentCfg.Status.Ready = true
 		shouldUpdateStatus = true
 	}
+	// Switch the agent to the new plugins, now that they are installed
+	if active := newActivePlugins(agentCfg, readyPVC); !reflect.DeepEqual(agentCfg.Status.ActivePlugins, active) {
+		log.V(Log4Debug).Info("Activating the installed plugins", "persistentvolumeclaim", readyPVC.Name)
+		agentCfg.Status.ActivePlugins = active
+		shouldUpdateStatus = true
+	}
 	if shouldUpdateStatus {
 		if err := r.saveStatus(ctx, log, agentCfg); err != nil {
 			return false, err
@@ -664,13 +905,27 @@ func removeOwnerAtIdx(s []metav1.OwnerReference, index int) []metav1.OwnerRefere
 	return append(ret, s[index+1:]...)
 }
 
-func (r *AgentConfigReconciler) syncPluginInstallStatus(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter) (bool, error) {
-	if agentCfg.Spec.Plugins.IsZero() && !agentCfg.Status.Ready {
+func (r *AgentConfigReconciler) syncPluginInstallStatus(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter, action *porterv1.AgentAction) (bool, error) {
+	if agentCfg.Spec.Plugins.IsZero() && (!agentCfg.Status.Ready || agentCfg.Status.ActivePlugins != nil) {
 		agentCfg.Status.Ready = true
+		agentCfg.Status.ActivePlugins = nil
 		err := r.saveStatus(ctx, log, agentCfg)
 		return true, err
 	}
 
+	// Plugins from a shared plugin cache are installed in the operator namespace
+	if usesSharedPluginCache(agentCfg) && !isDeleted(agentCfg) {
+		shared, err := r.syncSharedPluginCache(ctx, log, agentCfg)
+		if err != nil || shared {
+			return true, err
+		}
+	}
+
+	// Plugins that are delivered with an image are published by an agent action instead of installed on a volume
+	if !agentCfg.Spec.Plugins.IsZero() && !agentCfg.Spec.GetPluginDelivery().UsesVolume() && !isDeleted(agentCfg) {
+		return true, r.syncPluginImage(ctx, log, agentCfg, action)
+	}
+
 	readyPVC, tempPVC, err := r.getExistingPluginPVCs(ctx, log, agentCfg)
 	if err != nil {
 		return false, err
@@ -688,6 +943,10 @@ func (r *AgentConfigReconciler) syncPluginInstallStatus(ctx context.Context, log
 		if updated {
 			return true, nil
 		}
+
+		if err = r.syncInstalledPlugins(ctx, log, agentCfg, readyPVC); err != nil {
+			return false, err
+		}
 	}
 
 	// if plugin is not ready, we just need to wait for it before we move forward
@@ -719,6 +978,7 @@ func (r *AgentConfigReconciler) renamePluginVolume(ctx context.Context, log logr
 			return err
 		}
 		if updated {
+			r.Recorder.Event(&agentCfg.AgentConfig, "Normal", "BindPluginVolume", fmt.Sprintf("bound the plugin volume from temporary claim %s to claim %s", tempPVC.Name, agentCfg.GetPluginsPVCName()))
 			return nil
 		}
 		return r.deleteTemporaryPVC(ctx, log, tempPVC, agentCfg)
@@ -733,6 +993,7 @@ func (r *AgentConfigReconciler) renamePluginVolume(ctx context.Context, log logr
 		}
 
 		log.V(Log4Debug).Info("Created the new PVC with plugins hash as its name.", "new persistentvolumeclaim", hashedPVCName)
+		r.Recorder.Event(&agentCfg.AgentConfig, "Normal", "CreatePluginVolume", fmt.Sprintf("created plugin volume claim %s", hashedPVCName))
 	}
 
 	return nil
@@ -18,10 +18,12 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 func TestShouldDelete(t *testing.T) {
@@ -62,6 +64,7 @@ func TestShouldDelete(t *testing.T) {
 func TestCleanup(t *testing.T) {
 	ctx := context.Background()
 	inst := &porterv1.AgentConfig{
+		TypeMeta: metav1.TypeMeta{APIVersion: porterv1.GroupVersion.String(), Kind: porterv1.KindAgentConfig},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:       "fake-name",
 			Namespace:  "fake-namespace",
@@ -79,14 +82,16 @@ func TestCleanup(t *testing.T) {
 	ps := porterv1.NewPluginsList(plugins)
 	pv := corev1.PersistentVolume{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "fake-pv",
-			Namespace: "fake-namespace",
+			Name: "fake-pv",
 		},
 	}
 	pvc := corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "porter-f181fa67e59422c667a37d45da7481fb",
 			Namespace: "fake-namespace",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: inst.APIVersion, Kind: inst.Kind, Name: inst.Name},
+			},
 		},
 		Spec: corev1.PersistentVolumeClaimSpec{
 			VolumeName: "fake-pv",
@@ -101,6 +106,9 @@ func TestCleanup(t *testing.T) {
 	rec := setupAgentConfigController(&pvc, &pv, inst)
 	err := rec.cleanup(ctx, rec.Log, acAdap)
 	assert.NoError(t, err)
+
+	require.NoError(t, rec.Get(ctx, client.ObjectKeyFromObject(&pvc), &pvc))
+	assert.Empty(t, pvc.OwnerReferences, "the agent config should be removed from the owners of the plugin volume claim")
 }
 
 func TestGetPVC(t *testing.T) {
@@ -302,6 +310,8 @@ func TestAgentConfigReconciler_Reconcile(t *testing.T) {
 
 	triggerReconcile()
 	require.True(t, agentCfg.Status.Ready)
+	require.NotNil(t, agentCfg.Status.ActivePlugins, "the installed plugins should be used by the agent")
+	assert.Equal(t, renamedPVC.Name, agentCfg.Status.ActivePlugins.PersistentVolumeClaim)
 
 	// Fail the action
 	action.Status.Phase = porterv1.PhaseFailed
@@ -315,6 +325,7 @@ func TestAgentConfigReconciler_Reconcile(t *testing.T) {
 	require.False(t, agentCfg.Status.Ready, "agent config should not be ready if the agent action has failed")
 	assert.Equal(t, porterv1.PhaseFailed, agentCfg.Status.Phase, "incorrect Phase")
 	assert.True(t, apimeta.IsStatusConditionTrue(agentCfg.Status.Conditions, string(porterv1.ConditionFailed)))
+	assert.False(t, apimeta.IsStatusConditionTrue(agentCfg.Status.Conditions, string(porterv1.ConditionPluginUpdateFailed)), "the plugins were not changed")
 
 	// Edit the agent config spec
 	agentCfgData.Generation = 2
@@ -328,6 +339,8 @@ func TestAgentConfigReconciler_Reconcile(t *testing.T) {
 	assert.Equal(t, porterv1.PhaseUnknown, agentCfg.Status.Phase, "New resources should be initialized to Phase: Unknown")
 	assert.Empty(t, agentCfg.Status.Conditions, "Conditions should have been reset")
 	assert.False(t, agentCfg.Status.Ready)
+	require.NotNil(t, agentCfg.Status.ActivePlugins)
+	assert.Equal(t, renamedPVC.Name, agentCfg.Status.ActivePlugins.PersistentVolumeClaim, "the previously installed plugins should be used until the new plugins are installed")
 
 	triggerReconcile()
 
@@ -712,6 +725,65 @@ func TestAgentConfigReconciler_AgentConfigUpdates(t *testing.T) {
 
 }
 
+func TestAgentConfigReconciler_isHandled_LayerChanged(t *testing.T) {
+	ctx := context.Background()
+	systemCfg := &porterv1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: operatorNamespace},
+	}
+	nsCfg := &porterv1.AgentConfig{
+		TypeMeta:   metav1.TypeMeta{APIVersion: porterv1.GroupVersion.String(), Kind: porterv1.KindAgentConfig},
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test", Generation: 1},
+		Spec: porterv1.AgentConfigSpec{
+			PluginConfigFile: &porterv1.PluginFileSpec{Plugins: map[string]porterv1.Plugin{"azure": {}}},
+		},
+	}
+	r := setupAgentConfigController(systemCfg, nsCfg)
+
+	agentCfg := porterv1.NewAgentConfigAdapter(*nsCfg)
+	require.NoError(t, r.resolvePlugins(ctx, logr.Discard(), agentCfg))
+	action, err := r.newAgentAction(ctx, &corev1.PersistentVolumeClaim{}, agentCfg, getPluginInstallActionLabels(agentCfg), []string{"plugins", "install"})
+	require.NoError(t, err)
+	action.Name = "default-install"
+	require.NoError(t, r.Create(ctx, action))
+	_, handled, err := r.isHandled(ctx, logr.Discard(), agentCfg)
+	require.NoError(t, err)
+	assert.True(t, handled)
+
+	// The system level adds a plugin without changing the generation of the namespace AgentConfig
+	systemCfg.Spec.PluginConfigFile = &porterv1.PluginFileSpec{Plugins: map[string]porterv1.Plugin{"kubernetes": {}}}
+	require.NoError(t, r.Update(ctx, systemCfg))
+	agentCfg = porterv1.NewAgentConfigAdapter(*nsCfg)
+	require.NoError(t, r.resolvePlugins(ctx, logr.Discard(), agentCfg))
+	_, handled, err = r.isHandled(ctx, logr.Discard(), agentCfg)
+	require.NoError(t, err)
+	assert.False(t, handled, "the merged plugins should be installed")
+}
+
+func TestAgentConfigReconciler_mapConfigLayerToAgentConfigs(t *testing.T) {
+	ctx := context.Background()
+	systemCfg := &porterv1.AgentConfig{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: operatorNamespace}}
+	systemInstCfg := &porterv1.AgentConfig{ObjectMeta: metav1.ObjectMeta{Name: "custom", Namespace: operatorNamespace}}
+	nsCfg := &porterv1.AgentConfig{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test"}}
+	instCfg := &porterv1.AgentConfig{ObjectMeta: metav1.ObjectMeta{Name: "custom", Namespace: "test"}}
+	otherNsCfg := &porterv1.AgentConfig{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "other"}}
+	otherInstCfg := &porterv1.AgentConfig{ObjectMeta: metav1.ObjectMeta{Name: "custom", Namespace: "other"}}
+	clusterCfg := &porterv1.ClusterAgentConfig{ObjectMeta: metav1.ObjectMeta{Name: "all"}}
+	cacheCfg := &porterv1.AgentConfig{ObjectMeta: metav1.ObjectMeta{Name: "plugin-cache-abc", Namespace: operatorNamespace, Labels: map[string]string{porterv1.LabelPluginCache: "true"}}}
+	r := setupAgentConfigController(systemCfg, systemInstCfg, nsCfg, instCfg, otherNsCfg, otherInstCfg, clusterCfg, cacheCfg)
+
+	toRequest := func(cfg *porterv1.AgentConfig) reconcile.Request {
+		return reconcile.Request{NamespacedName: client.ObjectKeyFromObject(cfg)}
+	}
+	assert.ElementsMatch(t, []reconcile.Request{toRequest(systemInstCfg), toRequest(nsCfg), toRequest(instCfg), toRequest(otherNsCfg), toRequest(otherInstCfg)}, r.mapConfigLayerToAgentConfigs(ctx, systemCfg),
+		"the AgentConfigs that merge the system level AgentConfig should be reconciled")
+	assert.ElementsMatch(t, []reconcile.Request{toRequest(systemCfg), toRequest(systemInstCfg), toRequest(nsCfg), toRequest(instCfg), toRequest(otherNsCfg), toRequest(otherInstCfg)}, r.mapConfigLayerToAgentConfigs(ctx, clusterCfg),
+		"the AgentConfigs that merge the cluster configuration should be reconciled")
+	assert.ElementsMatch(t, []reconcile.Request{toRequest(instCfg)}, r.mapConfigLayerToAgentConfigs(ctx, nsCfg),
+		"the namespace AgentConfig should only be merged into the other AgentConfigs in the same namespace")
+	assert.Empty(t, r.mapConfigLayerToAgentConfigs(ctx, instCfg), "an AgentConfig that is not named default is not merged into other AgentConfigs")
+	assert.Empty(t, r.mapConfigLayerToAgentConfigs(ctx, systemInstCfg), "an AgentConfig that is not named default is not merged into other AgentConfigs")
+}
+
 func TestAgentConfigReconciler_createAgentAction(t *testing.T) {
 	ctx := context.Background()
 
@@ -809,6 +881,7 @@ func TestAgentConfigReconciler_createAgentAction(t *testing.T) {
 	assertContains(t, action.Labels, porterv1.LabelResourceName, "myblog", "incorrect label")
 	assertContains(t, action.Labels, porterv1.LabelResourceGeneration, "1", "incorrect label")
 	assertContains(t, action.Labels, "testLabel", "abc123", "incorrect label")
+	assertContains(t, action.Labels, porterv1.LabelPluginsHash, labels[porterv1.LabelPluginsHash], "incorrect label")
 
 	assert.NotEmpty(t, action.Spec.Volumes, "incorrect Volumes")
 	assert.Equal(t, action.Spec.Volumes[0].Name, porterv1.VolumePorterPluginsName, "incorrect Volumes")
@@ -871,6 +944,130 @@ func TestRenamePluginVolume(t *testing.T) {
 	}
 }
 
+func TestAgentConfigReconciler_resolvePlugins(t *testing.T) {
+	systemCfg := &porterv1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: operatorNamespace},
+		Spec: porterv1.AgentConfigSpec{
+			PluginConfigFile: &porterv1.PluginFileSpec{SchemaVersion: "1.0.0", Plugins: map[string]porterv1.Plugin{"kubernetes": {Version: "v1.0.0"}}},
+		},
+	}
+	nsCfg := &porterv1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test"},
+		Spec: porterv1.AgentConfigSpec{
+			PluginConfigFile: &porterv1.PluginFileSpec{Plugins: map[string]porterv1.Plugin{"azure": {}}},
+		},
+	}
+	instCfg := &porterv1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "custom", Namespace: "test"},
+		Spec: porterv1.AgentConfigSpec{
+			PluginConfigFile: &porterv1.PluginFileSpec{Plugins: map[string]porterv1.Plugin{"kubernetes": {Version: "v1.1.0"}}},
+		},
+	}
+	cacheCfg := &porterv1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "plugin-cache-abc", Namespace: operatorNamespace, Labels: map[string]string{porterv1.LabelPluginCache: "true"}},
+		Spec: porterv1.AgentConfigSpec{
+			PluginConfigFile: &porterv1.PluginFileSpec{SchemaVersion: "1.0.0", Plugins: map[string]porterv1.Plugin{"azure": {}}},
+		},
+	}
+	r := setupAgentConfigController(systemCfg, nsCfg, instCfg, cacheCfg)
+
+	t.Run("namespace default", func(t *testing.T) {
+		agentCfg := porterv1.NewAgentConfigAdapter(*nsCfg)
+		require.NoError(t, r.resolvePlugins(context.Background(), logr.Discard(), agentCfg))
+		assert.Equal(t, []string{"azure", "kubernetes"}, agentCfg.Spec.Plugins.GetNames(), "the system level plugins should also be installed")
+	})
+
+	t.Run("instance", func(t *testing.T) {
+		agentCfg := porterv1.NewAgentConfigAdapter(*instCfg)
+		require.NoError(t, r.resolvePlugins(context.Background(), logr.Discard(), agentCfg))
+		assert.Equal(t, []string{"azure", "kubernetes"}, agentCfg.Spec.Plugins.GetNames(), "the namespace and system level plugins should also be installed")
+		kubernetes, _ := agentCfg.Spec.Plugins.GetByName("kubernetes")
+		assert.Equal(t, "v1.1.0", kubernetes.Version, "the instance should override the plugin version")
+		assert.Equal(t, "v1.1.0", instCfg.Spec.PluginConfigFile.Plugins["kubernetes"].Version, "the AgentConfig resource should not be modified")
+	})
+
+	t.Run("shared plugin cache", func(t *testing.T) {
+		agentCfg := porterv1.NewAgentConfigAdapter(*cacheCfg)
+		require.NoError(t, r.resolvePlugins(context.Background(), logr.Discard(), agentCfg))
+		assert.Equal(t, []string{"azure"}, agentCfg.Spec.Plugins.GetNames(), "the cache should only install the plugins that it was created with")
+	})
+}
+
+func TestAgentConfigReconciler_Reconcile_PluginDelivery(t *testing.T) {
+	ctx := context.Background()
+
+	agentCfg := &porterv1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test", Generation: 1},
+		Spec: porterv1.AgentConfigSpec{
+			PluginConfigFile: &porterv1.PluginFileSpec{SchemaVersion: "1.0.0", Plugins: map[string]porterv1.Plugin{"kubernetes": {Version: "v1.0.0"}}},
+			PluginDelivery:   &porterv1.PluginDelivery{Mode: porterv1.PluginDeliveryImage},
+		},
+	}
+	controller := setupAgentConfigController(agentCfg)
+	controller.PodLogs = testPodLogReader{logs: map[string][]byte{
+		"publish-plugins": []byte(`[{"name":"kubernetes","version":"v1.0.0"}]`),
+	}}
+	recorder := controller.Recorder.(*record.FakeRecorder)
+	key := client.ObjectKeyFromObject(agentCfg)
+
+	_, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	require.NoError(t, controller.Get(ctx, key, agentCfg))
+	assert.False(t, agentCfg.Status.Ready, "the agent config should not be ready without a plugin repository")
+	assert.Contains(t, <-recorder.Events, "InvalidPluginDelivery")
+
+	// The plugins are published to an image tagged with the hash of the plugins
+	agentCfg.Spec.PluginDelivery.Repository = "example.com/porter-plugins"
+	require.NoError(t, controller.Update(ctx, agentCfg))
+	_, err = controller.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	require.NoError(t, controller.Get(ctx, key, agentCfg))
+	assert.False(t, agentCfg.Status.Ready, "the agent config should not be ready until the plugin image is published")
+
+	var actions porterv1.AgentActionList
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace("test")))
+	require.Len(t, actions.Items, 1, "an agent action should be created to publish the plugin image")
+	action := actions.Items[0]
+	hash := porterv1.NewAgentConfigAdapter(*agentCfg).Spec.Plugins.GetLabels()[porterv1.LabelPluginsHash]
+	assert.Equal(t, hash, action.Labels[porterv1.LabelPluginsHash])
+	assert.Equal(t, []string{"plugins", "list", "-o", "json"}, action.Spec.Args, "the agent should list the published plugins")
+	require.Len(t, action.Spec.Volumes, 1)
+	assert.NotNil(t, action.Spec.Volumes[0].EmptyDir, "the plugins should be installed on an empty volume")
+	assert.Contains(t, string(action.Spec.Files["plugins.yaml"]), "kubernetes", "expected the plugins file in the working directory")
+
+	var pvcs corev1.PersistentVolumeClaimList
+	require.NoError(t, controller.List(ctx, &pvcs, client.InNamespace("test")))
+	assert.Empty(t, pvcs.Items, "a plugin volume should not be created")
+
+	// Once the image is published, the agent uses it
+	action.Status.Phase = porterv1.PhaseSucceeded
+	action.Status.Job = &corev1.LocalObjectReference{Name: "publish-plugins"}
+	require.NoError(t, controller.Update(ctx, &action))
+	_, err = controller.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	require.NoError(t, controller.Get(ctx, key, agentCfg))
+	assert.True(t, agentCfg.Status.Ready, "the agent config should be ready once the plugin image is published")
+	require.NotNil(t, agentCfg.Status.ActivePlugins)
+	assert.Equal(t, "example.com/porter-plugins:"+hash, agentCfg.Status.ActivePlugins.Image)
+	assert.Empty(t, agentCfg.Status.ActivePlugins.PersistentVolumeClaim)
+	assert.Equal(t, hash, agentCfg.Status.InstalledPluginsHash)
+	assert.Equal(t, []porterv1.InstalledPlugin{
+		{Name: "kubernetes", Version: "v1.0.0", RequestedVersion: "v1.0.0", Source: defaultPluginSource},
+	}, agentCfg.Status.InstalledPlugins)
+
+	// The image is not published again when the AgentConfig changes without changing its plugins
+	agentCfg.Spec.ServiceAccount = "porter-agent"
+	agentCfg.Generation = 2
+	require.NoError(t, controller.Update(ctx, agentCfg))
+	_, err = controller.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	require.NoError(t, controller.Get(ctx, key, agentCfg))
+	assert.True(t, agentCfg.Status.Ready, "the agent config should keep using the published plugin image")
+	assert.Equal(t, int64(2), agentCfg.Status.ObservedGeneration)
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace("test")))
+	assert.Len(t, actions.Items, 1, "the plugin image should only be published once for each set of plugins")
+}
+
 func setupAgentConfigController(objs ...client.Object) *AgentConfigReconciler {
 	scheme := runtime.NewScheme()
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
@@ -879,11 +1076,66 @@ func setupAgentConfigController(objs ...client.Object) *AgentConfigReconciler {
 	fakeBuilder := fake.NewClientBuilder()
 	fakeBuilder.WithScheme(scheme)
 	fakeBuilder.WithObjects(objs...).WithStatusSubresource(objs...)
+	for _, obj := range []client.Object{&porterv1.AgentConfig{}, &porterv1.ClusterAgentConfig{}} {
+		fakeBuilder.WithIndex(obj, pluginConfigMapIndexKey, indexAgentConfigByPluginConfigMap)
+		fakeBuilder.WithIndex(obj, pluginSecretIndexKey, indexAgentConfigByPluginSecret)
+	}
 	fakeClient := fakeBuilder.Build()
 
 	return &AgentConfigReconciler{
-		Log:    logr.Discard(),
-		Client: fakeClient,
-		Scheme: scheme,
+		Log:      logr.Discard(),
+		Client:   fakeClient,
+		Recorder: record.NewFakeRecorder(42),
+		Scheme:   scheme,
+	}
+}
+
+func TestSetPluginUpdateFailedCondition(t *testing.T) {
+	oldPlugins := map[string]porterv1.Plugin{"kubernetes": {Version: "v1.0.0"}}
+	newAgentCfg := func(plugins map[string]porterv1.Plugin, phase porterv1.AgentPhase) *porterv1.AgentConfigAdapter {
+		cfg := porterv1.AgentConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test", Generation: 2},
+			Spec:       porterv1.AgentConfigSpec{PluginConfigFile: &porterv1.PluginFileSpec{Plugins: plugins}},
+			Status: porterv1.AgentConfigStatus{
+				PorterResourceStatus: porterv1.PorterResourceStatus{Phase: phase},
+				ActivePlugins: &porterv1.ActivePlugins{
+					PluginsHash:           porterv1.NewPluginsList(oldPlugins).GetLabels()[porterv1.LabelPluginsHash],
+					PersistentVolumeClaim: "porter-old",
+					Plugins:               oldPlugins,
+				},
+			},
+		}
+		return porterv1.NewAgentConfigAdapter(cfg)
 	}
+	newPlugins := map[string]porterv1.Plugin{"kubernetes": {Version: "v1.1.0"}}
+
+	t.Run("update failed", func(t *testing.T) {
+		agentCfg := newAgentCfg(newPlugins, porterv1.PhaseFailed)
+		assert.True(t, setPluginUpdateFailedCondition(agentCfg, porterv1.AgentConfigStatus{}), "a new failure should be reported")
+		cond := apimeta.FindStatusCondition(agentCfg.Status.Conditions, string(porterv1.ConditionPluginUpdateFailed))
+		require.NotNil(t, cond)
+		assert.Equal(t, metav1.ConditionTrue, cond.Status)
+		assert.Contains(t, cond.Message, "porter-old")
+
+		// The condition is kept with the same transition time when the status is synced again
+		origStatus := agentCfg.Status
+		origStatus.Conditions[0].LastTransitionTime = metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+		agentCfg = newAgentCfg(newPlugins, porterv1.PhaseFailed)
+		assert.False(t, setPluginUpdateFailedCondition(agentCfg, origStatus), "the failure was already reported")
+		cond = apimeta.FindStatusCondition(agentCfg.Status.Conditions, string(porterv1.ConditionPluginUpdateFailed))
+		require.NotNil(t, cond)
+		assert.Equal(t, origStatus.Conditions[0].LastTransitionTime, cond.LastTransitionTime)
+	})
+
+	t.Run("update in progress", func(t *testing.T) {
+		agentCfg := newAgentCfg(newPlugins, porterv1.PhaseRunning)
+		assert.False(t, setPluginUpdateFailedCondition(agentCfg, porterv1.AgentConfigStatus{}))
+		assert.Empty(t, agentCfg.Status.Conditions)
+	})
+
+	t.Run("same plugins failed", func(t *testing.T) {
+		agentCfg := newAgentCfg(oldPlugins, porterv1.PhaseFailed)
+		assert.False(t, setPluginUpdateFailedCondition(agentCfg, porterv1.AgentConfigStatus{}), "a failure that does not change the plugins is not a failed update")
+		assert.Empty(t, agentCfg.Status.Conditions)
+	})
 }
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// clusterConfig is a cluster scoped configuration resource that applies to the namespaces that it selects.
+type clusterConfig interface {
+	client.Object
+	GetPriority() int32
+	SelectsNamespace(namespaceLabels map[string]string) (bool, error)
+}
+
+// selectClusterConfigs returns the configurations that select a namespace with the specified labels,
+// sorted in the order that they should be applied: by ascending priority and then by name.
+// Configurations with an invalid namespace selector are skipped.
+func selectClusterConfigs[T clusterConfig](log logr.Logger, configs []T, namespaceLabels map[string]string) []T {
+	var selected []T
+	for _, cfg := range configs {
+		ok, err := cfg.SelectsNamespace(namespaceLabels)
+		if err != nil {
+			log.V(Log0Error).Error(err, "Ignoring cluster configuration with an invalid namespace selector", "name", cfg.GetName())
+			continue
+		}
+		if ok {
+			selected = append(selected, cfg)
+		}
+	}
+
+	sort.SliceStable(selected, func(i, j int) bool {
+		if selected[i].GetPriority() != selected[j].GetPriority() {
+			return selected[i].GetPriority() < selected[j].GetPriority()
+		}
+		return selected[i].GetName() < selected[j].GetName()
+	})
+	return selected
+}
+
+// getNamespaceLabels returns the labels of a namespace, used to select the cluster configurations.
+func getNamespaceLabels(ctx context.Context, c client.Client, namespace string) (map[string]string, error) {
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, client.ObjectKey{Name: namespace}, ns); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "error retrieving namespace %s", namespace)
+	}
+	return ns.Labels, nil
+}
+
+// getClusterConfigLayers returns the cluster configurations of the specified kind that select the namespace,
+// in the order that they are applied.
+func getClusterConfigLayers[T any, PT interface {
+	*T
+	clusterConfig
+}](ctx context.Context, log logr.Logger, c client.Client, kind string, namespace string) ([]porterv1.ConfigLayer, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(porterv1.GroupVersion.WithKind(kind + "List"))
+	if err := c.List(ctx, list); err != nil {
+		return nil, errors.Wrapf(err, "cannot retrieve the %s resources", kind)
+	}
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+
+	nsLabels, err := getNamespaceLabels(ctx, c, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := make([]PT, 0, len(list.Items))
+	specs := make(map[string]map[string]interface{}, len(list.Items))
+	for _, item := range list.Items {
+		cfg := PT(new(T))
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, cfg); err != nil {
+			return nil, errors.Wrapf(err, "error reading %s %s", kind, item.GetName())
+		}
+		configs = append(configs, cfg)
+
+		// Only keep the configuration, the selection fields are not part of the merged spec
+		spec, _, _ := unstructured.NestedMap(item.Object, "spec")
+		delete(spec, "namespaceSelector")
+		delete(spec, "priority")
+		specs[item.GetName()] = spec
+	}
+
+	selected := selectClusterConfigs(log, configs, nsLabels)
+	layers := make([]porterv1.ConfigLayer, 0, len(selected))
+	for _, cfg := range selected {
+		log.V(Log4Debug).Info("Found cluster configuration", "kind", kind, "name", cfg.GetName(), "priority", cfg.GetPriority())
+		layers = append(layers, porterv1.ConfigLayer{
+			Source: fmt.Sprintf("%s/%s", kind, cfg.GetName()),
+			Spec:   specs[cfg.GetName()],
+		})
+	}
+	return layers, nil
+}
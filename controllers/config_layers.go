@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"context"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The configuration for an AgentAction is merged from several layers, from the least to the most specific.
+// The layers are read as unstructured objects, so that the fields that are explicitly set to null
+// are kept and can remove the value defined by a less specific layer.
+const (
+	configSourceDefault   = "default"
+	configSourceSystem    = "system"
+	configSourceNamespace = "namespace"
+	configSourceInstance  = "instance"
+)
+
+var (
+	// errAgentConfigNotReady is returned when the agent configuration used by an action is not ready to be used,
+	// for example while the AgentConfig is installing its plugins.
+	errAgentConfigNotReady = errors.New("resolved agent configuration is not ready to be used")
+
+	// errPorterConfigNotFound is returned when the PorterConfig referenced by an action does not exist.
+	errPorterConfigNotFound = errors.New("not found")
+)
+
+// configLevel identifies the namespaced configuration resource used at a level of configuration.
+type configLevel struct {
+	source string
+	key    client.ObjectKey
+}
+
+// getConfigLayer reads a namespaced configuration resource of the specified kind.
+// It returns nil when the resource does not exist.
+func getConfigLayer(ctx context.Context, c client.Client, kind string, key client.ObjectKey) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(porterv1.GroupVersion.WithKind(kind))
+	if err := c.Get(ctx, key, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "cannot retrieve %s %s/%s", kind, key.Namespace, key.Name)
+	}
+	return obj, nil
+}
+
+// newConfigLayer returns the spec of a configuration resource as a layer of configuration.
+func newConfigLayer(source string, obj *unstructured.Unstructured) porterv1.ConfigLayer {
+	spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+	return porterv1.ConfigLayer{Source: source, Spec: spec}
+}
+
+// resolveAgentConfigLayers reads the layers of agent configuration that apply to a namespace,
+// from the least to the most specific:
+//  1. ClusterAgentConfig resources that select the namespace, by ascending priority and then by name.
+//  2. The AgentConfig named default in the operator namespace.
+//  3. The AgentConfig named default in the namespace.
+//  4. The AgentConfig named instance in the namespace, when set.
+//
+// It also returns the most specific AgentConfig that exists, which installs the plugins and determines
+// whether the configuration is ready to be used.
+func resolveAgentConfigLayers(ctx context.Context, log logr.Logger, c client.Client, namespace string, instance string) ([]porterv1.ConfigLayer, *porterv1.AgentConfig, error) {
+	layers, err := getClusterConfigLayers[porterv1.ClusterAgentConfig](ctx, log, c, porterv1.KindClusterAgentConfig, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	levels := []configLevel{
+		{configSourceSystem, client.ObjectKey{Name: "default", Namespace: operatorNamespace}},
+		{configSourceNamespace, client.ObjectKey{Name: "default", Namespace: namespace}},
+	}
+	if instance != "" {
+		levels = append(levels, configLevel{configSourceInstance, client.ObjectKey{Name: instance, Namespace: namespace}})
+	}
+
+	var mostSpecific *unstructured.Unstructured
+	for _, level := range levels {
+		obj, err := getConfigLayer(ctx, c, porterv1.KindAgentConfig, level.key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if obj == nil {
+			continue
+		}
+
+		log.V(Log4Debug).Info("Found porter agent configuration",
+			"level", level.source,
+			"namespace", obj.GetNamespace(),
+			"name", obj.GetName())
+		layers = append(layers, newConfigLayer(level.source, obj))
+		mostSpecific = obj
+	}
+
+	if mostSpecific == nil {
+		return layers, nil, nil
+	}
+	cfg := &porterv1.AgentConfig{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(mostSpecific.Object, cfg); err != nil {
+		return nil, nil, errors.Wrapf(err, "error reading AgentConfig %s/%s", mostSpecific.GetNamespace(), mostSpecific.GetName())
+	}
+	return layers, cfg, nil
+}
+
+// resolvePorterConfigLayers reads the layers of porter configuration that apply to a namespace,
+// from the least to the most specific:
+//  1. A default configuration that uses the in-cluster mongodb and kubernetes secrets.
+//  2. ClusterPorterConfig resources that select the namespace, by ascending priority and then by name.
+//  3. The PorterConfig named default in the operator namespace.
+//  4. The PorterConfig named default in the namespace.
+//  5. The PorterConfig named instance in the namespace, when set.
+func resolvePorterConfigLayers(ctx context.Context, log logr.Logger, c client.Client, namespace string, instance string) ([]porterv1.ConfigLayer, error) {
+	// Provide a safe default config in case nothing is defined anywhere
+	defaultCfg, err := porterv1.NewConfigLayer(configSourceDefault, porterv1.PorterConfigSpec{
+		DefaultStorage:       ptr.To("in-cluster-mongodb"),
+		DefaultSecretsPlugin: ptr.To("kubernetes.secrets"),
+		Storage: []porterv1.StorageConfig{
+			{PluginConfig: porterv1.PluginConfig{
+				Name:         "in-cluster-mongodb",
+				PluginSubKey: "mongodb",
+				Config:       runtime.RawExtension{Raw: []byte(`{"url":"mongodb://mongodb.porter-operator-system.svc.cluster.local"}`)},
+			}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	layers := []porterv1.ConfigLayer{defaultCfg}
+
+	// Read porter configuration defined at the cluster level
+	clusterLayers, err := getClusterConfigLayers[porterv1.ClusterPorterConfig](ctx, log, c, porterv1.KindClusterPorterConfig, namespace)
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, clusterLayers...)
+
+	// Read porter configuration defined at the system and namespace level
+	levels := []configLevel{
+		{configSourceSystem, client.ObjectKey{Name: "default", Namespace: operatorNamespace}},
+		{configSourceNamespace, client.ObjectKey{Name: "default", Namespace: namespace}},
+	}
+	for _, level := range levels {
+		obj, err := getConfigLayer(ctx, c, porterv1.KindPorterConfig, level.key)
+		if err != nil {
+			return nil, err
+		}
+		if obj == nil {
+			continue
+		}
+		log.V(Log4Debug).Info("Found porter config",
+			"level", level.source,
+			"namespace", obj.GetNamespace(),
+			"name", obj.GetName())
+		layers = append(layers, newConfigLayer(level.source, obj))
+	}
+
+	// Read porter configuration override
+	if instance != "" {
+		// Unlike a missing AgentConfig, which is caught by the readiness check, a missing PorterConfig would
+		// silently run porter against the wrong storage or secrets plugins, so it must exist.
+		key := client.ObjectKey{Name: instance, Namespace: namespace}
+		obj, err := getConfigLayer(ctx, c, porterv1.KindPorterConfig, key)
+		if err != nil {
+			return nil, err
+		}
+		if obj == nil {
+			return nil, errors.Wrapf(errPorterConfigNotFound, "cannot retrieve the porter configuration %s referenced by the action", key.Name)
+		}
+		log.V(Log4Debug).Info("Found porter config",
+			"level", configSourceInstance,
+			"namespace", obj.GetNamespace(),
+			"name", obj.GetName())
+		layers = append(layers, newConfigLayer(configSourceInstance, obj))
+	}
+
+	return layers, nil
+}
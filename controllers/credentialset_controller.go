@@ -11,10 +11,13 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	porterv1 "get.porter.sh/operator/api/v1"
 )
@@ -22,8 +25,9 @@ import (
 // CredentialSetReconciler reconciles a CredentialSet object
 type CredentialSetReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Scheme   *runtime.Scheme
 }
 
 //+kubebuilder:rbac:groups=getporter.org,resources=credentialsets,verbs=get;list;watch;create;update;patch;delete
@@ -34,17 +38,36 @@ type CredentialSetReconciler struct {
 //+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *CredentialSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	ctx := context.Background()
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &porterv1.CredentialSet{}, secretSourceIndexKey, indexCredentialSetBySecret); err != nil {
+		return errors.Wrap(err, "error indexing the credential sets by secret")
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&porterv1.CredentialSet{}, builder.WithPredicates(resourceChanged{})).
 		Owns(&porterv1.AgentAction{}).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.mapSecretToCredentialSets)).
 		Complete(r)
 }
 
+// mapSecretToCredentialSets requests the credential sets that resolve a source from a Secret, when it is created or changed.
+func (r *CredentialSetReconciler) mapSecretToCredentialSets(ctx context.Context, obj client.Object) []reconcile.Request {
+	return listResourcesUsingSource(ctx, r.Client, r.Log, &porterv1.CredentialSetList{}, secretSourceIndexKey, obj)
+}
+
 // Reconcile is called when the spec of a credential set is changed
 func (r *CredentialSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := startReconcileSpan(ctx, "CredentialSet", req)
+	result, err := r.reconcile(ctx, req)
+	endSpan(span, err)
+	return result, err
+}
+
+func (r *CredentialSetReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("credentialSet", req.Name, "namespace", req.Namespace)
 
 	cs := &porterv1.CredentialSet{}
@@ -76,6 +99,9 @@ func (r *CredentialSetReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 
 	if isDeleteProcessed(cs) {
 		err = removeCredSetFinalizer(ctx, log, r.Client, cs)
+		if err == nil {
+			r.Recorder.Event(cs, "Normal", "RemoveFinalizer", fmt.Sprintf("removed finalizer from credential set %s", cs.Name))
+		}
 		log.V(Log4Debug).Info("Reconciliation complete: Finalizer has been removed from the CredentialSet.")
 		return ctrl.Result{}, err
 	}
@@ -113,6 +139,15 @@ func (r *CredentialSetReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		log.V(Log4Debug).Info("Reconciliation complete: A finalizer has been set on the credential set.")
 		return ctrl.Result{}, nil
 	}
+	// Check the sources resolved by the operator before running the agent
+	if err = r.validateSources(ctx, log, cs); err != nil {
+		if errors.Is(err, errInvalidSource) {
+			log.V(Log4Debug).Info("Reconciliation complete: Waiting for the credential sources to be created", "error", err.Error())
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
 	err = r.runCredentialSet(ctx, log, cs)
 	if err != nil {
 		return ctrl.Result{}, err
@@ -141,17 +176,59 @@ func (r *CredentialSetReconciler) isHandled(ctx context.Context, log logr.Logger
 
 // Check the status of the porter-agent job and use that to update the AgentAction status
 func (r *CredentialSetReconciler) syncStatus(ctx context.Context, log logr.Logger, cs *porterv1.CredentialSet, action *porterv1.AgentAction) error {
+	_, span := startSpan(ctx, "CredentialSet.syncStatus")
+	defer span.End()
+
 	origStatus := cs.Status
 
 	applyAgentAction(log, cs, action)
+	if action == nil {
+		keepSourcesResolvedCondition(cs, origStatus.PorterResourceStatus)
+	}
 
 	if !reflect.DeepEqual(origStatus, cs.Status) {
-		return r.saveStatus(ctx, log, cs)
+		if err := r.saveStatus(ctx, log, cs); err != nil {
+			return err
+		}
+		recordAgentActionEvent(r.Recorder, cs, origStatus.Phase, action)
 	}
 
 	return nil
 }
 
+// validateSources checks the sources of the credentials, and that the Kubernetes Secret keys that they reference exist.
+// A source that does not exist is reported with the SourcesResolved condition, and the agent is not run until it is created.
+func (r *CredentialSetReconciler) validateSources(ctx context.Context, log logr.Logger, cs *porterv1.CredentialSet) error {
+	err := validateCredentialSources(cs.Spec)
+	if err == nil {
+		err = validateSecretKeyRefs(ctx, r.Client, cs.Namespace, cs.Spec.GetSecretKeyRefs())
+	}
+	if !errors.Is(err, errInvalidSource) {
+		return err
+	}
+
+	origStatus := *cs.Status.DeepCopy()
+	setSourcesNotResolvedCondition(cs, err)
+	if reflect.DeepEqual(origStatus, cs.Status) {
+		return err
+	}
+	if saveErr := r.saveStatus(ctx, log, cs); saveErr != nil {
+		return saveErr
+	}
+	r.Recorder.Event(cs, "Warning", "InvalidCredentialSource", err.Error())
+	return err
+}
+
+// validateCredentialSources checks that each credential has exactly one source.
+func validateCredentialSources(spec porterv1.CredentialSetSpec) error {
+	for _, cred := range spec.Credentials {
+		if err := cred.Source.Validate(); err != nil {
+			return errors.Wrapf(errInvalidSource, "credential %s: %s", cred.Name, err)
+		}
+	}
+	return nil
+}
+
 // Only update the status with a PATCH, don't clobber the entire installation
 func (r *CredentialSetReconciler) saveStatus(ctx context.Context, log logr.Logger, cs *porterv1.CredentialSet) error {
 	log.V(Log5Trace).Info("Patching credential set status")
@@ -201,7 +278,8 @@ func (r *CredentialSetReconciler) newAgentAction(cs *porterv1.CredentialSet) (*p
 			Annotations:  cs.Annotations,
 		},
 		Spec: porterv1.AgentActionSpec{
-			AgentConfig: cs.Spec.AgentConfig,
+			AgentConfig:  cs.Spec.AgentConfig,
+			PorterConfig: cs.Spec.PorterConfig,
 		},
 	}
 	if err := controllerutil.SetControllerReference(cs, action, r.Scheme); err != nil {
@@ -212,6 +290,9 @@ func (r *CredentialSetReconciler) newAgentAction(cs *porterv1.CredentialSet) (*p
 
 // create a porter credentials AgentAction for applying or deleting credential sets
 func (r *CredentialSetReconciler) createAgentAction(ctx context.Context, log logr.Logger, cs *porterv1.CredentialSet) (*porterv1.AgentAction, error) {
+	ctx, span := startSpan(ctx, "CredentialSet.createAgentAction")
+	defer span.End()
+
 	credSetResourceB, err := cs.Spec.ToPorterDocument()
 	if err != nil {
 		return nil, err
@@ -221,6 +302,7 @@ func (r *CredentialSetReconciler) createAgentAction(ctx context.Context, log log
 	if err != nil {
 		return nil, err
 	}
+	action.Annotations = injectTraceAnnotations(ctx, action.Annotations)
 	log.WithValues("action name", action.Name)
 	if r.shouldDelete(cs) {
 		log.V(Log5Trace).Info("Deleting porter credential set")
@@ -235,6 +317,8 @@ func (r *CredentialSetReconciler) createAgentAction(ctx context.Context, log log
 		return nil, errors.Wrap(err, "error creating the porter credential set agent action")
 	}
 
+	r.Recorder.Event(cs, "Normal", "CreateAgentAction", fmt.Sprintf("created credential set agent action for %s", cs.Name))
+
 	log.V(Log4Debug).Info("Created porter credential set agent action")
 	return action, nil
 }
@@ -254,6 +338,8 @@ func (r *CredentialSetReconciler) retry(ctx context.Context, log logr.Logger, cs
 	if err := r.Update(ctx, action); err != nil {
 		return errors.Wrap(err, "error updating the associated porter agent action")
 	}
+	recordAgentActionRetry(action)
+	r.Recorder.Event(cs, "Normal", "RetryAgentAction", fmt.Sprintf("retried credential set agent action %s", action.Name))
 
 	log.V(Log4Debug).Info("Retried associated porter agent action", "name", "retry", action.Name, retry)
 	return nil
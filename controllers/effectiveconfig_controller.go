@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"context"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// EffectiveConfigReconciler maintains an EffectiveConfig in each namespace that uses Porter,
+// with the configuration resolved from the cluster, system and namespace level configuration.
+type EffectiveConfigReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=getporter.org,resources=effectiveconfigs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=getporter.org,resources=effectiveconfigs/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=getporter.org,resources=agentconfigs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=getporter.org,resources=porterconfigs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=getporter.org,resources=clusteragentconfigs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=getporter.org,resources=clusterporterconfigs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=getporter.org,resources=installations,verbs=get;list;watch
+//+kubebuilder:rbac:groups=getporter.org,resources=credentialsets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=getporter.org,resources=parametersets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *EffectiveConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&porterv1.EffectiveConfig{}).
+		Watches(&porterv1.AgentConfig{}, handler.EnqueueRequestsFromMapFunc(r.mapConfigToEffectiveConfigs)).
+		Watches(&porterv1.PorterConfig{}, handler.EnqueueRequestsFromMapFunc(r.mapConfigToEffectiveConfigs)).
+		Watches(&porterv1.ClusterAgentConfig{}, handler.EnqueueRequestsFromMapFunc(r.mapToAllEffectiveConfigs)).
+		Watches(&porterv1.ClusterPorterConfig{}, handler.EnqueueRequestsFromMapFunc(r.mapToAllEffectiveConfigs)).
+		Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(mapNamespaceToEffectiveConfig)).
+		Watches(&porterv1.Installation{}, handler.EnqueueRequestsFromMapFunc(mapToEffectiveConfig)).
+		Watches(&porterv1.CredentialSet{}, handler.EnqueueRequestsFromMapFunc(mapToEffectiveConfig)).
+		Watches(&porterv1.ParameterSet{}, handler.EnqueueRequestsFromMapFunc(mapToEffectiveConfig)).
+		Complete(r)
+}
+
+// mapToEffectiveConfig requests the EffectiveConfig in the namespace of the object.
+func mapToEffectiveConfig(_ context.Context, obj client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: porterv1.EffectiveConfigName}}}
+}
+
+// mapNamespaceToEffectiveConfig requests the EffectiveConfig in a namespace,
+// because the namespace labels select the cluster configurations.
+func mapNamespaceToEffectiveConfig(_ context.Context, obj client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetName(), Name: porterv1.EffectiveConfigName}}}
+}
+
+// mapConfigToEffectiveConfigs requests the EffectiveConfig in the namespace of the configuration,
+// or every EffectiveConfig when the system configuration changes.
+func (r *EffectiveConfigReconciler) mapConfigToEffectiveConfigs(ctx context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetNamespace() == operatorNamespace && obj.GetName() == "default" {
+		return append(r.mapToAllEffectiveConfigs(ctx, obj), mapToEffectiveConfig(ctx, obj)...)
+	}
+	return mapToEffectiveConfig(ctx, obj)
+}
+
+// mapToAllEffectiveConfigs requests every EffectiveConfig, when a configuration that may apply to any namespace changes.
+func (r *EffectiveConfigReconciler) mapToAllEffectiveConfigs(ctx context.Context, _ client.Object) []reconcile.Request {
+	list := &porterv1.EffectiveConfigList{}
+	if err := r.List(ctx, list); err != nil {
+		r.Log.V(Log0Error).Error(err, "Could not list the effective configurations to update")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, item := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: item.Namespace, Name: item.Name}})
+	}
+	return requests
+}
+
+// Reconcile is called when any layer of configuration that applies to a namespace is changed,
+// or when a resource that uses the configuration is created or deleted.
+// Either update the EffectiveConfig for the namespace, or remove it when the namespace no longer uses Porter.
+func (r *EffectiveConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := startReconcileSpan(ctx, "EffectiveConfig", req)
+	result, err := r.reconcile(ctx, req)
+	endSpan(span, err)
+	return result, err
+}
+
+func (r *EffectiveConfigReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("effective config", req.Name, "namespace", req.Namespace)
+
+	// The operator only maintains one EffectiveConfig per namespace
+	if req.Name != porterv1.EffectiveConfigName {
+		log.V(Log5Trace).Info("Ignoring effective configuration that is not managed by the operator")
+		return ctrl.Result{}, nil
+	}
+
+	effectiveCfg := &porterv1.EffectiveConfig{}
+	err := r.Get(ctx, req.NamespacedName, effectiveCfg)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, errors.Wrapf(err, "could not retrieve effective config %s/%s", req.Namespace, req.Name)
+		}
+		effectiveCfg = nil
+	}
+
+	used, err := r.isConfigUsed(ctx, req.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !used {
+		if effectiveCfg != nil {
+			log.V(Log4Debug).Info("Removing the effective configuration from a namespace that no longer uses Porter")
+			err = r.Delete(ctx, effectiveCfg)
+			return ctrl.Result{}, client.IgnoreNotFound(errors.Wrap(err, "could not delete the effective config"))
+		}
+		return ctrl.Result{}, nil
+	}
+
+	status, err := r.resolveEffectiveConfig(ctx, log, req.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if effectiveCfg == nil {
+		log.V(Log4Debug).Info("Creating the effective configuration")
+		effectiveCfg = &porterv1.EffectiveConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      porterv1.EffectiveConfigName,
+				Namespace: req.Namespace,
+				Labels: map[string]string{
+					porterv1.LabelManaged: "true",
+				},
+			},
+		}
+		if err = r.Create(ctx, effectiveCfg); err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "could not create the effective config")
+		}
+	}
+
+	// Only update the status when the configuration changes, so that the update doesn't trigger another reconcile
+	current := effectiveCfg.Status.DeepCopy()
+	current.LastUpdated = nil
+	if equality.Semantic.DeepEqual(*current, status) {
+		log.V(Log5Trace).Info("Effective configuration is up-to-date")
+		return ctrl.Result{}, nil
+	}
+
+	log.V(Log4Debug).Info("Updating the effective configuration", "agentConfigSources", status.AgentConfigSources.String(), "porterConfigSources", status.PorterConfigSources.String())
+	effectiveCfg.Status = status
+	now := metav1.Now()
+	effectiveCfg.Status.LastUpdated = &now
+	err = r.Status().Update(ctx, effectiveCfg)
+	return ctrl.Result{}, errors.Wrap(err, "could not update the effective config status")
+}
+
+// isConfigUsed determines if the namespace uses Porter, in which case it should have an EffectiveConfig.
+// A namespace uses Porter when it is active and defines configuration or resources that run the Porter agent.
+func (r *EffectiveConfigReconciler) isConfigUsed(ctx context.Context, namespace string) (bool, error) {
+	ns := &corev1.Namespace{}
+	if err := r.Get(ctx, client.ObjectKey{Name: namespace}, ns); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "could not retrieve namespace %s", namespace)
+	}
+	if ns.DeletionTimestamp != nil {
+		return false, nil
+	}
+
+	lists := []client.ObjectList{
+		&porterv1.AgentConfigList{},
+		&porterv1.PorterConfigList{},
+		&porterv1.InstallationList{},
+		&porterv1.CredentialSetList{},
+		&porterv1.ParameterSetList{},
+	}
+	for _, list := range lists {
+		if err := r.List(ctx, list, client.InNamespace(namespace), client.Limit(1)); err != nil {
+			return false, errors.Wrapf(err, "could not list the %T resources in namespace %s", list, namespace)
+		}
+		if apimeta.LenList(list) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// resolveEffectiveConfig merges the configuration used by default in a namespace, which is the configuration
+// used by resources that do not reference an AgentConfig or PorterConfig.
+func (r *EffectiveConfigReconciler) resolveEffectiveConfig(ctx context.Context, log logr.Logger, namespace string) (porterv1.EffectiveConfigStatus, error) {
+	agentLayers, mostSpecific, err := resolveAgentConfigLayers(ctx, log, r.Client, namespace, "")
+	if err != nil {
+		return porterv1.EffectiveConfigStatus{}, err
+	}
+	agentCfg, agentCfgSources, err := porterv1.MergeAgentConfigLayers(agentLayers...)
+	if err != nil {
+		return porterv1.EffectiveConfigStatus{}, err
+	}
+
+	// Report the previously installed plugins when the agent uses them, see AgentActionReconciler.resolveAgentConfig
+	var activePlugins *porterv1.ActivePlugins
+	spec := porterv1.NewAgentConfigSpecAdapter(agentCfg)
+	if mostSpecific != nil && !hasInstalledPlugins(mostSpecific, spec) && canUseActivePlugins(mostSpecific, spec) {
+		activePlugins = mostSpecific.Status.ActivePlugins.DeepCopy()
+	}
+
+	porterLayers, err := resolvePorterConfigLayers(ctx, log, r.Client, namespace, "")
+	if err != nil {
+		return porterv1.EffectiveConfigStatus{}, err
+	}
+	porterCfg, porterCfgSources, err := porterv1.MergePorterConfigLayers(porterLayers...)
+	if err != nil {
+		return porterv1.EffectiveConfigStatus{}, err
+	}
+	porterCfg, err = porterCfg.Redact()
+	if err != nil {
+		return porterv1.EffectiveConfigStatus{}, err
+	}
+
+	return porterv1.EffectiveConfigStatus{
+		AgentConfig:         &agentCfg,
+		AgentConfigSources:  agentCfgSources,
+		ActivePlugins:       activePlugins,
+		PorterConfig:        &porterCfg,
+		PorterConfigSources: porterCfgSources,
+	}, nil
+}
@@ -1,18 +1,26 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	v1 "get.porter.sh/operator/api/v1"
 	installationv1 "get.porter.sh/porter/gen/proto/go/porterapis/installation/v1alpha1"
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -22,6 +30,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 )
 
 const (
@@ -33,6 +42,9 @@ type InstallationReconciler struct {
 	client.Client
 	Log              logr.Logger
 	PorterGRPCClient PorterClient
+	// PorterGRPCStatus reports the health of the connection used by PorterGRPCClient.
+	// +optional
+	PorterGRPCStatus ConnectionChecker
 	Recorder         record.EventRecorder
 	Scheme           *runtime.Scheme
 }
@@ -44,23 +56,52 @@ type InstallationReconciler struct {
 // +kubebuilder:rbac:groups=getporter.org,resources=installations/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=getporter.org,resources=installationoutputs/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=getporter.org,resources=installations/finalizers,verbs=update;patch
+// +kubebuilder:rbac:groups=getporter.org,resources=credentialsets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=getporter.org,resources=parametersets,verbs=get;list;watch
 // +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *InstallationReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	if mgr == nil {
+		return errors.New("must provide a non-nil Manager")
+	}
+
+	err := ctrl.NewControllerManagedBy(mgr).
 		For(&v1.Installation{}, builder.WithPredicates(resourceChanged{})).
 		Owns(&v1.AgentAction{}).
 		Owns(&v1.InstallationOutput{}, builder.MatchEveryOwner).
+		Watches(&v1.CredentialSet{}, handler.EnqueueRequestsFromMapFunc(r.mapCredentialSetToInstallations)).
+		Watches(&v1.ParameterSet{}, handler.EnqueueRequestsFromMapFunc(r.mapParameterSetToInstallations)).
 		Complete(r)
+	if err != nil {
+		return err
+	}
+
+	// Index the installations by the sets that they use, so that they are applied again when a set is updated
+	ctx := context.Background()
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &v1.Installation{}, credentialSetIndexKey, indexInstallationByCredentialSet); err != nil {
+		return errors.Wrap(err, "error indexing the installations by credential set")
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &v1.Installation{}, parameterSetIndexKey, indexInstallationByParameterSet); err != nil {
+		return errors.Wrap(err, "error indexing the installations by parameter set")
+	}
+	return nil
 }
 
 // Reconcile is called when the spec of an installation is changed
 // or a job associated with an installation is updated.
 // Either schedule a job to handle a spec change, or update the installation status in response to the job's state.
 func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := startReconcileSpan(ctx, "Installation", req)
+	result, err := r.reconcile(ctx, req)
+	endSpan(span, err)
+	return result, err
+}
+
+func (r *InstallationReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("installation", req.Name, "namespace", req.Namespace)
 
 	// Retrieve the Installation
@@ -80,6 +121,7 @@ func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request
 			if err := r.Update(ctx, inst); err != nil {
 				return ctrl.Result{}, err
 			}
+			r.Recorder.Event(inst, "Normal", "RemoveFinalizer", fmt.Sprintf("removed finalizer from installation %s", inst.Name))
 		}
 	}
 
@@ -106,6 +148,9 @@ func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request
 	// Check if we have finished uninstalling
 	if isDeleteProcessed(inst) {
 		err = removeFinalizer(ctx, log, r.Client, inst)
+		if err == nil {
+			r.Recorder.Event(inst, "Normal", "RemoveFinalizer", fmt.Sprintf("removed finalizer from installation %s", inst.Name))
+		}
 		log.V(Log4Debug).Info("Reconciliation complete: Finalizer has been removed from the Installation.")
 		return ctrl.Result{}, err
 	}
@@ -119,9 +164,23 @@ func (r *InstallationReconciler) Reconcile(ctx context.Context, req ctrl.Request
 			return ctrl.Result{}, err
 		}
 
+		// Check if a set used by the installation was updated since the last run
+		cause, err := r.getSetChangeCause(ctx, log, inst, action)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if cause != "" {
+			err = r.reapplyInstallation(ctx, log, inst, action, cause)
+			log.V(Log4Debug).Info("Reconciliation complete: A porter agent has been dispatched to apply the installation again.", "cause", cause)
+			return ctrl.Result{}, err
+		}
+
 		// Nothing for us to do at this point
 		log.V(Log4Debug).Info("Reconciliation complete: A porter agent has already been dispatched.")
 		if r.PorterGRPCClient != nil {
+			if err = r.syncPorterStatus(ctx, log, inst, action); err != nil {
+				return ctrl.Result{}, err
+			}
 			return r.CheckOrCreateInstallationOutputsCR(ctx, log, inst)
 		}
 		return ctrl.Result{}, nil
@@ -175,6 +234,7 @@ func (r *InstallationReconciler) CheckOrCreateInstallationOutputsCR(ctx context.
 			resp, err := r.PorterGRPCClient.ListInstallationLatestOutputs(ctx, in)
 			if err != nil {
 				log.V(Log4Debug).Info(fmt.Sprintf("failed to get output from grpc server for: %s:%s installation error: %s", inst.Spec.Name, inst.Spec.Namespace, err.Error()))
+				installationOutputSyncFailures.WithLabelValues(inst.Namespace).Inc()
 				// NOTE: Stop installation output cr creation
 				r.Recorder.Event(inst, "Warning", "CreatingInstallationOutputs", fmt.Sprintf("created installation outputs failed for %s", inst.Name))
 				return ctrl.Result{}, nil
@@ -199,6 +259,7 @@ func (r *InstallationReconciler) CheckOrCreateInstallationOutputsCR(ctx context.
 			if err != nil {
 				return ctrl.Result{}, err
 			}
+			setPorterConnectedCondition(installOutputs, nil)
 
 			err = r.Status().Update(ctx, installOutputs)
 			if err != nil {
@@ -210,9 +271,36 @@ func (r *InstallationReconciler) CheckOrCreateInstallationOutputsCR(ctx context.
 			log.V(Log5Trace).Info("patching installation cr")
 			return ctrl.Result{}, r.Patch(ctx, inst, patchInstall)
 		}
+		return ctrl.Result{}, err
 	}
-	patchInstallCR := client.MergeFrom(installCr.DeepCopy())
-	return ctrl.Result{}, r.Patch(ctx, installCr, patchInstallCR)
+
+	// Record whether the outputs can currently be synced from porter
+	if r.PorterGRPCStatus != nil {
+		patchInstallCR := client.MergeFrom(installCr.DeepCopy())
+		if setPorterConnectedCondition(installCr, r.PorterGRPCStatus.CheckConnection()) {
+			log.V(Log5Trace).Info("updating porter connection condition on installation outputs cr")
+			return ctrl.Result{}, r.Status().Patch(ctx, installCr, patchInstallCR)
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// setPorterConnectedCondition records the state of the connection to the Porter gRPC server on the outputs resource.
+// Returns whether the condition changed.
+func setPorterConnectedCondition(outputs *v1.InstallationOutput, connErr error) bool {
+	condition := metav1.Condition{
+		Type:               v1.InstallationOutputPorterConnected,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Connected",
+		Message:            "connected to the porter grpc server",
+		ObservedGeneration: outputs.Generation,
+	}
+	if connErr != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ConnectionUnavailable"
+		condition.Message = connErr.Error()
+	}
+	return apimeta.SetStatusCondition(&outputs.Status.Conditions, condition)
 }
 func (r *InstallationReconciler) CreateStatusOutputs(ctx context.Context, install *v1.InstallationOutput, in *installationv1.ListInstallationLatestOutputResponse) (*v1.InstallationOutput, error) {
 	install.Status = v1.InstallationOutputStatus{
@@ -231,11 +319,9 @@ func (r *InstallationReconciler) CreateStatusOutputs(ctx context.Context, instal
 	outputs := []v1.Output{}
 	outputNames := []string{}
 	for _, output := range in.Outputs {
-		tmpOutput := v1.Output{
-			Name:      output.Name,
-			Type:      output.Type,
-			Sensitive: output.Sensitive,
-			Value:     output.GetValue().GetStringValue(),
+		tmpOutput, err := convertOutput(output)
+		if err != nil {
+			return nil, err
 		}
 		outputNames = append(outputNames, output.Name)
 		outputs = append(outputs, tmpOutput)
@@ -246,6 +332,42 @@ func (r *InstallationReconciler) CreateStatusOutputs(ctx context.Context, instal
 	return install, nil
 }
 
+// convertOutput converts an output returned by the Porter gRPC API into its
+// Kubernetes representation, preserving the type of the value.
+func convertOutput(output *installationv1.PorterValue) (v1.Output, error) {
+	result := v1.Output{
+		Name:      output.GetName(),
+		Type:      output.GetType(),
+		Sensitive: output.GetSensitive(),
+	}
+
+	value := output.GetValue()
+	switch kind := value.GetKind().(type) {
+	case nil, *structpb.Value_NullValue:
+		return result, nil
+	case *structpb.Value_StringValue:
+		result.Value = kind.StringValue
+		if output.GetType() == "file" && !utf8.ValidString(kind.StringValue) {
+			result.Value = base64.StdEncoding.EncodeToString([]byte(kind.StringValue))
+			result.Encoding = v1.OutputEncodingBase64
+		}
+		return result, nil
+	}
+
+	raw, err := value.MarshalJSON()
+	if err != nil {
+		return v1.Output{}, errors.Wrapf(err, "error converting output %s to json", output.GetName())
+	}
+	// Use a compact representation so that the text value is stable
+	compacted := &bytes.Buffer{}
+	if err := json.Compact(compacted, raw); err != nil {
+		return v1.Output{}, errors.Wrapf(err, "error converting output %s to json", output.GetName())
+	}
+	result.JSONValue = &runtime.RawExtension{Raw: compacted.Bytes()}
+	result.Value = compacted.String()
+	return result, nil
+}
+
 func (r *InstallationReconciler) CreateInstallationOutputsCR(ctx context.Context, install *v1.Installation, in *installationv1.ListInstallationLatestOutputResponse) (*v1.InstallationOutput, error) {
 	if len(in.Outputs) < 1 {
 		return nil, fmt.Errorf("no outputs for the installation %s", install.Name)
@@ -276,7 +398,13 @@ func (r *InstallationReconciler) isHandled(ctx context.Context, log logr.Logger,
 		return nil, false, nil
 	}
 
+	// The generation may have been applied again when a set that it uses was updated, use the most recent action
 	action := results.Items[0]
+	for _, item := range results.Items[1:] {
+		if getReapplyCount(&item) > getReapplyCount(&action) {
+			action = item
+		}
+	}
 	log.V(Log4Debug).Info("Found existing agent action", "agentaction", action.Name, "namespace", action.Namespace)
 	return &action, true, nil
 }
@@ -320,8 +448,26 @@ func (r *InstallationReconciler) runPorter(ctx context.Context, log logr.Logger,
 
 // create an AgentAction that will trigger running porter
 func (r *InstallationReconciler) createAgentAction(ctx context.Context, log logr.Logger, inst *v1.Installation) (*v1.AgentAction, error) {
+	ctx, span := startSpan(ctx, "Installation.createAgentAction")
+	defer span.End()
+
 	log.V(Log5Trace).Info("Creating porter agent action")
 
+	action, err := r.newAgentAction(ctx, inst)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Create(ctx, action); err != nil {
+		return nil, errors.Wrap(err, "error creating the porter agent action")
+	}
+
+	r.Recorder.Event(inst, "Normal", "CreateAgentAction", fmt.Sprintf("created installation agent action for %s", inst.Name))
+	log.V(Log4Debug).Info("Created porter agent action", "name", action.Name)
+	return action, nil
+}
+
+// newAgentAction builds the AgentAction that runs porter installation apply for the installation.
+func (r *InstallationReconciler) newAgentAction(ctx context.Context, inst *v1.Installation) (*v1.AgentAction, error) {
 	installationResourceB, err := inst.Spec.ToPorterDocument()
 	if err != nil {
 		return nil, err
@@ -337,41 +483,156 @@ func (r *InstallationReconciler) createAgentAction(ctx context.Context, log logr
 			Namespace:    inst.Namespace,
 			GenerateName: inst.Name + "-",
 			Labels:       labels,
-			Annotations:  inst.Annotations,
+			Annotations:  injectTraceAnnotations(ctx, inst.Annotations),
 		},
 		Spec: v1.AgentActionSpec{
-			AgentConfig: inst.Spec.AgentConfig,
-			Args:        []string{"installation", "apply", "installation.yaml"},
+			AgentConfig:  inst.Spec.AgentConfig,
+			PorterConfig: inst.Spec.PorterConfig,
+			Args:         []string{"installation", "apply", "installation.yaml"},
 			Files: map[string][]byte{
 				"installation.yaml": installationResourceB,
 			},
 		},
 	}
+	// Pass the sources of the credential and parameter sets that are resolved by the operator to Porter
+	sources, err := getInstallationSources(ctx, r.Client, inst)
+	if err != nil {
+		return nil, err
+	}
+	action.Spec.Env = sources.Env
+	action.Spec.Volumes = sources.Volumes
+	action.Spec.VolumeMounts = sources.VolumeMounts
+	// Record the sets that were used, so that the installation is applied again when they are updated
+	generations, err := getSetGenerations(ctx, r.Client, inst)
+	if err != nil {
+		return nil, err
+	}
+	action.Annotations[v1.AnnotationSetGenerations] = formatSetGenerations(generations)
 	if err := controllerutil.SetControllerReference(inst, action, r.Scheme); err != nil {
 		return nil, err
 	}
+	return action, nil
+}
+
+// reapplyInstallation runs porter installation apply again for the current generation of the installation,
+// with a new agent action that records the cause in the history of the installation.
+func (r *InstallationReconciler) reapplyInstallation(ctx context.Context, log logr.Logger, inst *v1.Installation, current *v1.AgentAction, cause string) error {
+	ctx, span := startSpan(ctx, "Installation.reapplyInstallation")
+	defer span.End()
+
+	log.V(Log5Trace).Info("Initializing installation status")
+	inst.Status.Initialize()
+	if err := r.saveStatus(ctx, log, inst); err != nil {
+		return err
+	}
+
+	action, err := r.newAgentAction(ctx, inst)
+	if err != nil {
+		return err
+	}
+	// Porter does not compare the resolved credentials when checking if the installation is in sync, so force a run
+	action.Spec.Args = append(action.Spec.Args, "--force")
+	action.Labels[v1.LabelReapply] = strconv.Itoa(getReapplyCount(current) + 1)
+	action.Annotations[v1.AnnotationReapplyCause] = cause
 	if err := r.Create(ctx, action); err != nil {
-		return nil, errors.Wrap(err, "error creating the porter agent action")
+		return errors.Wrap(err, "error creating the porter agent action to apply the installation again")
 	}
 
-	r.Recorder.Event(inst, "Normal", "CreateAgentAction", fmt.Sprintf("created installation agent action for %s", inst.Name))
-	log.V(Log4Debug).Info("Created porter agent action", "name", action.Name)
-	return action, nil
+	r.Recorder.Event(inst, "Normal", "ReapplyInstallation", fmt.Sprintf("created installation agent action for %s because %s", inst.Name, cause))
+	log.V(Log4Debug).Info("Created porter agent action to apply the installation again", "name", action.Name, "cause", cause)
+
+	// Update the Installation Status with the agent action
+	return r.syncStatus(ctx, log, inst, action)
 }
 
 // Check the status of the porter-agent job and use that to update the AgentAction status
 func (r *InstallationReconciler) syncStatus(ctx context.Context, log logr.Logger, inst *v1.Installation, action *v1.AgentAction) error {
+	_, span := startSpan(ctx, "Installation.syncStatus")
+	defer span.End()
+
 	origStatus := inst.Status
 
 	applyAgentAction(log, inst, action)
 
 	if !reflect.DeepEqual(origStatus, inst.Status) {
-		return r.saveStatus(ctx, log, inst)
+		if err := r.saveStatus(ctx, log, inst); err != nil {
+			return err
+		}
+		recordAgentActionEvent(r.Recorder, inst, origStatus.Phase, action)
 	}
 
 	return nil
 }
 
+// Copy the status of the installation recorded by Porter into the installation status once the agent action has finished.
+func (r *InstallationReconciler) syncPorterStatus(ctx context.Context, log logr.Logger, inst *v1.Installation, action *v1.AgentAction) error {
+	if action == nil || (action.Status.Phase != v1.PhaseSucceeded && action.Status.Phase != v1.PhaseFailed) {
+		return nil
+	}
+
+	in := &installationv1.ListInstallationsRequest{Name: inst.Spec.Name, Namespace: ptr.To(inst.Spec.Namespace)}
+	resp, err := r.PorterGRPCClient.ListInstallations(ctx, in)
+	if err != nil {
+		// NOTE: Do not requeue, the status is synced again the next time the installation is reconciled
+		log.V(Log4Debug).Info(fmt.Sprintf("failed to get installation from grpc server for: %s:%s installation error: %s", inst.Spec.Name, inst.Spec.Namespace, err.Error()))
+		return nil
+	}
+
+	var porterInst *installationv1.Installation
+	for _, i := range resp.GetInstallation() {
+		// Only an exact match, the name filter may also match other installations
+		if i.GetName() == inst.Spec.Name && i.GetNamespace() == inst.Spec.Namespace {
+			porterInst = i
+			break
+		}
+	}
+	if porterInst == nil {
+		log.V(Log4Debug).Info("installation was not found in porter")
+		return nil
+	}
+
+	porterStatus := convertPorterInstallationStatus(porterInst)
+	if reflect.DeepEqual(inst.Status.Porter, porterStatus) {
+		return nil
+	}
+
+	log.V(Log5Trace).Info("Syncing installation status from porter", "resultStatus", porterStatus.ResultStatus)
+	inst.Status.Porter = porterStatus
+	return r.saveStatus(ctx, log, inst)
+}
+
+// convertPorterInstallationStatus converts an installation returned by the Porter gRPC API into the status recorded on the Installation.
+func convertPorterInstallationStatus(inst *installationv1.Installation) *v1.PorterInstallationStatus {
+	status := inst.GetStatus()
+	result := &v1.PorterInstallationStatus{
+		InstallationID:  inst.GetId(),
+		RunID:           status.GetRunId(),
+		Action:          status.GetAction(),
+		ResultID:        status.GetResultId(),
+		ResultStatus:    status.GetResultStatus(),
+		BundleReference: status.GetBundleReference(),
+		BundleVersion:   status.GetBundleVersion(),
+		BundleDigest:    status.GetBundleDigest(),
+		Created:         convertTimestamp(status.GetCreated()),
+		Modified:        convertTimestamp(status.GetModified()),
+		Installed:       convertTimestamp(status.GetInstalled()),
+		Uninstalled:     convertTimestamp(status.GetUninstalled()),
+	}
+	if result.BundleDigest == "" {
+		result.BundleDigest = inst.GetBundle().GetDigest()
+	}
+	return result
+}
+
+func convertTimestamp(ts *timestamppb.Timestamp) *metav1.Time {
+	if ts == nil {
+		return nil
+	}
+	// Round to the precision stored by Kubernetes so that the status is stable
+	t := metav1.NewTime(ts.AsTime().Truncate(time.Second).Local())
+	return &t
+}
+
 // Only update the status with a PATCH, don't clobber the entire installation
 func (r *InstallationReconciler) saveStatus(ctx context.Context, log logr.Logger, inst *v1.Installation) error {
 	log.V(Log5Trace).Info("Patching installation status")
@@ -400,6 +661,8 @@ func (r *InstallationReconciler) retry(ctx context.Context, log logr.Logger, ins
 	if err := r.Update(ctx, action); err != nil {
 		return errors.Wrap(err, "error updating the associated porter agent action")
 	}
+	recordAgentActionRetry(action)
+	r.Recorder.Event(inst, "Normal", "RetryAgentAction", fmt.Sprintf("retried installation agent action %s", action.Name))
 
 	log.V(Log4Debug).Info("Retried associated porter agent action", "name", "retry", action.Name, retry)
 	return nil
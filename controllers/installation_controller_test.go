@@ -3,6 +3,7 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"testing"
 	"time"
 
@@ -10,14 +11,17 @@ import (
 	mocks "get.porter.sh/operator/mocks/grpc"
 	installationv1 "get.porter.sh/porter/gen/proto/go/porterapis/installation/v1alpha1"
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -29,6 +33,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 )
 
 func TestShouldInstall(t *testing.T) {
@@ -250,9 +255,10 @@ func TestInstallationReconciler_createAgentAction(t *testing.T) {
 			},
 		},
 		Spec: v1.InstallationSpec{
-			Namespace:   "dev",
-			Name:        "wordpress",
-			AgentConfig: &corev1.LocalObjectReference{Name: "myAgentConfig"},
+			Namespace:    "dev",
+			Name:         "wordpress",
+			AgentConfig:  &corev1.LocalObjectReference{Name: "myAgentConfig"},
+			PorterConfig: &corev1.LocalObjectReference{Name: "myPorterConfig"},
 		},
 	}
 	action, err := controller.createAgentAction(context.Background(), logr.Discard(), inst)
@@ -278,7 +284,7 @@ func TestInstallationReconciler_createAgentAction(t *testing.T) {
 	assertContains(t, action.Labels, "testLabel", "abc123", "incorrect label")
 
 	assert.Equal(t, inst.Spec.AgentConfig, action.Spec.AgentConfig, "incorrect AgentConfig reference")
-	assert.Equal(t, inst.Spec.AgentConfig, action.Spec.AgentConfig, "incorrect PorterConfig reference")
+	assert.Equal(t, inst.Spec.PorterConfig, action.Spec.PorterConfig, "incorrect PorterConfig reference")
 	assert.Nilf(t, action.Spec.Command, "should use the default command for the agent")
 	assert.Equal(t, []string{"installation", "apply", "installation.yaml"}, action.Spec.Args, "incorrect agent arguments")
 	assert.Contains(t, action.Spec.Files, "installation.yaml")
@@ -377,6 +383,56 @@ func TestCreateStatusOutputs(t *testing.T) {
 	assert.IsType(t, v1.InstallationOutputStatus{}, installOut.Status)
 }
 
+func TestConvertOutput(t *testing.T) {
+	obj, err := structpb.NewStruct(map[string]interface{}{"host": "localhost", "port": 5432})
+	require.NoError(t, err)
+	list, err := structpb.NewList([]interface{}{"a", 1, true})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		outputType   string
+		value        *structpb.Value
+		wantValue    string
+		wantJSON     string
+		wantEncoding string
+	}{
+		"string":       {outputType: "string", value: structpb.NewStringValue("hello"), wantValue: "hello"},
+		"integer":      {outputType: "integer", value: structpb.NewNumberValue(42), wantValue: "42", wantJSON: "42"},
+		"number":       {outputType: "number", value: structpb.NewNumberValue(1.5), wantValue: "1.5", wantJSON: "1.5"},
+		"boolean":      {outputType: "boolean", value: structpb.NewBoolValue(true), wantValue: "true", wantJSON: "true"},
+		"object":       {outputType: "object", value: structpb.NewStructValue(obj), wantValue: `{"host":"localhost","port":5432}`, wantJSON: `{"host":"localhost","port":5432}`},
+		"array":        {outputType: "array", value: structpb.NewListValue(list), wantValue: `["a",1,true]`, wantJSON: `["a",1,true]`},
+		"null":         {outputType: "string", value: structpb.NewNullValue()},
+		"missing":      {outputType: "string"},
+		"text file":    {outputType: "file", value: structpb.NewStringValue("line1\nline2"), wantValue: "line1\nline2"},
+		"binary file":  {outputType: "file", value: structpb.NewStringValue("\xff\xfe"), wantValue: "//4=", wantEncoding: v1.OutputEncodingBase64},
+		"binary value": {outputType: "string", value: structpb.NewStringValue("\xff\xfe"), wantValue: "\xff\xfe"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			in := &installationv1.PorterValue{
+				Name:      "fake-output",
+				Type:      test.outputType,
+				Sensitive: true,
+				Value:     test.value,
+			}
+			got, err := convertOutput(in)
+			require.NoError(t, err)
+			assert.Equal(t, "fake-output", got.Name)
+			assert.Equal(t, test.outputType, got.Type)
+			assert.True(t, got.Sensitive)
+			assert.Equal(t, test.wantValue, got.Value)
+			assert.Equal(t, test.wantEncoding, got.Encoding)
+			if test.wantJSON == "" {
+				assert.Nil(t, got.JSONValue)
+			} else {
+				require.NotNil(t, got.JSONValue)
+				assert.JSONEq(t, test.wantJSON, string(got.JSONValue.Raw))
+			}
+		})
+	}
+}
+
 func TestCheckOrCreateInstallationOutputsCR(t *testing.T) {
 	ctx := context.Background()
 	output := &v1.InstallationOutput{
@@ -400,6 +456,55 @@ func TestCheckOrCreateInstallationOutputsCR(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+type fakeConnectionChecker struct {
+	err error
+}
+
+func (c fakeConnectionChecker) CheckConnection() error {
+	return c.err
+}
+
+func TestCheckOrCreateInstallationOutputsCR_PorterConnected(t *testing.T) {
+	ctx := context.Background()
+	install := &v1.Installation{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "fake-install",
+			Namespace: "fake-ns",
+		},
+		Spec: v1.InstallationSpec{
+			Name:      "fake-install",
+			Namespace: "fake-ns",
+		},
+	}
+	output := &v1.InstallationOutput{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "fake-install",
+			Namespace: "fake-ns",
+		},
+	}
+	rec := setupInstallationController(output)
+	key := client.ObjectKeyFromObject(output)
+
+	rec.PorterGRPCStatus = fakeConnectionChecker{err: fmt.Errorf("connection to the porter grpc server is TRANSIENT_FAILURE")}
+	_, err := rec.CheckOrCreateInstallationOutputsCR(ctx, logr.Discard(), install)
+	require.NoError(t, err)
+	require.NoError(t, rec.Get(ctx, key, output))
+	cond := apimeta.FindStatusCondition(output.Status.Conditions, v1.InstallationOutputPorterConnected)
+	require.NotNil(t, cond)
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, "ConnectionUnavailable", cond.Reason)
+	assert.Contains(t, cond.Message, "TRANSIENT_FAILURE")
+
+	rec.PorterGRPCStatus = fakeConnectionChecker{}
+	_, err = rec.CheckOrCreateInstallationOutputsCR(ctx, logr.Discard(), install)
+	require.NoError(t, err)
+	require.NoError(t, rec.Get(ctx, key, output))
+	cond = apimeta.FindStatusCondition(output.Status.Conditions, v1.InstallationOutputPorterConnected)
+	require.NotNil(t, cond)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, "Connected", cond.Reason)
+}
+
 func TestCheckOrCreateInstallationOutputsCRCreate(t *testing.T) {
 	ctx := context.Background()
 	grpcClient := &mocks.PorterClient{}
@@ -440,6 +545,7 @@ func TestCheckOrCreateInstallationOutputsCRCreate(t *testing.T) {
 
 func TestCheckOrCreateInstallationOutputsCRCreateFail(t *testing.T) {
 	ctx := context.Background()
+	installationOutputSyncFailures.Reset()
 	grpcClient := &mocks.PorterClient{}
 	listInstallationRequest := &installationv1.ListInstallationLatestOutputRequest{Name: "fake-install", Namespace: ptr.To("fake-ns")}
 	grpcClient.On("ListInstallationLatestOutputs", ctx, listInstallationRequest).Return(nil, fmt.Errorf("this is an error"))
@@ -460,6 +566,93 @@ func TestCheckOrCreateInstallationOutputsCRCreateFail(t *testing.T) {
 	// want to requeue if this fails.  We will not include outputs of
 	// installations that do not have it stored in the grpc server.
 	assert.NoError(t, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(installationOutputSyncFailures.WithLabelValues("fake-ns")))
+}
+
+func TestInstallationReconciler_syncPorterStatus(t *testing.T) {
+	ctx := context.Background()
+	installed := time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC)
+	porterInstallations := &installationv1.ListInstallationsResponse{
+		Installation: []*installationv1.Installation{
+			{Id: "other", Name: "fake-install-2", Namespace: "fake-ns"},
+			{
+				Id:        "01HN0000000000000000000000",
+				Name:      "fake-install",
+				Namespace: "fake-ns",
+				Bundle:    &installationv1.Bundle{Repository: "ghcr.io/getporter/examples/porter-hello", Digest: ptr.To("sha256:abc123")},
+				Status: &installationv1.InstallationStatus{
+					RunId:           ptr.To("run-1"),
+					Action:          ptr.To("install"),
+					ResultId:        ptr.To("result-1"),
+					ResultStatus:    ptr.To("succeeded"),
+					Installed:       timestamppb.New(installed),
+					BundleReference: ptr.To("ghcr.io/getporter/examples/porter-hello:v0.2.0"),
+					BundleVersion:   ptr.To("0.2.0"),
+				},
+			},
+		},
+	}
+
+	newInstallation := func() *v1.Installation {
+		return &v1.Installation{
+			ObjectMeta: metav1.ObjectMeta{Name: "fake-install", Namespace: "fake-ns"},
+			Spec:       v1.InstallationSpec{Name: "fake-install", Namespace: "fake-ns"},
+		}
+	}
+
+	t.Run("action finished", func(t *testing.T) {
+		inst := newInstallation()
+		grpcClient := &mocks.PorterClient{}
+		listInstallationsRequest := &installationv1.ListInstallationsRequest{Name: "fake-install", Namespace: ptr.To("fake-ns")}
+		grpcClient.On("ListInstallations", ctx, listInstallationsRequest).Return(porterInstallations, nil)
+		rec := setupInstallationController(inst)
+		rec.PorterGRPCClient = grpcClient
+
+		action := &v1.AgentAction{Status: v1.AgentActionStatus{Phase: v1.PhaseSucceeded}}
+		require.NoError(t, rec.syncPorterStatus(ctx, logr.Discard(), inst, action))
+
+		var got v1.Installation
+		require.NoError(t, rec.Get(ctx, client.ObjectKeyFromObject(inst), &got))
+		require.NotNil(t, got.Status.Porter)
+		assert.Equal(t, "01HN0000000000000000000000", got.Status.Porter.InstallationID)
+		assert.Equal(t, "run-1", got.Status.Porter.RunID)
+		assert.Equal(t, "install", got.Status.Porter.Action)
+		assert.Equal(t, "result-1", got.Status.Porter.ResultID)
+		assert.Equal(t, "succeeded", got.Status.Porter.ResultStatus)
+		assert.Equal(t, "ghcr.io/getporter/examples/porter-hello:v0.2.0", got.Status.Porter.BundleReference)
+		assert.Equal(t, "0.2.0", got.Status.Porter.BundleVersion)
+		assert.Equal(t, "sha256:abc123", got.Status.Porter.BundleDigest, "the digest should fall back to the bundle reference on the installation")
+		require.NotNil(t, got.Status.Porter.Installed)
+		assert.True(t, installed.Truncate(time.Second).Equal(got.Status.Porter.Installed.Time))
+		assert.Nil(t, got.Status.Porter.Uninstalled)
+		assert.Equal(t, convertPorterInstallationStatus(porterInstallations.Installation[1]), got.Status.Porter, "the converted status should round trip without changes")
+	})
+
+	t.Run("action running", func(t *testing.T) {
+		inst := newInstallation()
+		grpcClient := &mocks.PorterClient{}
+		rec := setupInstallationController(inst)
+		rec.PorterGRPCClient = grpcClient
+
+		action := &v1.AgentAction{Status: v1.AgentActionStatus{Phase: v1.PhaseRunning}}
+		require.NoError(t, rec.syncPorterStatus(ctx, logr.Discard(), inst, action))
+		grpcClient.AssertNotCalled(t, "ListInstallations")
+		assert.Nil(t, inst.Status.Porter)
+	})
+
+	t.Run("grpc error", func(t *testing.T) {
+		inst := newInstallation()
+		grpcClient := &mocks.PorterClient{}
+		listInstallationsRequest := &installationv1.ListInstallationsRequest{Name: "fake-install", Namespace: ptr.To("fake-ns")}
+		grpcClient.On("ListInstallations", ctx, listInstallationsRequest).Return(nil, fmt.Errorf("this is an error"))
+		rec := setupInstallationController(inst)
+		rec.PorterGRPCClient = grpcClient
+
+		action := &v1.AgentAction{Status: v1.AgentActionStatus{Phase: v1.PhaseFailed}}
+		// NOTE: The status is synced again on the next reconcile, so this is not returned as an error
+		require.NoError(t, rec.syncPorterStatus(ctx, logr.Discard(), inst, action))
+		assert.Nil(t, inst.Status.Porter)
+	})
 }
 
 func TestSetupWithManager(t *testing.T) {
@@ -471,6 +664,23 @@ func TestSetupWithManager(t *testing.T) {
 	assert.Error(t, err)
 	err = r.SetupWithManager(mgr)
 	assert.Error(t, err)
+
+	// Resolve the resources without a cluster
+	mapper := apimeta.NewDefaultRESTMapper([]schema.GroupVersion{v1.GroupVersion})
+	for gvk := range scheme.AllKnownTypes() {
+		mapper.Add(gvk, apimeta.RESTScopeNamespace)
+	}
+	restConfig = &rest.Config{Host: "http://localhost:1"}
+	mgr, err = manager.New(restConfig, manager.Options{
+		Scheme:  scheme,
+		Metrics: metricsserver.Options{BindAddress: "0"},
+		MapperProvider: func(*rest.Config, *http.Client) (apimeta.RESTMapper, error) {
+			return mapper, nil
+		},
+	})
+	require.NoError(t, err)
+	err = r.SetupWithManager(mgr)
+	assert.NoError(t, err)
 }
 
 func setupInstallationController(objs ...client.Object) *InstallationReconciler {
@@ -481,6 +691,8 @@ func setupInstallationController(objs ...client.Object) *InstallationReconciler
 	fakeBuilder := fake.NewClientBuilder()
 	fakeBuilder.WithScheme(scheme)
 	fakeBuilder.WithObjects(objs...).WithStatusSubresource(objs...)
+	fakeBuilder.WithIndex(&v1.Installation{}, credentialSetIndexKey, indexInstallationByCredentialSet)
+	fakeBuilder.WithIndex(&v1.Installation{}, parameterSetIndexKey, indexInstallationByParameterSet)
 	fakeClient := fakeBuilder.Build()
 
 	return &InstallationReconciler{
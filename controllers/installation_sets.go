@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// credentialSetIndexKey indexes the installations by the namespace/porter namespace/porter name
+	// of each CredentialSet that they use.
+	credentialSetIndexKey = "credentialSet"
+
+	// parameterSetIndexKey indexes the installations by the namespace/porter namespace/porter name
+	// of each ParameterSet that they use.
+	parameterSetIndexKey = "parameterSet"
+)
+
+func indexInstallationByCredentialSet(obj client.Object) []string {
+	inst := obj.(*porterv1.Installation)
+	return getSetIndexValues(inst, inst.Spec.CredentialSets)
+}
+
+func indexInstallationByParameterSet(obj client.Object) []string {
+	inst := obj.(*porterv1.Installation)
+	return getSetIndexValues(inst, inst.Spec.ParameterSets)
+}
+
+func getSetIndexValues(inst *porterv1.Installation, names []string) []string {
+	values := make([]string, 0, len(names))
+	for _, name := range names {
+		values = append(values, getSetIndexValue(inst.Namespace, inst.Spec.Namespace, name))
+	}
+	return values
+}
+
+// getSetIndexValue identifies a credential or parameter set by the namespace of the resource,
+// and its namespace and name in Porter which are used to reference it from an installation.
+func getSetIndexValue(namespace string, porterNamespace string, porterName string) string {
+	return namespace + "/" + porterNamespace + "/" + porterName
+}
+
+// isSetApplied determines if the current generation of a credential or parameter set has been applied to Porter.
+func isSetApplied(set PorterResource) bool {
+	status := set.GetStatus()
+	return status.Phase == porterv1.PhaseSucceeded && status.ObservedGeneration == set.GetGeneration()
+}
+
+// mapCredentialSetToInstallations requests the installations that use a CredentialSet, once it has been applied.
+func (r *InstallationReconciler) mapCredentialSetToInstallations(ctx context.Context, obj client.Object) []reconcile.Request {
+	cs := obj.(*porterv1.CredentialSet)
+	if !isSetApplied(cs) {
+		return nil
+	}
+	return r.listInstallationsUsingSet(ctx, credentialSetIndexKey, getSetIndexValue(cs.Namespace, cs.Spec.Namespace, cs.Spec.Name))
+}
+
+// mapParameterSetToInstallations requests the installations that use a ParameterSet, once it has been applied.
+func (r *InstallationReconciler) mapParameterSetToInstallations(ctx context.Context, obj client.Object) []reconcile.Request {
+	ps := obj.(*porterv1.ParameterSet)
+	if !isSetApplied(ps) {
+		return nil
+	}
+	return r.listInstallationsUsingSet(ctx, parameterSetIndexKey, getSetIndexValue(ps.Namespace, ps.Spec.Namespace, ps.Spec.Name))
+}
+
+func (r *InstallationReconciler) listInstallationsUsingSet(ctx context.Context, indexKey string, key string) []reconcile.Request {
+	installations := &porterv1.InstallationList{}
+	if err := r.List(ctx, installations, client.MatchingFields{indexKey: key}); err != nil {
+		r.Log.V(Log0Error).Error(err, "Could not list the installations using a set", indexKey, key)
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(installations.Items))
+	for _, inst := range installations.Items {
+		if inst.Spec.GetSetChangePolicy() == porterv1.SetChangePolicyIgnore {
+			continue
+		}
+		r.Log.V(Log4Debug).Info("Requeuing installation because a set that it uses was applied", "namespace", inst.Namespace, "installation", inst.Name, indexKey, key)
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: inst.Namespace, Name: inst.Name}})
+	}
+	return requests
+}
+
+// getSetGenerations returns the generation of each credential and parameter set used by an installation
+// that has been applied to Porter, keyed by KIND/NAME of the set resource.
+func getSetGenerations(ctx context.Context, c client.Client, inst *porterv1.Installation) (map[string]int64, error) {
+	generations := map[string]int64{}
+
+	if len(inst.Spec.CredentialSets) > 0 {
+		var credSets porterv1.CredentialSetList
+		if err := c.List(ctx, &credSets, client.InNamespace(inst.Namespace)); err != nil {
+			return nil, errors.Wrap(err, "error listing the credential sets used by the installation")
+		}
+		for i := range credSets.Items {
+			cs := &credSets.Items[i]
+			if usesSet(inst, inst.Spec.CredentialSets, cs.Spec.Namespace, cs.Spec.Name) && isSetApplied(cs) {
+				generations["CredentialSet/"+cs.Name] = cs.Generation
+			}
+		}
+	}
+
+	if len(inst.Spec.ParameterSets) > 0 {
+		var paramSets porterv1.ParameterSetList
+		if err := c.List(ctx, &paramSets, client.InNamespace(inst.Namespace)); err != nil {
+			return nil, errors.Wrap(err, "error listing the parameter sets used by the installation")
+		}
+		for i := range paramSets.Items {
+			ps := &paramSets.Items[i]
+			if usesSet(inst, inst.Spec.ParameterSets, ps.Spec.Namespace, ps.Spec.Name) && isSetApplied(ps) {
+				generations["ParameterSet/"+ps.Name] = ps.Generation
+			}
+		}
+	}
+
+	return generations, nil
+}
+
+// formatSetGenerations serializes the generations of the sets for the AnnotationSetGenerations annotation.
+func formatSetGenerations(generations map[string]int64) string {
+	values := make([]string, 0, len(generations))
+	for set, generation := range generations {
+		values = append(values, fmt.Sprintf("%s=%d", set, generation))
+	}
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+// parseSetGenerations reads the AnnotationSetGenerations annotation, ignoring invalid entries.
+func parseSetGenerations(value string) map[string]int64 {
+	generations := map[string]int64{}
+	for _, entry := range strings.Split(value, ",") {
+		set, generation, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		if g, err := strconv.ParseInt(generation, 10, 64); err == nil {
+			generations[set] = g
+		}
+	}
+	return generations
+}
+
+// getReapplyCount returns the number of times that the generation of an installation was applied again
+// before running the agent action.
+func getReapplyCount(action *porterv1.AgentAction) int {
+	count, _ := strconv.Atoi(action.Labels[porterv1.LabelReapply])
+	return count
+}
+
+// getSetChangeCause determines if a credential or parameter set used by an installation was applied to Porter
+// after the most recent agent action was created, and returns a description of the change.
+// Actions that are still running, or that were created before the generations of the sets were recorded, are left alone.
+// Installations that are uninstalled or being deleted are never applied again.
+func (r *InstallationReconciler) getSetChangeCause(ctx context.Context, log logr.Logger, inst *porterv1.Installation, action *porterv1.AgentAction) (string, error) {
+	if inst.Spec.GetSetChangePolicy() == porterv1.SetChangePolicyIgnore {
+		return "", nil
+	}
+	if inst.Spec.Uninstalled || inst.DeletionTimestamp != nil {
+		return "", nil
+	}
+	if action.Status.Phase != porterv1.PhaseSucceeded && action.Status.Phase != porterv1.PhaseFailed {
+		return "", nil
+	}
+	recordedValue, ok := action.Annotations[porterv1.AnnotationSetGenerations]
+	if !ok {
+		return "", nil
+	}
+
+	generations, err := getSetGenerations(ctx, r.Client, inst)
+	if err != nil {
+		return "", err
+	}
+	recorded := parseSetGenerations(recordedValue)
+
+	sets := make([]string, 0, len(generations))
+	for set := range generations {
+		sets = append(sets, set)
+	}
+	sort.Strings(sets)
+	for _, set := range sets {
+		if generation, ok := recorded[set]; !ok || generation != generations[set] {
+			log.V(Log4Debug).Info("A set used by the installation was applied", "set", set, "generation", generations[set], "recordedGeneration", generation)
+			return fmt.Sprintf("%s was applied at generation %d", set, generations[set]), nil
+		}
+	}
+	return "", nil
+}
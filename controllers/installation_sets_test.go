@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	v1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestInstallationReconciler_Reconcile_SetChanged(t *testing.T) {
+	ctx := context.Background()
+
+	inst := &v1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns", Generation: 1, Finalizers: []string{v1.FinalizerName}},
+		Spec: v1.InstallationSpec{
+			Namespace:      "dev",
+			Name:           "mybuns",
+			CredentialSets: []string{"mycreds"},
+		},
+	}
+	cs := &v1.CredentialSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mycreds", Generation: 1},
+		Spec:       v1.CredentialSetSpec{Namespace: "dev", Name: "mycreds"},
+		Status: v1.CredentialSetStatus{PorterResourceStatus: v1.PorterResourceStatus{
+			ObservedGeneration: 1,
+			Phase:              v1.PhaseSucceeded,
+		}},
+	}
+	// Register the status subresource of the agent actions created by the controller
+	unrelated := &v1.AgentAction{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "unrelated"}}
+	controller := setupInstallationController(inst, cs, unrelated)
+	recorder := controller.Recorder.(*record.FakeRecorder)
+	instKey := client.ObjectKeyFromObject(inst)
+
+	triggerReconcile := func() {
+		_, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: instKey})
+		require.NoError(t, err)
+		require.NoError(t, controller.Get(ctx, instKey, inst))
+	}
+	getAction := func() *v1.AgentAction {
+		require.NotNil(t, inst.Status.Action)
+		action := &v1.AgentAction{}
+		require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: inst.Namespace, Name: inst.Status.Action.Name}, action))
+		return action
+	}
+	completeAction := func(action *v1.AgentAction) {
+		action.Status.Phase = v1.PhaseSucceeded
+		require.NoError(t, controller.Status().Update(ctx, action))
+	}
+	applySet := func(generation int64) {
+		require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(cs), cs))
+		cs.Generation = generation
+		require.NoError(t, controller.Update(ctx, cs))
+		cs.Status.ObservedGeneration = generation
+		cs.Status.Phase = v1.PhaseSucceeded
+		require.NoError(t, controller.Status().Update(ctx, cs))
+	}
+
+	// The sets used by the installation are recorded on the action
+	triggerReconcile()
+	action := getAction()
+	assert.Equal(t, "CredentialSet/mycreds=1", action.Annotations[v1.AnnotationSetGenerations])
+	assert.Empty(t, action.Labels[v1.LabelReapply])
+	completeAction(action)
+	triggerReconcile()
+	assert.Equal(t, action.Name, getAction().Name, "the installation should not be applied again when the sets did not change")
+
+	// Updating the set applies the installation again once the set is applied
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(cs), cs))
+	cs.Generation = 2
+	cs.Status.Phase = v1.PhaseRunning
+	require.NoError(t, controller.Update(ctx, cs))
+	require.NoError(t, controller.Status().Update(ctx, cs))
+	assert.Empty(t, controller.mapCredentialSetToInstallations(ctx, cs), "the installation should wait for the set to be applied")
+	triggerReconcile()
+	assert.Equal(t, action.Name, getAction().Name, "the installation should wait for the set to be applied")
+
+	applySet(2)
+	assert.Equal(t, []ctrl.Request{{NamespacedName: instKey}}, controller.mapCredentialSetToInstallations(ctx, cs))
+	for len(recorder.Events) > 0 {
+		<-recorder.Events
+	}
+	triggerReconcile()
+	assert.Contains(t, <-recorder.Events, "ReapplyInstallation")
+	reapplied := getAction()
+	assert.NotEqual(t, action.Name, reapplied.Name, "a new action should be created")
+	assert.Equal(t, "1", reapplied.Labels[v1.LabelReapply])
+	assert.Equal(t, "1", reapplied.Labels[v1.LabelResourceGeneration], "the same generation of the installation should be applied")
+	assert.Equal(t, "CredentialSet/mycreds was applied at generation 2", reapplied.Annotations[v1.AnnotationReapplyCause], "the cause should be recorded in the history of the installation")
+	assert.Equal(t, "CredentialSet/mycreds=2", reapplied.Annotations[v1.AnnotationSetGenerations])
+	assert.Contains(t, reapplied.Spec.Args, "--force")
+
+	// The most recent action is used for the generation
+	triggerReconcile()
+	assert.Equal(t, reapplied.Name, getAction().Name)
+
+	// The installation is not applied again while the action runs
+	applySet(3)
+	triggerReconcile()
+	assert.Equal(t, reapplied.Name, getAction().Name, "the installation should not be applied again until the action completes")
+	completeAction(reapplied)
+	triggerReconcile()
+	latest := getAction()
+	assert.Equal(t, "2", latest.Labels[v1.LabelReapply])
+
+	// Opt out of applying the installation again
+	inst.Spec.SetChangePolicy = v1.SetChangePolicyIgnore
+	require.NoError(t, controller.Update(ctx, inst))
+	completeAction(latest)
+	applySet(4)
+	assert.Empty(t, controller.mapCredentialSetToInstallations(ctx, cs))
+	triggerReconcile()
+	assert.Equal(t, latest.Name, getAction().Name, "the installation should not be applied again when the policy is Ignore")
+}
+
+func TestInstallationReconciler_getSetChangeCause_Parameters(t *testing.T) {
+	ctx := context.Background()
+	inst := &v1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns"},
+		Spec:       v1.InstallationSpec{Namespace: "dev", Name: "mybuns", ParameterSets: []string{"myparams"}},
+	}
+	newParameterSet := func(name string, porterNamespace string) *v1.ParameterSet {
+		return &v1.ParameterSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: name, Generation: 2},
+			Spec:       v1.ParameterSetSpec{Namespace: porterNamespace, Name: "myparams"},
+			Status: v1.ParameterSetStatus{PorterResourceStatus: v1.PorterResourceStatus{
+				ObservedGeneration: 2,
+				Phase:              v1.PhaseSucceeded,
+			}},
+		}
+	}
+	controller := setupInstallationController(inst, newParameterSet("myparams", "dev"), newParameterSet("other-namespace", "prod"))
+
+	action := &v1.AgentAction{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+	action.Status.Phase = v1.PhaseFailed
+	cause, err := controller.getSetChangeCause(ctx, logr.Discard(), inst, action)
+	require.NoError(t, err)
+	assert.Empty(t, cause, "actions created before the sets were recorded should not be applied again")
+
+	action.Annotations[v1.AnnotationSetGenerations] = ""
+	cause, err = controller.getSetChangeCause(ctx, logr.Discard(), inst, action)
+	require.NoError(t, err)
+	assert.Equal(t, "ParameterSet/myparams was applied at generation 2", cause, "a set that was applied after the action was created should apply the installation again")
+
+	action.Annotations[v1.AnnotationSetGenerations] = "ParameterSet/myparams=2"
+	cause, err = controller.getSetChangeCause(ctx, logr.Discard(), inst, action)
+	require.NoError(t, err)
+	assert.Empty(t, cause, "the set in another porter namespace is not used by the installation")
+}
+
+func TestInstallationReconciler_getSetChangeCause_Uninstalled(t *testing.T) {
+	ctx := context.Background()
+	inst := &v1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns"},
+		Spec:       v1.InstallationSpec{Namespace: "dev", Name: "mybuns", CredentialSets: []string{"mycreds"}},
+	}
+	cs := &v1.CredentialSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mycreds", Generation: 2},
+		Spec:       v1.CredentialSetSpec{Namespace: "dev", Name: "mycreds"},
+		Status: v1.CredentialSetStatus{PorterResourceStatus: v1.PorterResourceStatus{
+			ObservedGeneration: 2,
+			Phase:              v1.PhaseSucceeded,
+		}},
+	}
+	controller := setupInstallationController(inst, cs)
+
+	action := &v1.AgentAction{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{v1.AnnotationSetGenerations: "CredentialSet/mycreds=1"}}}
+	action.Status.Phase = v1.PhaseSucceeded
+	cause, err := controller.getSetChangeCause(ctx, logr.Discard(), inst, action)
+	require.NoError(t, err)
+	require.NotEmpty(t, cause, "the installation should be applied again when the set changed")
+
+	uninstalled := inst.DeepCopy()
+	uninstalled.Spec.Uninstalled = true
+	cause, err = controller.getSetChangeCause(ctx, logr.Discard(), uninstalled, action)
+	require.NoError(t, err)
+	assert.Empty(t, cause, "an uninstalled installation should not be applied again")
+
+	deleted := inst.DeepCopy()
+	now := metav1.Now()
+	deleted.DeletionTimestamp = &now
+	cause, err = controller.getSetChangeCause(ctx, logr.Discard(), deleted, action)
+	require.NoError(t, err)
+	assert.Empty(t, cause, "an installation that is being deleted should not be applied again")
+}
+
+func TestIndexInstallationBySets(t *testing.T) {
+	inst := &v1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns"},
+		Spec: v1.InstallationSpec{
+			Namespace:      "dev",
+			CredentialSets: []string{"azure", "github"},
+			ParameterSets:  []string{"settings"},
+		},
+	}
+	assert.Equal(t, []string{"test/dev/azure", "test/dev/github"}, indexInstallationByCredentialSet(inst))
+	assert.Equal(t, []string{"test/dev/settings"}, indexInstallationByParameterSet(inst))
+}
+
+func TestParseSetGenerations(t *testing.T) {
+	generations := map[string]int64{"ParameterSet/settings": 3, "CredentialSet/azure": 12}
+	value := formatSetGenerations(generations)
+	assert.Equal(t, "CredentialSet/azure=12,ParameterSet/settings=3", value)
+	assert.Equal(t, generations, parseSetGenerations(value))
+	assert.Empty(t, parseSetGenerations(""))
+	assert.Equal(t, map[string]int64{"CredentialSet/azure": 1}, parseSetGenerations("CredentialSet/azure=1,invalid,ParameterSet/settings=abc"))
+}
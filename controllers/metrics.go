@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	metricsNamespace = "porter_operator"
+
+	// agentActionKindUnknown is the kind reported for agent actions that were not created for a Porter resource.
+	agentActionKindUnknown = "AgentAction"
+)
+
+var (
+	// agentActionRuns counts the agent actions that finished, by the kind of resource that created them, namespace and result.
+	agentActionRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "agent_action_runs_total",
+		Help:      "Number of porter agent actions that finished, by resource kind, namespace and result.",
+	}, []string{"kind", "namespace", "result"})
+
+	// agentJobDuration tracks how long the porter agent job ran.
+	agentJobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "agent_job_duration_seconds",
+		Help:      "Time from when the porter agent job started until it finished, by resource kind and result.",
+		Buckets:   []float64{5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+	}, []string{"kind", "result"})
+
+	// agentJobPending tracks how long the porter agent job waited before it started.
+	agentJobPending = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "agent_job_pending_seconds",
+		Help:      "Time from when the porter agent job was created until it started running, by resource kind.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"kind"})
+
+	// agentActionRetries counts the agent actions retried by a user.
+	agentActionRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "agent_action_retries_total",
+		Help:      "Number of porter agent actions that were retried, by resource kind and namespace.",
+	}, []string{"kind", "namespace"})
+
+	// agentActionQueueDepth tracks the agent actions waiting for their agent job to start.
+	// It is updated by the AgentAction reconciler, see recordAgentActionQueued.
+	agentActionQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "agent_action_queue_depth",
+		Help:      "Number of porter agent actions waiting for their agent job to start, by namespace.",
+	}, []string{"namespace"})
+
+	// agentActionQueue is the set of agent actions counted by agentActionQueueDepth.
+	agentActionQueue = &waitingAgentActions{actions: map[types.NamespacedName]bool{}}
+
+	// installationOutputSyncFailures counts failures to retrieve installation outputs from Porter.
+	installationOutputSyncFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "installation_output_sync_failures_total",
+		Help:      "Number of times the outputs of an installation could not be retrieved from the porter grpc server, by namespace.",
+	}, []string{"namespace"})
+
+	// porterGRPCDuration tracks the latency of calls to the Porter gRPC server.
+	porterGRPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "porter_grpc_request_duration_seconds",
+		Help:      "Latency of calls to the porter grpc server, by method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		agentActionRuns,
+		agentJobDuration,
+		agentJobPending,
+		agentActionRetries,
+		agentActionQueueDepth,
+		installationOutputSyncFailures,
+		porterGRPCDuration,
+	)
+}
+
+// getAgentActionKind returns the kind of resource that created the agent action.
+func getAgentActionKind(action *porterv1.AgentAction) string {
+	if kind := action.Labels[porterv1.LabelResourceKind]; kind != "" {
+		return kind
+	}
+	return agentActionKindUnknown
+}
+
+// isAgentPhaseFinished returns whether the phase is the final phase of an agent action.
+func isAgentPhaseFinished(phase porterv1.AgentPhase) bool {
+	return phase == porterv1.PhaseSucceeded || phase == porterv1.PhaseFailed
+}
+
+// isAgentPhaseWaiting returns whether an agent action in the phase is waiting for its job to start.
+func isAgentPhaseWaiting(phase porterv1.AgentPhase) bool {
+	return phase == "" || phase == porterv1.PhaseUnknown || phase == porterv1.PhasePending
+}
+
+// recordAgentActionPhaseChange records metrics when the phase of an agent action changes
+// in response to its job.
+func recordAgentActionPhaseChange(action *porterv1.AgentAction, origPhase porterv1.AgentPhase, job *batchv1.Job) {
+	newPhase := action.Status.Phase
+	if job == nil || origPhase == newPhase {
+		return
+	}
+
+	kind := getAgentActionKind(action)
+	if isAgentPhaseWaiting(origPhase) && !isAgentPhaseWaiting(newPhase) {
+		started := time.Now()
+		if job.Status.StartTime != nil {
+			started = job.Status.StartTime.Time
+		}
+		agentJobPending.WithLabelValues(kind).Observe(started.Sub(job.CreationTimestamp.Time).Seconds())
+	}
+
+	if !isAgentPhaseFinished(origPhase) && isAgentPhaseFinished(newPhase) {
+		result := string(newPhase)
+		agentActionRuns.WithLabelValues(kind, action.Namespace, result).Inc()
+
+		if job.Status.StartTime != nil {
+			finished := time.Now()
+			if job.Status.CompletionTime != nil {
+				finished = job.Status.CompletionTime.Time
+			}
+			agentJobDuration.WithLabelValues(kind, result).Observe(finished.Sub(job.Status.StartTime.Time).Seconds())
+		}
+	}
+}
+
+// recordAgentActionRetry records that a user retried the agent action.
+func recordAgentActionRetry(action *porterv1.AgentAction) {
+	agentActionRetries.WithLabelValues(getAgentActionKind(action), action.Namespace).Inc()
+}
+
+// waitingAgentActions tracks the agent actions that are waiting for their job to start, as they are reconciled.
+// Every action is reconciled when the operator starts, so the set does not need to be persisted.
+type waitingAgentActions struct {
+	mu      sync.Mutex
+	actions map[types.NamespacedName]bool
+}
+
+// recordAgentActionQueued updates the queue depth after an agent action is reconciled.
+// The action is nil when it was deleted.
+func recordAgentActionQueued(key types.NamespacedName, action *porterv1.AgentAction) {
+	waiting := action != nil && action.DeletionTimestamp == nil && isAgentPhaseWaiting(action.Status.Phase)
+
+	agentActionQueue.mu.Lock()
+	defer agentActionQueue.mu.Unlock()
+	if agentActionQueue.actions[key] == waiting {
+		return
+	}
+	if waiting {
+		agentActionQueue.actions[key] = true
+		agentActionQueueDepth.WithLabelValues(key.Namespace).Inc()
+	} else {
+		delete(agentActionQueue.actions, key)
+		agentActionQueueDepth.WithLabelValues(key.Namespace).Dec()
+	}
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestRecordAgentActionPhaseChange(t *testing.T) {
+	agentActionRuns.Reset()
+	agentJobDuration.Reset()
+	agentJobPending.Reset()
+
+	created := time.Now().Add(-time.Minute)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)},
+		Status: batchv1.JobStatus{
+			StartTime:      &metav1.Time{Time: created.Add(10 * time.Second)},
+			CompletionTime: &metav1.Time{Time: created.Add(40 * time.Second)},
+		},
+	}
+	action := &porterv1.AgentAction{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test",
+			Labels:    map[string]string{porterv1.LabelResourceKind: "Installation"},
+		},
+	}
+
+	action.Status.Phase = porterv1.PhasePending
+	recordAgentActionPhaseChange(action, porterv1.PhaseUnknown, job)
+	assert.Equal(t, 0, testutil.CollectAndCount(agentJobPending), "no metrics should be recorded until the job starts")
+
+	action.Status.Phase = porterv1.PhaseRunning
+	recordAgentActionPhaseChange(action, porterv1.PhasePending, job)
+	assert.Equal(t, 1, testutil.CollectAndCount(agentJobPending))
+	assert.Equal(t, 0, testutil.CollectAndCount(agentActionRuns))
+
+	action.Status.Phase = porterv1.PhaseSucceeded
+	recordAgentActionPhaseChange(action, porterv1.PhaseRunning, job)
+	// Observing the same phase again should not count the run twice
+	recordAgentActionPhaseChange(action, porterv1.PhaseSucceeded, job)
+	assert.Equal(t, 1.0, testutil.ToFloat64(agentActionRuns.WithLabelValues("Installation", "test", "Succeeded")))
+
+	wantHistograms := `
+# HELP porter_operator_agent_job_duration_seconds Time from when the porter agent job started until it finished, by resource kind and result.
+# TYPE porter_operator_agent_job_duration_seconds histogram
+porter_operator_agent_job_duration_seconds_bucket{kind="Installation",result="Succeeded",le="5"} 0
+porter_operator_agent_job_duration_seconds_bucket{kind="Installation",result="Succeeded",le="15"} 0
+porter_operator_agent_job_duration_seconds_bucket{kind="Installation",result="Succeeded",le="30"} 1
+porter_operator_agent_job_duration_seconds_bucket{kind="Installation",result="Succeeded",le="60"} 1
+porter_operator_agent_job_duration_seconds_bucket{kind="Installation",result="Succeeded",le="120"} 1
+porter_operator_agent_job_duration_seconds_bucket{kind="Installation",result="Succeeded",le="300"} 1
+porter_operator_agent_job_duration_seconds_bucket{kind="Installation",result="Succeeded",le="600"} 1
+porter_operator_agent_job_duration_seconds_bucket{kind="Installation",result="Succeeded",le="1200"} 1
+porter_operator_agent_job_duration_seconds_bucket{kind="Installation",result="Succeeded",le="1800"} 1
+porter_operator_agent_job_duration_seconds_bucket{kind="Installation",result="Succeeded",le="3600"} 1
+porter_operator_agent_job_duration_seconds_bucket{kind="Installation",result="Succeeded",le="+Inf"} 1
+porter_operator_agent_job_duration_seconds_sum{kind="Installation",result="Succeeded"} 30
+porter_operator_agent_job_duration_seconds_count{kind="Installation",result="Succeeded"} 1
+# HELP porter_operator_agent_job_pending_seconds Time from when the porter agent job was created until it started running, by resource kind.
+# TYPE porter_operator_agent_job_pending_seconds histogram
+porter_operator_agent_job_pending_seconds_bucket{kind="Installation",le="1"} 0
+porter_operator_agent_job_pending_seconds_bucket{kind="Installation",le="5"} 0
+porter_operator_agent_job_pending_seconds_bucket{kind="Installation",le="10"} 1
+porter_operator_agent_job_pending_seconds_bucket{kind="Installation",le="30"} 1
+porter_operator_agent_job_pending_seconds_bucket{kind="Installation",le="60"} 1
+porter_operator_agent_job_pending_seconds_bucket{kind="Installation",le="120"} 1
+porter_operator_agent_job_pending_seconds_bucket{kind="Installation",le="300"} 1
+porter_operator_agent_job_pending_seconds_bucket{kind="Installation",le="600"} 1
+porter_operator_agent_job_pending_seconds_bucket{kind="Installation",le="+Inf"} 1
+porter_operator_agent_job_pending_seconds_sum{kind="Installation"} 10
+porter_operator_agent_job_pending_seconds_count{kind="Installation"} 1
+`
+	err := testutil.CollectAndCompare(agentJobDuration, strings.NewReader(wantHistograms), "porter_operator_agent_job_duration_seconds")
+	require.NoError(t, err)
+	err = testutil.CollectAndCompare(agentJobPending, strings.NewReader(wantHistograms), "porter_operator_agent_job_pending_seconds")
+	require.NoError(t, err)
+}
+
+func TestRecordAgentActionRetry(t *testing.T) {
+	agentActionRetries.Reset()
+
+	recordAgentActionRetry(&porterv1.AgentAction{ObjectMeta: metav1.ObjectMeta{Namespace: "test"}})
+	recordAgentActionRetry(&porterv1.AgentAction{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "test",
+		Labels:    map[string]string{porterv1.LabelResourceKind: "CredentialSet"},
+	}})
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(agentActionRetries.WithLabelValues("AgentAction", "test")), "actions created directly should use the AgentAction kind")
+	assert.Equal(t, 1.0, testutil.ToFloat64(agentActionRetries.WithLabelValues("CredentialSet", "test")))
+}
+
+func TestRecordAgentActionQueued(t *testing.T) {
+	agentActionQueueDepth.Reset()
+	agentActionQueue.actions = map[types.NamespacedName]bool{}
+
+	newAction := func(namespace string, name string, phase porterv1.AgentPhase) (types.NamespacedName, *porterv1.AgentAction) {
+		return types.NamespacedName{Namespace: namespace, Name: name}, &porterv1.AgentAction{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Status:     porterv1.AgentActionStatus{Phase: phase},
+		}
+	}
+	recordAgentActionQueued(newAction("ns1", "new", ""))
+	recordAgentActionQueued(newAction("ns1", "pending", porterv1.PhasePending))
+	recordAgentActionQueued(newAction("ns1", "pending", porterv1.PhasePending))
+	recordAgentActionQueued(newAction("ns1", "running", porterv1.PhaseRunning))
+	recordAgentActionQueued(newAction("ns2", "unknown", porterv1.PhaseUnknown))
+	recordAgentActionQueued(newAction("ns2", "done", porterv1.PhaseSucceeded))
+	assert.Equal(t, 2.0, testutil.ToFloat64(agentActionQueueDepth.WithLabelValues("ns1")), "an action should only be counted once")
+	assert.Equal(t, 1.0, testutil.ToFloat64(agentActionQueueDepth.WithLabelValues("ns2")))
+
+	// The action leaves the queue when its job starts, or when it is deleted
+	recordAgentActionQueued(newAction("ns1", "new", porterv1.PhaseRunning))
+	key, _ := newAction("ns2", "unknown", "")
+	recordAgentActionQueued(key, nil)
+	key, deleting := newAction("ns1", "pending", porterv1.PhasePending)
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	recordAgentActionQueued(key, deleting)
+	assert.Equal(t, 0.0, testutil.ToFloat64(agentActionQueueDepth.WithLabelValues("ns1")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(agentActionQueueDepth.WithLabelValues("ns2")))
+}
+
+func TestObservePorterGRPCCall(t *testing.T) {
+	porterGRPCDuration.Reset()
+
+	ok := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+	unavailable := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.Unavailable, "connection refused")
+	}
+
+	method := "/porter.v1alpha1.Porter/ListInstallations"
+	require.NoError(t, observePorterGRPCCall(context.Background(), method, nil, nil, nil, ok))
+	require.Error(t, observePorterGRPCCall(context.Background(), method, nil, nil, nil, unavailable))
+
+	assert.Equal(t, 2, testutil.CollectAndCount(porterGRPCDuration))
+	for _, code := range []string{"OK", "Unavailable"} {
+		var m dto.Metric
+		h := porterGRPCDuration.WithLabelValues("ListInstallations", code).(prometheus.Histogram)
+		require.NoError(t, h.Write(&m))
+		assert.Equal(t, uint64(1), m.GetHistogram().GetSampleCount(), "expected a latency observation for code %s", code)
+	}
+}
@@ -11,10 +11,13 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	porterv1 "get.porter.sh/operator/api/v1"
 )
@@ -22,8 +25,9 @@ import (
 // ParameterSetReconciler reconciles a ParameterSet object
 type ParameterSetReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Scheme   *runtime.Scheme
 }
 
 //+kubebuilder:rbac:groups=getporter.org,resources=parametersets,verbs=get;list;watch;create;update;patch;delete
@@ -34,17 +38,37 @@ type ParameterSetReconciler struct {
 //+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *ParameterSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	ctx := context.Background()
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &porterv1.ParameterSet{}, configMapSourceIndexKey, indexParameterSetByConfigMap); err != nil {
+		return errors.Wrap(err, "error indexing the parameter sets by configmap")
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&porterv1.ParameterSet{}, builder.WithPredicates(resourceChanged{})).
 		Owns(&porterv1.AgentAction{}).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.mapConfigMapToParameterSets)).
 		Complete(r)
 }
 
+// mapConfigMapToParameterSets requests the parameter sets that resolve a source from a ConfigMap, when it is created or changed.
+func (r *ParameterSetReconciler) mapConfigMapToParameterSets(ctx context.Context, obj client.Object) []reconcile.Request {
+	return listResourcesUsingSource(ctx, r.Client, r.Log, &porterv1.ParameterSetList{}, configMapSourceIndexKey, obj)
+}
+
 // Reconcile is called when the spec of a parameter set is changed
 func (r *ParameterSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := startReconcileSpan(ctx, "ParameterSet", req)
+	result, err := r.reconcile(ctx, req)
+	endSpan(span, err)
+	return result, err
+}
+
+func (r *ParameterSetReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 
 	log := r.Log.WithValues("parameterSet", req.Name, "namespace", req.Namespace)
 
@@ -77,6 +101,9 @@ func (r *ParameterSetReconciler) Reconcile(ctx context.Context, req ctrl.Request
 
 	if isDeleteProcessed(ps) {
 		err = removeParamSetFinalizer(ctx, log, r.Client, ps)
+		if err == nil {
+			r.Recorder.Event(ps, "Normal", "RemoveFinalizer", fmt.Sprintf("removed finalizer from parameter set %s", ps.Name))
+		}
 		log.V(Log4Debug).Info("Reconciliation complete: Finalizer has been removed from the ParameterSet.")
 		return ctrl.Result{}, err
 	}
@@ -114,6 +141,15 @@ func (r *ParameterSetReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		log.V(Log4Debug).Info("Reconciliation complete: A finalizer has been set on the parameter set.")
 		return ctrl.Result{}, nil
 	}
+	// Check the sources resolved by the operator before running the agent
+	if err = r.validateSources(ctx, log, ps); err != nil {
+		if errors.Is(err, errInvalidSource) {
+			log.V(Log4Debug).Info("Reconciliation complete: Waiting for the parameter sources to be created", "error", err.Error())
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
 	err = r.runParameterSet(ctx, log, ps)
 	if err != nil {
 		return ctrl.Result{}, err
@@ -142,12 +178,21 @@ func (r *ParameterSetReconciler) isHandled(ctx context.Context, log logr.Logger,
 
 // Check the status of the porter-agent job and use that to update the AgentAction status
 func (r *ParameterSetReconciler) syncStatus(ctx context.Context, log logr.Logger, ps *porterv1.ParameterSet, action *porterv1.AgentAction) error {
+	_, span := startSpan(ctx, "ParameterSet.syncStatus")
+	defer span.End()
+
 	origStatus := ps.Status
 
 	applyAgentAction(log, ps, action)
+	if action == nil {
+		keepSourcesResolvedCondition(ps, origStatus.PorterResourceStatus)
+	}
 
 	if !reflect.DeepEqual(origStatus, ps.Status) {
-		return r.saveStatus(ctx, log, ps)
+		if err := r.saveStatus(ctx, log, ps); err != nil {
+			return err
+		}
+		recordAgentActionEvent(r.Recorder, ps, origStatus.Phase, action)
 	}
 
 	return nil
@@ -174,6 +219,39 @@ func (r *ParameterSetReconciler) runPorter(ctx context.Context, log logr.Logger,
 	return r.syncStatus(ctx, log, ps, action)
 }
 
+// validateSources checks the sources of the parameters, and that the ConfigMap keys that they reference exist.
+// A source that does not exist is reported with the SourcesResolved condition, and the agent is not run until it is created.
+func (r *ParameterSetReconciler) validateSources(ctx context.Context, log logr.Logger, ps *porterv1.ParameterSet) error {
+	err := validateParameterSources(ps.Spec)
+	if err == nil {
+		err = validateConfigMapKeyRefs(ctx, r.Client, ps.Namespace, ps.Spec.GetConfigMapKeyRefs())
+	}
+	if !errors.Is(err, errInvalidSource) {
+		return err
+	}
+
+	origStatus := *ps.Status.DeepCopy()
+	setSourcesNotResolvedCondition(ps, err)
+	if reflect.DeepEqual(origStatus, ps.Status) {
+		return err
+	}
+	if saveErr := r.saveStatus(ctx, log, ps); saveErr != nil {
+		return saveErr
+	}
+	r.Recorder.Event(ps, "Warning", "InvalidParameterSource", err.Error())
+	return err
+}
+
+// validateParameterSources checks that each parameter has at most one source.
+func validateParameterSources(spec porterv1.ParameterSetSpec) error {
+	for _, param := range spec.Parameters {
+		if err := param.Source.Validate(); err != nil {
+			return errors.Wrapf(errInvalidSource, "parameter %s: %s", param.Name, err)
+		}
+	}
+	return nil
+}
+
 // Only update the status with a PATCH, don't clobber the entire installation
 func (r *ParameterSetReconciler) saveStatus(ctx context.Context, log logr.Logger, ps *porterv1.ParameterSet) error {
 	log.V(Log5Trace).Info("Patching parameter set status")
@@ -184,6 +262,9 @@ func (r *ParameterSetReconciler) saveStatus(ctx context.Context, log logr.Logger
 
 // create a porter parameters AgentAction for applying or deleting parameter sets
 func (r *ParameterSetReconciler) createAgentAction(ctx context.Context, log logr.Logger, ps *porterv1.ParameterSet) (*porterv1.AgentAction, error) {
+	ctx, span := startSpan(ctx, "ParameterSet.createAgentAction")
+	defer span.End()
+
 	paramSetResourceB, err := ps.Spec.ToPorterDocument()
 	if err != nil {
 		return nil, err
@@ -193,6 +274,7 @@ func (r *ParameterSetReconciler) createAgentAction(ctx context.Context, log logr
 	if err != nil {
 		return nil, err
 	}
+	action.Annotations = injectTraceAnnotations(ctx, action.Annotations)
 	log.WithValues("action name", action.Name)
 	if r.shouldDelete(ps) {
 		log.V(Log5Trace).Info("Deleting porter parameter set")
@@ -207,6 +289,8 @@ func (r *ParameterSetReconciler) createAgentAction(ctx context.Context, log logr
 		return nil, errors.Wrap(err, "error creating the porter parameter set agent action")
 	}
 
+	r.Recorder.Event(ps, "Normal", "CreateAgentAction", fmt.Sprintf("created parameter set agent action for %s", ps.Name))
+
 	log.V(Log4Debug).Info("Created porter parameter set agent action")
 	return action, nil
 }
@@ -231,6 +315,8 @@ func (r *ParameterSetReconciler) retry(ctx context.Context, log logr.Logger, ps
 	if err := r.Update(ctx, action); err != nil {
 		return errors.Wrap(err, "error updating the associated porter agent action")
 	}
+	recordAgentActionRetry(action)
+	r.Recorder.Event(ps, "Normal", "RetryAgentAction", fmt.Sprintf("retried parameter set agent action %s", action.Name))
 
 	log.V(Log4Debug).Info("Retried associated porter agent action", "name", "retry", action.Name, retry)
 	return nil
@@ -257,7 +343,8 @@ func (r *ParameterSetReconciler) newPSAgentAction(ps *porterv1.ParameterSet) (*p
 			Annotations:  ps.Annotations,
 		},
 		Spec: porterv1.AgentActionSpec{
-			AgentConfig: ps.Spec.AgentConfig,
+			AgentConfig:  ps.Spec.AgentConfig,
+			PorterConfig: ps.Spec.PorterConfig,
 		},
 	}
 	if err := controllerutil.SetControllerReference(ps, action, r.Scheme); err != nil {
@@ -17,6 +17,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -205,9 +206,10 @@ func TestParameterSetReconciler_createAgentAction(t *testing.T) {
 					},
 				},
 				Spec: porterv1.ParameterSetSpec{
-					Namespace:   "dev",
-					Name:        "paramset",
-					AgentConfig: &corev1.LocalObjectReference{Name: "myAgentConfig"},
+					Namespace:    "dev",
+					Name:         "paramset",
+					AgentConfig:  &corev1.LocalObjectReference{Name: "myAgentConfig"},
+					PorterConfig: &corev1.LocalObjectReference{Name: "myPorterConfig"},
 				},
 			}
 			controllerutil.AddFinalizer(cs, porterv1.FinalizerName)
@@ -237,7 +239,7 @@ func TestParameterSetReconciler_createAgentAction(t *testing.T) {
 			assertContains(t, action.Labels, "testLabel", "abc123", "incorrect label")
 
 			assert.Equal(t, cs.Spec.AgentConfig, action.Spec.AgentConfig, "incorrect AgentConfig reference")
-			assert.Equal(t, cs.Spec.AgentConfig, action.Spec.AgentConfig, "incorrect PorterConfig reference")
+			assert.Equal(t, cs.Spec.PorterConfig, action.Spec.PorterConfig, "incorrect PorterConfig reference")
 			assert.Nilf(t, action.Spec.Command, "should use the default command for the agent")
 			if test.delete {
 				assert.Equal(t, []string{"parameters", "delete", "-n", cs.Spec.Namespace, cs.Spec.Name}, action.Spec.Args, "incorrect agent arguments")
@@ -278,11 +280,13 @@ func setupParameterSetController(objs ...client.Object) ParameterSetReconciler {
 	fakeBuilder := fake.NewClientBuilder()
 	fakeBuilder.WithScheme(scheme)
 	fakeBuilder.WithObjects(objs...).WithStatusSubresource(objs...)
+	fakeBuilder.WithIndex(&porterv1.ParameterSet{}, configMapSourceIndexKey, indexParameterSetByConfigMap)
 	fakeClient := fakeBuilder.Build()
 
 	return ParameterSetReconciler{
-		Log:    logr.Discard(),
-		Client: fakeClient,
-		Scheme: scheme,
+		Log:      logr.Discard(),
+		Client:   fakeClient,
+		Recorder: record.NewFakeRecorder(42),
+		Scheme:   scheme,
 	}
 }
@@ -0,0 +1,465 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// pluginCacheNamePrefix is the prefix of the name of the AgentConfig that installs a shared plugin cache in the operator namespace.
+const pluginCacheNamePrefix = "plugin-cache-"
+
+// errPluginCacheUnsupported is returned when the volume of a shared plugin cache cannot be bound to other namespaces.
+var errPluginCacheUnsupported = errors.New("the volume of the shared plugin cache cannot be shared across namespaces")
+
+// usesSharedPluginCache determines if the plugins of an AgentConfig are installed by a shared plugin cache in the operator namespace.
+// An AgentConfig in the operator namespace installs its plugins on its own volume, which is already shared.
+func usesSharedPluginCache(agentCfg *porterv1.AgentConfigAdapter) bool {
+	return !agentCfg.Spec.Plugins.IsZero() && agentCfg.Spec.GetPluginDelivery().IsShared() && agentCfg.Namespace != operatorNamespace
+}
+
+// isPluginCache determines if an AgentConfig installs a shared plugin cache in the operator namespace.
+func isPluginCache(agentCfg *porterv1.AgentConfig) bool {
+	return agentCfg.Namespace == operatorNamespace && agentCfg.Labels[porterv1.LabelPluginCache] == "true"
+}
+
+// getPluginCacheName returns the name of the AgentConfig that installs a set of plugins in the operator namespace.
+func getPluginCacheName(agentCfg *porterv1.AgentConfigAdapter) string {
+	return pluginCacheNamePrefix + agentCfg.Spec.Plugins.GetLabels()[porterv1.LabelPluginsHash]
+}
+
+// getPluginCacheRef returns how an AgentConfig is recorded in the references of a shared plugin cache.
+func getPluginCacheRef(agentCfg *porterv1.AgentConfigAdapter) string {
+	return agentCfg.Namespace + "/" + agentCfg.Name
+}
+
+// getPluginCacheRefs returns the AgentConfigs, as namespace/name, that use a shared plugin cache.
+func getPluginCacheRefs(cache *porterv1.AgentConfig) []string {
+	var refs []string
+	for _, ref := range strings.Split(cache.Annotations[porterv1.AnnotationPluginCacheRefs], ",") {
+		if ref = strings.TrimSpace(ref); ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// setPluginCacheRefs records the AgentConfigs that use a shared plugin cache.
+func setPluginCacheRefs(cache *porterv1.AgentConfig, refs []string) {
+	sort.Strings(refs)
+	if cache.Annotations == nil {
+		cache.Annotations = map[string]string{}
+	}
+	cache.Annotations[porterv1.AnnotationPluginCacheRefs] = strings.Join(refs, ",")
+}
+
+// syncSharedPluginCache makes the plugins of an AgentConfig available from a shared plugin cache.
+// The plugins are installed once for each set of plugins by an AgentConfig in the operator namespace, which records
+// the AgentConfigs that use it. Once the plugins are installed, the persistent volume of the cache is bound
+// read-only to a plugin volume claim in the namespace of the AgentConfig, which is mounted by the agent.
+// It returns false when the volume of the cache cannot be bound to other namespaces, and the plugins must be
+// installed in the namespace of the AgentConfig instead.
+func (r *AgentConfigReconciler) syncSharedPluginCache(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter) (bool, error) {
+	// The finalizer releases the plugin cache when the AgentConfig is deleted
+	updated, err := ensureFinalizerSet(ctx, log, r.Client, &agentCfg.AgentConfig)
+	if err != nil || updated {
+		return true, err
+	}
+
+	origStatus := *agentCfg.Status.DeepCopy()
+	agentCfg.Status.ObservedGeneration = agentCfg.Generation
+
+	// The cache cannot read the archives of plugins that are installed from a source in the namespace of the AgentConfig
+	if names := agentCfg.Spec.Plugins.GetNamesWithSource(); len(names) > 0 {
+		msg := fmt.Sprintf("plugins installed from a source in the cluster cannot be shared across namespaces: %s", strings.Join(names, ", "))
+		agentCfg.Status.Ready = false
+		if reflect.DeepEqual(origStatus, agentCfg.Status) {
+			return true, nil
+		}
+		r.Recorder.Event(&agentCfg.AgentConfig, "Warning", "InvalidPluginDelivery", msg)
+		return true, r.saveStatus(ctx, log, agentCfg)
+	}
+
+	cache, err := r.ensurePluginCache(ctx, log, agentCfg)
+	if err != nil {
+		return true, err
+	}
+	if reason := cache.Annotations[porterv1.AnnotationPluginCacheUnsupported]; reason != "" {
+		log.V(Log4Debug).Info("Installing the plugins in the namespace because the shared plugin cache cannot be bound to it", "cache", cache.Name, "reason", reason)
+		agentCfg.Status = origStatus
+		return false, nil
+	}
+
+	var pvc *corev1.PersistentVolumeClaim
+	if cache.Status.Ready {
+		pvc, err = r.bindPluginCache(ctx, log, agentCfg)
+		if errors.Is(err, errPluginCacheUnsupported) {
+			agentCfg.Status = origStatus
+			return false, r.setPluginCacheUnsupported(ctx, log, agentCfg, cache, err)
+		}
+		if err != nil {
+			return true, err
+		}
+	}
+
+	agentCfg.Status.Phase = cache.Status.Phase
+	if agentCfg.Status.Phase == "" {
+		agentCfg.Status.Phase = porterv1.PhaseUnknown
+	}
+	ready := pvc != nil && pvc.Status.Phase == corev1.ClaimBound
+	if ready {
+		// Stop using the previous plugins only once the new plugins are available
+		if err = r.releasePluginCaches(ctx, log, agentCfg, cache.Name); err != nil {
+			return true, err
+		}
+		agentCfg.Status.ActivePlugins = newActivePlugins(agentCfg, pvc)
+	} else if agentCfg.Status.Phase == porterv1.PhaseSucceeded {
+		// The plugins are installed but the volume is not bound to the namespace yet
+		agentCfg.Status.Phase = porterv1.PhasePending
+	}
+	agentCfg.Status.Ready = ready
+
+	var updateFailed bool
+	if agentCfg.Status.Phase == porterv1.PhaseFailed {
+		updateFailed = setPluginUpdateFailedCondition(agentCfg, origStatus)
+	} else {
+		apimeta.RemoveStatusCondition(&agentCfg.Status.Conditions, string(porterv1.ConditionPluginUpdateFailed))
+	}
+
+	if reflect.DeepEqual(origStatus, agentCfg.Status) {
+		return true, nil
+	}
+	log.V(Log4Debug).Info("Syncing the status of the shared plugin cache", "cache", cache.Name, "phase", agentCfg.Status.Phase, "ready", ready)
+	if err = r.saveStatus(ctx, log, agentCfg); err != nil {
+		return true, err
+	}
+	if ready && !origStatus.Ready {
+		r.Recorder.Event(&agentCfg.AgentConfig, "Normal", "BindSharedPluginCache", fmt.Sprintf("bound plugin volume claim %s to the shared plugin cache %s", pvc.Name, cache.Name))
+	}
+	if updateFailed {
+		r.Recorder.Event(&agentCfg.AgentConfig, "Warning", "PluginUpdateFailed", fmt.Sprintf("could not update the plugins, the agent keeps using the plugins installed on %s", agentCfg.Status.ActivePlugins.GetLocation()))
+	}
+	return true, nil
+}
+
+// setPluginCacheUnsupported records on a shared plugin cache that its volume cannot be bound to other namespaces,
+// so that the AgentConfigs that use it install their plugins in their own namespace instead.
+func (r *AgentConfigReconciler) setPluginCacheUnsupported(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter, cache *porterv1.AgentConfig, reason error) error {
+	log.V(Log2ApplicationState).Info("The shared plugin cache cannot be bound to other namespaces, the plugins are installed in each namespace instead", "cache", cache.Name, "reason", reason.Error())
+	patch := client.MergeFrom(cache.DeepCopy())
+	if cache.Annotations == nil {
+		cache.Annotations = map[string]string{}
+	}
+	cache.Annotations[porterv1.AnnotationPluginCacheUnsupported] = reason.Error()
+	if err := r.Patch(ctx, cache, patch); err != nil {
+		return errors.Wrapf(err, "error recording that the shared plugin cache %s cannot be shared", cache.Name)
+	}
+	r.Recorder.Event(&agentCfg.AgentConfig, "Warning", "PluginCacheUnsupported", fmt.Sprintf("installing the plugins in the namespace instead of using the shared plugin cache %s/%s: %s", operatorNamespace, cache.Name, reason))
+	return nil
+}
+
+// ensurePluginCache returns the AgentConfig in the operator namespace that installs the plugins of an AgentConfig,
+// creating it when it does not exist, and records that the AgentConfig uses it.
+func (r *AgentConfigReconciler) ensurePluginCache(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter) (*porterv1.AgentConfig, error) {
+	name := getPluginCacheName(agentCfg)
+	ref := getPluginCacheRef(agentCfg)
+
+	cache := &porterv1.AgentConfig{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: operatorNamespace, Name: name}, cache)
+	if apierrors.IsNotFound(err) {
+		cache = newPluginCache(agentCfg)
+		log.V(Log4Debug).Info("Creating a shared plugin cache", "cache", name, "namespace", operatorNamespace)
+		if err = r.Create(ctx, cache); err != nil {
+			return nil, errors.Wrapf(err, "error creating the shared plugin cache %s", name)
+		}
+		r.Recorder.Event(&agentCfg.AgentConfig, "Normal", "CreatePluginCache", fmt.Sprintf("created shared plugin cache %s/%s", operatorNamespace, name))
+		return cache, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error retrieving the shared plugin cache %s", name)
+	}
+
+	if isDeleted(cache) {
+		// Wait for the cache to be removed, it is created again on the next reconcile
+		return nil, errors.Errorf("the shared plugin cache %s is being deleted", name)
+	}
+
+	refs := getPluginCacheRefs(cache)
+	for _, existing := range refs {
+		if existing == ref {
+			return cache, nil
+		}
+	}
+
+	log.V(Log4Debug).Info("Adding a reference to the shared plugin cache", "cache", name)
+	patch := client.MergeFromWithOptions(cache.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	setPluginCacheRefs(cache, append(refs, ref))
+	if err = r.Patch(ctx, cache, patch); err != nil {
+		return nil, errors.Wrapf(err, "error adding a reference to the shared plugin cache %s", name)
+	}
+	return cache, nil
+}
+
+// newPluginCache defines the AgentConfig that installs the plugins of an AgentConfig on a volume in the operator namespace.
+func newPluginCache(agentCfg *porterv1.AgentConfigAdapter) *porterv1.AgentConfig {
+	spec := agentCfg.Spec.GetSpec()
+	plugins := make(map[string]porterv1.Plugin, len(agentCfg.Spec.Plugins.GetNames()))
+	for _, name := range agentCfg.Spec.Plugins.GetNames() {
+		plugins[name], _ = agentCfg.Spec.Plugins.GetByName(name)
+	}
+
+	labels := agentCfg.Spec.Plugins.GetLabels()
+	labels[porterv1.LabelManaged] = "true"
+	labels[porterv1.LabelPluginCache] = "true"
+	cache := &porterv1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getPluginCacheName(agentCfg),
+			Namespace: operatorNamespace,
+			Labels:    labels,
+		},
+		Spec: porterv1.AgentConfigSpec{
+			PorterRepository: spec.PorterRepository,
+			PorterVersion:    spec.PorterVersion,
+			PullPolicy:       spec.PullPolicy,
+			StorageClassName: spec.StorageClassName,
+			VolumeSize:       spec.VolumeSize,
+			PluginConfigFile: &porterv1.PluginFileSpec{SchemaVersion: spec.PluginConfigFile.SchemaVersion, Plugins: plugins},
+			PluginDelivery:   &porterv1.PluginDelivery{Mode: porterv1.PluginDeliveryVolume},
+		},
+	}
+	setPluginCacheRefs(cache, []string{getPluginCacheRef(agentCfg)})
+	return cache
+}
+
+// bindPluginCache returns the plugin volume claim in the namespace of the AgentConfig. When it does not exist,
+// the persistent volume of the shared plugin cache is cloned with a Retain reclaim policy and bound read-only
+// to a new claim, so that removing the claim never removes the plugins used by the other namespaces.
+// It returns errPluginCacheUnsupported when the volume of the cache cannot be cloned, see checkPluginCacheVolume.
+func (r *AgentConfigReconciler) bindPluginCache(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter) (*corev1.PersistentVolumeClaim, error) {
+	pvcName := agentCfg.GetPluginsPVCName()
+	pvc, exists, err := r.getPersistentVolumeClaim(ctx, agentCfg.Namespace, pvcName)
+	if err != nil || exists {
+		return pvc, err
+	}
+
+	cachePVCName := agentCfg.Spec.Plugins.GetPVCName(operatorNamespace)
+	cachePVC, exists, err := r.getPersistentVolumeClaim(ctx, operatorNamespace, cachePVCName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || cachePVC.Spec.VolumeName == "" {
+		log.V(Log4Debug).Info("Waiting for the volume of the shared plugin cache", "persistentvolumeclaim", cachePVCName, "namespace", operatorNamespace)
+		return nil, nil
+	}
+	cachePV, err := r.getPersistentVolume(ctx, "", cachePVC.Spec.VolumeName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error retrieving the volume of the shared plugin cache %s", cachePVCName)
+	}
+	if err = checkPluginCacheVolume(cachePV); err != nil {
+		return nil, err
+	}
+
+	labels := agentCfg.Spec.Plugins.GetLabels()
+	labels[porterv1.LabelManaged] = "true"
+	labels[porterv1.LabelPluginCache] = "true"
+
+	pv := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: pvcName, Labels: labels},
+		Spec:       *cachePV.Spec.DeepCopy(),
+	}
+	pv.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadOnlyMany}
+	pv.Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimRetain
+	pv.Spec.ClaimRef = &corev1.ObjectReference{
+		Kind:       "PersistentVolumeClaim",
+		APIVersion: "v1",
+		Namespace:  agentCfg.Namespace,
+		Name:       pvcName,
+	}
+	log.V(Log4Debug).Info("Cloning the volume of the shared plugin cache", "persistentvolume", pv.Name, "cache persistentvolume", cachePV.Name)
+	if err = r.Create(ctx, pv); err != nil && !apierrors.IsAlreadyExists(err) {
+		return nil, errors.Wrapf(err, "error cloning the volume of the shared plugin cache %s", cachePVCName)
+	}
+
+	pvcLabels := agentCfg.Spec.Plugins.GetLabels()
+	pvcLabels[porterv1.LabelPluginCache] = "true"
+	pvcLabels[porterv1.LabelResourceName] = agentCfg.Name
+	pvc = &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pvcName,
+			Namespace: agentCfg.Namespace,
+			Labels:    pvcLabels,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion:         agentCfg.APIVersion,
+					Kind:               agentCfg.Kind,
+					Name:               agentCfg.Name,
+					UID:                agentCfg.UID,
+					Controller:         ptr.To(true),
+					BlockOwnerDeletion: ptr.To(true),
+				},
+			},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadOnlyMany},
+			VolumeName:       pv.Name,
+			StorageClassName: ptr.To(pv.Spec.StorageClassName),
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: map[corev1.ResourceName]resource.Quantity{
+					corev1.ResourceStorage: cachePV.Spec.Capacity[corev1.ResourceStorage],
+				},
+			},
+		},
+	}
+	log.V(Log4Debug).Info("Binding the shared plugin cache to the namespace", "persistentvolumeclaim", pvcName)
+	if err = r.Create(ctx, pvc); err != nil {
+		return nil, errors.Wrapf(err, "error creating the plugin volume claim %s for the shared plugin cache", pvcName)
+	}
+	return pvc, nil
+}
+
+// checkPluginCacheVolume determines if the persistent volume of a shared plugin cache can be bound to other namespaces.
+// The volume is cloned with the same source for each namespace, which only works for network file systems that
+// can be mounted by any number of persistent volumes. CSI and block volumes are identified by their volume handle
+// or device, so a clone collides with the volume of the cache.
+func checkPluginCacheVolume(pv *corev1.PersistentVolume) error {
+	if pv.Spec.VolumeMode != nil && *pv.Spec.VolumeMode == corev1.PersistentVolumeBlock {
+		return errors.Wrapf(errPluginCacheUnsupported, "persistent volume %s is a block volume", pv.Name)
+	}
+
+	source := pv.Spec.PersistentVolumeSource
+	switch {
+	case source.NFS != nil, source.CephFS != nil, source.Glusterfs != nil, source.AzureFile != nil:
+		return nil
+	case source.CSI != nil:
+		return errors.Wrapf(errPluginCacheUnsupported, "persistent volume %s is provisioned by the CSI driver %s", pv.Name, source.CSI.Driver)
+	default:
+		return errors.Wrapf(errPluginCacheUnsupported, "persistent volume %s is not a network file system", pv.Name)
+	}
+}
+
+// releasePluginCaches removes the references of an AgentConfig from the shared plugin caches, except the cache that it uses.
+// The cache is unbound from the namespace of the AgentConfig, see unbindPluginCache. A cache that is no longer used
+// by any AgentConfig is deleted, and its volume is removed by the plugin volume sweeper.
+func (r *AgentConfigReconciler) releasePluginCaches(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter, keep string) error {
+	var caches porterv1.AgentConfigList
+	if err := r.List(ctx, &caches, client.InNamespace(operatorNamespace), client.MatchingLabels{porterv1.LabelPluginCache: "true"}); err != nil {
+		return errors.Wrap(err, "error listing the shared plugin caches")
+	}
+
+	ref := getPluginCacheRef(agentCfg)
+	for i := range caches.Items {
+		cache := &caches.Items[i]
+		if cache.Name == keep || isDeleted(cache) {
+			continue
+		}
+
+		refs := getPluginCacheRefs(cache)
+		remaining := make([]string, 0, len(refs))
+		for _, existing := range refs {
+			if existing != ref {
+				remaining = append(remaining, existing)
+			}
+		}
+		if len(remaining) == len(refs) {
+			continue
+		}
+
+		if err := r.unbindPluginCache(ctx, log, agentCfg, cache, remaining); err != nil {
+			return err
+		}
+
+		if len(remaining) == 0 {
+			log.V(Log4Debug).Info("Deleting the shared plugin cache that is no longer used", "cache", cache.Name)
+			if err := r.Delete(ctx, cache, client.Preconditions{ResourceVersion: &cache.ResourceVersion}); client.IgnoreNotFound(err) != nil {
+				return errors.Wrapf(err, "error deleting the shared plugin cache %s", cache.Name)
+			}
+			r.Recorder.Event(&agentCfg.AgentConfig, "Normal", "DeletePluginCache", fmt.Sprintf("deleted shared plugin cache %s/%s that is no longer used", operatorNamespace, cache.Name))
+			continue
+		}
+
+		log.V(Log4Debug).Info("Removing a reference to the shared plugin cache", "cache", cache.Name)
+		patch := client.MergeFromWithOptions(cache.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		setPluginCacheRefs(cache, remaining)
+		if err := r.Patch(ctx, cache, patch); client.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, "error removing a reference to the shared plugin cache %s", cache.Name)
+		}
+	}
+	return nil
+}
+
+// unbindPluginCache removes the plugin volume claim that binds a shared plugin cache to the namespace of an AgentConfig,
+// along with its cloned persistent volume, which is never removed otherwise because it is retained. The claim is kept
+// while another AgentConfig in the namespace uses the cache.
+func (r *AgentConfigReconciler) unbindPluginCache(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter, cache *porterv1.AgentConfig, remaining []string) error {
+	for _, ref := range remaining {
+		if namespace, _, _ := strings.Cut(ref, "/"); namespace == agentCfg.Namespace {
+			return nil
+		}
+	}
+
+	name := porterv1.NewAgentConfigSpecAdapter(cache.Spec).Plugins.GetPVCName(agentCfg.Namespace)
+	pvc, exists, err := r.getPersistentVolumeClaim(ctx, agentCfg.Namespace, name)
+	if err != nil {
+		return err
+	}
+	// Plugins that were installed in the namespace because the cache cannot be shared are removed by the plugin volume sweeper
+	if exists && pvc.Labels[porterv1.LabelPluginCache] == "true" {
+		log.V(Log4Debug).Info("Removing the plugin volume claim bound to the shared plugin cache", "persistentvolumeclaim", name, "cache", cache.Name)
+		if err = r.Delete(ctx, pvc); client.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, "error deleting the plugin volume claim %s bound to the shared plugin cache %s", name, cache.Name)
+		}
+	}
+
+	pv := &corev1.PersistentVolume{}
+	err = r.Get(ctx, client.ObjectKey{Name: name}, pv)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error retrieving the persistent volume %s bound to the shared plugin cache %s", name, cache.Name)
+	}
+	if pv.Labels[porterv1.LabelPluginCache] != "true" || pv.DeletionTimestamp != nil {
+		return nil
+	}
+
+	// The volume is removed once the claim is released, and the plugins of the cache are kept because it is retained
+	log.V(Log4Debug).Info("Removing the persistent volume bound to the shared plugin cache", "persistentvolume", name, "cache", cache.Name)
+	if err = r.Delete(ctx, pv); client.IgnoreNotFound(err) != nil {
+		return errors.Wrapf(err, "error deleting the persistent volume %s bound to the shared plugin cache %s", name, cache.Name)
+	}
+	return nil
+}
+
+// mapPluginCacheToAgentConfigs reconciles the AgentConfigs that use a shared plugin cache when the cache changes,
+// for example when its plugins are installed.
+func (r *AgentConfigReconciler) mapPluginCacheToAgentConfigs(ctx context.Context, obj client.Object) []reconcile.Request {
+	cache, ok := obj.(*porterv1.AgentConfig)
+	if !ok || !isPluginCache(cache) {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, ref := range getPluginCacheRefs(cache) {
+		namespace, name, found := strings.Cut(ref, "/")
+		if !found {
+			continue
+		}
+		requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKey{Namespace: namespace, Name: name}})
+	}
+	return requests
+}
@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newSharedPluginCacheAgentConfig(namespace string) *porterv1.AgentConfig {
+	return &porterv1.AgentConfig{
+		TypeMeta:   metav1.TypeMeta{APIVersion: porterv1.GroupVersion.String(), Kind: porterv1.KindAgentConfig},
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: namespace, Generation: 1, Finalizers: []string{porterv1.FinalizerName}},
+		Spec: porterv1.AgentConfigSpec{
+			PluginConfigFile: &porterv1.PluginFileSpec{SchemaVersion: "1.0.0", Plugins: map[string]porterv1.Plugin{"kubernetes": {Version: "v1.0.0"}}},
+			PluginDelivery:   &porterv1.PluginDelivery{Mode: porterv1.PluginDeliverySharedVolume},
+		},
+	}
+}
+
+func TestAgentConfigReconciler_Reconcile_SharedPluginCache(t *testing.T) {
+	ctx := context.Background()
+
+	testCfg := newSharedPluginCacheAgentConfig("test")
+	otherCfg := newSharedPluginCacheAgentConfig("other")
+	controller := setupAgentConfigController(testCfg, otherCfg)
+	recorder := controller.Recorder.(*record.FakeRecorder)
+	testKey := client.ObjectKeyFromObject(testCfg)
+	otherKey := client.ObjectKeyFromObject(otherCfg)
+
+	triggerReconcile := func(key client.ObjectKey) {
+		_, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		require.NoError(t, err)
+	}
+
+	// The plugins are installed by a cache in the operator namespace
+	triggerReconcile(testKey)
+	assert.Contains(t, <-recorder.Events, "CreatePluginCache")
+	agentCfg := porterv1.NewAgentConfigAdapter(*testCfg)
+	cacheKey := client.ObjectKey{Namespace: operatorNamespace, Name: getPluginCacheName(agentCfg)}
+	cache := &porterv1.AgentConfig{}
+	require.NoError(t, controller.Get(ctx, cacheKey, cache))
+	assert.Equal(t, "true", cache.Labels[porterv1.LabelPluginCache])
+	assert.Equal(t, "test/default", cache.Annotations[porterv1.AnnotationPluginCacheRefs])
+	assert.Equal(t, porterv1.PluginDeliveryVolume, cache.Spec.PluginDelivery.Mode, "the cache should install the plugins on its own volume")
+	assert.Equal(t, testCfg.Spec.PluginConfigFile.Plugins, cache.Spec.PluginConfigFile.Plugins)
+
+	var actions porterv1.AgentActionList
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace("test")))
+	assert.Empty(t, actions.Items, "the plugins should not be installed in the namespace")
+	require.NoError(t, controller.Get(ctx, testKey, testCfg))
+	assert.False(t, testCfg.Status.Ready)
+
+	// Another namespace with the same plugins uses the same cache
+	triggerReconcile(otherKey)
+	require.NoError(t, controller.Get(ctx, cacheKey, cache))
+	assert.Equal(t, "other/default,test/default", cache.Annotations[porterv1.AnnotationPluginCacheRefs])
+
+	// Install the plugins in the cache
+	cachePV := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-cache"},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity:                      corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("64Mi")},
+			AccessModes:                   []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce, corev1.ReadOnlyMany},
+			PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimDelete,
+			StorageClassName:              "nfs",
+			PersistentVolumeSource:        corev1.PersistentVolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs.example.com", Path: "/plugins"}},
+			ClaimRef:                      &corev1.ObjectReference{Namespace: operatorNamespace, Name: agentCfg.Spec.Plugins.GetPVCName(operatorNamespace)},
+		},
+	}
+	require.NoError(t, controller.Create(ctx, cachePV))
+	cachePVC := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: agentCfg.Spec.Plugins.GetPVCName(operatorNamespace), Namespace: operatorNamespace},
+		Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: cachePV.Name},
+	}
+	require.NoError(t, controller.Create(ctx, cachePVC))
+	cache.Status.Ready = true
+	cache.Status.Phase = porterv1.PhaseSucceeded
+	require.NoError(t, controller.Status().Update(ctx, cache))
+
+	// The volume of the cache is bound to the namespace
+	triggerReconcile(testKey)
+	pvcName := agentCfg.GetPluginsPVCName()
+	pv := &corev1.PersistentVolume{}
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Name: pvcName}, pv))
+	assert.Equal(t, cachePV.Spec.NFS, pv.Spec.NFS, "the volume of the cache should be cloned")
+	assert.Equal(t, corev1.PersistentVolumeReclaimRetain, pv.Spec.PersistentVolumeReclaimPolicy, "removing the clone should keep the plugins")
+	assert.Equal(t, []corev1.PersistentVolumeAccessMode{corev1.ReadOnlyMany}, pv.Spec.AccessModes)
+	assert.Equal(t, "test", pv.Spec.ClaimRef.Namespace)
+	assert.Equal(t, pvcName, pv.Spec.ClaimRef.Name)
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	require.NoError(t, controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: pvcName}, pvc))
+	assert.Equal(t, pv.Name, pvc.Spec.VolumeName)
+	assert.Equal(t, "nfs", *pvc.Spec.StorageClassName)
+	assert.Equal(t, agentCfg.Spec.Plugins.GetLabels()[porterv1.LabelPluginsHash], pvc.Labels[porterv1.LabelPluginsHash])
+	require.NoError(t, controller.Get(ctx, testKey, testCfg))
+	assert.False(t, testCfg.Status.Ready, "the agent config should not be ready until the volume is bound")
+	assert.Equal(t, porterv1.PhasePending, testCfg.Status.Phase)
+
+	pvc.Status.Phase = corev1.ClaimBound
+	require.NoError(t, controller.Status().Update(ctx, pvc))
+	triggerReconcile(testKey)
+	assert.Contains(t, <-recorder.Events, "BindSharedPluginCache")
+	require.NoError(t, controller.Get(ctx, testKey, testCfg))
+	assert.True(t, testCfg.Status.Ready)
+	assert.Equal(t, porterv1.PhaseSucceeded, testCfg.Status.Phase)
+	require.NotNil(t, testCfg.Status.ActivePlugins)
+	assert.Equal(t, pvcName, testCfg.Status.ActivePlugins.PersistentVolumeClaim)
+
+	// The status is not synced from an agent action, so reconciling again does not change it
+	triggerReconcile(testKey)
+	require.NoError(t, controller.Get(ctx, testKey, testCfg))
+	assert.True(t, testCfg.Status.Ready)
+
+	// Deleting an agent config releases the cache
+	require.NoError(t, controller.Delete(ctx, testCfg))
+	for i := 0; i < 3; i++ {
+		triggerReconcile(testKey)
+	}
+	assert.True(t, apierrors.IsNotFound(controller.Get(ctx, testKey, testCfg)), "the finalizer should be removed")
+	assert.True(t, apierrors.IsNotFound(controller.Get(ctx, client.ObjectKey{Namespace: "test", Name: pvcName}, pvc)), "the plugin volume claim should be removed from the namespace")
+	assert.True(t, apierrors.IsNotFound(controller.Get(ctx, client.ObjectKey{Name: pvcName}, pv)), "the retained clone of the volume should be removed")
+	require.NoError(t, controller.Get(ctx, cacheKey, cache))
+	assert.Equal(t, "other/default", cache.Annotations[porterv1.AnnotationPluginCacheRefs], "the cache should still be used by the other namespace")
+
+	// The cache is deleted once it is no longer used
+	require.NoError(t, controller.Get(ctx, otherKey, otherCfg))
+	require.NoError(t, controller.Delete(ctx, otherCfg))
+	for i := 0; i < 3; i++ {
+		triggerReconcile(otherKey)
+	}
+	assert.True(t, apierrors.IsNotFound(controller.Get(ctx, cacheKey, cache)), "the cache should be deleted")
+}
+
+func TestAgentConfigReconciler_Reconcile_SharedPluginCache_Unsupported(t *testing.T) {
+	ctx := context.Background()
+
+	testCfg := newSharedPluginCacheAgentConfig("test")
+	controller := setupAgentConfigController(testCfg)
+	recorder := controller.Recorder.(*record.FakeRecorder)
+	testKey := client.ObjectKeyFromObject(testCfg)
+
+	triggerReconcile := func() {
+		_, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: testKey})
+		require.NoError(t, err)
+	}
+
+	triggerReconcile()
+	assert.Contains(t, <-recorder.Events, "CreatePluginCache")
+
+	// Install the plugins in the cache on a CSI volume, which cannot be cloned
+	agentCfg := porterv1.NewAgentConfigAdapter(*testCfg)
+	cacheKey := client.ObjectKey{Namespace: operatorNamespace, Name: getPluginCacheName(agentCfg)}
+	cachePV := &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pvc-cache"},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity:               corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("64Mi")},
+			AccessModes:            []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{Driver: "ebs.csi.aws.com", VolumeHandle: "vol-123"}},
+		},
+	}
+	require.NoError(t, controller.Create(ctx, cachePV))
+	cachePVC := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: agentCfg.Spec.Plugins.GetPVCName(operatorNamespace), Namespace: operatorNamespace},
+		Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: cachePV.Name},
+	}
+	require.NoError(t, controller.Create(ctx, cachePVC))
+	cache := &porterv1.AgentConfig{}
+	require.NoError(t, controller.Get(ctx, cacheKey, cache))
+	cache.Status.Ready = true
+	cache.Status.Phase = porterv1.PhaseSucceeded
+	require.NoError(t, controller.Status().Update(ctx, cache))
+
+	// The plugins are installed in the namespace instead
+	triggerReconcile()
+	assert.Contains(t, <-recorder.Events, "PluginCacheUnsupported")
+	require.NoError(t, controller.Get(ctx, cacheKey, cache))
+	assert.Contains(t, cache.Annotations[porterv1.AnnotationPluginCacheUnsupported], "CSI driver ebs.csi.aws.com")
+	err := controller.Get(ctx, client.ObjectKey{Name: agentCfg.GetPluginsPVCName()}, &corev1.PersistentVolume{})
+	assert.True(t, apierrors.IsNotFound(err), "the volume of the cache should not be cloned")
+
+	var actions porterv1.AgentActionList
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace("test")))
+	assert.Len(t, actions.Items, 1, "the plugins should be installed in the namespace")
+
+	// The cache is not bound again
+	triggerReconcile()
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace("test")))
+	assert.Len(t, actions.Items, 1)
+	require.NoError(t, controller.Get(ctx, cacheKey, cache))
+	assert.Equal(t, "test/default", cache.Annotations[porterv1.AnnotationPluginCacheRefs], "the cache is still referenced so that it is removed once no longer used")
+}
+
+func TestCheckPluginCacheVolume(t *testing.T) {
+	testcases := []struct {
+		name      string
+		source    corev1.PersistentVolumeSource
+		mode      corev1.PersistentVolumeMode
+		supported bool
+	}{
+		{name: "nfs", source: corev1.PersistentVolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs.example.com", Path: "/plugins"}}, supported: true},
+		{name: "cephfs", source: corev1.PersistentVolumeSource{CephFS: &corev1.CephFSPersistentVolumeSource{Monitors: []string{"ceph"}}}, supported: true},
+		{name: "nfs block", source: corev1.PersistentVolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs.example.com", Path: "/plugins"}}, mode: corev1.PersistentVolumeBlock},
+		{name: "csi", source: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{Driver: "efs.csi.aws.com", VolumeHandle: "fs-123"}}},
+		{name: "host path", source: corev1.PersistentVolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/plugins"}}},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			pv := &corev1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Name: "pvc-cache"},
+				Spec:       corev1.PersistentVolumeSpec{PersistentVolumeSource: tc.source},
+			}
+			if tc.mode != "" {
+				pv.Spec.VolumeMode = &tc.mode
+			}
+
+			err := checkPluginCacheVolume(pv)
+			if tc.supported {
+				assert.NoError(t, err)
+			} else {
+				assert.True(t, errors.Is(err, errPluginCacheUnsupported), "expected errPluginCacheUnsupported, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAgentConfigReconciler_Reconcile_SharedPluginCache_PluginSource(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := newSharedPluginCacheAgentConfig("test")
+	cfg.Spec.PluginConfigFile.Plugins["azure"] = porterv1.Plugin{Source: &porterv1.PluginSource{
+		ConfigMap: &porterv1.PluginArchiveKeyRef{Name: "plugins", Key: "azure.tgz"},
+		SHA256:    archiveChecksum,
+	}}
+	controller := setupAgentConfigController(cfg)
+	recorder := controller.Recorder.(*record.FakeRecorder)
+
+	_, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cfg)})
+	require.NoError(t, err)
+	assert.Contains(t, <-recorder.Events, "InvalidPluginDelivery")
+
+	var caches porterv1.AgentConfigList
+	require.NoError(t, controller.List(ctx, &caches, client.InNamespace(operatorNamespace)))
+	assert.Empty(t, caches.Items, "plugins from a source in the namespace should not be shared")
+}
+
+func TestAgentConfigReconciler_mapPluginCacheToAgentConfigs(t *testing.T) {
+	controller := setupAgentConfigController()
+	cache := &porterv1.AgentConfig{ObjectMeta: metav1.ObjectMeta{
+		Name:        "plugin-cache-abc",
+		Namespace:   operatorNamespace,
+		Labels:      map[string]string{porterv1.LabelPluginCache: "true"},
+		Annotations: map[string]string{porterv1.AnnotationPluginCacheRefs: "other/default,test/custom"},
+	}}
+
+	requests := controller.mapPluginCacheToAgentConfigs(context.Background(), cache)
+	assert.Equal(t, []ctrl.Request{
+		{NamespacedName: client.ObjectKey{Namespace: "other", Name: "default"}},
+		{NamespacedName: client.ObjectKey{Namespace: "test", Name: "custom"}},
+	}, requests)
+
+	delete(cache.Labels, porterv1.LabelPluginCache)
+	assert.Empty(t, controller.mapPluginCacheToAgentConfigs(context.Background(), cache), "only changes to a shared plugin cache should be mapped")
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// pluginImageArchive is the archive of the installed plugins that is appended to the base image of the plugin image.
+// It is written to the volume shared by the agent, because the working directory is read only.
+var pluginImageArchive = path.Join(porterv1.VolumePorterSharedPath, "plugins.tar")
+
+// isPluginImageAction determines if the action was created by an AgentConfig to publish its plugins to a plugin image.
+func isPluginImageAction(action *porterv1.AgentAction, agentCfg porterv1.AgentConfigSpecAdapter) bool {
+	return action.CreatedByAgentConfig() && agentCfg.GetPluginImage() != ""
+}
+
+// getInstallPluginsInitContainer returns an init container that installs the plugins listed in the working directory
+// with the same configuration as the agent, before they are published to the plugin image.
+func getInstallPluginsInitContainer(agentCfg porterv1.AgentConfigSpecAdapter, env []corev1.EnvVar, envFrom []corev1.EnvFromSource,
+	volumeMounts []corev1.VolumeMount, resources corev1.ResourceRequirements, securityContext *corev1.SecurityContext) corev1.Container {
+	return corev1.Container{
+		Name:            "install-plugins",
+		Image:           agentCfg.GetPorterImage(),
+		ImagePullPolicy: agentCfg.GetPullPolicy(),
+		Args:            []string{"plugins", "install", "-f", pluginsFileName},
+		Env:             env,
+		EnvFrom:         envFrom,
+		VolumeMounts:    volumeMounts,
+		WorkingDir:      porterv1.VolumePorterWorkDirPath,
+		Resources:       resources,
+		SecurityContext: securityContext,
+	}
+}
+
+// getPublishPluginsInitContainer returns an init container that appends the installed plugins to the base image
+// and pushes the result to the plugin image, tagged with the hash of the plugins.
+// It uses the docker config of the agent to authenticate to the registry.
+func getPublishPluginsInitContainer(agentCfg porterv1.AgentConfigSpecAdapter, volumeMounts []corev1.VolumeMount,
+	resources corev1.ResourceRequirements, securityContext *corev1.SecurityContext) corev1.Container {
+	delivery := agentCfg.GetPluginDelivery()
+	// The plugins directory is archived from its parent, so that it is extracted into /plugins, see PluginImagePath
+	pluginsDir := porterv1.VolumePorterPluginsPath
+	script := []string{
+		"set -e",
+		fmt.Sprintf("tar -cf %s -C %s %s", shellQuote(pluginImageArchive), shellQuote(path.Dir(pluginsDir)), shellQuote(path.Base(pluginsDir))),
+		fmt.Sprintf("crane append --base %s --new_layer %s --new_tag %s", shellQuote(delivery.BaseImage), shellQuote(pluginImageArchive), shellQuote(agentCfg.GetPluginImage())),
+		fmt.Sprintf("rm -f %s", shellQuote(pluginImageArchive)),
+	}
+
+	return corev1.Container{
+		Name:    "publish-plugins",
+		Image:   delivery.PublisherImage,
+		Command: []string{"/busybox/sh", "-c", strings.Join(script, "\n")},
+		Env: []corev1.EnvVar{
+			{Name: "DOCKER_CONFIG", Value: path.Join(porterv1.VolumeImgPullSecretPath, ".docker")},
+		},
+		VolumeMounts:    volumeMounts,
+		Resources:       resources,
+		SecurityContext: securityContext,
+	}
+}
+
+// getCopyPluginsInitContainer returns an init container that copies the plugins from the plugin image
+// into the empty plugin volume of the agent pod.
+func getCopyPluginsInitContainer(agentCfg porterv1.AgentConfigSpecAdapter, resources corev1.ResourceRequirements, securityContext *corev1.SecurityContext) corev1.Container {
+	return corev1.Container{
+		Name:    "copy-plugins",
+		Image:   agentCfg.GetPluginImage(),
+		Command: []string{"cp", "-R", porterv1.PluginImagePath + "/.", porterv1.VolumePorterPluginsPath},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: porterv1.VolumePorterPluginsName, MountPath: porterv1.VolumePorterPluginsPath},
+		},
+		Resources:       resources,
+		SecurityContext: securityContext,
+	}
+}
+
+// hasPublishedPluginImage determines if the plugins of an AgentConfig were already published to its plugin image,
+// for example by the agent action of a previous generation of the AgentConfig.
+func hasPublishedPluginImage(agentCfg *porterv1.AgentConfigAdapter) bool {
+	image := agentCfg.Spec.GetPluginImage()
+	active := agentCfg.Status.ActivePlugins
+	return image != "" && active != nil && active.Image == image
+}
+
+// syncPluginImage publishes the plugins of an AgentConfig that delivers them with an image, and updates its status.
+// The plugins are installed and published by an agent action, which then lists the installed plugins.
+// The image is tagged with the hash of the plugins, so it is only published again when the plugins change.
+func (r *AgentConfigReconciler) syncPluginImage(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter, action *porterv1.AgentAction) error {
+	ctx, span := startSpan(ctx, "AgentConfig.syncPluginImage")
+	defer span.End()
+
+	origStatus := *agentCfg.Status.DeepCopy()
+	if err := agentCfg.Spec.GetPluginDelivery().Validate(); err != nil {
+		r.Recorder.Event(&agentCfg.AgentConfig, "Warning", "InvalidPluginDelivery", err.Error())
+		if agentCfg.Status.Ready {
+			agentCfg.Status.Ready = false
+			return r.saveStatus(ctx, log, agentCfg)
+		}
+		return nil
+	}
+
+	log = log.WithValues("image", agentCfg.Spec.GetPluginImage())
+	if action == nil {
+		if hasPublishedPluginImage(agentCfg) {
+			log.V(Log4Debug).Info("The plugin image was already published")
+			return r.activatePluginImage(ctx, log, agentCfg, origStatus)
+		}
+
+		// The plugins from a source in the cluster are installed with the other plugins
+		if err := r.verifyPluginSources(ctx, log, agentCfg); err != nil {
+			if errors.Is(err, errInvalidPluginSource) {
+				r.Recorder.Event(&agentCfg.AgentConfig, "Warning", "InvalidPluginSource", err.Error())
+			}
+			return err
+		}
+
+		log.V(Log5Trace).Info("Initializing agent config status")
+		agentCfg.Status.Initialize()
+		if err := r.saveStatus(ctx, log, agentCfg); err != nil {
+			return err
+		}
+		action, err := r.createPluginImageAction(ctx, log, agentCfg)
+		if err != nil {
+			return err
+		}
+		return r.syncStatus(ctx, log, agentCfg, action)
+	}
+
+	// Check if a retry was requested
+	if action.GetRetryLabelValue() != agentCfg.GetRetryLabelValue() {
+		return r.retry(ctx, log, agentCfg, action)
+	}
+
+	// Wait for the plugins to be published, the status of the action was already synced
+	if action.Status.Phase != porterv1.PhaseSucceeded {
+		log.V(Log4Debug).Info("Plugin image is not published yet.", "action status", action.Status)
+		return nil
+	}
+
+	// The agent lists the plugins after they are published
+	hash := agentCfg.Spec.Plugins.GetLabels()[porterv1.LabelPluginsHash]
+	if r.PodLogs != nil && action.Status.Job != nil && agentCfg.Status.InstalledPluginsHash != hash {
+		r.setInstalledPlugins(ctx, log, agentCfg, action)
+		agentCfg.Status.InstalledPluginsHash = hash
+	}
+	return r.activatePluginImage(ctx, log, agentCfg, origStatus)
+}
+
+// activatePluginImage switches the agent to the published plugin image, and marks the AgentConfig as ready.
+func (r *AgentConfigReconciler) activatePluginImage(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter, origStatus porterv1.AgentConfigStatus) error {
+	agentCfg.Status.ObservedGeneration = agentCfg.Generation
+	agentCfg.Status.Phase = porterv1.PhaseSucceeded
+	agentCfg.Status.Ready = true
+	agentCfg.Status.ActivePlugins = newActivePlugins(agentCfg, nil)
+	if reflect.DeepEqual(origStatus, agentCfg.Status) {
+		return nil
+	}
+
+	log.V(Log4Debug).Info("Activating the plugin image")
+	return r.saveStatus(ctx, log, agentCfg)
+}
+
+// createPluginImageAction creates an AgentAction that installs the plugins on an empty volume, publishes them to the plugin image,
+// and then runs porter plugins list to report the installed plugins.
+func (r *AgentConfigReconciler) createPluginImageAction(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter) (*porterv1.AgentAction, error) {
+	action, err := r.newAgentAction(ctx, nil, agentCfg, getPluginInstallActionLabels(agentCfg), []string{"plugins", "list", "-o", "json"})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.Create(ctx, action); err != nil {
+		return nil, errors.Wrap(err, "error creating the porter agent action to publish the plugin image")
+	}
+	r.Recorder.Event(&agentCfg.AgentConfig, "Normal", "CreateAgentAction", fmt.Sprintf("created agent action to publish the plugin image %s", agentCfg.Spec.GetPluginImage()))
+
+	log.V(Log4Debug).Info("Created porter agent action to publish the plugin image", "name", action.Name)
+	return action, nil
+}
@@ -0,0 +1,303 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// pluginSourcesPath is where the plugin archives are mounted in the container that installs them.
+	pluginSourcesPath = "/app/plugin-sources"
+
+	// pluginConfigMapIndexKey indexes the AgentConfigs and ClusterAgentConfigs by each ConfigMap
+	// that contains the archive of a plugin, see getPluginSourceIndexValue.
+	pluginConfigMapIndexKey = "pluginConfigMap"
+
+	// pluginSecretIndexKey indexes the AgentConfigs and ClusterAgentConfigs by each Secret
+	// that contains the archive of a plugin, see getPluginSourceIndexValue.
+	pluginSecretIndexKey = "pluginSecret"
+)
+
+func indexAgentConfigByPluginConfigMap(obj client.Object) []string {
+	return getPluginSourceIndexValues(obj, func(source porterv1.PluginSource) *porterv1.PluginArchiveKeyRef {
+		return source.ConfigMap
+	})
+}
+
+func indexAgentConfigByPluginSecret(obj client.Object) []string {
+	return getPluginSourceIndexValues(obj, func(source porterv1.PluginSource) *porterv1.PluginArchiveKeyRef {
+		return source.Secret
+	})
+}
+
+func getPluginSourceIndexValues(obj client.Object, getRef func(porterv1.PluginSource) *porterv1.PluginArchiveKeyRef) []string {
+	var spec porterv1.AgentConfigSpec
+	var namespace string
+	switch cfg := obj.(type) {
+	case *porterv1.AgentConfig:
+		spec = cfg.Spec
+		if cfg.Namespace != operatorNamespace || cfg.Name != "default" {
+			namespace = cfg.Namespace
+		}
+	case *porterv1.ClusterAgentConfig:
+		spec = cfg.Spec.AgentConfigSpec
+	}
+	if spec.PluginConfigFile == nil {
+		return nil
+	}
+
+	var values []string
+	for _, plugin := range spec.PluginConfigFile.Plugins {
+		if plugin.Source == nil {
+			continue
+		}
+		if ref := getRef(*plugin.Source); ref != nil {
+			values = append(values, getPluginSourceIndexValue(namespace, ref.Name))
+		}
+	}
+	return values
+}
+
+// getPluginSourceIndexValue returns the namespace/name of a ConfigMap or Secret that contains the archive of a plugin.
+// The archive is read from the namespace of the AgentConfig that installs the plugin, so the namespace is empty
+// for the layers of configuration that are merged into the AgentConfigs of every namespace: the ClusterAgentConfigs
+// and the system level AgentConfig.
+func getPluginSourceIndexValue(namespace string, name string) string {
+	return namespace + "/" + name
+}
+
+// mapPluginSourceToAgentConfigs returns a function that requests the AgentConfigs that install a plugin from the archive
+// in a ConfigMap or Secret, when it is created or changed. The AgentConfigs that merge the plugin from a less specific
+// layer of configuration are requested as well.
+func (r *AgentConfigReconciler) mapPluginSourceToAgentConfigs(indexKey string) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		var requests []reconcile.Request
+		requested := map[client.ObjectKey]bool{}
+		add := func(reqs ...reconcile.Request) {
+			for _, req := range reqs {
+				if !requested[req.NamespacedName] {
+					requested[req.NamespacedName] = true
+					requests = append(requests, req)
+				}
+			}
+		}
+
+		agentCfgs := &porterv1.AgentConfigList{}
+		key := getPluginSourceIndexValue(obj.GetNamespace(), obj.GetName())
+		if err := r.List(ctx, agentCfgs, client.MatchingFields{indexKey: key}); err != nil {
+			r.Log.V(Log0Error).Error(err, "Could not list the agent configurations that use a plugin source", indexKey, key)
+			return nil
+		}
+		for i := range agentCfgs.Items {
+			agentCfg := &agentCfgs.Items[i]
+			add(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(agentCfg)})
+			add(r.mapConfigLayerToAgentConfigs(ctx, agentCfg)...)
+		}
+
+		// The layers merged into every namespace read the archive from the namespace of each AgentConfig
+		key = getPluginSourceIndexValue("", obj.GetName())
+		systemCfgs := &porterv1.AgentConfigList{}
+		clusterCfgs := &porterv1.ClusterAgentConfigList{}
+		if err := r.List(ctx, systemCfgs, client.MatchingFields{indexKey: key}); err != nil {
+			r.Log.V(Log0Error).Error(err, "Could not list the agent configurations that use a plugin source", indexKey, key)
+			return nil
+		}
+		if err := r.List(ctx, clusterCfgs, client.MatchingFields{indexKey: key}); err != nil {
+			r.Log.V(Log0Error).Error(err, "Could not list the cluster agent configurations that use a plugin source", indexKey, key)
+			return nil
+		}
+		if len(systemCfgs.Items) == 0 && len(clusterCfgs.Items) == 0 {
+			return requests
+		}
+
+		nsCfgs := &porterv1.AgentConfigList{}
+		if err := r.List(ctx, nsCfgs, client.InNamespace(obj.GetNamespace())); err != nil {
+			r.Log.V(Log0Error).Error(err, "Could not list the agent configurations that use a plugin source", "namespace", obj.GetNamespace())
+			return nil
+		}
+		for i := range nsCfgs.Items {
+			if !isPluginCache(&nsCfgs.Items[i]) {
+				add(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&nsCfgs.Items[i])})
+			}
+		}
+		return requests
+	}
+}
+
+// errInvalidPluginSource is returned when the archive of a plugin that is installed from a source in the cluster
+// is missing or does not match its checksum.
+var errInvalidPluginSource = errors.New("invalid plugin source")
+
+// verifyPluginSources checks the archives of the plugins that are installed from a source in the cluster.
+// The checksum of an archive in a ConfigMap or Secret is verified by the operator, while an archive
+// on a volume is verified by the agent before it is installed, see getLocalPluginsInitContainer.
+func (r *AgentConfigReconciler) verifyPluginSources(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter) error {
+	for _, name := range agentCfg.Spec.Plugins.GetNamesWithSource() {
+		plugin, _ := agentCfg.Spec.Plugins.GetByName(name)
+		source := *plugin.Source
+		if err := source.Validate(); err != nil {
+			return errors.Wrapf(errInvalidPluginSource, "plugin %s: %s", name, err)
+		}
+
+		var archive []byte
+		var found bool
+		switch {
+		case source.ConfigMap != nil:
+			cm := &corev1.ConfigMap{}
+			if err := r.Get(ctx, client.ObjectKey{Namespace: agentCfg.Namespace, Name: source.ConfigMap.Name}, cm); err != nil {
+				if apierrors.IsNotFound(err) {
+					return errors.Wrapf(errInvalidPluginSource, "plugin %s: configmap %s not found", name, source.ConfigMap.Name)
+				}
+				return errors.Wrapf(err, "error retrieving the archive of plugin %s", name)
+			}
+			archive, found = cm.BinaryData[source.ConfigMap.Key]
+			if !found {
+				var data string
+				data, found = cm.Data[source.ConfigMap.Key]
+				archive = []byte(data)
+			}
+		case source.Secret != nil:
+			secret := &corev1.Secret{}
+			if err := r.Get(ctx, client.ObjectKey{Namespace: agentCfg.Namespace, Name: source.Secret.Name}, secret); err != nil {
+				if apierrors.IsNotFound(err) {
+					return errors.Wrapf(errInvalidPluginSource, "plugin %s: secret %s not found", name, source.Secret.Name)
+				}
+				return errors.Wrapf(err, "error retrieving the archive of plugin %s", name)
+			}
+			archive, found = secret.Data[source.Secret.Key]
+		default:
+			continue
+		}
+		if !found {
+			return errors.Wrapf(errInvalidPluginSource, "plugin %s: %s not found", name, source)
+		}
+
+		sum := sha256.Sum256(archive)
+		if checksum := hex.EncodeToString(sum[:]); !strings.EqualFold(checksum, source.SHA256) {
+			return errors.Wrapf(errInvalidPluginSource, "plugin %s: the checksum of %s is %s instead of %s", name, source, checksum, source.SHA256)
+		}
+		log.V(Log5Trace).Info("Verified the plugin archive", "plugin", name, "source", source.String())
+	}
+	return nil
+}
+
+// usesLocalPluginsContainer determines if the plugins installed from a source in the cluster are installed
+// by an init container in the agent pod, when the AgentConfig installs the plugins on its volume,
+// or before they are published to the plugin image.
+func usesLocalPluginsContainer(action *porterv1.AgentAction, agentCfg porterv1.AgentConfigSpecAdapter) bool {
+	if len(agentCfg.Plugins.GetNamesWithSource()) == 0 {
+		return false
+	}
+	return isPluginInstallAction(action) && agentCfg.GetPluginDelivery().UsesVolume() || isPluginImageAction(action, agentCfg)
+}
+
+// isPluginInstallAction determines if the action was created by an AgentConfig to install its plugins.
+func isPluginInstallAction(action *porterv1.AgentAction) bool {
+	args := action.Spec.Args
+	return action.CreatedByAgentConfig() && len(args) >= 2 && args[0] == "plugins" && args[1] == "install"
+}
+
+// getPluginSourceVolumeName returns the name of the volume that contains the archive of a plugin.
+func getPluginSourceVolumeName(plugin string) string {
+	return "plugin-source-" + plugin
+}
+
+// getPluginSourceVolumes returns the volumes that contain the archives of the plugins installed from a source in the cluster.
+func getPluginSourceVolumes(agentCfg porterv1.AgentConfigSpecAdapter) []corev1.Volume {
+	var volumes []corev1.Volume
+	for _, name := range agentCfg.Plugins.GetNamesWithSource() {
+		plugin, _ := agentCfg.Plugins.GetByName(name)
+		volume := corev1.Volume{Name: getPluginSourceVolumeName(name)}
+		switch source := plugin.Source; {
+		case source.ConfigMap != nil:
+			volume.ConfigMap = &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: source.ConfigMap.Name},
+				Items:                []corev1.KeyToPath{{Key: source.ConfigMap.Key, Path: source.ConfigMap.Key}},
+			}
+		case source.Secret != nil:
+			volume.Secret = &corev1.SecretVolumeSource{
+				SecretName: source.Secret.Name,
+				Items:      []corev1.KeyToPath{{Key: source.Secret.Key, Path: source.Secret.Key}},
+			}
+		case source.PersistentVolumeClaim != nil:
+			volume.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: source.PersistentVolumeClaim.ClaimName,
+				ReadOnly:  true,
+			}
+		default:
+			continue
+		}
+		volumes = append(volumes, volume)
+	}
+	return volumes
+}
+
+// getLocalPluginsInitContainer returns an init container that verifies the checksum of the archive of each plugin
+// installed from a source in the cluster, and extracts it into the plugins directory.
+func getLocalPluginsInitContainer(agentCfg porterv1.AgentConfigSpecAdapter, volumeMounts []corev1.VolumeMount,
+	resources corev1.ResourceRequirements, securityContext *corev1.SecurityContext) corev1.Container {
+	var mounts []corev1.VolumeMount
+	for _, mount := range volumeMounts {
+		if mount.Name == porterv1.VolumePorterPluginsName {
+			mount.ReadOnly = false
+			mounts = append(mounts, mount)
+		}
+	}
+
+	script := []string{"set -e"}
+	for _, name := range agentCfg.Plugins.GetNamesWithSource() {
+		plugin, _ := agentCfg.Plugins.GetByName(name)
+		source := plugin.Source
+
+		var archive string
+		switch {
+		case source.ConfigMap != nil:
+			archive = source.ConfigMap.Key
+		case source.Secret != nil:
+			archive = source.Secret.Key
+		case source.PersistentVolumeClaim != nil:
+			archive = source.PersistentVolumeClaim.Path
+		default:
+			continue
+		}
+		sourcePath := path.Join(pluginSourcesPath, name)
+		archive = path.Join(sourcePath, archive)
+		mounts = append(mounts, corev1.VolumeMount{Name: getPluginSourceVolumeName(name), MountPath: sourcePath, ReadOnly: true})
+
+		pluginDir := path.Join(porterv1.VolumePorterPluginsPath, name)
+		script = append(script,
+			fmt.Sprintf("echo %s | sha256sum -c -", shellQuote(strings.ToLower(source.SHA256)+"  "+archive)),
+			fmt.Sprintf("rm -rf %[1]s && mkdir -p %[1]s", shellQuote(pluginDir)),
+			fmt.Sprintf("tar -xzf %s -C %s", shellQuote(archive), shellQuote(pluginDir)),
+			fmt.Sprintf("chmod +x %s", shellQuote(path.Join(pluginDir, name))),
+		)
+	}
+
+	return corev1.Container{
+		Name:            "install-local-plugins",
+		Image:           agentCfg.GetPorterImage(),
+		ImagePullPolicy: agentCfg.GetPullPolicy(),
+		Command:         []string{"/bin/sh", "-c", strings.Join(script, "\n")},
+		VolumeMounts:    mounts,
+		Resources:       resources,
+		SecurityContext: securityContext,
+	}
+}
+
+// shellQuote quotes a value so that it is passed as a single argument to a shell command.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
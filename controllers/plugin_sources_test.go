@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// archiveChecksum is the SHA256 checksum of the test archive, "archive"
+const archiveChecksum = "0eb3e36bfb24dcd9bb1d1bece1531216b59539a8fde17ee80224af0653c92aa3"
+
+func TestAgentConfigReconciler_verifyPluginSources(t *testing.T) {
+	ctx := context.Background()
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "plugins"},
+		BinaryData: map[string][]byte{"kubernetes.tgz": []byte("archive")},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "plugins"},
+		Data:       map[string][]byte{"kubernetes.tgz": []byte("archive")},
+	}
+
+	testcases := []struct {
+		name    string
+		source  porterv1.PluginSource
+		wantErr string
+	}{
+		{name: "configmap", source: porterv1.PluginSource{ConfigMap: &porterv1.PluginArchiveKeyRef{Name: "plugins", Key: "kubernetes.tgz"}, SHA256: archiveChecksum}},
+		{name: "secret", source: porterv1.PluginSource{Secret: &porterv1.PluginArchiveKeyRef{Name: "plugins", Key: "kubernetes.tgz"}, SHA256: archiveChecksum}},
+		{name: "volume is verified by the agent", source: porterv1.PluginSource{PersistentVolumeClaim: &porterv1.PluginArchiveVolumeRef{ClaimName: "plugins", Path: "kubernetes.tgz"}, SHA256: archiveChecksum}},
+		{name: "checksum mismatch", source: porterv1.PluginSource{ConfigMap: &porterv1.PluginArchiveKeyRef{Name: "plugins", Key: "kubernetes.tgz"}, SHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+			wantErr: "the checksum of configmap/plugins/kubernetes.tgz is " + archiveChecksum},
+		{name: "missing configmap", source: porterv1.PluginSource{ConfigMap: &porterv1.PluginArchiveKeyRef{Name: "missing", Key: "kubernetes.tgz"}, SHA256: archiveChecksum},
+			wantErr: "configmap missing not found"},
+		{name: "missing key", source: porterv1.PluginSource{Secret: &porterv1.PluginArchiveKeyRef{Name: "plugins", Key: "azure.tgz"}, SHA256: archiveChecksum},
+			wantErr: "secret/plugins/azure.tgz not found"},
+		{name: "invalid source", source: porterv1.PluginSource{SHA256: archiveChecksum}, wantErr: "exactly one of"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			controller := setupAgentConfigController(cm, secret)
+			agentCfg := porterv1.NewAgentConfigAdapter(porterv1.AgentConfig{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "default"},
+				Spec: porterv1.AgentConfigSpec{
+					PluginConfigFile: &porterv1.PluginFileSpec{Plugins: map[string]porterv1.Plugin{"kubernetes": {Source: &tc.source}}},
+				},
+			})
+
+			err := controller.verifyPluginSources(ctx, logr.Discard(), agentCfg)
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tc.wantErr)
+				assert.True(t, errors.Is(err, errInvalidPluginSource))
+			}
+		})
+	}
+}
+
+func TestAgentConfigReconciler_Reconcile_InvalidPluginSource(t *testing.T) {
+	ctx := context.Background()
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "plugins"},
+		BinaryData: map[string][]byte{"kubernetes.tgz": []byte("tampered")},
+	}
+	agentCfg := &porterv1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test", Generation: 1, Finalizers: []string{porterv1.FinalizerName}},
+		Spec: porterv1.AgentConfigSpec{
+			PluginConfigFile: &porterv1.PluginFileSpec{SchemaVersion: "1.0.0", Plugins: map[string]porterv1.Plugin{
+				"kubernetes": {Source: &porterv1.PluginSource{
+					ConfigMap: &porterv1.PluginArchiveKeyRef{Name: "plugins", Key: "kubernetes.tgz"},
+					SHA256:    archiveChecksum,
+				}},
+			}},
+		},
+	}
+	controller := setupAgentConfigController(agentCfg, cm)
+	recorder := controller.Recorder.(*record.FakeRecorder)
+	key := client.ObjectKeyFromObject(agentCfg)
+
+	result, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	assert.Zero(t, result.RequeueAfter, "the plugin sources should be verified again when the archive changes")
+	assert.Contains(t, <-recorder.Events, "InvalidPluginSource")
+
+	require.NoError(t, controller.Get(ctx, key, agentCfg))
+	assert.False(t, agentCfg.Status.Ready)
+	var actions porterv1.AgentActionList
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace("test")))
+	assert.Empty(t, actions.Items, "the plugins should not be installed until the archive is verified")
+
+	// Fix the archive
+	cm.BinaryData["kubernetes.tgz"] = []byte("archive")
+	require.NoError(t, controller.Update(ctx, cm))
+	assert.Equal(t, []reconcile.Request{{NamespacedName: key}}, controller.mapPluginSourceToAgentConfigs(pluginConfigMapIndexKey)(ctx, cm),
+		"the agent config should be requested when the archive changes")
+	_, err = controller.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace("test")))
+	assert.Len(t, actions.Items, 1, "the plugins should be installed once the archive is verified")
+}
+
+func TestAgentConfigReconciler_mapPluginSourceToAgentConfigs(t *testing.T) {
+	ctx := context.Background()
+	withSource := func(source porterv1.PluginSource) porterv1.AgentConfigSpec {
+		source.SHA256 = archiveChecksum
+		return porterv1.AgentConfigSpec{PluginConfigFile: &porterv1.PluginFileSpec{SchemaVersion: "1.0.0", Plugins: map[string]porterv1.Plugin{
+			"kubernetes": {Source: &source},
+		}}}
+	}
+	configMapSource := porterv1.PluginSource{ConfigMap: &porterv1.PluginArchiveKeyRef{Name: "plugins", Key: "kubernetes.tgz"}}
+	secretSource := porterv1.PluginSource{Secret: &porterv1.PluginArchiveKeyRef{Name: "plugins", Key: "kubernetes.tgz"}}
+
+	nsCfg := &porterv1.AgentConfig{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test"}, Spec: withSource(configMapSource)}
+	instCfg := &porterv1.AgentConfig{ObjectMeta: metav1.ObjectMeta{Name: "custom", Namespace: "test"}}
+	otherNsCfg := &porterv1.AgentConfig{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "other"}}
+	otherInstCfg := &porterv1.AgentConfig{ObjectMeta: metav1.ObjectMeta{Name: "custom", Namespace: "other"}, Spec: withSource(configMapSource)}
+	clusterCfg := &porterv1.ClusterAgentConfig{ObjectMeta: metav1.ObjectMeta{Name: "all"}, Spec: porterv1.ClusterAgentConfigSpec{AgentConfigSpec: withSource(secretSource)}}
+	r := setupAgentConfigController(nsCfg, instCfg, otherNsCfg, otherInstCfg, clusterCfg)
+
+	toRequest := func(cfg *porterv1.AgentConfig) reconcile.Request {
+		return reconcile.Request{NamespacedName: client.ObjectKeyFromObject(cfg)}
+	}
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "plugins", Namespace: "test"}}
+	assert.ElementsMatch(t, []reconcile.Request{toRequest(nsCfg), toRequest(instCfg)}, r.mapPluginSourceToAgentConfigs(pluginConfigMapIndexKey)(ctx, cm),
+		"the AgentConfigs that merge the plugin from the namespace AgentConfig should be requested")
+	cm.Namespace = "other"
+	assert.ElementsMatch(t, []reconcile.Request{toRequest(otherInstCfg)}, r.mapPluginSourceToAgentConfigs(pluginConfigMapIndexKey)(ctx, cm),
+		"only the AgentConfig that installs the plugin should be requested")
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "plugins", Namespace: "other"}}
+	assert.ElementsMatch(t, []reconcile.Request{toRequest(otherNsCfg), toRequest(otherInstCfg)}, r.mapPluginSourceToAgentConfigs(pluginSecretIndexKey)(ctx, secret),
+		"the AgentConfigs in the namespace of the archive should be requested when a ClusterAgentConfig installs the plugin")
+	secret.Name = "unused"
+	assert.Empty(t, r.mapPluginSourceToAgentConfigs(pluginSecretIndexKey)(ctx, secret), "a secret that does not contain a plugin archive should not be mapped")
+}
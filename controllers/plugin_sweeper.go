@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultPluginVolumeGracePeriod is how long an unused plugin volume is kept by default before it is removed.
+const DefaultPluginVolumeGracePeriod = 24 * time.Hour
+
+// PluginVolumeSweeperOptions configures how the AgentConfig controller removes plugin volumes that are no longer used.
+type PluginVolumeSweeperOptions struct {
+	// Interval between sweeps. The sweeper is disabled when it is zero.
+	Interval time.Duration
+
+	// GracePeriod is how long a plugin volume must be unused before it is removed.
+	GracePeriod time.Duration
+}
+
+// BindFlags registers flags for the sweeper options.
+func (o *PluginVolumeSweeperOptions) BindFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&o.Interval, "plugin-volume-sweep-interval", time.Hour, "How often to look for plugin volumes that are no longer used by an AgentConfig. Set to 0 to disable the sweeper.")
+	fs.DurationVar(&o.GracePeriod, "plugin-volume-grace-period", DefaultPluginVolumeGracePeriod, "How long a plugin volume must be unused before it is removed.")
+}
+
+// StartPluginVolumeSweeper sweeps the plugin volumes on an interval until the context is cancelled.
+// It is added to the manager as a runnable that only runs on the leader.
+func (r *AgentConfigReconciler) StartPluginVolumeSweeper(ctx context.Context) error {
+	log := r.Log.WithName("PluginVolumeSweeper")
+	if r.PluginVolumeSweeper.Interval <= 0 {
+		log.V(Log2ApplicationState).Info("The plugin volume sweeper is disabled")
+		return nil
+	}
+
+	ticker := time.NewTicker(r.PluginVolumeSweeper.Interval)
+	defer ticker.Stop()
+	for {
+		if err := r.SweepPluginVolumes(ctx); err != nil {
+			log.V(Log0Error).Error(err, "Could not sweep the plugin volumes")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// SweepPluginVolumes finds the plugin volumes (pvc) with a plugins hash that is not used by any AgentConfig in their namespace.
+// Unused volumes are annotated with when they were first found to be unused, reported in the status of the AgentConfig
+// that installed them, and removed along with their persistent volume once the grace period has passed.
+func (r *AgentConfigReconciler) SweepPluginVolumes(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "AgentConfig.SweepPluginVolumes")
+	defer span.End()
+
+	log := r.Log.WithName("PluginVolumeSweeper")
+	log.V(Log5Trace).Info("Sweeping plugin volumes")
+
+	var agentCfgs porterv1.AgentConfigList
+	if err := r.List(ctx, &agentCfgs); err != nil {
+		return errors.Wrap(err, "error listing the agent configs")
+	}
+
+	// Find the plugins used in each namespace. When the plugins of an AgentConfig cannot be resolved,
+	// the namespace is skipped so that we never remove a volume that may still be used.
+	usedPlugins := map[string]map[string]bool{}
+	skippedNamespaces := map[string]bool{}
+	for _, cfg := range agentCfgs.Items {
+		if _, ok := usedPlugins[cfg.Namespace]; !ok {
+			usedPlugins[cfg.Namespace] = map[string]bool{}
+		}
+		if isDeleted(&cfg) {
+			continue
+		}
+
+		agentCfg := porterv1.NewAgentConfigAdapter(cfg)
+		if err := r.resolvePlugins(ctx, log, agentCfg); err != nil {
+			log.V(Log4Debug).Info("Skipping the plugin volumes in a namespace where the plugins of an AgentConfig could not be resolved", "namespace", cfg.Namespace, "agent config", cfg.Name, "error", err.Error())
+			skippedNamespaces[cfg.Namespace] = true
+			continue
+		}
+		if !agentCfg.Spec.GetPluginDelivery().UsesVolume() {
+			continue
+		}
+		if hash := agentCfg.Spec.Plugins.GetLabels()[porterv1.LabelPluginsHash]; hash != "" {
+			usedPlugins[cfg.Namespace][hash] = true
+		}
+		// The agent keeps using the previously installed plugins until the new plugins are installed
+		if active := cfg.Status.ActivePlugins; active != nil {
+			usedPlugins[cfg.Namespace][active.PluginsHash] = true
+		}
+	}
+
+	var pvcs corev1.PersistentVolumeClaimList
+	if err := r.List(ctx, &pvcs, client.MatchingLabels{porterv1.LabelManaged: "true"}, client.HasLabels{porterv1.LabelPluginsHash}); err != nil {
+		return errors.Wrap(err, "error listing the plugin volumes (pvc)")
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	unused := map[types.NamespacedName][]porterv1.UnusedPluginVolume{}
+	var removed int
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+		if skippedNamespaces[pvc.Namespace] || pvc.DeletionTimestamp != nil {
+			continue
+		}
+
+		pvcLog := log.WithValues("persistentvolumeclaim", pvc.Name, "namespace", pvc.Namespace)
+		hash := pvc.Labels[porterv1.LabelPluginsHash]
+		if usedPlugins[pvc.Namespace][hash] {
+			if err := r.setPluginVolumeUnusedSince(ctx, pvc, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		unusedSince, err := r.getPluginVolumeUnusedSince(ctx, pvcLog, pvc, now)
+		if err != nil {
+			return err
+		}
+		deleteAfter := unusedSince.Add(r.getPluginVolumeGracePeriod())
+		owner := getPluginVolumeOwner(pvc)
+		if now.Before(deleteAfter) {
+			unused[owner] = append(unused[owner], porterv1.UnusedPluginVolume{
+				Name:        pvc.Name,
+				PluginsHash: hash,
+				UnusedSince: metav1.NewTime(unusedSince),
+				DeleteAfter: metav1.NewTime(deleteAfter),
+			})
+			continue
+		}
+
+		if err = r.deletePluginVolume(ctx, pvcLog, pvc); err != nil {
+			return err
+		}
+		removed++
+		for _, cfg := range agentCfgs.Items {
+			if cfg.Namespace == owner.Namespace && cfg.Name == owner.Name {
+				r.Recorder.Event(&cfg, "Normal", "DeletePluginVolume", fmt.Sprintf("deleted unused plugin volume claim %s", pvc.Name))
+				break
+			}
+		}
+	}
+
+	// Report the unused volumes on the AgentConfig that installed them
+	for i := range agentCfgs.Items {
+		cfg := &agentCfgs.Items[i]
+		if skippedNamespaces[cfg.Namespace] || isDeleted(cfg) {
+			continue
+		}
+
+		volumes := unused[types.NamespacedName{Namespace: cfg.Namespace, Name: cfg.Name}]
+		sort.Slice(volumes, func(i, j int) bool {
+			return volumes[i].Name < volumes[j].Name
+		})
+		if equality.Semantic.DeepEqual(cfg.Status.UnusedPluginVolumes, volumes) {
+			continue
+		}
+
+		patch := client.MergeFrom(cfg.DeepCopy())
+		cfg.Status.UnusedPluginVolumes = volumes
+		if err := r.Status().Patch(ctx, cfg, patch); client.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, "error reporting the unused plugin volumes on agent config %s/%s", cfg.Namespace, cfg.Name)
+		}
+	}
+
+	log.V(Log4Debug).Info("Swept plugin volumes", "removed", removed)
+	return nil
+}
+
+func (r *AgentConfigReconciler) getPluginVolumeGracePeriod() time.Duration {
+	if r.PluginVolumeSweeper.GracePeriod <= 0 {
+		return DefaultPluginVolumeGracePeriod
+	}
+	return r.PluginVolumeSweeper.GracePeriod
+}
+
+// getPluginVolumeUnusedSince returns when the plugin volume was first found to be unused,
+// recording the current time on the volume when it was not already unused.
+func (r *AgentConfigReconciler) getPluginVolumeUnusedSince(ctx context.Context, log logr.Logger, pvc *corev1.PersistentVolumeClaim, now time.Time) (time.Time, error) {
+	if value, ok := pvc.Annotations[porterv1.AnnotationPluginsUnusedSince]; ok {
+		unusedSince, err := time.Parse(time.RFC3339, value)
+		if err == nil {
+			return unusedSince, nil
+		}
+		log.V(Log4Debug).Info("Resetting the invalid unused since annotation on the plugin volume", "value", value)
+	}
+
+	log.V(Log4Debug).Info("Plugin volume is no longer used by an AgentConfig")
+	return now, r.setPluginVolumeUnusedSince(ctx, pvc, &now)
+}
+
+// setPluginVolumeUnusedSince records when the plugin volume was first found to be unused,
+// or removes the record when unusedSince is nil.
+func (r *AgentConfigReconciler) setPluginVolumeUnusedSince(ctx context.Context, pvc *corev1.PersistentVolumeClaim, unusedSince *time.Time) error {
+	_, exists := pvc.Annotations[porterv1.AnnotationPluginsUnusedSince]
+	if unusedSince == nil && !exists {
+		return nil
+	}
+
+	patch := client.MergeFrom(pvc.DeepCopy())
+	if unusedSince == nil {
+		delete(pvc.Annotations, porterv1.AnnotationPluginsUnusedSince)
+	} else {
+		if pvc.Annotations == nil {
+			pvc.Annotations = map[string]string{}
+		}
+		pvc.Annotations[porterv1.AnnotationPluginsUnusedSince] = unusedSince.Format(time.RFC3339)
+	}
+	if err := r.Patch(ctx, pvc, patch); client.IgnoreNotFound(err) != nil {
+		return errors.Wrapf(err, "error updating plugin volume %s/%s", pvc.Namespace, pvc.Name)
+	}
+	return nil
+}
+
+// deletePluginVolume removes an unused plugin volume claim, and the persistent volume
+// that was bound to it when the volume was labeled by the operator.
+func (r *AgentConfigReconciler) deletePluginVolume(ctx context.Context, log logr.Logger, pvc *corev1.PersistentVolumeClaim) error {
+	log.V(Log4Debug).Info("Removing unused plugin volume")
+	if err := r.Delete(ctx, pvc); client.IgnoreNotFound(err) != nil {
+		return errors.Wrapf(err, "error removing plugin volume %s/%s", pvc.Namespace, pvc.Name)
+	}
+
+	if pvc.Spec.VolumeName == "" {
+		return nil
+	}
+	pv := &corev1.PersistentVolume{}
+	if err := r.Get(ctx, client.ObjectKey{Name: pvc.Spec.VolumeName}, pv); err != nil {
+		return client.IgnoreNotFound(errors.Wrapf(err, "error retrieving the persistent volume %s of plugin volume %s/%s", pvc.Spec.VolumeName, pvc.Namespace, pvc.Name))
+	}
+	if _, ok := pv.Labels[porterv1.LabelPluginsHash]; !ok {
+		return nil
+	}
+	if pv.Spec.ClaimRef != nil && (pv.Spec.ClaimRef.Namespace != pvc.Namespace || pv.Spec.ClaimRef.Name != pvc.Name) {
+		return nil
+	}
+
+	log.V(Log4Debug).Info("Removing the persistent volume of the unused plugin volume", "persistentvolume", pv.Name)
+	if err := r.Delete(ctx, pv); client.IgnoreNotFound(err) != nil {
+		return errors.Wrapf(err, "error removing the persistent volume %s of plugin volume %s/%s", pv.Name, pvc.Namespace, pvc.Name)
+	}
+	return nil
+}
+
+// getPluginVolumeOwner returns the AgentConfig that installed the plugins on the volume.
+func getPluginVolumeOwner(pvc *corev1.PersistentVolumeClaim) types.NamespacedName {
+	owner := types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Labels[porterv1.LabelResourceName]}
+	if owner.Name == "" {
+		if ref := metav1.GetControllerOf(pvc); ref != nil && ref.Kind == porterv1.KindAgentConfig {
+			owner.Name = ref.Name
+		}
+	}
+	return owner
+}
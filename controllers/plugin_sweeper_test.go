@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestAgentConfigReconciler_SweepPluginVolumes(t *testing.T) {
+	ctx := context.Background()
+
+	agentCfg := &porterv1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "default"},
+		Spec: porterv1.AgentConfigSpec{
+			PluginConfigFile: &porterv1.PluginFileSpec{
+				Plugins: map[string]porterv1.Plugin{"kubernetes": {Version: "v1.0.0"}},
+			},
+		},
+	}
+	usedHash := porterv1.NewPluginsList(agentCfg.Spec.PluginConfigFile.Plugins).GetLabels()[porterv1.LabelPluginsHash]
+
+	newPluginVolume := func(name string, hash string, unusedSince time.Time) *corev1.PersistentVolumeClaim {
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "test",
+				Name:      name,
+				Labels: map[string]string{
+					porterv1.LabelManaged:      "true",
+					porterv1.LabelPluginsHash:  hash,
+					porterv1.LabelResourceName: "default",
+				},
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{VolumeName: name},
+		}
+		if !unusedSince.IsZero() {
+			pvc.Annotations = map[string]string{porterv1.AnnotationPluginsUnusedSince: unusedSince.Format(time.RFC3339)}
+		}
+		return pvc
+	}
+	newPV := func(name string) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{porterv1.LabelPluginsHash: "abc"}},
+			Spec:       corev1.PersistentVolumeSpec{ClaimRef: &corev1.ObjectReference{Namespace: "test", Name: name}},
+		}
+	}
+
+	usedPVC := newPluginVolume("used", usedHash, time.Now().Add(-48*time.Hour))
+	newlyUnusedPVC := newPluginVolume("newly-unused", "abc", time.Time{})
+	expiredPVC := newPluginVolume("expired", "def", time.Now().Add(-25*time.Hour))
+	expiredPV := newPV("expired")
+	unmanagedPVC := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "unmanaged", Labels: map[string]string{porterv1.LabelPluginsHash: "ghi"}},
+	}
+
+	controller := setupAgentConfigController(agentCfg, usedPVC, newlyUnusedPVC, expiredPVC, expiredPV, unmanagedPVC)
+	controller.PluginVolumeSweeper.GracePeriod = 24 * time.Hour
+	require.NoError(t, controller.SweepPluginVolumes(ctx))
+
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(usedPVC), usedPVC), "a plugin volume that is used should be kept")
+	assert.NotContains(t, usedPVC.Annotations, porterv1.AnnotationPluginsUnusedSince, "a plugin volume that is used again should no longer be marked as unused")
+
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(newlyUnusedPVC), newlyUnusedPVC), "an unused plugin volume should be kept during the grace period")
+	assert.Contains(t, newlyUnusedPVC.Annotations, porterv1.AnnotationPluginsUnusedSince, "an unused plugin volume should be marked as unused")
+
+	err := controller.Get(ctx, client.ObjectKeyFromObject(expiredPVC), expiredPVC)
+	assert.True(t, apierrors.IsNotFound(err), "an unused plugin volume should be removed after the grace period, got %v", err)
+	err = controller.Get(ctx, client.ObjectKeyFromObject(expiredPV), expiredPV)
+	assert.True(t, apierrors.IsNotFound(err), "the persistent volume of a removed plugin volume should be removed, got %v", err)
+
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(unmanagedPVC), unmanagedPVC), "a volume that is not managed by the operator should be kept")
+
+	// Check that the unused volumes are reported on the AgentConfig that installed them
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(agentCfg), agentCfg))
+	require.Len(t, agentCfg.Status.UnusedPluginVolumes, 1)
+	unused := agentCfg.Status.UnusedPluginVolumes[0]
+	assert.Equal(t, "newly-unused", unused.Name)
+	assert.Equal(t, "abc", unused.PluginsHash)
+	assert.Equal(t, 24*time.Hour, unused.DeleteAfter.Sub(unused.UnusedSince.Time))
+
+	// Use the plugins on the unused volume again
+	newlyUnusedPVC.Labels[porterv1.LabelPluginsHash] = usedHash
+	require.NoError(t, controller.Update(ctx, newlyUnusedPVC))
+	require.NoError(t, controller.SweepPluginVolumes(ctx))
+
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(agentCfg), agentCfg))
+	assert.Empty(t, agentCfg.Status.UnusedPluginVolumes, "the volume should no longer be reported as unused")
+}
@@ -0,0 +1,219 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultPluginSource is the source of plugins that do not define a url, feed url or mirror.
+const defaultPluginSource = "https://cdn.porter.sh/plugins/atom.xml"
+
+// listedPlugin is a plugin in the output of porter plugins list -o json.
+type listedPlugin struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// syncInstalledPlugins reports the versions of the plugins installed on the plugin volume in the status of the AgentConfig.
+// Once the plugins are installed, it runs porter plugins list against the plugin volume and records the result,
+// so that the versions installed from a feed without a pinned version are known. It is only run once for each set of plugins.
+func (r *AgentConfigReconciler) syncInstalledPlugins(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter, pvc *corev1.PersistentVolumeClaim) error {
+	if r.PodLogs == nil {
+		log.V(Log5Trace).Info("Skipping the plugin version report because the pod logs cannot be read")
+		return nil
+	}
+
+	hash := agentCfg.Spec.Plugins.GetLabels()[porterv1.LabelPluginsHash]
+	if agentCfg.Status.InstalledPluginsHash == hash {
+		return nil
+	}
+
+	ctx, span := startSpan(ctx, "AgentConfig.syncInstalledPlugins")
+	defer span.End()
+
+	labels := getPluginsListActionLabels(agentCfg, hash)
+	var actions porterv1.AgentActionList
+	if err := r.List(ctx, &actions, client.InNamespace(agentCfg.Namespace), client.MatchingLabels(labels)); err != nil {
+		return errors.Wrap(err, "could not query for the plugins list agent action")
+	}
+	if len(actions.Items) == 0 {
+		return r.createPluginsListAction(ctx, log, pvc, agentCfg, labels)
+	}
+
+	action := actions.Items[0]
+	log = log.WithValues("agentaction", action.Name)
+	switch action.Status.Phase {
+	case porterv1.PhaseSucceeded:
+		if action.Status.Job == nil {
+			return nil
+		}
+		r.setInstalledPlugins(ctx, log, agentCfg, &action)
+	case porterv1.PhaseFailed:
+		r.Recorder.Event(&agentCfg.AgentConfig, "Warning", "PluginListFailed", fmt.Sprintf("porter agent action %s could not list the installed plugins", action.Name))
+		agentCfg.Status.InstalledPlugins = nil
+	default:
+		log.V(Log4Debug).Info("Waiting for the installed plugins to be listed")
+		return nil
+	}
+
+	log.V(Log4Debug).Info("Reporting the installed plugins", "plugins", len(agentCfg.Status.InstalledPlugins))
+	agentCfg.Status.InstalledPluginsHash = hash
+	return r.saveStatus(ctx, log, agentCfg)
+}
+
+// setInstalledPlugins records the plugins listed by the succeeded agent action in the status of the AgentConfig,
+// and flags the plugins that are not installed with the requested version.
+// The plugins are only listed once, so when the logs of the agent cannot be read, for example because its pod was removed,
+// the installed plugins are not reported instead of reading the logs again.
+func (r *AgentConfigReconciler) setInstalledPlugins(ctx context.Context, log logr.Logger, agentCfg *porterv1.AgentConfigAdapter, action *porterv1.AgentAction) {
+	logs, err := r.PodLogs.GetJobLogs(ctx, action.Namespace, action.Status.Job.Name, "porter-agent")
+	if err != nil {
+		log.V(Log4Debug).Info("Could not read the installed plugins", "error", err.Error())
+		r.Recorder.Event(&agentCfg.AgentConfig, "Warning", "PluginListFailed", fmt.Sprintf("could not read the output of porter plugins list: %s", err))
+		agentCfg.Status.InstalledPlugins = nil
+		return
+	}
+	listed, err := parsePluginsList(logs)
+	if err != nil {
+		log.V(Log4Debug).Info("Could not parse the installed plugins", "error", err.Error())
+		r.Recorder.Event(&agentCfg.AgentConfig, "Warning", "PluginListFailed", fmt.Sprintf("could not parse the output of porter plugins list: %s", err))
+		agentCfg.Status.InstalledPlugins = nil
+		return
+	}
+	agentCfg.Status.InstalledPlugins = compareInstalledPlugins(agentCfg.Spec.Plugins, listed)
+	if mismatches := getPluginVersionMismatches(agentCfg.Status.InstalledPlugins); len(mismatches) > 0 {
+		r.Recorder.Event(&agentCfg.AgentConfig, "Warning", "PluginVersionMismatch", fmt.Sprintf("the installed plugins do not match the requested versions: %s", strings.Join(mismatches, ", ")))
+	}
+}
+
+// getPluginsListActionLabels returns the labels of the agent action that lists the installed plugins.
+// The generation of the AgentConfig is not included, so that it is not found as the action that installs the plugins,
+// and the plugins are only listed again when they change.
+func getPluginsListActionLabels(agentCfg *porterv1.AgentConfigAdapter, hash string) map[string]string {
+	labels := getActionLabels(agentCfg)
+	delete(labels, porterv1.LabelResourceGeneration)
+	labels[porterv1.LabelPluginsHash] = hash
+	return labels
+}
+
+// createPluginsListAction creates an AgentAction that runs porter plugins list against the plugin volume.
+func (r *AgentConfigReconciler) createPluginsListAction(ctx context.Context, log logr.Logger, pvc *corev1.PersistentVolumeClaim, agentCfg *porterv1.AgentConfigAdapter, labels map[string]string) error {
+	action, err := r.newAgentAction(ctx, pvc, agentCfg, labels, []string{"plugins", "list", "-o", "json"})
+	if err != nil {
+		return err
+	}
+	for i := range action.Spec.VolumeMounts {
+		action.Spec.VolumeMounts[i].ReadOnly = true
+	}
+
+	if err = r.Create(ctx, action); err != nil {
+		return errors.Wrap(err, "error creating the porter agent action to list the installed plugins")
+	}
+	log.V(Log4Debug).Info("Created porter agent action to list the installed plugins", "name", action.Name)
+	return nil
+}
+
+// parsePluginsList reads the plugins from the output of porter plugins list -o json.
+// The output of the agent may have other lines before the list, which are skipped.
+func parsePluginsList(logs []byte) ([]listedPlugin, error) {
+	start := bytes.Index(logs, []byte("\n["))
+	if bytes.HasPrefix(logs, []byte("[")) {
+		start = 0
+	} else if start >= 0 {
+		start++
+	} else {
+		return nil, errors.New("no list of plugins found")
+	}
+
+	var plugins []listedPlugin
+	if err := json.NewDecoder(bytes.NewReader(logs[start:])).Decode(&plugins); err != nil {
+		return nil, errors.Wrap(err, "invalid list of plugins")
+	}
+	return plugins, nil
+}
+
+// compareInstalledPlugins combines the requested and installed plugins, and flags the
+// plugins that are not installed with the requested version.
+func compareInstalledPlugins(requested porterv1.PluginsConfigList, listed []listedPlugin) []porterv1.InstalledPlugin {
+	installed := make(map[string]string, len(listed))
+	for _, p := range listed {
+		installed[p.Name] = p.Version
+	}
+
+	result := make([]porterv1.InstalledPlugin, 0, len(listed))
+	for _, name := range requested.GetNames() {
+		spec, _ := requested.GetByName(name)
+		version, ok := installed[name]
+		delete(installed, name)
+
+		plugin := porterv1.InstalledPlugin{
+			Name:             name,
+			Version:          version,
+			RequestedVersion: spec.Version,
+			Source:           getPluginSource(spec),
+		}
+		plugin.VersionMismatch = !ok || !isRequestedPluginVersion(spec.Version, version)
+		result = append(result, plugin)
+	}
+
+	// Report the plugins that were installed without being requested, for example plugins that are included in the agent image
+	for _, p := range listed {
+		if _, ok := installed[p.Name]; ok {
+			result = append(result, porterv1.InstalledPlugin{Name: p.Name, Version: p.Version})
+		}
+	}
+	return result
+}
+
+// isRequestedPluginVersion determines if the installed version satisfies the requested version.
+// Any version satisfies a plugin that is not pinned to a version.
+func isRequestedPluginVersion(requested string, installed string) bool {
+	if requested == "" || requested == "latest" || requested == "canary" {
+		return true
+	}
+	return strings.TrimPrefix(requested, "v") == strings.TrimPrefix(installed, "v")
+}
+
+// getPluginSource returns where a plugin is installed from.
+func getPluginSource(p porterv1.Plugin) string {
+	switch {
+	case p.Source != nil:
+		return p.Source.String()
+	case p.URL != "":
+		return p.URL
+	case p.FeedURL != "":
+		return p.FeedURL
+	case p.Mirror != "":
+		return p.Mirror
+	default:
+		return defaultPluginSource
+	}
+}
+
+// getPluginVersionMismatches describes the plugins that are not installed with the requested version.
+func getPluginVersionMismatches(plugins []porterv1.InstalledPlugin) []string {
+	var mismatches []string
+	for _, p := range plugins {
+		if !p.VersionMismatch {
+			continue
+		}
+		requested, installed := p.RequestedVersion, p.Version
+		if requested == "" {
+			requested = "any version"
+		}
+		if installed == "" {
+			installed = "not installed"
+		}
+		mismatches = append(mismatches, fmt.Sprintf("%s requested %s, installed %s", p.Name, requested, installed))
+	}
+	return mismatches
+}
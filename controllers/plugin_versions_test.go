@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type testPodLogReader struct {
+	logs map[string][]byte
+}
+
+func (r testPodLogReader) GetJobLogs(ctx context.Context, namespace string, job string, container string) ([]byte, error) {
+	logs, ok := r.logs[job]
+	if !ok {
+		return nil, errors.Errorf("no pods found for job %s/%s", namespace, job)
+	}
+	return logs, nil
+}
+
+func TestParsePluginsList(t *testing.T) {
+	t.Run("json only", func(t *testing.T) {
+		plugins, err := parsePluginsList([]byte(`[{"name":"kubernetes","version":"v1.0.0"}]`))
+		require.NoError(t, err)
+		assert.Equal(t, []listedPlugin{{Name: "kubernetes", Version: "v1.0.0"}}, plugins)
+	})
+
+	t.Run("agent output before the list", func(t *testing.T) {
+		logs := "porter version v1.0.0\n[\n  {\"name\": \"kubernetes\", \"version\": \"v1.0.0\"}\n]\nexecution completed successfully!\n"
+		plugins, err := parsePluginsList([]byte(logs))
+		require.NoError(t, err)
+		assert.Equal(t, []listedPlugin{{Name: "kubernetes", Version: "v1.0.0"}}, plugins)
+	})
+
+	t.Run("no list", func(t *testing.T) {
+		_, err := parsePluginsList([]byte("porter version v1.0.0\n"))
+		require.ErrorContains(t, err, "no list of plugins found")
+	})
+}
+
+func TestCompareInstalledPlugins(t *testing.T) {
+	requested := porterv1.NewPluginsList(map[string]porterv1.Plugin{
+		"azure":      {Version: "v1.2.0", FeedURL: "https://example.com/atom.xml"},
+		"kubernetes": {Version: "v1.0.0"},
+		"mongodb":    {},
+		"missing":    {Version: "v0.1.0", URL: "https://example.com/missing"},
+	})
+	listed := []listedPlugin{
+		{Name: "azure", Version: "v1.2.0"},
+		{Name: "kubernetes", Version: "v1.0.1"},
+		{Name: "mongodb", Version: "v0.5.0"},
+		{Name: "docker", Version: "v0.1.0"},
+	}
+
+	installed := compareInstalledPlugins(requested, listed)
+	assert.Equal(t, []porterv1.InstalledPlugin{
+		{Name: "azure", Version: "v1.2.0", RequestedVersion: "v1.2.0", Source: "https://example.com/atom.xml"},
+		{Name: "kubernetes", Version: "v1.0.1", RequestedVersion: "v1.0.0", Source: defaultPluginSource, VersionMismatch: true},
+		{Name: "missing", RequestedVersion: "v0.1.0", Source: "https://example.com/missing", VersionMismatch: true},
+		{Name: "mongodb", Version: "v0.5.0", Source: defaultPluginSource},
+		{Name: "docker", Version: "v0.1.0"},
+	}, installed)
+
+	assert.Equal(t, []string{
+		"kubernetes requested v1.0.0, installed v1.0.1",
+		"missing requested v0.1.0, installed not installed",
+	}, getPluginVersionMismatches(installed))
+}
+
+func TestAgentConfigReconciler_syncInstalledPlugins(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := &porterv1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test", Generation: 1},
+		Spec: porterv1.AgentConfigSpec{
+			PluginConfigFile: &porterv1.PluginFileSpec{SchemaVersion: "1.0.0", Plugins: map[string]porterv1.Plugin{"kubernetes": {Version: "v1.0.0"}}},
+		},
+	}
+	controller := setupAgentConfigController(cfg)
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(cfg), cfg))
+	agentCfg := porterv1.NewAgentConfigAdapter(*cfg)
+	hash := agentCfg.Spec.Plugins.GetLabels()[porterv1.LabelPluginsHash]
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: agentCfg.GetPluginsPVCName(), Namespace: "test"}}
+
+	controller.PodLogs = testPodLogReader{logs: map[string][]byte{
+		"list-plugins": []byte(`[{"name":"kubernetes","version":"v1.0.1"}]`),
+	}}
+	recorder := controller.Recorder.(*record.FakeRecorder)
+
+	// The first sync starts listing the installed plugins
+	require.NoError(t, controller.syncInstalledPlugins(ctx, logr.Discard(), agentCfg, pvc))
+	var actions porterv1.AgentActionList
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace("test")))
+	require.Len(t, actions.Items, 1, "an agent action should be created to list the installed plugins")
+	action := actions.Items[0]
+	assert.Equal(t, []string{"plugins", "list", "-o", "json"}, action.Spec.Args)
+	assert.Equal(t, hash, action.Labels[porterv1.LabelPluginsHash])
+	assert.NotContains(t, action.Labels, porterv1.LabelResourceGeneration, "the action should not be mistaken for the action that installs the plugins")
+	require.Len(t, action.Spec.VolumeMounts, 1)
+	assert.True(t, action.Spec.VolumeMounts[0].ReadOnly, "the plugin volume should be mounted read-only")
+
+	// Nothing is reported until the action completes
+	require.NoError(t, controller.syncInstalledPlugins(ctx, logr.Discard(), agentCfg, pvc))
+	assert.Empty(t, agentCfg.Status.InstalledPlugins)
+
+	action.Status.Phase = porterv1.PhaseSucceeded
+	action.Status.Job = &corev1.LocalObjectReference{Name: "list-plugins"}
+	require.NoError(t, controller.Update(ctx, &action))
+
+	require.NoError(t, controller.syncInstalledPlugins(ctx, logr.Discard(), agentCfg, pvc))
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(cfg), cfg))
+	assert.Equal(t, hash, cfg.Status.InstalledPluginsHash)
+	assert.Equal(t, []porterv1.InstalledPlugin{
+		{Name: "kubernetes", Version: "v1.0.1", RequestedVersion: "v1.0.0", Source: defaultPluginSource, VersionMismatch: true},
+	}, cfg.Status.InstalledPlugins)
+	assert.Contains(t, <-recorder.Events, "PluginVersionMismatch")
+
+	// The plugins are only listed once for each set of plugins
+	require.NoError(t, controller.syncInstalledPlugins(ctx, logr.Discard(), agentCfg, pvc))
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace("test")))
+	assert.Len(t, actions.Items, 1)
+}
+
+func TestAgentConfigReconciler_syncInstalledPlugins_PodRemoved(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := &porterv1.AgentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test", Generation: 1},
+		Spec: porterv1.AgentConfigSpec{
+			PluginConfigFile: &porterv1.PluginFileSpec{SchemaVersion: "1.0.0", Plugins: map[string]porterv1.Plugin{"kubernetes": {Version: "v1.0.0"}}},
+		},
+	}
+	controller := setupAgentConfigController(cfg)
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(cfg), cfg))
+	agentCfg := porterv1.NewAgentConfigAdapter(*cfg)
+	hash := agentCfg.Spec.Plugins.GetLabels()[porterv1.LabelPluginsHash]
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: agentCfg.GetPluginsPVCName(), Namespace: "test"}}
+
+	// The pod of the action was removed, so its logs cannot be read
+	controller.PodLogs = testPodLogReader{}
+	recorder := controller.Recorder.(*record.FakeRecorder)
+
+	require.NoError(t, controller.syncInstalledPlugins(ctx, logr.Discard(), agentCfg, pvc))
+	var actions porterv1.AgentActionList
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace("test")))
+	require.Len(t, actions.Items, 1)
+	action := actions.Items[0]
+	action.Status.Phase = porterv1.PhaseSucceeded
+	action.Status.Job = &corev1.LocalObjectReference{Name: "list-plugins"}
+	require.NoError(t, controller.Update(ctx, &action))
+
+	require.NoError(t, controller.syncInstalledPlugins(ctx, logr.Discard(), agentCfg, pvc), "the AgentConfig should not be reconciled again until the logs are available")
+	assert.Contains(t, <-recorder.Events, "PluginListFailed")
+	require.NoError(t, controller.Get(ctx, client.ObjectKeyFromObject(cfg), cfg))
+	assert.Equal(t, hash, cfg.Status.InstalledPluginsHash, "the plugins should not be listed again")
+	assert.Empty(t, cfg.Status.InstalledPlugins)
+}
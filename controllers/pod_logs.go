@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+var _ PodLogReader = &KubernetesPodLogReader{}
+
+// KubernetesPodLogReader reads the logs of pods from the Kubernetes API.
+// Logs are not supported by the controller-runtime client, so it uses a clientset,
+// which also avoids caching every pod in the cluster.
+type KubernetesPodLogReader struct {
+	Clientset kubernetes.Interface
+}
+
+// NewPodLogReader creates a PodLogReader that uses the connection to the Kubernetes API of the manager.
+func NewPodLogReader(cfg *rest.Config) (*KubernetesPodLogReader, error) {
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating a kubernetes clientset to read pod logs")
+	}
+	return &KubernetesPodLogReader{Clientset: clientset}, nil
+}
+
+// GetJobLogs returns the logs of the container of the most recent pod of a job.
+func (r *KubernetesPodLogReader) GetJobLogs(ctx context.Context, namespace string, job string, container string) ([]byte, error) {
+	// Use the legacy job-name label, which is set by every version of Kubernetes
+	pods, err := r.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", job),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing the pods of job %s/%s", namespace, job)
+	}
+
+	var latest *corev1.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if latest == nil || latest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			latest = pod
+		}
+	}
+	if latest == nil {
+		return nil, errors.Errorf("no pods found for job %s/%s", namespace, job)
+	}
+
+	logs, err := r.Clientset.CoreV1().Pods(namespace).GetLogs(latest.Name, &corev1.PodLogOptions{Container: container}).DoRaw(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error retrieving the logs of pod %s/%s", namespace, latest.Name)
+	}
+	return logs, nil
+}
@@ -0,0 +1,284 @@
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	installationv1 "get.porter.sh/porter/gen/proto/go/porterapis/installation/v1alpha1"
+	porterv1alpha1 "get.porter.sh/porter/gen/proto/go/porterapis/porter/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultPorterGRPCAddress is the address of the Porter gRPC service installed with the operator.
+	DefaultPorterGRPCAddress = "porter-grpc-service:3001"
+)
+
+// PorterGRPCOptions configures the connection to the Porter gRPC server.
+type PorterGRPCOptions struct {
+	// Address of the Porter gRPC server. The connection is disabled when empty.
+	Address string
+
+	// TLS enables TLS when connecting to the server.
+	TLS bool
+
+	// CAFile is the path to a PEM encoded CA bundle used to verify the server.
+	// The system certificate pool is used when empty.
+	CAFile string
+
+	// CertFile is the path to a PEM encoded client certificate.
+	CertFile string
+
+	// KeyFile is the path to the PEM encoded private key of the client certificate.
+	KeyFile string
+
+	// ServerName overrides the server name used to verify the server certificate.
+	ServerName string
+
+	// ConnectTimeout is the minimum amount of time to wait for a connection attempt to complete.
+	ConnectTimeout time.Duration
+
+	// CallTimeout limits how long a single call to the server may take.
+	CallTimeout time.Duration
+
+	// KeepaliveTime is how long the connection is idle before the client pings the server.
+	KeepaliveTime time.Duration
+
+	// KeepaliveTimeout is how long the client waits for a ping response before closing the connection.
+	KeepaliveTimeout time.Duration
+
+	// MaxBackoffDelay is the upper bound of the delay between reconnect attempts.
+	MaxBackoffDelay time.Duration
+
+	// ReadinessCheck reports the operator as not ready while the server is unreachable.
+	ReadinessCheck bool
+}
+
+// BindFlags registers flags for the Porter gRPC connection options.
+func (o *PorterGRPCOptions) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Address, "porter-grpc-address", DefaultPorterGRPCAddress, "The address of the Porter gRPC server. Set to an empty string to disable syncing installation outputs.")
+	fs.BoolVar(&o.TLS, "porter-grpc-tls", false, "Use TLS when connecting to the Porter gRPC server.")
+	fs.StringVar(&o.CAFile, "porter-grpc-ca-file", "", "Path to a PEM encoded CA bundle used to verify the Porter gRPC server. Defaults to the system certificate pool.")
+	fs.StringVar(&o.CertFile, "porter-grpc-cert-file", "", "Path to a PEM encoded client certificate used to authenticate with the Porter gRPC server.")
+	fs.StringVar(&o.KeyFile, "porter-grpc-key-file", "", "Path to the PEM encoded private key for --porter-grpc-cert-file.")
+	fs.StringVar(&o.ServerName, "porter-grpc-server-name", "", "Override the server name used to verify the Porter gRPC server certificate.")
+	fs.DurationVar(&o.ConnectTimeout, "porter-grpc-connect-timeout", 20*time.Second, "Minimum time to wait for a connection attempt to the Porter gRPC server to complete.")
+	fs.DurationVar(&o.CallTimeout, "porter-grpc-call-timeout", 30*time.Second, "Maximum time a single call to the Porter gRPC server may take.")
+	fs.DurationVar(&o.KeepaliveTime, "porter-grpc-keepalive-time", 30*time.Second, "Idle time before the connection to the Porter gRPC server is checked with a ping.")
+	fs.DurationVar(&o.KeepaliveTimeout, "porter-grpc-keepalive-timeout", 10*time.Second, "Time to wait for a ping response from the Porter gRPC server before the connection is closed.")
+	fs.DurationVar(&o.MaxBackoffDelay, "porter-grpc-max-backoff", 2*time.Minute, "Maximum delay between attempts to reconnect to the Porter gRPC server.")
+	fs.BoolVar(&o.ReadinessCheck, "porter-grpc-readiness-check", false, "Report the operator as not ready while the Porter gRPC server is unreachable.")
+}
+
+// Validate checks that the options are consistent.
+func (o PorterGRPCOptions) Validate() error {
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return errors.New("both --porter-grpc-cert-file and --porter-grpc-key-file must be specified to use a client certificate")
+	}
+	if !o.TLS && (o.CAFile != "" || o.CertFile != "" || o.ServerName != "") {
+		return errors.New("--porter-grpc-tls must be enabled to use a CA bundle, client certificate or server name")
+	}
+	return nil
+}
+
+func (o PorterGRPCOptions) transportCredentials() (credentials.TransportCredentials, error) {
+	if !o.TLS {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: o.ServerName,
+	}
+
+	if o.CAFile != "" {
+		caB, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading the porter grpc CA bundle")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caB) {
+			return nil, errors.Errorf("no certificates found in the porter grpc CA bundle %s", o.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if o.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "error loading the porter grpc client certificate")
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(tlsCfg), nil
+}
+
+func (o PorterGRPCOptions) dialOptions() ([]grpc.DialOption, error) {
+	creds, err := o.transportCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	backoffCfg := backoff.DefaultConfig
+	if o.MaxBackoffDelay > 0 {
+		backoffCfg.MaxDelay = o.MaxBackoffDelay
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoffCfg,
+			MinConnectTimeout: o.ConnectTimeout,
+		}),
+		grpc.WithChainUnaryInterceptor(observePorterGRPCCall),
+	}
+	if o.KeepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                o.KeepaliveTime,
+			Timeout:             o.KeepaliveTimeout,
+			PermitWithoutStream: true,
+		}))
+	}
+	return opts, nil
+}
+
+// observePorterGRPCCall records the latency of calls to the Porter gRPC server.
+func observePorterGRPCCall(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	porterGRPCDuration.WithLabelValues(path.Base(method), status.Code(err).String()).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// PorterGRPCConnection is a managed connection to the Porter gRPC server.
+// The connection is established in the background and re-established with
+// backoff whenever it is lost, so the server does not need to be available
+// when the operator starts.
+type PorterGRPCConnection struct {
+	Log  logr.Logger
+	opts PorterGRPCOptions
+	conn *grpc.ClientConn
+}
+
+// NewPorterGRPCConnection configures a connection to the Porter gRPC server.
+// It does not wait for the server to be available.
+func NewPorterGRPCConnection(log logr.Logger, opts PorterGRPCOptions) (*PorterGRPCConnection, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	dialOpts, err := opts.dialOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.Dial(opts.Address, dialOpts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error configuring the connection to the porter grpc server %s", opts.Address)
+	}
+
+	return &PorterGRPCConnection{
+		Log:  log.WithValues("address", opts.Address),
+		opts: opts,
+		conn: conn,
+	}, nil
+}
+
+// Client returns a PorterClient that uses this connection.
+func (c *PorterGRPCConnection) Client() PorterClient {
+	return &timeoutPorterClient{
+		client:  porterv1alpha1.NewPorterClient(c.conn),
+		timeout: c.opts.CallTimeout,
+	}
+}
+
+// CheckConnection returns an error when the connection to the Porter gRPC server is not usable.
+func (c *PorterGRPCConnection) CheckConnection() error {
+	switch state := c.conn.GetState(); state {
+	case connectivity.Ready:
+		return nil
+	case connectivity.Idle:
+		// An idle connection is healthy, it reconnects on the next call.
+		c.conn.Connect()
+		return nil
+	default:
+		return errors.Errorf("connection to the porter grpc server %s is %s", c.opts.Address, state)
+	}
+}
+
+// ReadyzCheck implements healthz.Checker using the state of the connection.
+func (c *PorterGRPCConnection) ReadyzCheck(_ *http.Request) error {
+	return c.CheckConnection()
+}
+
+// Start watches the connection, logging state changes and reconnecting when it
+// becomes idle, until the context is cancelled. It implements manager.Runnable.
+func (c *PorterGRPCConnection) Start(ctx context.Context) error {
+	defer c.Close()
+
+	c.conn.Connect()
+	state := c.conn.GetState()
+	for {
+		c.Log.V(Log2ApplicationState).Info("Porter grpc connection state", "state", state.String())
+		if state == connectivity.Idle {
+			c.conn.Connect()
+		}
+
+		if !c.conn.WaitForStateChange(ctx, state) {
+			// The context was cancelled
+			return nil
+		}
+		state = c.conn.GetState()
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable so that the
+// connection is monitored on every replica.
+func (c *PorterGRPCConnection) NeedLeaderElection() bool {
+	return false
+}
+
+// Close the connection to the Porter gRPC server.
+func (c *PorterGRPCConnection) Close() error {
+	return c.conn.Close()
+}
+
+// timeoutPorterClient applies a timeout to each call made to the Porter gRPC server.
+type timeoutPorterClient struct {
+	client  PorterClient
+	timeout time.Duration
+}
+
+func (c *timeoutPorterClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+func (c *timeoutPorterClient) ListInstallations(ctx context.Context, in *installationv1.ListInstallationsRequest, opts ...grpc.CallOption) (*installationv1.ListInstallationsResponse, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return c.client.ListInstallations(ctx, in, opts...)
+}
+
+func (c *timeoutPorterClient) ListInstallationLatestOutputs(ctx context.Context, in *installationv1.ListInstallationLatestOutputRequest, opts ...grpc.CallOption) (*installationv1.ListInstallationLatestOutputResponse, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return c.client.ListInstallationLatestOutputs(ctx, in, opts...)
+}
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPorterGRPCOptions_Validate(t *testing.T) {
+	testcases := []struct {
+		name    string
+		opts    PorterGRPCOptions
+		wantErr string
+	}{
+		{name: "insecure", opts: PorterGRPCOptions{Address: DefaultPorterGRPCAddress}},
+		{name: "tls with system roots", opts: PorterGRPCOptions{Address: DefaultPorterGRPCAddress, TLS: true}},
+		{name: "mutual tls", opts: PorterGRPCOptions{Address: DefaultPorterGRPCAddress, TLS: true, CAFile: "ca.pem", CertFile: "tls.crt", KeyFile: "tls.key"}},
+		{name: "cert without key", opts: PorterGRPCOptions{Address: DefaultPorterGRPCAddress, TLS: true, CertFile: "tls.crt"}, wantErr: "both --porter-grpc-cert-file and --porter-grpc-key-file"},
+		{name: "ca without tls", opts: PorterGRPCOptions{Address: DefaultPorterGRPCAddress, CAFile: "ca.pem"}, wantErr: "--porter-grpc-tls must be enabled"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.opts.Validate()
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewPorterGRPCConnection(t *testing.T) {
+	t.Run("does not wait for the server", func(t *testing.T) {
+		conn, err := NewPorterGRPCConnection(logr.Discard(), PorterGRPCOptions{Address: "localhost:0"})
+		require.NoError(t, err)
+		defer conn.Close()
+		assert.NotNil(t, conn.Client())
+	})
+
+	t.Run("missing CA bundle", func(t *testing.T) {
+		_, err := NewPorterGRPCConnection(logr.Discard(), PorterGRPCOptions{Address: "localhost:0", TLS: true, CAFile: "missing.pem"})
+		assert.ErrorContains(t, err, "error reading the porter grpc CA bundle")
+	})
+}
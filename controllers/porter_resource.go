@@ -13,6 +13,7 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
@@ -98,6 +99,27 @@ func applyAgentAction(log logr.Logger, resource PorterResource, action *porterv1
 	resource.SetStatus(status)
 }
 
+// recordAgentActionEvent emits an event on the resource when the phase of its agent action changes.
+func recordAgentActionEvent(recorder record.EventRecorder, resource PorterResource, origPhase porterv1.AgentPhase, action *porterv1.AgentAction) {
+	phase := resource.GetStatus().Phase
+	if action == nil || phase == origPhase {
+		return
+	}
+
+	switch phase {
+	case porterv1.PhaseRunning:
+		recorder.Eventf(resource, "Normal", "AgentActionStarted", "porter agent action %s started", action.Name)
+	case porterv1.PhaseSucceeded:
+		recorder.Eventf(resource, "Normal", "AgentActionSucceeded", "porter agent action %s succeeded", action.Name)
+	case porterv1.PhaseFailed:
+		job := ""
+		if action.Status.Job != nil {
+			job = action.Status.Job.Name
+		}
+		recorder.Eventf(resource, "Warning", "AgentActionFailed", "porter agent action %s failed, see the logs of job %s for details", action.Name, job)
+	}
+}
+
 // isDeleted checks whether a porter resource is deleted.
 func isDeleted(resource PorterResource) bool {
 	timestamp := resource.GetDeletionTimestamp()
@@ -120,7 +142,7 @@ func isFinalizerSet(resource PorterResource) bool {
 }
 
 // ensureFinalizerSet sets a finalizer on the resource and saves it, if necessary.
-func ensureFinalizerSet(ctx context.Context, log logr.Logger, client client.Client, resource PorterResource) (updated bool, err error) {
+func ensureFinalizerSet(ctx context.Context, log logr.Logger, clnt client.Client, resource PorterResource) (updated bool, err error) {
 	// Ensure all resources have a finalizer to we can react when they are deleted
 	if !isDeleted(resource) {
 		// The object is not being deleted, so if it does not have our finalizer,
@@ -128,8 +150,10 @@ func ensureFinalizerSet(ctx context.Context, log logr.Logger, client client.Clie
 		// registering our finalizer.
 		if !isFinalizerSet(resource) {
 			log.V(Log5Trace).Info("adding finalizer")
+			// Patch only the finalizers, so that the fields of the spec that are explicitly set to null are kept
+			patch := client.MergeFrom(resource.DeepCopyObject().(client.Object))
 			controllerutil.AddFinalizer(resource, porterv1.FinalizerName)
-			return true, client.Update(ctx, resource)
+			return true, clnt.Patch(ctx, resource, patch)
 		}
 	}
 	return false, nil
@@ -7,7 +7,10 @@ import (
 	porterv1 "get.porter.sh/operator/api/v1"
 	"github.com/go-logr/logr"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
@@ -136,3 +139,41 @@ func TestRemoveFinalizer(t *testing.T) {
 	err := removeFinalizer(ctx, logr.Discard(), client.Client, inst)
 	assert.NoError(t, err)
 }
+
+func Test_recordAgentActionEvent(t *testing.T) {
+	action := &porterv1.AgentAction{
+		ObjectMeta: metav1.ObjectMeta{Name: "myinstall-abc"},
+		Status: porterv1.AgentActionStatus{
+			Job: &corev1.LocalObjectReference{Name: "myinstall-abc-xyz"},
+		},
+	}
+
+	testcases := []struct {
+		name      string
+		origPhase porterv1.AgentPhase
+		phase     porterv1.AgentPhase
+		wantEvent string
+	}{
+		{name: "pending", origPhase: porterv1.PhaseUnknown, phase: porterv1.PhasePending},
+		{name: "started", origPhase: porterv1.PhasePending, phase: porterv1.PhaseRunning, wantEvent: "Normal AgentActionStarted porter agent action myinstall-abc started"},
+		{name: "succeeded", origPhase: porterv1.PhaseRunning, phase: porterv1.PhaseSucceeded, wantEvent: "Normal AgentActionSucceeded porter agent action myinstall-abc succeeded"},
+		{name: "failed", origPhase: porterv1.PhaseRunning, phase: porterv1.PhaseFailed, wantEvent: "Warning AgentActionFailed porter agent action myinstall-abc failed, see the logs of job myinstall-abc-xyz for details"},
+		{name: "unchanged", origPhase: porterv1.PhaseFailed, phase: porterv1.PhaseFailed},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(1)
+			inst := &porterv1.Installation{}
+			inst.Status.Phase = tc.phase
+
+			recordAgentActionEvent(recorder, inst, tc.origPhase, action)
+
+			if tc.wantEvent == "" {
+				assert.Empty(t, recorder.Events)
+			} else {
+				require.Len(t, recorder.Events, 1)
+				assert.Equal(t, tc.wantEvent, <-recorder.Events)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"sort"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// secretSourceIndexKey indexes the credential sets by the namespace/name of each Secret
+	// that they resolve with a secretKeyRef source.
+	secretSourceIndexKey = "secretSource"
+
+	// configMapSourceIndexKey indexes the parameter sets by the namespace/name of each ConfigMap
+	// that they resolve with a configMapKeyRef or fileFromConfigMap source.
+	configMapSourceIndexKey = "configMapSource"
+)
+
+// errInvalidSource is returned when a source of a credential or parameter set that is resolved by the operator does not exist.
+var errInvalidSource = errors.New("invalid source")
+
+// validateSecretKeyRefs checks that the keys of the Kubernetes Secrets referenced by a credential or parameter set exist.
+// A missing optional key is ignored, the agent runs without the environment variable.
+func validateSecretKeyRefs(ctx context.Context, c client.Client, namespace string, refs []corev1.SecretKeySelector) error {
+	for _, ref := range refs {
+		optional := ref.Optional != nil && *ref.Optional
+
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, secret); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return errors.Wrapf(err, "error retrieving secret %s", ref.Name)
+			}
+			if optional {
+				continue
+			}
+			return errors.Wrapf(errInvalidSource, "secret %s not found", ref.Name)
+		}
+		if _, ok := secret.Data[ref.Key]; !ok && !optional {
+			return errors.Wrapf(errInvalidSource, "key %s not found in secret %s", ref.Key, ref.Name)
+		}
+	}
+	return nil
+}
+
+// validateConfigMapKeyRefs checks that the keys of the ConfigMaps referenced by a parameter set exist.
+// A missing optional key is ignored.
+func validateConfigMapKeyRefs(ctx context.Context, c client.Client, namespace string, refs []corev1.ConfigMapKeySelector) error {
+	for _, ref := range refs {
+		optional := ref.Optional != nil && *ref.Optional
+
+		cm := &corev1.ConfigMap{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, cm); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return errors.Wrapf(err, "error retrieving configmap %s", ref.Name)
+			}
+			if optional {
+				continue
+			}
+			return errors.Wrapf(errInvalidSource, "configmap %s not found", ref.Name)
+		}
+		_, hasData := cm.Data[ref.Key]
+		_, hasBinaryData := cm.BinaryData[ref.Key]
+		if !hasData && !hasBinaryData && !optional {
+			return errors.Wrapf(errInvalidSource, "key %s not found in configmap %s", ref.Key, ref.Name)
+		}
+	}
+	return nil
+}
+
+func indexCredentialSetBySecret(obj client.Object) []string {
+	cs := obj.(*porterv1.CredentialSet)
+	refs := cs.Spec.GetSecretKeyRefs()
+	values := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		values = append(values, cs.Namespace+"/"+ref.Name)
+	}
+	return values
+}
+
+func indexParameterSetByConfigMap(obj client.Object) []string {
+	ps := obj.(*porterv1.ParameterSet)
+	refs := ps.Spec.GetConfigMapKeyRefs()
+	values := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		values = append(values, ps.Namespace+"/"+ref.Name)
+	}
+	return values
+}
+
+// listResourcesUsingSource requests the credential or parameter sets that resolve a source from a Secret or ConfigMap,
+// so that the sources are resolved again when it is created or changed.
+func listResourcesUsingSource(ctx context.Context, c client.Client, log logr.Logger, list client.ObjectList, indexKey string, source client.Object) []reconcile.Request {
+	key := source.GetNamespace() + "/" + source.GetName()
+	if err := c.List(ctx, list, client.MatchingFields{indexKey: key}); err != nil {
+		log.V(Log0Error).Error(err, "Could not list the resources that use a source", indexKey, key)
+		return nil
+	}
+
+	items, err := apimeta.ExtractList(list)
+	if err != nil {
+		log.V(Log0Error).Error(err, "Could not list the resources that use a source", indexKey, key)
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(items))
+	for _, item := range items {
+		obj := item.(client.Object)
+		log.V(Log4Debug).Info("Requeuing resource because its source changed", "namespace", obj.GetNamespace(), "name", obj.GetName(), indexKey, key)
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}})
+	}
+	return requests
+}
+
+// setSourcesNotResolvedCondition flags a credential or parameter set with a source that does not exist.
+func setSourcesNotResolvedCondition(resource PorterResource, err error) {
+	status := resource.GetStatus()
+	apimeta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               string(porterv1.ConditionSourcesResolved),
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: resource.GetGeneration(),
+		Reason:             "SourceNotFound",
+		Message:            err.Error(),
+	})
+	resource.SetStatus(status)
+}
+
+// keepSourcesResolvedCondition copies the condition set when the sources were resolved, which is not reported by
+// an agent action because the agent is only run once the sources exist.
+func keepSourcesResolvedCondition(resource PorterResource, origStatus porterv1.PorterResourceStatus) {
+	cond := apimeta.FindStatusCondition(origStatus.Conditions, string(porterv1.ConditionSourcesResolved))
+	if cond == nil || cond.ObservedGeneration != resource.GetGeneration() {
+		return
+	}
+	status := resource.GetStatus()
+	apimeta.SetStatusCondition(&status.Conditions, *cond)
+	resource.SetStatus(status)
+}
+
+// agentSources are the sources of the credential and parameter sets used by an installation that are resolved
+// by the operator, and projected into the Porter Agent pod so that Porter reads them with an env or path source.
+type agentSources struct {
+	Env          []corev1.EnvVar
+	Volumes      []corev1.Volume
+	VolumeMounts []corev1.VolumeMount
+
+	added map[string]bool
+	files map[string]*corev1.ConfigMapVolumeSource
+}
+
+// addSecretKeyRef passes a key of a Secret as an environment variable.
+func (s *agentSources) addSecretKeyRef(ref corev1.SecretKeySelector) {
+	s.addEnv(porterv1.GetSecretKeyRefEnvName(ref), &corev1.EnvVarSource{SecretKeyRef: ref.DeepCopy()})
+}
+
+// addConfigMapKeyRef passes a key of a ConfigMap as an environment variable.
+func (s *agentSources) addConfigMapKeyRef(ref corev1.ConfigMapKeySelector) {
+	s.addEnv(porterv1.GetConfigMapKeyRefEnvName(ref), &corev1.EnvVarSource{ConfigMapKeyRef: ref.DeepCopy()})
+}
+
+func (s *agentSources) addEnv(name string, source *corev1.EnvVarSource) {
+	if s.added[name] {
+		return
+	}
+	s.added[name] = true
+	s.Env = append(s.Env, corev1.EnvVar{Name: name, ValueFrom: source})
+}
+
+// addFileFromConfigMap mounts a key of a ConfigMap as a file, with a single volume for each ConfigMap.
+func (s *agentSources) addFileFromConfigMap(ref corev1.ConfigMapKeySelector) {
+	filePath := porterv1.GetFileFromConfigMapPath(ref)
+	if s.added[filePath] {
+		return
+	}
+	s.added[filePath] = true
+
+	volume, ok := s.files[ref.Name]
+	if !ok {
+		volume = &corev1.ConfigMapVolumeSource{LocalObjectReference: ref.LocalObjectReference}
+		s.files[ref.Name] = volume
+	}
+	volume.Items = append(volume.Items, corev1.KeyToPath{Key: ref.Key, Path: ref.Key})
+	// The volume is only optional when all of its keys are
+	if ref.Optional == nil || !*ref.Optional {
+		volume.Optional = ptr.To(false)
+	} else if volume.Optional == nil {
+		volume.Optional = ptr.To(true)
+	}
+}
+
+// getSourceVolumeName returns a valid volume name for the files of a ConfigMap.
+func getSourceVolumeName(configMapName string) string {
+	sum := md5.Sum([]byte(configMapName))
+	return "porter-source-" + hex.EncodeToString(sum[:4])
+}
+
+// getInstallationSources returns the sources resolved by the operator of the credential and parameter sets
+// used by an installation.
+func getInstallationSources(ctx context.Context, c client.Client, inst *porterv1.Installation) (agentSources, error) {
+	sources := agentSources{added: map[string]bool{}, files: map[string]*corev1.ConfigMapVolumeSource{}}
+
+	if len(inst.Spec.CredentialSets) > 0 {
+		var credSets porterv1.CredentialSetList
+		if err := c.List(ctx, &credSets, client.InNamespace(inst.Namespace)); err != nil {
+			return agentSources{}, errors.Wrap(err, "error listing the credential sets used by the installation")
+		}
+		for _, cs := range credSets.Items {
+			if !usesSet(inst, inst.Spec.CredentialSets, cs.Spec.Namespace, cs.Spec.Name) {
+				continue
+			}
+			for _, ref := range cs.Spec.GetSecretKeyRefs() {
+				sources.addSecretKeyRef(ref)
+			}
+		}
+	}
+
+	if len(inst.Spec.ParameterSets) > 0 {
+		var paramSets porterv1.ParameterSetList
+		if err := c.List(ctx, &paramSets, client.InNamespace(inst.Namespace)); err != nil {
+			return agentSources{}, errors.Wrap(err, "error listing the parameter sets used by the installation")
+		}
+		for _, ps := range paramSets.Items {
+			if !usesSet(inst, inst.Spec.ParameterSets, ps.Spec.Namespace, ps.Spec.Name) {
+				continue
+			}
+			for _, param := range ps.Spec.Parameters {
+				if ref := param.Source.ConfigMapKeyRef; ref != nil {
+					sources.addConfigMapKeyRef(*ref)
+				}
+				if ref := param.Source.FileFromConfigMap; ref != nil {
+					sources.addFileFromConfigMap(*ref)
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(sources.files))
+	for name := range sources.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		volumeName := getSourceVolumeName(name)
+		sources.Volumes = append(sources.Volumes, corev1.Volume{
+			Name:         volumeName,
+			VolumeSource: corev1.VolumeSource{ConfigMap: sources.files[name]},
+		})
+		sources.VolumeMounts = append(sources.VolumeMounts, corev1.VolumeMount{
+			Name:      volumeName,
+			MountPath: porterv1.GetConfigMapSourcePath(name),
+			ReadOnly:  true,
+		})
+	}
+	return sources, nil
+}
+
+// usesSet determines if an installation uses a credential or parameter set, which is referenced by its name in Porter.
+func usesSet(inst *porterv1.Installation, names []string, porterNamespace string, porterName string) bool {
+	if porterNamespace != inst.Spec.Namespace {
+		return false
+	}
+	for _, name := range names {
+		if name == porterName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestValidateSecretKeyRefs(t *testing.T) {
+	ctx := context.Background()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "db"},
+		Data:       map[string][]byte{"password": []byte("topsecret")},
+	}
+	controller := setupCredentialSetController(secret)
+	newRef := func(name string, key string) corev1.SecretKeySelector {
+		return corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+	}
+
+	testcases := []struct {
+		name    string
+		ref     corev1.SecretKeySelector
+		wantErr string
+	}{
+		{name: "key exists", ref: newRef("db", "password")},
+		{name: "missing secret", ref: newRef("missing", "password"), wantErr: "secret missing not found"},
+		{name: "missing key", ref: newRef("db", "username"), wantErr: "key username not found in secret db"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateSecretKeyRefs(ctx, controller.Client, "test", []corev1.SecretKeySelector{tc.ref})
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tc.wantErr)
+				assert.ErrorIs(t, err, errInvalidSource)
+			}
+
+			// An optional key that is missing is not an error
+			tc.ref.Optional = ptr.To(true)
+			require.NoError(t, validateSecretKeyRefs(ctx, controller.Client, "test", []corev1.SecretKeySelector{tc.ref}))
+		})
+	}
+}
+
+func TestCredentialSetReconciler_Reconcile_SecretKeyRef(t *testing.T) {
+	ctx := context.Background()
+
+	cs := &porterv1.CredentialSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mycreds", Generation: 1, Finalizers: []string{porterv1.FinalizerName}},
+		Spec: porterv1.CredentialSetSpec{
+			SchemaVersion: "1.0.1",
+			Namespace:     "dev",
+			Name:          "mycreds",
+			Credentials: []porterv1.Credential{{
+				Name: "password",
+				Source: porterv1.CredentialSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "db"},
+					Key:                  "password",
+				}},
+			}},
+		},
+	}
+	controller := setupCredentialSetController(cs)
+	recorder := controller.Recorder.(*record.FakeRecorder)
+	key := client.ObjectKeyFromObject(cs)
+
+	result, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	assert.Zero(t, result.RequeueAfter, "the sources should be resolved again when the secret changes")
+	assert.Contains(t, <-recorder.Events, "InvalidCredentialSource")
+
+	require.NoError(t, controller.Get(ctx, key, cs))
+	cond := apimeta.FindStatusCondition(cs.Status.Conditions, string(porterv1.ConditionSourcesResolved))
+	require.NotNil(t, cond, "the missing secret should be reported")
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, "SourceNotFound", cond.Reason)
+	assert.Contains(t, cond.Message, "secret db not found")
+	var actions porterv1.AgentActionList
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace("test")))
+	assert.Empty(t, actions.Items, "the agent should not run until the secret exists")
+
+	// The condition is kept, and the event is not repeated, while the secret is missing
+	_, err = controller.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	require.NoError(t, controller.Get(ctx, key, cs))
+	assert.NotNil(t, apimeta.FindStatusCondition(cs.Status.Conditions, string(porterv1.ConditionSourcesResolved)))
+	assert.Empty(t, recorder.Events)
+
+	// Create the secret
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "db"},
+		Data:       map[string][]byte{"password": []byte("topsecret")},
+	}
+	require.NoError(t, controller.Create(ctx, secret))
+	assert.Equal(t, []reconcile.Request{{NamespacedName: key}}, controller.mapSecretToCredentialSets(ctx, secret),
+		"the credential set should be requested when the secret is created")
+	result, err = controller.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	assert.Zero(t, result.RequeueAfter)
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace("test")))
+	require.Len(t, actions.Items, 1, "the agent should run once the secret exists")
+	envName := porterv1.GetSecretKeyRefEnvName(*cs.Spec.Credentials[0].Source.SecretKeyRef)
+	assert.Contains(t, string(actions.Items[0].Spec.Files["credentials.yaml"]), "env: "+envName, "porter should read the credential from the environment")
+	assert.NotContains(t, string(actions.Items[0].Spec.Files["credentials.yaml"]), "topsecret", "the secret value should not be stored by porter")
+}
+
+func TestInstallationReconciler_createAgentAction_SecretKeyRef(t *testing.T) {
+	ref := corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "db"}, Key: "password"}
+	newCredentialSet := func(name string, porterName string, porterNamespace string) *porterv1.CredentialSet {
+		return &porterv1.CredentialSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: name},
+			Spec: porterv1.CredentialSetSpec{
+				Namespace: porterNamespace,
+				Name:      porterName,
+				Credentials: []porterv1.Credential{
+					{Name: "password", Source: porterv1.CredentialSource{SecretKeyRef: &ref}},
+					{Name: "token", Source: porterv1.CredentialSource{Secret: "token"}},
+				},
+			},
+		}
+	}
+	controller := setupInstallationController(
+		newCredentialSet("mycreds", "mycreds", "dev"),
+		newCredentialSet("shared", "shared", "dev"),
+		newCredentialSet("other-namespace", "mycreds", "prod"),
+	)
+
+	inst := &porterv1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns"},
+		Spec: porterv1.InstallationSpec{
+			Namespace:      "dev",
+			Name:           "mybuns",
+			CredentialSets: []string{"mycreds", "shared"},
+		},
+	}
+	action, err := controller.createAgentAction(context.Background(), logr.Discard(), inst)
+	require.NoError(t, err)
+	assert.Equal(t, []corev1.EnvVar{{
+		Name:      porterv1.GetSecretKeyRefEnvName(ref),
+		ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &ref},
+	}}, action.Spec.Env, "the secret key should be passed once to the agent")
+}
+
+func TestValidateConfigMapKeyRefs(t *testing.T) {
+	ctx := context.Background()
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "settings"},
+		Data:       map[string]string{"region": "eastus"},
+		BinaryData: map[string][]byte{"kubeconfig": []byte("apiVersion: v1")},
+	}
+	controller := setupParameterSetController(cm)
+	newRef := func(name string, key string) corev1.ConfigMapKeySelector {
+		return corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+	}
+
+	testcases := []struct {
+		name    string
+		ref     corev1.ConfigMapKeySelector
+		wantErr string
+	}{
+		{name: "key exists", ref: newRef("settings", "region")},
+		{name: "binary key exists", ref: newRef("settings", "kubeconfig")},
+		{name: "missing configmap", ref: newRef("missing", "region"), wantErr: "configmap missing not found"},
+		{name: "missing key", ref: newRef("settings", "zone"), wantErr: "key zone not found in configmap settings"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateConfigMapKeyRefs(ctx, controller.Client, "test", []corev1.ConfigMapKeySelector{tc.ref})
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tc.wantErr)
+				assert.ErrorIs(t, err, errInvalidSource)
+			}
+
+			// An optional key that is missing is not an error
+			tc.ref.Optional = ptr.To(true)
+			require.NoError(t, validateConfigMapKeyRefs(ctx, controller.Client, "test", []corev1.ConfigMapKeySelector{tc.ref}))
+		})
+	}
+}
+
+func TestParameterSetReconciler_Reconcile_ConfigMapSources(t *testing.T) {
+	ctx := context.Background()
+
+	regionRef := &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}, Key: "region"}
+	kubeconfigRef := &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}, Key: "kubeconfig"}
+	ps := &porterv1.ParameterSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "myparams", Generation: 1, Finalizers: []string{porterv1.FinalizerName}},
+		Spec: porterv1.ParameterSetSpec{
+			SchemaVersion: "1.0.1",
+			Namespace:     "dev",
+			Name:          "myparams",
+			Parameters: []porterv1.Parameter{
+				{Name: "region", Source: porterv1.ParameterSource{ConfigMapKeyRef: regionRef}},
+				{Name: "kubeconfig", Source: porterv1.ParameterSource{FileFromConfigMap: kubeconfigRef}},
+				{Name: "token", Source: porterv1.ParameterSource{Env: "TOKEN"}},
+			},
+		},
+	}
+	controller := setupParameterSetController(ps)
+	recorder := controller.Recorder.(*record.FakeRecorder)
+	key := client.ObjectKeyFromObject(ps)
+
+	result, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	assert.Zero(t, result.RequeueAfter, "the sources should be resolved again when the configmap changes")
+	assert.Contains(t, <-recorder.Events, "InvalidParameterSource")
+
+	require.NoError(t, controller.Get(ctx, key, ps))
+	cond := apimeta.FindStatusCondition(ps.Status.Conditions, string(porterv1.ConditionSourcesResolved))
+	require.NotNil(t, cond, "the missing configmap should be reported")
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Contains(t, cond.Message, "configmap settings not found")
+	var actions porterv1.AgentActionList
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace("test")))
+	assert.Empty(t, actions.Items, "the agent should not run until the configmap exists")
+
+	// Create the configmap
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "settings"},
+		Data:       map[string]string{"region": "eastus", "kubeconfig": "apiVersion: v1"},
+	}
+	require.NoError(t, controller.Create(ctx, cm))
+	assert.Equal(t, []reconcile.Request{{NamespacedName: key}}, controller.mapConfigMapToParameterSets(ctx, cm),
+		"the parameter set should be requested when the configmap is created")
+	other := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "settings"}}
+	assert.Empty(t, controller.mapConfigMapToParameterSets(ctx, other), "a configmap in another namespace is not used by the parameter set")
+	result, err = controller.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	require.NoError(t, err)
+	assert.Zero(t, result.RequeueAfter)
+	require.NoError(t, controller.List(ctx, &actions, client.InNamespace("test")))
+	require.Len(t, actions.Items, 1, "the agent should run once the configmap exists")
+	doc := string(actions.Items[0].Spec.Files["parameters.yaml"])
+	assert.Contains(t, doc, "env: "+porterv1.GetConfigMapKeyRefEnvName(*regionRef), "porter should read the value from the environment")
+	assert.Contains(t, doc, "path: "+porterv1.GetFileFromConfigMapPath(*kubeconfigRef), "porter should read the file mounted by the operator")
+	assert.Contains(t, doc, "env: TOKEN")
+}
+
+func TestInstallationReconciler_createAgentAction_ParameterSources(t *testing.T) {
+	newRef := func(name string, key string) *corev1.ConfigMapKeySelector {
+		return &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+	}
+	controller := setupInstallationController(
+		&porterv1.ParameterSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "myparams"},
+			Spec: porterv1.ParameterSetSpec{
+				Namespace: "dev",
+				Name:      "myparams",
+				Parameters: []porterv1.Parameter{
+					{Name: "region", Source: porterv1.ParameterSource{ConfigMapKeyRef: newRef("settings", "region")}},
+					{Name: "kubeconfig", Source: porterv1.ParameterSource{FileFromConfigMap: newRef("settings", "kubeconfig")}},
+					{Name: "values", Source: porterv1.ParameterSource{FileFromConfigMap: newRef("settings", "values.yaml")}},
+					{Name: "logo", Source: porterv1.ParameterSource{FileFromConfigMap: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "assets"},
+						Key:                  "logo.png",
+						Optional:             ptr.To(true),
+					}}},
+					{Name: "token", Source: porterv1.ParameterSource{Env: "TOKEN"}},
+				},
+			},
+		},
+		&porterv1.ParameterSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "unused"},
+			Spec: porterv1.ParameterSetSpec{
+				Namespace:  "dev",
+				Name:       "unused",
+				Parameters: []porterv1.Parameter{{Name: "zone", Source: porterv1.ParameterSource{ConfigMapKeyRef: newRef("settings", "zone")}}},
+			},
+		},
+	)
+
+	inst := &porterv1.Installation{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "mybuns"},
+		Spec: porterv1.InstallationSpec{
+			Namespace:     "dev",
+			Name:          "mybuns",
+			ParameterSets: []string{"myparams"},
+		},
+	}
+	action, err := controller.createAgentAction(context.Background(), logr.Discard(), inst)
+	require.NoError(t, err)
+
+	assert.Equal(t, []corev1.EnvVar{{
+		Name:      porterv1.GetConfigMapKeyRefEnvName(*newRef("settings", "region")),
+		ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: newRef("settings", "region")},
+	}}, action.Spec.Env, "only the values of the parameter sets used by the installation should be passed to the agent")
+
+	require.Len(t, action.Spec.Volumes, 2, "the files of each configmap should be mounted with a volume")
+	assets := action.Spec.Volumes[0]
+	assert.Equal(t, getSourceVolumeName("assets"), assets.Name)
+	assert.Equal(t, []corev1.KeyToPath{{Key: "logo.png", Path: "logo.png"}}, assets.ConfigMap.Items)
+	assert.True(t, *assets.ConfigMap.Optional, "a volume with only optional keys should be optional")
+	settings := action.Spec.Volumes[1]
+	assert.Equal(t, "settings", settings.ConfigMap.Name)
+	assert.Equal(t, []corev1.KeyToPath{{Key: "kubeconfig", Path: "kubeconfig"}, {Key: "values.yaml", Path: "values.yaml"}}, settings.ConfigMap.Items)
+	assert.False(t, *settings.ConfigMap.Optional)
+
+	assert.Equal(t, []corev1.VolumeMount{
+		{Name: assets.Name, MountPath: porterv1.GetConfigMapSourcePath("assets"), ReadOnly: true},
+		{Name: settings.Name, MountPath: porterv1.GetConfigMapSourcePath("settings"), ReadOnly: true},
+	}, action.Spec.VolumeMounts)
+	assert.Equal(t, "/porter-sources/configmaps/settings/kubeconfig", porterv1.GetFileFromConfigMapPath(*newRef("settings", "kubeconfig")))
+}
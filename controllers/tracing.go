@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"context"
+	"flag"
+	"strings"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// tracerName is the name of the tracer used to instrument the operator.
+	tracerName = "get.porter.sh/operator"
+
+	// traceServiceName is the service name reported in traces emitted by the operator.
+	traceServiceName = "porter-operator"
+
+	// traceAnnotationPrefix is the prefix of the annotations used to propagate the trace context on an AgentAction.
+	traceAnnotationPrefix = porterv1.Prefix + "trace-"
+)
+
+// TracingOptions configures how the operator exports traces.
+type TracingOptions struct {
+	// Endpoint of the OTLP gRPC collector. Tracing is disabled when empty.
+	Endpoint string
+
+	// Insecure disables TLS when connecting to the collector.
+	Insecure bool
+
+	// SampleRatio is the fraction of new traces that are sampled.
+	SampleRatio float64
+}
+
+// BindFlags registers flags for the tracing options.
+func (o *TracingOptions) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Endpoint, "otel-exporter-otlp-endpoint", "", "The host:port of an OTLP gRPC collector to send traces to. Tracing is disabled when empty.")
+	fs.BoolVar(&o.Insecure, "otel-exporter-otlp-insecure", false, "Connect to the OTLP collector without TLS.")
+	fs.Float64Var(&o.SampleRatio, "otel-sample-ratio", 1, "The fraction of new traces to sample, between 0 and 1. Traces started by another service follow the parent's sampling decision.")
+}
+
+// SetupTracing configures OpenTelemetry to export the spans emitted by the operator.
+// The returned function flushes any remaining spans and must be called before the operator exits.
+func SetupTracing(ctx context.Context, opts TracingOptions) (func(context.Context) error, error) {
+	// Always propagate the trace context so that it is passed along even when the operator does not export spans
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporterOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating the OTLP trace exporter for %s", opts.Endpoint)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(traceServiceName)))
+	if err != nil {
+		return nil, errors.Wrap(err, "error defining the trace resource")
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// startSpan starts a span using the operator's tracer.
+func startSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// startReconcileSpan starts the span that covers the reconciliation of a resource.
+func startReconcileSpan(ctx context.Context, kind string, req ctrl.Request) (context.Context, trace.Span) {
+	return startSpan(ctx, kind+".Reconcile", trace.WithAttributes(
+		attribute.String("k8s.resource.kind", kind),
+		attribute.String("k8s.resource.name", req.Name),
+		semconv.K8SNamespaceName(req.Namespace)))
+}
+
+// endSpan records the error, if any, on the span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// annotationCarrier stores the trace context in the annotations of a resource.
+type annotationCarrier map[string]string
+
+var _ propagation.TextMapCarrier = annotationCarrier{}
+
+// Get implements propagation.TextMapCarrier.
+func (c annotationCarrier) Get(key string) string {
+	return c[traceAnnotationPrefix+key]
+}
+
+// Set implements propagation.TextMapCarrier.
+func (c annotationCarrier) Set(key string, value string) {
+	c[traceAnnotationPrefix+key] = value
+}
+
+// Keys implements propagation.TextMapCarrier.
+func (c annotationCarrier) Keys() []string {
+	var keys []string
+	for k := range c {
+		if strings.HasPrefix(k, traceAnnotationPrefix) {
+			keys = append(keys, strings.TrimPrefix(k, traceAnnotationPrefix))
+		}
+	}
+	return keys
+}
+
+// injectTraceAnnotations returns a copy of the annotations that includes the trace context from ctx.
+func injectTraceAnnotations(ctx context.Context, annotations map[string]string) map[string]string {
+	carrier := make(annotationCarrier, len(annotations)+2)
+	for k, v := range annotations {
+		// Do not copy a trace context from the source resource
+		if !strings.HasPrefix(k, traceAnnotationPrefix) {
+			carrier[k] = v
+		}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier
+}
+
+// extractTraceAnnotations returns a context that continues the trace stored in the annotations.
+func extractTraceAnnotations(ctx context.Context, annotations map[string]string) context.Context {
+	if len(annotations) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, annotationCarrier(annotations))
+}
+
+// envCarrier stores the trace context in environment variables, using the
+// TRACEPARENT and TRACESTATE names understood by OpenTelemetry instrumented tools.
+type envCarrier map[string]string
+
+var _ propagation.TextMapCarrier = envCarrier{}
+
+// Get implements propagation.TextMapCarrier.
+func (c envCarrier) Get(key string) string {
+	return c[strings.ToUpper(key)]
+}
+
+// Set implements propagation.TextMapCarrier.
+func (c envCarrier) Set(key string, value string) {
+	c[strings.ToUpper(key)] = value
+}
+
+// Keys implements propagation.TextMapCarrier.
+func (c envCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, strings.ToLower(k))
+	}
+	return keys
+}
+
+// getTraceEnv returns the environment variables that pass the trace context from ctx to the porter agent.
+func getTraceEnv(ctx context.Context) []corev1.EnvVar {
+	carrier := envCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+
+	var env []corev1.EnvVar
+	for _, name := range []string{"TRACEPARENT", "TRACESTATE"} {
+		if value, ok := carrier[name]; ok && value != "" {
+			env = append(env, corev1.EnvVar{Name: name, Value: value})
+		}
+	}
+	return env
+}
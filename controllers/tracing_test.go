@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	porterv1 "get.porter.sh/operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// withTestSpan returns a context with a sampled remote span, so that the trace context can be propagated
+// without configuring a tracer provider.
+func withTestSpan(t *testing.T) (context.Context, trace.SpanContext) {
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	return trace.ContextWithSpanContext(context.Background(), sc), sc
+}
+
+func TestTraceAnnotations(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	ctx, sc := withTestSpan(t)
+
+	orig := map[string]string{
+		"favorite-color":                      "blue",
+		traceAnnotationPrefix + "traceparent": "00-11111111111111111111111111111111-2222222222222222-01",
+	}
+	annotations := injectTraceAnnotations(ctx, orig)
+
+	assert.Equal(t, "blue", annotations["favorite-color"], "existing annotations should be copied")
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", annotations[porterv1.Prefix+"trace-traceparent"],
+		"the trace context of the source resource should be replaced")
+	assert.Equal(t, "00-11111111111111111111111111111111-2222222222222222-01", orig[traceAnnotationPrefix+"traceparent"],
+		"the source annotations should not be modified")
+
+	extracted := trace.SpanContextFromContext(extractTraceAnnotations(context.Background(), annotations))
+	assert.Equal(t, sc.TraceID(), extracted.TraceID())
+	assert.Equal(t, sc.SpanID(), extracted.SpanID())
+	assert.True(t, extracted.IsSampled())
+}
+
+func TestExtractTraceAnnotations_Missing(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	ctx := extractTraceAnnotations(context.Background(), map[string]string{"favorite-color": "blue"})
+	assert.False(t, trace.SpanContextFromContext(ctx).IsValid())
+}
+
+func TestGetTraceEnv(t *testing.T) {
+	t.Run("with span", func(t *testing.T) {
+		ctx, _ := withTestSpan(t)
+
+		env := getTraceEnv(ctx)
+		require.Len(t, env, 1)
+		assert.Equal(t, "TRACEPARENT", env[0].Name)
+		assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", env[0].Value)
+	})
+
+	t.Run("without span", func(t *testing.T) {
+		assert.Empty(t, getTraceEnv(context.Background()))
+	})
+}
@@ -11,3 +11,15 @@ type PorterClient interface {
 	ListInstallations(ctx context.Context, in *installationv1.ListInstallationsRequest, opts ...grpc.CallOption) (*installationv1.ListInstallationsResponse, error)
 	ListInstallationLatestOutputs(ctx context.Context, in *installationv1.ListInstallationLatestOutputRequest, opts ...grpc.CallOption) (*installationv1.ListInstallationLatestOutputResponse, error)
 }
+
+// ConnectionChecker reports whether the connection to the Porter gRPC server is usable.
+type ConnectionChecker interface {
+	// CheckConnection returns an error describing why the connection is not usable.
+	CheckConnection() error
+}
+
+// PodLogReader reads the logs of the pods that run the Porter Agent.
+type PodLogReader interface {
+	// GetJobLogs returns the logs of the container of the most recent pod of a job.
+	GetJobLogs(ctx context.Context, namespace string, job string, container string) ([]byte, error)
+}
@@ -61,6 +61,7 @@ removeData() {
   # Look for any stray data that wasn't in a porter managed namespace, or were missing labels
   kubectl delete jobs,pods,secrets,pvc,pv --all-namespaces $filter --wait
   kubectl delete installations.getporter.org,agentconfigs.getporter.org,porterconfigs.getporter.org --all-namespaces --wait
+  kubectl delete clusteragentconfigs.getporter.org,clusterporterconfigs.getporter.org --all --wait
 }
 
 # Call the requested function and pass the arguments as-is
@@ -4,11 +4,10 @@ import (
 	"context"
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"k8s.io/apimachinery/pkg/runtime"
@@ -21,7 +20,6 @@ import (
 
 	v1 "get.porter.sh/operator/api/v1"
 	"get.porter.sh/operator/controllers"
-	porterv1alpha1 "get.porter.sh/porter/gen/proto/go/porterapis/porter/v1alpha1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -45,6 +43,14 @@ func main() {
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	var grpcOpts controllers.PorterGRPCOptions
+	grpcOpts.BindFlags(flag.CommandLine)
+	var tracingOpts controllers.TracingOptions
+	tracingOpts.BindFlags(flag.CommandLine)
+	var sweeperOpts controllers.AgentResourceSweeperOptions
+	sweeperOpts.BindFlags(flag.CommandLine)
+	var pluginSweeperOpts controllers.PluginVolumeSweeperOptions
+	pluginSweeperOpts.BindFlags(flag.CommandLine)
 	opts := zap.Options{
 		Development: true,
 	}
@@ -53,6 +59,12 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	shutdownTracing, err := controllers.SetupTracing(context.Background(), tracingOpts)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
 		Metrics: server.Options{
@@ -66,19 +78,32 @@ func main() {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
-	// NOTE: Pass in nil client if connection isn't established
+	// NOTE: Pass in nil client when the connection is disabled
 	var client controllers.PorterClient
-	conn, err := grpc.DialContext(context.Background(), "porter-grpc-service:3001", grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		setupLog.Error(err, "unable to set up listener")
-	}
-	defer conn.Close()
-	if conn != nil {
-		client = porterv1alpha1.NewPorterClient(conn)
+	var grpcStatus controllers.ConnectionChecker
+	if grpcOpts.Address != "" {
+		conn, err := controllers.NewPorterGRPCConnection(ctrl.Log.WithName("porter-grpc"), grpcOpts)
+		if err != nil {
+			setupLog.Error(err, "unable to configure the porter grpc connection")
+			os.Exit(1)
+		}
+		if err = mgr.Add(conn); err != nil {
+			setupLog.Error(err, "unable to set up the porter grpc connection")
+			os.Exit(1)
+		}
+		if grpcOpts.ReadinessCheck {
+			if err = mgr.AddReadyzCheck("porter-grpc", conn.ReadyzCheck); err != nil {
+				setupLog.Error(err, "unable to set up porter grpc ready check")
+				os.Exit(1)
+			}
+		}
+		client = conn.Client()
+		grpcStatus = conn
 	}
 	if err = (&controllers.InstallationReconciler{
 		Client:           mgr.GetClient(),
 		PorterGRPCClient: client,
+		PorterGRPCStatus: grpcStatus,
 		Recorder:         mgr.GetEventRecorderFor("installation"),
 		Log:              ctrl.Log.WithName("controllers").WithName("Installation"),
 		Scheme:           mgr.GetScheme(),
@@ -87,39 +112,68 @@ func main() {
 		os.Exit(1)
 	}
 	if err = (&controllers.AgentActionReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("AgentAction"),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Recorder: mgr.GetEventRecorderFor("agentaction"),
+		Log:      ctrl.Log.WithName("controllers").WithName("AgentAction"),
+		Scheme:   mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AgentAction")
 		os.Exit(1)
 	}
 	if err = (&controllers.CredentialSetReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("CredentialSet"),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Recorder: mgr.GetEventRecorderFor("credentialset"),
+		Log:      ctrl.Log.WithName("controllers").WithName("CredentialSet"),
+		Scheme:   mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CredentialSet")
 		os.Exit(1)
 	}
 	if err = (&controllers.ParameterSetReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("ParameterSet"),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Recorder: mgr.GetEventRecorderFor("parameterset"),
+		Log:      ctrl.Log.WithName("controllers").WithName("ParameterSet"),
+		Scheme:   mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ParameterSet")
 		os.Exit(1)
 	}
+	podLogs, err := controllers.NewPodLogReader(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to set up the pod log reader")
+		os.Exit(1)
+	}
 	if err = (&controllers.AgentConfigReconciler{
+		Client:   mgr.GetClient(),
+		Recorder: mgr.GetEventRecorderFor("agentconfig"),
+		Log:      ctrl.Log.WithName("controllers").WithName("AgentConfig"),
+		Scheme:   mgr.GetScheme(),
+
+		PluginVolumeSweeper: pluginSweeperOpts,
+		PodLogs:             podLogs,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "AgentConfig")
+		os.Exit(1)
+	}
+	if err = (&controllers.EffectiveConfigReconciler{
 		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("AgentConfig"),
+		Log:    ctrl.Log.WithName("controllers").WithName("EffectiveConfig"),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "AgentConfig")
+		setupLog.Error(err, "unable to create controller", "controller", "EffectiveConfig")
 		os.Exit(1)
 	}
 	// +kubebuilder:scaffold:builder
 
+	if err = mgr.Add(&controllers.AgentResourceSweeper{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("sweeper").WithName("AgentResources"),
+		Opts:   sweeperOpts,
+	}); err != nil {
+		setupLog.Error(err, "unable to set up the agent resource sweeper")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("health", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -130,7 +184,16 @@ func main() {
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	err = mgr.Start(ctrl.SetupSignalHandler())
+
+	// Send any spans that have not been exported yet
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if shutdownErr := shutdownTracing(ctx); shutdownErr != nil {
+		setupLog.Error(shutdownErr, "unable to flush traces")
+	}
+	cancel()
+
+	if err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
@@ -78,30 +78,34 @@ var _ = BeforeSuite(func(done Done) {
 	Expect(err).ToNot(HaveOccurred())
 
 	err = (&controllers.CredentialSetReconciler{
-		Client: k8sManager.GetClient(),
-		Scheme: scheme.Scheme,
-		Log:    ctrl.Log.WithName("controllers").WithName("CredentialSet"),
+		Client:   k8sManager.GetClient(),
+		Scheme:   scheme.Scheme,
+		Recorder: k8sManager.GetEventRecorderFor("credentialset"),
+		Log:      ctrl.Log.WithName("controllers").WithName("CredentialSet"),
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
 	err = (&controllers.ParameterSetReconciler{
-		Client: k8sManager.GetClient(),
-		Scheme: scheme.Scheme,
-		Log:    ctrl.Log.WithName("controllers").WithName("ParameterSet"),
+		Client:   k8sManager.GetClient(),
+		Scheme:   scheme.Scheme,
+		Recorder: k8sManager.GetEventRecorderFor("parameterset"),
+		Log:      ctrl.Log.WithName("controllers").WithName("ParameterSet"),
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
 	err = (&controllers.AgentActionReconciler{
-		Client: k8sManager.GetClient(),
-		Scheme: scheme.Scheme,
-		Log:    ctrl.Log.WithName("controllers").WithName("AgentAction"),
+		Client:   k8sManager.GetClient(),
+		Scheme:   scheme.Scheme,
+		Recorder: k8sManager.GetEventRecorderFor("agentaction"),
+		Log:      ctrl.Log.WithName("controllers").WithName("AgentAction"),
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
 	err = (&controllers.AgentConfigReconciler{
-		Client: k8sManager.GetClient(),
-		Scheme: scheme.Scheme,
-		Log:    ctrl.Log.WithName("controllers").WithName("AgentConfig"),
+		Client:   k8sManager.GetClient(),
+		Scheme:   scheme.Scheme,
+		Recorder: k8sManager.GetEventRecorderFor("agentconfig"),
+		Log:      ctrl.Log.WithName("controllers").WithName("AgentConfig"),
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 